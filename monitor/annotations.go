@@ -0,0 +1,192 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// デバイスに付けた所有者とメモ
+type Annotation struct {
+	Owner   string    `json:"owner,omitempty"`
+	Note    string    `json:"note,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// デバイスのフィンガープリントごとの所有者とメモ（アノテーションファイルに保存する）
+type Annotations map[string]Annotation
+
+// 監視で使用するアノテーション（実行中に再読み込みされるため、currentAnnotationsで取得する）
+var (
+	annotationsMu      sync.RWMutex
+	runningAnnotations Annotations
+)
+
+// 現在のアノテーションを取得
+func currentAnnotations() Annotations {
+	annotationsMu.RLock()
+	defer annotationsMu.RUnlock()
+	return runningAnnotations
+}
+
+// アノテーションを置き換える
+func setAnnotations(a Annotations) {
+	annotationsMu.Lock()
+	defer annotationsMu.Unlock()
+	runningAnnotations = a
+}
+
+// アノテーションファイルのパス（設定で指定しない場合は %ProgramData%\usbmon\annotations.json）
+func annotationsPath(cfg Config) string {
+	if cfg.AnnotationsFile != "" {
+		return cfg.AnnotationsFile
+	}
+	return filepath.Join(os.Getenv("ProgramData"), "usbmon", "annotations.json")
+}
+
+// アノテーションファイルを読み込む（ファイルがない場合は空）
+func loadAnnotations(path string) (Annotations, error) {
+	a := Annotations{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return a, fmt.Errorf("Failed to read annotations: %w", err)
+	}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return a, fmt.Errorf("Failed to parse annotations %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// アノテーションファイルに保存
+func saveAnnotations(path string, a Annotations) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create annotations directory: %w", err)
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write annotations: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Failed to write annotations: %w", err)
+	}
+	return nil
+}
+
+// デバイスのフィンガープリント（VID:PID:シリアル番号、シリアル番号を持たないデバイスはインスタンスID）
+// 同じデバイスはどのポートに接続しても同じになる
+func deviceFingerprint(instanceID string) string {
+	vid, pid := parseVIDPID(instanceID)
+	serial := deviceSerial(instanceID)
+	if vid == "" || serial == "" {
+		return strings.ToUpper(instanceID)
+	}
+	return strings.ToUpper(vid + ":" + pid + ":" + serial)
+}
+
+// イベントにフィンガープリントと、デバイスに付けた所有者とメモを設定
+func annotateEvent(event *DeviceEvent) {
+	event.Fingerprint = deviceFingerprint(event.Device.InstanceID)
+	if annotation, ok := currentAnnotations()[event.Fingerprint]; ok {
+		event.Owner = annotation.Owner
+		event.Note = annotation.Note
+	}
+}
+
+// `usbmon device` サブコマンド
+// デバイスに所有者とメモを付け、実行中の監視に再読み込みさせる
+func runDevice(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(`usage: usbmon device annotate <fingerprint> [-owner "Tanaka"] [-note "backup drive"] | usbmon device list`)
+		return 2
+	}
+	fs := flag.NewFlagSet("device "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find annotations_file)")
+	owner := fs.String("owner", "", "owner of the device")
+	note := fs.String("note", "", "free-text note about the device")
+	fs.Parse(args[1:])
+	// フィンガープリントの後に指定したフラグも読み取る
+	var positional []string
+	for fs.NArg() > 0 {
+		positional = append(positional, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	path := annotationsPath(cfg)
+	a, err := loadAnnotations(path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		printAnnotations(a)
+		return 0
+	case "annotate":
+		if len(positional) != 1 {
+			fmt.Println("specify one device fingerprint (VID:PID:SERIAL or instance ID, shown as Fingerprint in events)")
+			return 2
+		}
+		fingerprint := strings.ToUpper(positional[0])
+		// 所有者とメモを両方空にした場合はアノテーションを削除
+		if *owner == "" && *note == "" {
+			delete(a, fingerprint)
+		} else {
+			a[fingerprint] = Annotation{Owner: *owner, Note: *note, Updated: time.Now()}
+		}
+	default:
+		fmt.Printf("unknown device command %q\n", args[0])
+		return 2
+	}
+
+	if err := saveAnnotations(path, a); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	printAnnotations(a)
+	// 実行中の監視があれば、新しいアノテーションを読み込ませる
+	if response, err := sendControlCommand("reload"); err != nil {
+		fmt.Printf("Annotations saved to %s (%v)\n", path, err)
+	} else if response != "OK" {
+		fmt.Printf("Annotations saved to %s, but the running monitor failed to reload: %s\n", path, response)
+		return 1
+	}
+	return 0
+}
+
+// アノテーションの一覧を出力
+func printAnnotations(a Annotations) {
+	if len(a) == 0 {
+		fmt.Println("No device annotations")
+		return
+	}
+	fingerprints := make([]string, 0, len(a))
+	for fingerprint := range a {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Strings(fingerprints)
+	fmt.Printf("%-40s  %-16s  %-10s  %s\n", "FINGERPRINT", "OWNER", "UPDATED", "NOTE")
+	for _, fingerprint := range fingerprints {
+		annotation := a[fingerprint]
+		fmt.Printf("%-40s  %-16s  %-10s  %s\n", fingerprint, annotation.Owner, annotation.Updated.Format("2006-01-02"), annotation.Note)
+	}
+}
@@ -0,0 +1,170 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 異常検知の既定値
+const (
+	// 基準を学習するまでに観測する接続の数
+	defaultAnomalyLearningEvents = 50
+	// この割合より接続が少ない時間帯の接続を異常とする
+	defaultAnomalyHourRatio = 0.01
+	// 短時間に接続された異なるデバイスの数の上限
+	defaultAnomalyBurstDevices = 5
+	// 異なるデバイスの数を数える期間
+	defaultAnomalyBurstWindow = 10 * time.Minute
+)
+
+// 異常検知の設定
+type AnomalyConfig struct {
+	// 異常検知を有効にするかどうか
+	Enabled bool `json:"enabled"`
+	// 基準を保存するファイル（空の場合は %ProgramData%\usbmon\baseline.json）
+	BaselineFile string `json:"baseline_file"`
+	// 基準を学習するまでに観測する接続の数（それまでは異常としない）
+	LearningEvents int `json:"learning_events"`
+	// この割合より接続が少ない時間帯の接続を異常とする（例: 0.01）
+	HourRatio float64 `json:"hour_ratio"`
+	// burst_windowの間に接続された異なるデバイスの数の上限
+	BurstDevices int `json:"burst_devices"`
+	// 異なるデバイスの数を数える期間（例: "10m"）
+	BurstWindow Duration `json:"burst_window"`
+}
+
+// このホストでの通常の接続の傾向
+type Baseline struct {
+	// 観測した接続の数
+	Arrivals int `json:"arrivals"`
+	// デバイスの種類ごとの接続の数
+	DeviceTypes map[string]int `json:"device_types"`
+	// 時間帯（0〜23時）ごとの接続の数
+	Hours [24]int `json:"hours"`
+}
+
+// 接続の傾向を学習し、通常と異なる接続を検出する
+type AnomalyDetector struct {
+	mu       sync.Mutex
+	baseline Baseline
+	// 基準を読み込んだファイル（別のファイルが設定された場合は読み込み直す）
+	path string
+	// 最近接続されたデバイスのフィンガープリントと接続日時
+	recent map[string]time.Time
+}
+
+var anomalyDetector = &AnomalyDetector{recent: map[string]time.Time{}}
+
+// 基準のファイルのパス
+func baselinePath(cfg AnomalyConfig) string {
+	if cfg.BaselineFile != "" {
+		return cfg.BaselineFile
+	}
+	return filepath.Join(os.Getenv("ProgramData"), "usbmon", "baseline.json")
+}
+
+// 基準をファイルから読み込む（ファイルがない場合は空）
+func loadBaseline(path string) (Baseline, error) {
+	baseline := Baseline{DeviceTypes: map[string]int{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return baseline, nil
+	}
+	if err != nil {
+		return baseline, fmt.Errorf("Failed to read baseline: %w", err)
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return baseline, fmt.Errorf("Failed to parse baseline %s: %w", path, err)
+	}
+	if baseline.DeviceTypes == nil {
+		baseline.DeviceTypes = map[string]int{}
+	}
+	return baseline, nil
+}
+
+// 接続イベントを基準と比べ、異常があれば理由を返す。その後、接続を基準に加える
+func (d *AnomalyDetector) observe(cfg AnomalyConfig, event DeviceEvent, t time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path := baselinePath(cfg)
+	if d.path != path {
+		baseline, err := loadBaseline(path)
+		if err != nil {
+			fmt.Println(err)
+		}
+		d.baseline, d.path = baseline, path
+	}
+
+	learningEvents := cfg.LearningEvents
+	if learningEvents <= 0 {
+		learningEvents = defaultAnomalyLearningEvents
+	}
+	hourRatio := cfg.HourRatio
+	if hourRatio <= 0 {
+		hourRatio = defaultAnomalyHourRatio
+	}
+	burstDevices := cfg.BurstDevices
+	if burstDevices <= 0 {
+		burstDevices = defaultAnomalyBurstDevices
+	}
+	burstWindow := time.Duration(cfg.BurstWindow)
+	if burstWindow <= 0 {
+		burstWindow = defaultAnomalyBurstWindow
+	}
+
+	var reasons []string
+	b := &d.baseline
+	if b.Arrivals >= learningEvents {
+		if b.DeviceTypes[event.DeviceType] == 0 {
+			reasons = append(reasons, fmt.Sprintf("device type %s has never been seen on this host", event.DeviceType))
+		}
+		if n := b.Hours[t.Hour()]; float64(n) < float64(b.Arrivals)*hourRatio {
+			reasons = append(reasons, fmt.Sprintf("activity at %02d:00 is unusual (%d of %d past arrivals)", t.Hour(), n, b.Arrivals))
+		}
+	}
+	// 短時間に多くの異なるデバイスが接続された（学習期間中も検出）
+	d.recent[event.Fingerprint] = t
+	for fingerprint, seen := range d.recent {
+		if t.Sub(seen) > burstWindow {
+			delete(d.recent, fingerprint)
+		}
+	}
+	if len(d.recent) > burstDevices {
+		reasons = append(reasons, fmt.Sprintf("%d distinct devices within %s", len(d.recent), burstWindow))
+	}
+
+	b.Arrivals++
+	b.DeviceTypes[event.DeviceType]++
+	b.Hours[t.Hour()]++
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err == nil {
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write baseline: %v\n", err)
+	}
+	return reasons
+}
+
+// 接続イベントに異常があれば、理由を付けたAnomalyイベントを出力
+func detectAnomaly(event DeviceEvent) {
+	cfg := currentConfig().Anomaly
+	if !cfg.Enabled {
+		return
+	}
+	reasons := anomalyDetector.observe(cfg, event, time.Now())
+	if len(reasons) == 0 {
+		return
+	}
+	event.Action = "Anomaly"
+	event.Severity = severityWarning
+	event.Explanation = strings.Join(reasons, "; ")
+	logDeviceEvent(event)
+}
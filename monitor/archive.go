@@ -0,0 +1,227 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 月ごとのアーカイブのファイル名の末尾（例: audit.jsonl.2026-09.jsonl.gz）
+const auditArchiveSuffix = ".jsonl.gz"
+
+// 月ごとのアーカイブのパス（月は記録したUTCの日時で決める）
+func auditArchivePath(path string, t time.Time) string {
+	return path + "." + t.UTC().Format("2006-01") + auditArchiveSuffix
+}
+
+// 監査ログのアーカイブのパス（古い月の順）
+func auditArchives(path string) ([]string, error) {
+	archives, err := filepath.Glob(escapeGlob(path) + ".*" + auditArchiveSuffix)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(archives)
+	return archives, nil
+}
+
+// パスに含まれるGlobの特殊文字をエスケープ
+func escapeGlob(path string) string {
+	return strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]").Replace(path)
+}
+
+// archive_afterより古いレコードを月ごとのgzip圧縮したJSONLのアーカイブに移し、監査ログから除く
+// アーカイブしたレコードは番号とハッシュを保つため、アーカイブと監査ログをつなげたチェーンも検証できる
+func (l *AuditLog) archive(cfg Config) (int, error) {
+	after := time.Duration(cfg.ArchiveAfter)
+	if l == nil || after <= 0 {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, err := readAuditLog(l.path)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-after)
+	n := 0
+	for n < len(records) && records[n].Time.Before(cutoff) {
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	// アーカイブに追記してから監査ログから除く（途中で失敗してもレコードは失われず、重複は読み込み時に除く）
+	for start := 0; start < n; {
+		path := auditArchivePath(l.path, records[start].Time)
+		end := start + 1
+		for end < n && auditArchivePath(l.path, records[end].Time) == path {
+			end++
+		}
+		if err := appendAuditArchive(path, records[start:end]); err != nil {
+			return 0, fmt.Errorf("Failed to archive audit log: %w", err)
+		}
+		start = end
+	}
+	if err := l.dropLocked(records, n); err != nil {
+		return 0, fmt.Errorf("Failed to archive audit log: %w", err)
+	}
+	return n, nil
+}
+
+// アーカイブにgzipのメンバーとしてレコードを追記（gzipは複数のメンバーを続けて読める）
+func appendAuditArchive(path string, records []AuditRecord) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(file)
+	encoder := json.NewEncoder(zw)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			zw.Close()
+			file.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// アーカイブのファイル名から月の初めの日時を読み取る
+// Globが返すパスは整えられている（例: ./audit.log → audit.log）ため、ファイル名どうしで比べる
+func auditArchiveMonth(path string, archive string) (time.Time, bool) {
+	name, ok := strings.CutPrefix(filepath.Base(archive), filepath.Base(path)+".")
+	if !ok {
+		return time.Time{}, false
+	}
+	start, err := time.Parse("2006-01", strings.TrimSuffix(name, auditArchiveSuffix))
+	return start, err == nil
+}
+
+// 保持期間（retention_max_age）より前に終わった月のアーカイブを削除
+func pruneAuditArchives(path string, cfg Config) (int, error) {
+	maxAge := time.Duration(cfg.RetentionMaxAge)
+	if maxAge <= 0 {
+		return 0, nil
+	}
+	archives, err := auditArchives(path)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, archive := range archives {
+		start, ok := auditArchiveMonth(path, archive)
+		if !ok || !start.AddDate(0, 1, 0).Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(archive); err != nil {
+			return removed, fmt.Errorf("Failed to remove audit archive: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// アーカイブと監査ログのレコードを、古い順にまとめて読み込む（export用）
+// アーカイブの途中で失敗して重複したレコードは、番号で除く
+func readAuditHistory(path string) ([]AuditRecord, error) {
+	archives, err := auditArchives(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []AuditRecord
+	for _, archive := range archives {
+		archived, err := readAuditArchive(archive)
+		if err != nil {
+			return nil, err
+		}
+		records = appendNewRecords(records, archived)
+	}
+	current, err := readAuditLog(path)
+	if err != nil && !(os.IsNotExist(err) && len(records) > 0) {
+		return nil, err
+	}
+	return appendNewRecords(records, current), nil
+}
+
+// アーカイブのレコードのチェーンを古い順に検証し、監査ログの .base のレコードと一致するかを確認（検証したレコードの数を返す）
+// 保持期間を過ぎて削除したアーカイブより前と、アーカイブせずに削除したレコード（retention_max_size_mb）の前後はたどれないため検証しない
+func verifyAuditArchives(path string) (int, error) {
+	archives, err := auditArchives(path)
+	if err != nil {
+		return 0, err
+	}
+	var records []AuditRecord
+	for _, archive := range archives {
+		archived, err := readAuditArchive(archive)
+		if err != nil {
+			return 0, err
+		}
+		// アーカイブの途中で失敗して同じレコードを再び追記した場合は、番号で除く
+		records = appendNewRecords(records, archived)
+	}
+	for i, record := range records {
+		if record.computeHash() != record.Hash {
+			return i, fmt.Errorf("archived record %d: hash does not match (record modified)", record.Seq)
+		}
+		if i == 0 {
+			continue
+		}
+		previous := records[i-1]
+		if record.Seq != previous.Seq+1 {
+			return i, fmt.Errorf("archived record %d: expected seq %d, found %d (records removed or reordered)", previous.Seq+1, previous.Seq+1, record.Seq)
+		}
+		if record.PrevHash != previous.Hash {
+			return i, fmt.Errorf("archived record %d: previous hash does not match (chain broken)", record.Seq)
+		}
+	}
+	// 監査ログから除いた最後のレコード（.base）がアーカイブにあれば、監査ログのチェーンにつながる
+	baseSeq, baseHash, err := readAuditMark(path + auditBaseSuffix)
+	if err != nil {
+		return len(records), err
+	}
+	for _, record := range records {
+		if record.Seq == baseSeq && record.Hash != baseHash {
+			return len(records), fmt.Errorf("archived record %d does not match the base of the log (chain broken)", record.Seq)
+		}
+	}
+	return len(records), nil
+}
+
+// gzip圧縮したアーカイブのレコードを読み込む
+func readAuditArchive(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read audit archive %s: %w", path, err)
+	}
+	defer zr.Close()
+	return readAuditRecords(zr, path)
+}
+
+// 既に読み込んだレコードより番号が大きいレコードだけを追加
+func appendNewRecords(records []AuditRecord, more []AuditRecord) []AuditRecord {
+	for _, record := range more {
+		if len(records) == 0 || record.Seq > records[len(records)-1].Seq {
+			records = append(records, record)
+		}
+	}
+	return records
+}
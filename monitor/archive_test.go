@@ -0,0 +1,226 @@
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuditArchivePath(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC), "audit.jsonl.2026-09.jsonl.gz"},
+		// 月はUTCの日時で決める
+		{time.Date(2026, 10, 1, 5, 0, 0, 0, tokyo), "audit.jsonl.2026-09.jsonl.gz"},
+		{time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC), "audit.jsonl.2026-12.jsonl.gz"},
+	}
+	for _, test := range tests {
+		if got := auditArchivePath("audit.jsonl", test.t); got != test.want {
+			t.Errorf("auditArchivePath(%s) = %s, want %s", test.t, got, test.want)
+		}
+	}
+}
+
+func TestAuditArchiveMonth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	tests := []struct {
+		path    string
+		archive string
+		want    time.Time
+		wantOK  bool
+	}{
+		{path, filepath.Join(dir, "audit.jsonl.2026-09.jsonl.gz"), time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), true},
+		// Globが整えたパス（./audit.jsonl → audit.jsonl）でも月を読み取れる
+		{"." + string(filepath.Separator) + "audit.jsonl", "audit.jsonl.2025-12.jsonl.gz", time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), true},
+		{path, filepath.Join(dir, "other.jsonl.2026-09.jsonl.gz"), time.Time{}, false},
+		{path, filepath.Join(dir, "audit.jsonl.2026-13.jsonl.gz"), time.Time{}, false},
+		{path, filepath.Join(dir, "audit.jsonl.backup.jsonl.gz"), time.Time{}, false},
+		{path, filepath.Join(dir, "audit.jsonl.2026-09.jsonl"), time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := auditArchiveMonth(test.path, test.archive)
+		if ok != test.wantOK || !got.Equal(test.want) {
+			t.Errorf("auditArchiveMonth(%s, %s) = %s, %v, want %s, %v", test.path, test.archive, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestAppendNewRecords(t *testing.T) {
+	chain := recentAuditRecords()
+	tests := []struct {
+		name    string
+		records []AuditRecord
+		more    []AuditRecord
+		want    int
+	}{
+		{name: "empty", more: chain, want: 5},
+		{name: "continued", records: chain[:2], more: chain[2:], want: 5},
+		// アーカイブの途中で失敗して、アーカイブと監査ログの両方に残ったレコード
+		{name: "overlapping", records: chain[:3], more: chain[1:], want: 5},
+		{name: "already read", records: chain, more: chain[:2], want: 5},
+	}
+	for _, test := range tests {
+		got := appendNewRecords(append([]AuditRecord{}, test.records...), test.more)
+		if len(got) != test.want {
+			t.Errorf("%s: appendNewRecords() = %d records, want %d", test.name, len(got), test.want)
+			continue
+		}
+		for i, record := range got {
+			if record.Seq != uint64(i+1) {
+				t.Errorf("%s: record %d has seq %d", test.name, i, record.Seq)
+			}
+		}
+	}
+}
+
+func TestAuditLogArchive(t *testing.T) {
+	now := time.Now().UTC()
+	old := time.Date(now.Year(), now.Month(), 1, 12, 0, 0, 0, time.UTC).AddDate(0, -3, 0)
+	chain := testAuditRecords(
+		old, old.Add(time.Hour),
+		old.AddDate(0, 1, 0),
+		now.Add(-2*time.Second), now.Add(-time.Second),
+	)
+	tests := []struct {
+		name         string
+		archiveAfter time.Duration
+		want         int
+		wantArchives int
+	}{
+		{name: "disabled", want: 0, wantArchives: 0},
+		{name: "nothing old enough", archiveAfter: 365 * 24 * time.Hour, want: 0, wantArchives: 0},
+		{name: "old months", archiveAfter: 30 * 24 * time.Hour, want: 3, wantArchives: 2},
+		{name: "everything", archiveAfter: time.Nanosecond, want: 5, wantArchives: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, chain, nil, chain[len(chain)-1])
+			l := openTestAuditLog(t, path)
+
+			n, err := l.archive(Config{ArchiveAfter: Duration(test.archiveAfter)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != test.want {
+				t.Errorf("archive() = %d, want %d", n, test.want)
+			}
+			archives, err := auditArchives(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archives) != test.wantArchives {
+				t.Errorf("archives = %v, want %d", archives, test.wantArchives)
+			}
+			// 監査ログに残ったレコードのチェーンは .base から検証できる
+			if remaining, err := verifyAuditLog(path); err != nil || remaining != len(chain)-test.want {
+				t.Errorf("verifyAuditLog() = %d, %v, want %d", remaining, err, len(chain)-test.want)
+			}
+			// アーカイブしたレコードのチェーンは、.base のレコードまでつながる
+			if archived, err := verifyAuditArchives(path); err != nil || archived != test.want {
+				t.Errorf("verifyAuditArchives() = %d, %v, want %d", archived, err, test.want)
+			}
+			// アーカイブと監査ログをつなげると、元のチェーンになる
+			history, err := readAuditHistory(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != len(chain) {
+				t.Fatalf("readAuditHistory() = %d records, want %d", len(history), len(chain))
+			}
+			for i, record := range history {
+				if record.Hash != chain[i].Hash {
+					t.Errorf("record %d: hash %s, want %s", i+1, record.Hash, chain[i].Hash)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAuditArchives(t *testing.T) {
+	chain := recentAuditRecords()
+	modified := slices.Clone(chain)
+	modified[1].Event = json.RawMessage(`{"action":"Removal","n":2}`)
+	tests := []struct {
+		name     string
+		archived []AuditRecord
+		// 監査ログから除いた最後のレコード
+		base    AuditRecord
+		want    int
+		wantErr bool
+	}{
+		{name: "intact", archived: chain[:3], base: chain[2], want: 3},
+		{name: "modified", archived: modified[:3], base: chain[2], want: 1, wantErr: true},
+		{name: "removed", archived: []AuditRecord{chain[0], chain[2]}, base: chain[2], want: 1, wantErr: true},
+		{name: "wrong base", archived: chain[:3], base: AuditRecord{Seq: 3, Hash: chain[1].Hash}, want: 3, wantErr: true},
+		// アーカイブせずに削除したレコード（retention_max_size_mb）の先は、つながりを検証しない
+		{name: "pruned after archiving", archived: chain[:2], base: chain[2], want: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, chain[test.base.Seq:], &test.base, chain[len(chain)-1])
+			if err := appendAuditArchive(auditArchivePath(path, chain[0].Time), test.archived); err != nil {
+				t.Fatal(err)
+			}
+			n, err := verifyAuditArchives(path)
+			if (err != nil) != test.wantErr {
+				t.Errorf("verifyAuditArchives() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if n != test.want {
+				t.Errorf("verifyAuditArchives() = %d, want %d", n, test.want)
+			}
+		})
+	}
+}
+
+func TestPruneAuditArchives(t *testing.T) {
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		// 作成するアーカイブの月（今月からの月数）
+		months []int
+		want   int
+	}{
+		{name: "disabled", months: []int{-24, -1}, want: 0},
+		{name: "expired", maxAge: 365 * 24 * time.Hour, months: []int{-24, -14, -1}, want: 2},
+		// 保持期間の途中で終わる月は、月の最後のレコードが期限を過ぎるまで残す
+		{name: "partially expired", maxAge: 45 * 24 * time.Hour, months: []int{-1, 0}, want: 0},
+		{name: "none expired", maxAge: 365 * 24 * time.Hour, months: []int{-3, -2}, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			for _, month := range test.months {
+				if err := os.WriteFile(auditArchivePath(path, thisMonth.AddDate(0, month, 0)), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// アーカイブ以外のファイルは削除しない
+			if err := os.WriteFile(path+".backup"+auditArchiveSuffix, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			removed, err := pruneAuditArchives(path, Config{RetentionMaxAge: Duration(test.maxAge)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != test.want {
+				t.Errorf("pruneAuditArchives() = %d, want %d", removed, test.want)
+			}
+			archives, err := auditArchives(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archives) != len(test.months)+1-test.want {
+				t.Errorf("archives = %v, want %d", archives, len(test.months)+1-test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 監査ログの最後のレコードの番号とハッシュを記録するファイルの拡張子
+	// 末尾のレコードを削除されても、チェーンだけでは検出できないため
+	auditHeadSuffix = ".head"
+	// 保持期間を過ぎて削除した最後のレコードの番号とハッシュを記録するファイルの拡張子
+	// 残ったレコードのチェーンはこのレコードから検証する
+	auditBaseSuffix = ".base"
+	// 書き込みの途中で停止して壊れた末尾のレコードを移すファイルの拡張子
+	auditTornSuffix = ".torn"
+)
+
+// 監査ログの1件のレコード
+// hashは、番号・時刻・前のレコードのハッシュ・イベントのJSONから計算する（最初のレコードのprev_hashは空）
+// audit_encryptionを指定した場合はeventの代わりにsealedに暗号化したイベントを記録し、hashは暗号化したイベントから計算する
+// （復号できなくてもチェーンを検証できるようにするため）
+type AuditRecord struct {
+	Seq      uint64          `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Event    json.RawMessage `json:"event,omitempty"`
+	Sealed   string          `json:"sealed,omitempty"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+// レコードのハッシュを計算
+func (r AuditRecord) computeHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n", r.Seq, r.Time.Format(time.RFC3339Nano), r.PrevHash)
+	if r.Sealed != "" {
+		h.Write([]byte(r.Sealed))
+	} else {
+		h.Write(r.Event)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 出力したイベントを、改ざんを検出できるハッシュチェーンとして追記する監査ログ
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// イベントを暗号化する設定（暗号化しない場合はnil）
+	encryption *AuditEncryptionConfig
+	// 最後に書き込んだレコードの番号とハッシュ
+	seq  uint64
+	hash string
+}
+
+// 設定でaudit_logを指定した場合の監査ログ（指定しない場合はnil）
+var auditLog *AuditLog
+
+// 監査ログを追記モードで開き、既存のレコードの続きからチェーンをつなぐ
+// encryptionを指定した場合は、以降に追記するイベントを暗号化する
+func openAuditLog(path string, encryption *AuditEncryptionConfig) (*AuditLog, error) {
+	if encryption != nil {
+		// パスフレーズの環境変数が設定されていないなどで暗号化できない場合は、平文で書き込まずに起動を止める
+		if _, err := sealAuditEvent([]byte("{}"), encryption); err != nil {
+			return nil, fmt.Errorf("Failed to open audit log: %w", err)
+		}
+	}
+	if err := quarantineTornAuditRecord(path); err != nil {
+		return nil, err
+	}
+	records, err := readAuditLog(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open audit log: %w", err)
+	}
+	l := &AuditLog{path: path, file: file, encryption: encryption}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		l.seq, l.hash = last.Seq, last.Hash
+		// レコードのSyncと.headの書き込みの間で停止した場合は、.headを最後のレコードに合わせる
+		if headSeq, _, err := readAuditMark(path + auditHeadSuffix); err == nil && headSeq == l.seq-1 {
+			if err := writeAuditMark(path+auditHeadSuffix, l.seq, l.hash); err != nil {
+				fmt.Printf("Failed to write audit log: %v\n", err)
+			}
+		}
+	} else if l.seq, l.hash, err = readAuditMark(path + auditBaseSuffix); err != nil {
+		// すべてのレコードを削除した場合は、削除した最後のレコードからチェーンをつなぐ
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// レコードの番号とハッシュを記録したファイル（.head / .base）を読み込む（ファイルがない場合は0と空）
+func readAuditMark(path string) (uint64, string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	seqText, hash, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return seq, hash, nil
+}
+
+// レコードの番号とハッシュをファイル（.head / .base）に記録
+// 書き込みの途中で停止しても前の内容か新しい内容のどちらかが残るよう、一時ファイルに書き出してから置き換える
+func writeAuditMark(path string, seq uint64, hash string) error {
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "%d %s\n", seq, hash); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// 書き込みの途中で停止して壊れた末尾のレコード（改行で終わらない行、または読み込めない最後の行）を
+// .tornファイルに移して監査ログから除く（壊れたレコードが残っていると監査ログを開けず、監視を始められないため）
+// 書き込みの途中で停止した場合は .head がその前のレコードを指すため、それ以外の場合と
+// 最後の行以外の壊れたレコードは改ざんの可能性があるとして、移さずにエラーにする
+func quarantineTornAuditRecord(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read audit log: %w", err)
+	}
+	body := bytes.TrimSuffix(data, []byte("\n"))
+	if len(body) == 0 {
+		return nil
+	}
+	start := bytes.LastIndexByte(body, '\n') + 1
+	last := body[start:]
+	var record AuditRecord
+	if json.Unmarshal(last, &record) == nil && record.Hash != "" && record.computeHash() == record.Hash {
+		if len(body) == len(data) {
+			// 改行だけが書き込まれなかった場合は、レコードを残して改行を補う
+			return appendAuditBytes(path, []byte("\n"))
+		}
+		return nil
+	}
+	intactSeq, err := lastIntactAuditSeq(path, body[:start])
+	if err != nil {
+		return err
+	}
+	headSeq, _, err := readAuditMark(path + auditHeadSuffix)
+	if err != nil {
+		return err
+	}
+	if headSeq != intactSeq {
+		return fmt.Errorf("Failed to open audit log: last record is corrupt, but record %d was written (record modified)", headSeq)
+	}
+	if err := appendAuditBytes(path+auditTornSuffix, append(slices.Clone(data[start:]), '\n')); err != nil {
+		return fmt.Errorf("Failed to quarantine torn audit record: %w", err)
+	}
+	if err := os.Truncate(path, int64(start)); err != nil {
+		return fmt.Errorf("Failed to quarantine torn audit record: %w", err)
+	}
+	fmt.Printf(tr("Torn audit record moved to %s (%d bytes)\n"), path+auditTornSuffix, len(data)-start)
+	return nil
+}
+
+// 壊れた最後の行より前（intact）の最後のレコードの番号を返す（前のレコードがない場合は .base の番号）
+func lastIntactAuditSeq(path string, intact []byte) (uint64, error) {
+	intact = bytes.TrimSuffix(intact, []byte("\n"))
+	if len(intact) == 0 {
+		seq, _, err := readAuditMark(path + auditBaseSuffix)
+		return seq, err
+	}
+	var record AuditRecord
+	if err := json.Unmarshal(intact[bytes.LastIndexByte(intact, '\n')+1:], &record); err != nil {
+		return 0, fmt.Errorf("Failed to open audit log: %w", err)
+	}
+	return record.Seq, nil
+}
+
+// ファイルの末尾にデータを追記してディスクに書き出す
+func appendAuditBytes(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// 監査ログを閉じる
+func (l *AuditLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("Failed to close audit log: %w", err)
+	}
+	return nil
+}
+
+// イベントを監査ログに追記
+func (l *AuditLog) append(event DeviceEvent) {
+	if l == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record := AuditRecord{Seq: l.seq + 1, Time: time.Now().UTC(), Event: data, PrevHash: l.hash}
+	if l.encryption != nil {
+		sealed, err := sealAuditEvent(data, l.encryption)
+		if err != nil {
+			fmt.Printf("Failed to write audit log: %v\n", err)
+			return
+		}
+		record.Event, record.Sealed = nil, sealed
+	}
+	record.Hash = record.computeHash()
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return
+	}
+	// 停電などで書き込んだはずのレコードが失われないよう、ディスクに書き出す
+	if err := l.file.Sync(); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return
+	}
+	l.seq, l.hash = record.Seq, record.Hash
+	if err := writeAuditMark(l.path+auditHeadSuffix, l.seq, l.hash); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+	}
+}
+
+// 監査ログのレコードをすべて読み込む
+func readAuditLog(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readAuditRecords(file, path)
+}
+
+// 1行に1件のレコードを読み込む（nameはエラーの表示用）
+func readAuditRecords(r io.Reader, path string) ([]AuditRecord, error) {
+	var records []AuditRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("Failed to parse audit log %s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("Failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// 監査ログのチェーンを検証し、改ざん・削除されたレコードがあればエラーを返す
+func verifyAuditLog(path string) (int, error) {
+	records, err := readAuditLog(path)
+	if err != nil {
+		return 0, err
+	}
+	// 保持期間を過ぎたレコードを削除した場合は、削除した最後のレコードからチェーンをたどる
+	baseSeq, prevHash, err := readAuditMark(path + auditBaseSuffix)
+	if err != nil {
+		return 0, err
+	}
+	baseHash := prevHash
+	for i, record := range records {
+		if expected := baseSeq + uint64(i+1); record.Seq != expected {
+			return i, fmt.Errorf("record %d: expected seq %d, found %d (records removed or reordered)", expected, expected, record.Seq)
+		}
+		if record.PrevHash != prevHash {
+			return i, fmt.Errorf("record %d: previous hash does not match (chain broken)", record.Seq)
+		}
+		if record.computeHash() != record.Hash {
+			return i, fmt.Errorf("record %d: hash does not match (record modified)", record.Seq)
+		}
+		prevHash = record.Hash
+	}
+
+	// 末尾のレコードの削除は、最後に書き込んだレコードの記録と比べて検出
+	headSeq, headHash, err := readAuditMark(path + auditHeadSuffix)
+	if err != nil {
+		return len(records), err
+	}
+	lastSeq := baseSeq + uint64(len(records))
+	if headSeq == lastSeq && headHash == prevHash {
+		return len(records), nil
+	}
+	// レコードのSyncと.headの書き込みの間で停止した場合は、.headが最後の1つ前のレコードを指す
+	if len(records) > 0 && headSeq+1 == lastSeq {
+		previous := baseHash
+		if len(records) > 1 {
+			previous = records[len(records)-2].Hash
+		}
+		if headHash == previous {
+			return len(records), nil
+		}
+	}
+	return len(records), fmt.Errorf("log ends at record %d, but record %d was written (log truncated)", lastSeq, headSeq)
+}
+
+// 監査ログのすべてのイベントの署名を検証（暗号化したイベントは復号して検証）
+func verifyAuditSignatures(path string, publicKey ed25519.PublicKey, encryption *AuditEncryptionConfig) error {
+	records, err := readAuditLog(path)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		event, err := record.event(encryption)
+		if err != nil {
+			return err
+		}
+		if err := verifyEventSignature(event, publicKey); err != nil {
+			return fmt.Errorf("record %d: %w", record.Seq, err)
+		}
+	}
+	return nil
+}
+
+// `usbmon verify` サブコマンド
+// 監査ログのハッシュチェーンを検証し、改ざんが見つかった場合は1で終了
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find audit_log and audit_encryption)")
+	path := fs.String("log", "", "path to the audit log (overrides audit_log in the config)")
+	publicKeyText := fs.String("public-key", "", "base64 Ed25519 public key to also verify event signatures with")
+	fs.Parse(args)
+	var publicKey ed25519.PublicKey
+	if *publicKeyText != "" {
+		key, err := parsePublicKey(*publicKeyText)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		publicKey = key
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if *path == "" {
+		*path = cfg.AuditLog
+	}
+	if *path == "" {
+		fmt.Println("specify -log or audit_log in the config")
+		return 2
+	}
+	// アーカイブしたレコードを先に、監査ログのレコードを後に検証
+	archived, err := verifyAuditArchives(*path)
+	if err != nil {
+		fmt.Printf("Audit log verification failed: %s: %v\n", *path, err)
+		return 1
+	}
+	n, err := verifyAuditLog(*path)
+	if err != nil {
+		fmt.Printf("Audit log verification failed: %s: %v\n", *path, err)
+		return 1
+	}
+	if publicKey != nil {
+		if err := verifyAuditSignatures(*path, publicKey, cfg.AuditEncryption); err != nil {
+			fmt.Printf("Audit log verification failed: %s: %v\n", *path, err)
+			return 1
+		}
+	}
+	// 起動時に移した壊れたレコードがあれば、検証の対象外であることを示す
+	if info, err := os.Stat(*path + auditTornSuffix); err == nil {
+		fmt.Printf(tr("Torn audit records quarantined in %s (%d bytes, not verified)\n"), *path+auditTornSuffix, info.Size())
+	}
+	fmt.Printf("Audit log OK: %s (%d records, %d archived)\n", *path, n, archived)
+	return 0
+}
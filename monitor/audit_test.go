@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 時刻ごとに1件のレコードを持つハッシュチェーンを作成
+func testAuditRecords(times ...time.Time) []AuditRecord {
+	var records []AuditRecord
+	prevHash := ""
+	for i, t := range times {
+		record := AuditRecord{
+			Seq:      uint64(i + 1),
+			Time:     t.UTC(),
+			Event:    json.RawMessage(fmt.Sprintf(`{"action":"Arrival","n":%d}`, i+1)),
+			PrevHash: prevHash,
+		}
+		record.Hash = record.computeHash()
+		prevHash = record.Hash
+		records = append(records, record)
+	}
+	return records
+}
+
+// 一時ディレクトリの監査ログにレコードを書き込み、.head（baseを指定した場合は .base も）を記録して、監査ログのパスを返す
+func writeTestAuditLog(t *testing.T, records []AuditRecord, base *AuditRecord, head AuditRecord) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if base != nil {
+		if err := writeAuditMark(path+auditBaseSuffix, base.Seq, base.Hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeAuditMark(path+auditHeadSuffix, head.Seq, head.Hash); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 監査ログを開き、テストの終了時に閉じる（開いたままでは一時ディレクトリを削除できないため）
+func openTestAuditLog(t *testing.T, path string) *AuditLog {
+	t.Helper()
+	l, err := openAuditLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.file.Close() })
+	return l
+}
+
+// 直近の5分間に1件ずつ記録した5件のチェーン
+func recentAuditRecords() []AuditRecord {
+	now := time.Now()
+	var times []time.Time
+	for i := 5; i > 0; i-- {
+		times = append(times, now.Add(-time.Duration(i)*time.Minute))
+	}
+	return testAuditRecords(times...)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	chain := recentAuditRecords()
+	last := chain[len(chain)-1]
+
+	modified := slices.Clone(chain)
+	modified[2].Event = json.RawMessage(`{"action":"Removal","n":3}`)
+	removed := slices.Delete(slices.Clone(chain), 2, 3)
+	reordered := slices.Clone(chain)
+	reordered[1], reordered[2] = reordered[2], reordered[1]
+	relinked := slices.Clone(chain)
+	relinked[3].PrevHash = chain[1].Hash
+	relinked[3].Hash = relinked[3].computeHash()
+
+	tests := []struct {
+		name    string
+		records []AuditRecord
+		base    *AuditRecord
+		head    AuditRecord
+		want    int
+		wantErr bool
+	}{
+		{name: "intact", records: chain, head: last, want: 5},
+		{name: "modified", records: modified, head: last, want: 2, wantErr: true},
+		{name: "removed", records: removed, head: last, want: 2, wantErr: true},
+		{name: "reordered", records: reordered, head: last, want: 1, wantErr: true},
+		{name: "relinked", records: relinked, head: last, want: 3, wantErr: true},
+		{name: "truncated", records: chain[:4], head: last, want: 4, wantErr: true},
+		// レコードのSyncと.headの書き込みの間で停止した場合
+		{name: "head lag", records: chain, head: chain[3], want: 5},
+		{name: "head lag single record", records: chain[:1], head: AuditRecord{}, want: 1},
+		{name: "head lag wrong hash", records: chain, head: AuditRecord{Seq: 4, Hash: chain[2].Hash}, want: 5, wantErr: true},
+		{name: "head behind", records: chain, head: chain[2], want: 5, wantErr: true},
+		// 保持期間を過ぎたレコードを削除した場合
+		{name: "pruned", records: chain[2:], base: &chain[1], head: last, want: 3},
+		{name: "pruned head lag", records: chain[2:], base: &chain[1], head: chain[3], want: 3},
+		{name: "pruned without base", records: chain[2:], head: last, want: 0, wantErr: true},
+		{name: "pruned wrong base", records: chain[2:], base: &chain[0], head: last, want: 0, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, test.records, test.base, test.head)
+			n, err := verifyAuditLog(path)
+			if (err != nil) != test.wantErr {
+				t.Errorf("verifyAuditLog() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if n != test.want {
+				t.Errorf("verifyAuditLog() = %d, want %d", n, test.want)
+			}
+		})
+	}
+}
+
+func TestQuarantineTornAuditRecord(t *testing.T) {
+	chain := recentAuditRecords()
+	tests := []struct {
+		name string
+		// 書き込んだ監査ログの内容を変更
+		tear func(data []byte) []byte
+		// .tornに移される内容（移されない場合は空）
+		wantTorn string
+		// 壊れたレコードを除いた後に監査ログを開けるかどうか
+		wantOpen bool
+	}{
+		{
+			name:     "intact",
+			tear:     func(data []byte) []byte { return data },
+			wantOpen: true,
+		},
+		{
+			name:     "partial record",
+			tear:     func(data []byte) []byte { return append(data, `{"seq":6,"time":"20`...) },
+			wantTorn: `{"seq":6,"time":"20` + "\n",
+			wantOpen: true,
+		},
+		{
+			name:     "missing newline",
+			tear:     func(data []byte) []byte { return data[:len(data)-1] },
+			wantOpen: true,
+		},
+		{
+			// 最後の行以外の壊れたレコードは改ざんの可能性があるため移さない
+			name: "corrupt middle record",
+			tear: func(data []byte) []byte {
+				lines := bytes.SplitAfter(data, []byte("\n"))
+				lines[1] = []byte("{garbage}\n")
+				return bytes.Join(lines, nil)
+			},
+			wantOpen: false,
+		},
+		{
+			// .headが最後のレコードを指している（書き込みは完了していた）ため移さない
+			name: "modified last record",
+			tear: func(data []byte) []byte {
+				return bytes.Replace(data, []byte(`"n":5`), []byte(`"n":6`), 1)
+			},
+			wantOpen: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, chain, nil, chain[len(chain)-1])
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, test.tear(slices.Clone(data)), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := openAuditLog(path, nil)
+			if (err == nil) != test.wantOpen {
+				t.Fatalf("openAuditLog() error = %v, wantOpen %v", err, test.wantOpen)
+			}
+			if l != nil {
+				l.file.Close()
+			}
+			torn, err := os.ReadFile(path + auditTornSuffix)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(torn) != test.wantTorn {
+				t.Errorf("torn = %q, want %q", torn, test.wantTorn)
+			}
+			if !test.wantOpen {
+				return
+			}
+			if n, err := verifyAuditLog(path); err != nil || n != len(chain) {
+				t.Errorf("verifyAuditLog() = %d, %v, want %d", n, err, len(chain))
+			}
+		})
+	}
+}
+
+func TestAuditLogAppend(t *testing.T) {
+	chain := recentAuditRecords()
+	tests := []struct {
+		name    string
+		records []AuditRecord
+		base    *AuditRecord
+		head    AuditRecord
+		// 追記したレコードの番号
+		wantSeq uint64
+	}{
+		{name: "new", wantSeq: 1},
+		{name: "existing", records: chain, head: chain[4], wantSeq: 6},
+		// .headが最後の1つ前のレコードを指す場合は、開いたときに最後のレコードに合わせる
+		{name: "head lag", records: chain, head: chain[3], wantSeq: 6},
+		// すべてのレコードを削除した場合は、.baseのレコードからチェーンをつなぐ
+		{name: "all pruned", base: &chain[4], head: chain[4], wantSeq: 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			if test.records != nil || test.base != nil {
+				path = writeTestAuditLog(t, test.records, test.base, test.head)
+			}
+			l := openTestAuditLog(t, path)
+			l.append(DeviceEvent{Action: "Arrival"})
+			l.append(DeviceEvent{Action: "Removal"})
+
+			if l.seq != test.wantSeq+1 {
+				t.Errorf("seq = %d, want %d", l.seq, test.wantSeq+1)
+			}
+			records, err := readAuditLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := records[len(records)-2].Seq; got != test.wantSeq {
+				t.Errorf("appended seq = %d, want %d", got, test.wantSeq)
+			}
+			if _, err := verifyAuditLog(path); err != nil {
+				t.Errorf("verifyAuditLog() error = %v", err)
+			}
+		})
+	}
+}
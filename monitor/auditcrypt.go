@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 監査ログとアーカイブのイベントをDPAPIで暗号化する設定
+// 共有の端末では、デバイスのシリアル番号やファイルにアクセスしたユーザーを他のアカウントから読まれないようにする
+type AuditEncryptionConfig struct {
+	// 復号できるアカウントの範囲（machine: この端末のすべてのアカウント / user: 監視を実行するアカウントのみ、既定はmachine）
+	Scope string `json:"scope"`
+	// DPAPIの追加のエントロピーとして使うパスフレーズを格納した環境変数の名前（空の場合はパスフレーズなし）
+	// 指定した場合、同じパスフレーズを設定しないとexportや署名の検証で復号できない
+	PassphraseEnv string `json:"passphrase_env"`
+}
+
+// 暗号化したイベントに付ける説明（DPAPIのデータに含まれる）
+const auditSealDescription = "usbmon audit event"
+
+// 設定の暗号化の範囲を確認
+func checkAuditEncryption(cfg *AuditEncryptionConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Scope {
+	case "", "machine", "user":
+		return nil
+	default:
+		return fmt.Errorf("invalid audit_encryption scope %q (use machine or user)", cfg.Scope)
+	}
+}
+
+// パスフレーズを追加のエントロピーとして返す（指定しない場合はnil）
+func (c *AuditEncryptionConfig) entropy() (*windows.DataBlob, error) {
+	if c == nil || c.PassphraseEnv == "" {
+		return nil, nil
+	}
+	passphrase := os.Getenv(c.PassphraseEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("audit_encryption passphrase environment variable %s is not set", c.PassphraseEnv)
+	}
+	return newDataBlob([]byte(passphrase)), nil
+}
+
+// イベントのJSONをDPAPIで暗号化してBase64で返す
+func sealAuditEvent(data []byte, cfg *AuditEncryptionConfig) (string, error) {
+	entropy, err := cfg.entropy()
+	if err != nil {
+		return "", err
+	}
+	description, err := windows.UTF16PtrFromString(auditSealDescription)
+	if err != nil {
+		return "", err
+	}
+	flags := uint32(windows.CRYPTPROTECT_UI_FORBIDDEN)
+	if cfg.Scope != "user" {
+		flags |= windows.CRYPTPROTECT_LOCAL_MACHINE
+	}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(newDataBlob(data), description, entropy, 0, nil, flags, &out); err != nil {
+		return "", fmt.Errorf("Failed to encrypt audit record: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(takeDataBlob(&out)), nil
+}
+
+// DPAPIで暗号化したイベントを復号
+func unsealAuditEvent(sealed string, cfg *AuditEncryptionConfig) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt audit record: %w", err)
+	}
+	entropy, err := cfg.entropy()
+	if err != nil {
+		return nil, err
+	}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(newDataBlob(data), nil, entropy, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, fmt.Errorf("Failed to decrypt audit record: %w", err)
+	}
+	return takeDataBlob(&out), nil
+}
+
+// レコードのイベントを読み込む（暗号化されている場合は復号する）
+func (r AuditRecord) event(cfg *AuditEncryptionConfig) (DeviceEvent, error) {
+	var event DeviceEvent
+	data := []byte(r.Event)
+	if r.Sealed != "" {
+		var err error
+		if data, err = unsealAuditEvent(r.Sealed, cfg); err != nil {
+			return event, fmt.Errorf("record %d: %w", r.Seq, err)
+		}
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("record %d: %w", r.Seq, err)
+	}
+	return event, nil
+}
+
+// DPAPIに渡すDATA_BLOB構造体を作成
+func newDataBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// DPAPIが確保したDATA_BLOB構造体の内容をコピーして解放
+func takeDataBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
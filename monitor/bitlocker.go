@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// リモートデスクトップサービスのAPI群を提供するwtsapi32.dllから関数をロード
+var (
+	wtsapi32 = syscall.NewLazyDLL("wtsapi32.dll")
+	// 指定したセッションのデスクトップにメッセージボックスを表示（サービスからも表示できる）
+	procWTSSendMessageW = wtsapi32.NewProc("WTSSendMessageW")
+)
+
+const (
+	// 「はい」「いいえ」のボタンと質問のアイコンを表示するメッセージボックスのスタイル
+	MB_YESNO        = 0x00000004
+	MB_ICONQUESTION = 0x00000020
+	// メッセージボックスの応答
+	IDYES     = 6
+	IDNO      = 7
+	IDTIMEOUT = 32000
+	// 暗号化の確認に応答がない場合に閉じるまでの時間
+	bitLockerPromptTimeout = 5 * time.Minute
+)
+
+// 暗号化されていない許可済みのドライブについて、ログオン中のユーザーにBitLocker To Goでの暗号化を確認し、
+// 承諾された場合はmanage-bdeで暗号化を開始して、選択と結果をEncryptionPromptイベントとして記録
+func promptBitLocker(event DeviceEvent) {
+	title := tr("Encrypt USB drive")
+	message := fmt.Sprintf(tr("%s (%s) is not encrypted. Start BitLocker To Go encryption now?"), event.Volume, event.Device.FriendlyName)
+	response, err := sendSessionMessage(title, message, MB_YESNO|MB_ICONQUESTION, bitLockerPromptTimeout)
+	event.Action = "EncryptionPrompt"
+	event.Severity = severityNotice
+	switch {
+	case err != nil:
+		event.Explanation = fmt.Sprintf("prompt failed: %v", err)
+	case response == IDYES:
+		// 回復パスワードを出力するため、manage-bdeの出力は記録しない
+		if err := exec.Command("manage-bde", "-on", event.Volume, "-RecoveryPassword", "-UsedSpaceOnly").Run(); err != nil {
+			event.Severity = severityWarning
+			event.Explanation = fmt.Sprintf("user accepted; manage-bde failed: %v", err)
+		} else {
+			event.Explanation = "user accepted; encryption started"
+		}
+	case response == IDNO:
+		event.Severity = severityWarning
+		event.Explanation = "user declined"
+	default:
+		event.Severity = severityWarning
+		event.Explanation = "no response"
+	}
+	logDeviceEvent(event)
+}
+
+// コンソールセッションのデスクトップにメッセージボックスを表示し、ユーザーの応答を待つ
+func sendSessionMessage(title string, message string, style uint32, timeout time.Duration) (uint32, error) {
+	sessionID := windows.WTSGetActiveConsoleSessionId()
+	if sessionID == 0xFFFFFFFF {
+		return 0, fmt.Errorf("no user is logged on")
+	}
+	titleText, err := windows.UTF16FromString(title)
+	if err != nil {
+		return 0, err
+	}
+	messageText, err := windows.UTF16FromString(message)
+	if err != nil {
+		return 0, err
+	}
+	var response uint32
+	// 長さは終端のNULを含まないバイト数
+	_, err = callWin32(procWTSSendMessageW,
+		0, // WTS_CURRENT_SERVER_HANDLE
+		uintptr(sessionID),
+		uintptr(unsafe.Pointer(&titleText[0])),
+		uintptr((len(titleText)-1)*2),
+		uintptr(unsafe.Pointer(&messageText[0])),
+		uintptr((len(messageText)-1)*2),
+		uintptr(style),
+		uintptr(timeout.Seconds()),
+		uintptr(unsafe.Pointer(&response)),
+		1, // 応答を待つ
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to show message: %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// 監視するデバイスの種類の既定値
+const defaultWatchClass = "USB"
+
+// 監視できるデバイスの種類と、通知を登録するデバイスインターフェースクラスGUID
+var watchClassGuids = map[string]windows.GUID{
+	// USBデバイス（GUID_DEVINTERFACE_USB_DEVICE）
+	"USB": usbDeviceInterfaceGuid,
+	// HIDデバイス（GUID_DEVINTERFACE_HID）
+	"HID": hidInterfaceGuid,
+	// ディスクドライブ（GUID_DEVINTERFACE_DISK）
+	"DiskDrive": {Data1: 0x53F56307, Data2: 0xB6BF, Data3: 0x11D0, Data4: [8]byte{0x94, 0xF2, 0x00, 0xA0, 0xC9, 0x1E, 0xFB, 0x8B}},
+	// シリアルポート（GUID_DEVINTERFACE_COMPORT）
+	"Ports": {Data1: 0x86E0D1E0, Data2: 0x8089, Data3: 0x11D0, Data4: [8]byte{0x9C, 0xE4, 0x08, 0x00, 0x3E, 0x30, 0x1F, 0x73}},
+	// スキャナー・カメラなどのイメージングデバイス（GUID_DEVINTERFACE_IMAGE）
+	"Image": {Data1: 0x6BDD1FC6, Data2: 0x810F, Data3: 0x11D0, Data4: [8]byte{0xBE, 0xC7, 0x08, 0x00, 0x2B, 0xE2, 0x09, 0x2F}},
+	// USBプリンター（GUID_DEVINTERFACE_USBPRINT）
+	"Printer": {Data1: 0x28D78FAD, Data2: 0x5A12, Data3: 0x11D1, Data4: [8]byte{0xAE, 0x5B, 0x00, 0x00, 0xF8, 0x03, 0xA8, 0xC2}},
+	// Webカメラ（KSCATEGORY_VIDEO_CAMERA）
+	"Camera": {Data1: 0xE5323777, Data2: 0xF976, Data3: 0x4F5B, Data4: [8]byte{0x9B, 0x55, 0xB9, 0x46, 0x99, 0xC4, 0x6E, 0x44}},
+	// ネットワークアダプター（GUID_DEVINTERFACE_NET）
+	"Net": {Data1: 0xCAC88484, Data2: 0x7515, Data3: 0x4C03, Data4: [8]byte{0x82, 0xE6, 0x71, 0xA8, 0x7A, 0xBA, 0xC3, 0x61}},
+	// MTP / PTPモードのスマートフォンなどのポータブルデバイス（GUID_DEVINTERFACE_WPD）
+	"WPD": {Data1: 0x6AC27878, Data2: 0xA6FA, Data3: 0x4155, Data4: [8]byte{0xBA, 0x85, 0xF9, 0x8F, 0x49, 0x1D, 0x4F, 0x33}},
+	// Bluetoothアダプター（GUID_BTHPORT_DEVICE_INTERFACE）
+	"Bluetooth": {Data1: 0x0850302A, Data2: 0xB344, Data3: 0x4FDA, Data4: [8]byte{0x9B, 0xE9, 0x90, 0x57, 0x6B, 0x8D, 0x46, 0xF0}},
+	// スマートカードリーダー（GUID_DEVINTERFACE_SMARTCARD_READER）
+	"SmartCardReader": {Data1: 0x50DD5230, Data2: 0xBA8A, Data3: 0x11D1, Data4: [8]byte{0xBF, 0x5D, 0x00, 0x00, 0xF8, 0x05, 0xF5, 0x30}},
+}
+
+// 監視するデバイスの種類（名前、または {GUID} 形式のデバイスインターフェースクラスGUID）をGUIDに変換
+func parseWatchClass(name string) (windows.GUID, error) {
+	if strings.HasPrefix(name, "{") {
+		return windows.GUIDFromString(name)
+	}
+	for className, guid := range watchClassGuids {
+		if strings.EqualFold(className, name) {
+			return guid, nil
+		}
+	}
+	return windows.GUID{}, fmt.Errorf("unknown watch class %q", name)
+}
+
+// 設定に従って、通知を登録するデバイスの種類の一覧を返す
+// Bluetooth経由のHIDデバイスだけを監視するために、HIDの通知を追加で登録した場合はtrueも返す
+// （HIDを監視対象に含めていない場合、Bluetooth以外のHIDデバイスのイベントは出力しない）
+func notificationClasses(cfg Config) ([]string, bool) {
+	classes := append([]string{}, cfg.WatchClasses...)
+	if !cfg.MonitorBluetoothHID {
+		return classes, false
+	}
+	for _, class := range classes {
+		if strings.EqualFold(class, "HID") {
+			return classes, false
+		}
+	}
+	return append(classes, "HID"), true
+}
+
+// 通知で受け取ったデバイスインターフェースクラスGUIDを、監視するデバイスの種類の名前に変換
+func watchClassName(guid windows.GUID) string {
+	for className, classGuid := range watchClassGuids {
+		if classGuid == guid {
+			return className
+		}
+	}
+	return guid.String()
+}
@@ -0,0 +1,195 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 資産管理システムの種類
+	cmdbServiceNow = "servicenow"
+	cmdbSnipeIT    = "snipeit"
+	// ServiceNowで資産を登録するテーブルの既定値
+	defaultServiceNowTable = "cmdb_ci_peripheral"
+	// 資産管理システムへの要求のタイムアウト
+	cmdbRequestTimeout = 30 * time.Second
+)
+
+// 接続されたデバイスを登録する資産管理システム（CMDB）の設定
+type CMDBConfig struct {
+	// servicenow / snipeit（空の場合は登録しない）
+	Type string `json:"type"`
+	// インスタンスのURL（例: https://example.service-now.com）
+	URL string `json:"url"`
+	// APIトークン（ServiceNowは user:password を指定するとBasic認証）
+	Token string `json:"token"`
+	// ServiceNowで資産を登録するテーブル（既定は cmdb_ci_peripheral）
+	Table string `json:"table"`
+	// Snipe-ITで新しい資産に設定するモデルIDとステータスID
+	ModelID  int `json:"model_id"`
+	StatusID int `json:"status_id"`
+}
+
+// 資産管理システムに登録するデバイスの情報
+type AssetRecord struct {
+	Fingerprint  string
+	Name         string
+	Manufacturer string
+	Model        string
+	Serial       string
+	Owner        string
+	Host         string
+}
+
+// 接続されたデバイスを資産管理システムに登録・更新する
+type AssetSync struct {
+	client *http.Client
+	mu     sync.Mutex
+	// 登録済みのフィンガープリント（同じデバイスを接続のたびに登録し直さない）
+	synced map[string]bool
+}
+
+var assetSync = &AssetSync{client: &http.Client{Timeout: cmdbRequestTimeout}, synced: map[string]bool{}}
+
+// 接続イベントのデバイスを、まだ登録していなければ資産管理システムに登録
+func (s *AssetSync) push(event DeviceEvent) {
+	cfg := currentConfig().CMDB
+	if cfg.Type == "" {
+		return
+	}
+	s.mu.Lock()
+	if s.synced[event.Fingerprint] {
+		s.mu.Unlock()
+		return
+	}
+	s.synced[event.Fingerprint] = true
+	s.mu.Unlock()
+
+	record := AssetRecord{
+		Fingerprint:  event.Fingerprint,
+		Name:         event.Device.FriendlyName,
+		Manufacturer: event.Device.Manufacturer,
+		Model:        event.DeviceType,
+		Serial:       deviceSerial(event.Device.InstanceID),
+		Owner:        event.Owner,
+		Host:         event.HostName,
+	}
+	var err error
+	switch cfg.Type {
+	case cmdbServiceNow:
+		err = s.upsertServiceNow(cfg, record)
+	case cmdbSnipeIT:
+		err = s.upsertSnipeIT(cfg, record)
+	default:
+		err = fmt.Errorf("unknown cmdb type %q", cfg.Type)
+	}
+	if err != nil {
+		fmt.Printf("Failed to sync %s to %s: %v\n", record.Fingerprint, cfg.Type, err)
+		// 次の接続で登録し直す
+		s.mu.Lock()
+		delete(s.synced, record.Fingerprint)
+		s.mu.Unlock()
+	}
+}
+
+// ServiceNowのテーブルAPIで、asset_tagがフィンガープリントのレコードを更新（ない場合は作成）
+func (s *AssetSync) upsertServiceNow(cfg CMDBConfig, record AssetRecord) error {
+	table := cfg.Table
+	if table == "" {
+		table = defaultServiceNowTable
+	}
+	base := strings.TrimRight(cfg.URL, "/") + "/api/now/table/" + table
+	var found struct {
+		Result []struct {
+			SysID string `json:"sys_id"`
+		} `json:"result"`
+	}
+	query := url.Values{"sysparm_query": {"asset_tag=" + record.Fingerprint}, "sysparm_fields": {"sys_id"}, "sysparm_limit": {"1"}}
+	if err := s.do(cfg, http.MethodGet, base+"?"+query.Encode(), nil, &found); err != nil {
+		return err
+	}
+	body := map[string]string{
+		"name":          record.Name,
+		"asset_tag":     record.Fingerprint,
+		"serial_number": record.Serial,
+		"manufacturer":  record.Manufacturer,
+		"model_id":      record.Model,
+		"assigned_to":   record.Owner,
+		"comments":      "Last seen on " + record.Host,
+	}
+	// 参照項目（manufacturer、assigned_toなど）は表示名で指定
+	target := base + "?sysparm_input_display_value=true"
+	if len(found.Result) > 0 {
+		return s.do(cfg, http.MethodPatch, base+"/"+found.Result[0].SysID+"?sysparm_input_display_value=true", body, nil)
+	}
+	return s.do(cfg, http.MethodPost, target, body, nil)
+}
+
+// Snipe-ITのAPIで、シリアル番号の資産を更新（ない場合は作成）
+func (s *AssetSync) upsertSnipeIT(cfg CMDBConfig, record AssetRecord) error {
+	base := strings.TrimRight(cfg.URL, "/") + "/api/v1/hardware"
+	body := map[string]any{
+		"name":      record.Name,
+		"asset_tag": record.Fingerprint,
+		"serial":    record.Serial,
+		"notes":     fmt.Sprintf("Owner: %s, last seen on %s", record.Owner, record.Host),
+	}
+	if record.Serial != "" {
+		var found struct {
+			Rows []struct {
+				ID int `json:"id"`
+			} `json:"rows"`
+		}
+		if err := s.do(cfg, http.MethodGet, base+"/byserial/"+url.PathEscape(record.Serial), nil, &found); err != nil {
+			return err
+		}
+		if len(found.Rows) > 0 {
+			return s.do(cfg, http.MethodPatch, fmt.Sprintf("%s/%d", base, found.Rows[0].ID), body, nil)
+		}
+	}
+	body["model_id"] = cfg.ModelID
+	body["status_id"] = cfg.StatusID
+	return s.do(cfg, http.MethodPost, base, body, nil)
+}
+
+// 資産管理システムのAPIを呼び出し、応答のJSONをresultに読み込む
+func (s *AssetSync) do(cfg CMDBConfig, method string, target string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if user, password, ok := strings.Cut(cfg.Token, ":"); ok && cfg.Type == cmdbServiceNow {
+		req.SetBasicAuth(user, password)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, target, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
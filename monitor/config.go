@@ -0,0 +1,209 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 監視の設定（-configで指定したJSONファイルから読み込む）
+type Config struct {
+	// 監視するデバイスの種類（USB, HID, DiskDrive, Ports, Printer, Image, Camera, Net, WPD, Bluetooth, SmartCardReader、または {GUID}）
+	WatchClasses []string `json:"watch_classes"`
+	// Bluetoothアダプター経由で接続されたHIDデバイス（キーボード・マウスなど）も監視するかどうか
+	MonitorBluetoothHID bool `json:"monitor_bluetooth_hid"`
+	// イベントの出力から除外するデバイスの設定
+	Filters FilterConfig `json:"filters"`
+	// デバイスの種類（例: SmartCardReader）ごとのイベントの重大度（info / notice / warning / critical）
+	Severities map[string]string `json:"severities"`
+	// 曜日・時間帯によって変える重大度（最初に一致した規則を使用し、severitiesより優先）
+	ScheduledSeverities []ScheduledSeverity `json:"scheduled_severities"`
+	// 接続されているデバイスを再列挙し、取りこぼした通知を補正する間隔（例: "5m"、"0"で無効）
+	ReconcileInterval Duration `json:"reconcile_interval"`
+	// 同じポートで、切断からこの時間以内にディスクリプタの異なるデバイスが接続された場合にReenumeratedイベントを出力（例: "3s"、0で無効）
+	ReenumerationWindow Duration `json:"reenumeration_window"`
+	// 起動時に接続されているデバイスの扱い（suppress: 出力しない（既定）、emit: Presentイベントを出力）
+	StartupEvents string `json:"startup_events"`
+	// 通知と補正のための再列挙で同じデバイスの同じ接続・切断を検出した場合に、1つのイベントにまとめる時間幅（既定は10秒、0で無効）
+	DedupWindow Duration `json:"dedup_window"`
+	// 接続中の別のデバイスと同じシリアル番号、または既定のままのシリアル番号（例: 0123456789）のデバイスを検出するかどうか
+	DetectDuplicateSerials bool `json:"detect_duplicate_serials"`
+	// 接続後に複合デバイスのインターフェース（キーボードなど）が追加された場合にIdentityMorphイベントを出力するかどうか
+	DetectIdentityMorph bool `json:"detect_identity_morph"`
+	// 許可・ブロックの規則を保存するファイル（空の場合は %ProgramData%\usbmon\policy.json）
+	PolicyFile string `json:"policy_file"`
+	// ポリシーを配布するサーバーのURL（https、空の場合は取得しない）
+	PolicyURL string `json:"policy_url"`
+	// 配布されたポリシーの署名を検証するEd25519公開鍵（Base64）
+	PolicyPublicKey string `json:"policy_public_key"`
+	// 配布サーバーからポリシーを取得する間隔（例: "15m"）
+	PolicyPollInterval Duration `json:"policy_poll_interval"`
+	// 出力したイベントを改ざんを検出できる形式で追記する監査ログのパス（空の場合は記録しない）
+	AuditLog string `json:"audit_log"`
+	// 監査ログとアーカイブのイベントをDPAPIで暗号化する設定（指定しない場合は暗号化しない）
+	AuditEncryption *AuditEncryptionConfig `json:"audit_encryption"`
+	// 監査ログのレコードを保持する期間（例: "2160h"、"0"で無期限）
+	RetentionMaxAge Duration `json:"retention_max_age"`
+	// 監査ログのレコードを月ごとの圧縮したアーカイブに移すまでの期間（例: "720h"、0でアーカイブしない）
+	ArchiveAfter Duration `json:"archive_after"`
+	// 監査ログのサイズの上限（MB、0で無制限）
+	RetentionMaxSizeMB int `json:"retention_max_size_mb"`
+	// デバイスに付けた所有者とメモを保存するファイル（空の場合は %ProgramData%\usbmon\annotations.json）
+	AnnotationsFile string `json:"annotations_file"`
+	// イベントの出力先（名前ごとの設定）
+	Sinks map[string]SinkConfig `json:"sinks"`
+	// 重大度ごとのイベントの出力先の名前（指定しない重大度はコンソールのみ）
+	Routes map[string][]string `json:"routes"`
+	// イベントを監査ログに記録したまま、コンソール以外の出力先への通知を止めるメンテナンス期間
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows"`
+	// usbmon maintenanceで設定したメンテナンス期間を保存するファイル（空の場合は %ProgramData%\usbmon\maintenance.json）
+	MaintenanceFile string `json:"maintenance_file"`
+	// 通常と異なる接続（初めての種類のデバイス、普段と違う時間帯、短時間に多数のデバイス）の検出
+	Anomaly AnomalyConfig `json:"anomaly"`
+	// 接続の量のしきい値（超えた場合にThresholdイベントを出力）
+	Thresholds []ThresholdRule `json:"thresholds"`
+	// セキュリティログの4663（リムーバブル記憶域の監査）から、USBストレージ上のファイルへのアクセスを記録するかどうか
+	SecurityLogCorrelation bool `json:"security_log_correlation"`
+	// 接続中のUSBストレージに書き込まれたファイルの記録
+	FileTransfer FileTransferConfig `json:"file_transfer"`
+	// 暗号化（BitLocker To Go）されていないリムーバブルメディアの検出
+	EncryptedMedia EncryptedMediaConfig `json:"encrypted_media"`
+	// 許可されていないUSBストレージのボリュームからのプログラムの実行を、取り外すまで禁止するかどうか
+	BlockRemovableExecution bool `json:"block_removable_execution"`
+	// 同じデバイスのイベントの出力を制限する規則（最初に一致した規則を使用）
+	RateLimits []RateLimitRule `json:"rate_limits"`
+	// 常に接続されているべきデバイス（切断されたまま時間が過ぎたらアラートを出力）
+	RequiredDevices []RequiredDevice `json:"required_devices"`
+	// 監視が動作していることを知らせるハートビート
+	Heartbeat HeartbeatConfig `json:"heartbeat"`
+	// 接続中のデバイスの一覧を定期的に送る設定
+	Inventory InventoryConfig `json:"inventory"`
+	// 接続されたデバイスを登録する資産管理システム（ServiceNow・Snipe-IT）
+	CMDB CMDBConfig `json:"cmdb"`
+	// 署名された更新の配布元と自動更新の設定
+	Update UpdateConfig `json:"update"`
+	// 監視の内部の障害を報告するSentry互換の報告先
+	ErrorReporting ErrorReportingConfig `json:"error_reporting"`
+	// イベントを出力する前に項目を追加するテンプレートと外部プログラム
+	Enrichment EnrichmentConfig `json:"enrichment"`
+	// イベントに署名するEd25519鍵のファイル（usbmon keygenで作成、空の場合は署名しない）
+	SigningKey string `json:"signing_key"`
+}
+
+// JSONでは "5m" のような文字列で指定する時間
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("Failed to parse duration %s: %w", data, err)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("Failed to parse duration %q: %w", text, err)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// イベントの出力から除外するデバイスの設定
+// 除外したデバイスもトポロジーやフラッピングの検出では引き続き扱う
+type FilterConfig struct {
+	// ルートハブを除外するかどうか
+	ExcludeRootHubs bool `json:"exclude_root_hubs"`
+	// 内部ポートに接続されたハブ・内蔵ハブを除外するかどうか
+	ExcludeInternalHubs bool `json:"exclude_internal_hubs"`
+	// 内部ポートに接続されたデバイス・内蔵デバイス（Webカメラ、指紋センサーなど）を除外するかどうか
+	ExcludeBuiltinDevices bool `json:"exclude_builtin_devices"`
+}
+
+// 監視で使用する設定（実行中に再読み込みされるため、currentConfigで取得する）
+var (
+	configMu sync.RWMutex
+	config   = defaultConfig()
+	// -configで指定した設定ファイルのパス（再読み込みに使用）
+	configPath string
+)
+
+// 現在の設定を取得
+func currentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// 設定を置き換える
+func setConfig(cfg Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = cfg
+}
+
+// 設定ファイルを指定しない場合の設定
+func defaultConfig() Config {
+	return Config{
+		WatchClasses:       []string{defaultWatchClass},
+		ReconcileInterval:  Duration(defaultReconcileInterval),
+		PolicyPollInterval: Duration(defaultPolicyPollInterval),
+		DedupWindow:        Duration(defaultDedupWindow),
+		Inventory:          InventoryConfig{Interval: Duration(defaultInventoryInterval)},
+		Filters: FilterConfig{
+			ExcludeRootHubs:       true,
+			ExcludeInternalHubs:   true,
+			ExcludeBuiltinDevices: true,
+		},
+	}
+}
+
+// 設定ファイルを読み込む（ファイルにない項目は既定値のまま）
+// レジストリ（HKLM\Software\usbmon）に設定があれば、設定ファイルより優先する
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("Failed to read config: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+		}
+	}
+	if err := applyRegistryConfig(&cfg); err != nil {
+		return cfg, err
+	}
+	if err := checkMaintenanceWindows(cfg.MaintenanceWindows); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	if err := checkScheduledSeverities(cfg.ScheduledSeverities); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	if err := checkThresholdRules(cfg.Thresholds); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	if err := checkAuditEncryption(cfg.AuditEncryption); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	if err := checkRequiredDevices(cfg.RequiredDevices); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	if err := checkEnrichment(cfg.Enrichment); err != nil {
+		return cfg, fmt.Errorf("Failed to parse config %s: %w", path, err)
+	}
+	switch cfg.StartupEvents {
+	case "", startupEventsSuppress, startupEventsEmit:
+	default:
+		return cfg, fmt.Errorf("Failed to parse config %s: invalid startup_events %q", path, cfg.StartupEvents)
+	}
+	switch cfg.EncryptedMedia.Severity {
+	case "", severityInfo, severityNotice, severityWarning, severityCritical:
+	default:
+		return cfg, fmt.Errorf("Failed to parse config %s: invalid severity %q", path, cfg.EncryptedMedia.Severity)
+	}
+	return cfg, nil
+}
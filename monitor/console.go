@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ANSIエスケープシーケンスの文字の装飾
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// 表形式の列の幅
+const (
+	tableActionWidth   = 16
+	tableTypeWidth     = 16
+	tableSeverityWidth = 8
+	tableNameWidth     = 32
+)
+
+var (
+	// イベントを1行1件の表形式で出力するかどうか（-tableで有効化）
+	tableOutput bool
+	// イベントの種類ごとに色を付けるかどうか（出力先がコンソールの場合のみ、-no-colorで無効化）
+	colorOutput bool
+	// 表の見出しを1回だけ出力するための制御
+	tableHeader sync.Once
+)
+
+// 標準出力がコンソールの場合、ANSIエスケープシーケンスによる色付けを有効にする
+// リダイレクトされている場合は色を付けない
+func enableColor() bool {
+	stdout := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(stdout, &mode); err != nil {
+		return false
+	}
+	return windows.SetConsoleMode(stdout, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
+
+// イベントの種類に応じた色を付ける（接続・起動時に接続済みは緑、切断は赤、ブロックは太字、それ以外は黄）
+func colorizeAction(action string, text string) string {
+	if !colorOutput {
+		return text
+	}
+	switch action {
+	case "Connected", "Present":
+		return ansiGreen + text + ansiReset
+	case "Disconnected":
+		return ansiRed + text + ansiReset
+	case "Blocked":
+		return ansiBold + text + ansiReset
+	default:
+		return ansiYellow + text + ansiReset
+	}
+}
+
+// イベントを表の1行として出力
+func logDeviceEventRow(event DeviceEvent) {
+	tableHeader.Do(func() {
+		fmt.Printf("%-8s  %-*s  %-*s  %-*s  %-*s  %s\n",
+			tr("TIME"),
+			tableActionWidth, tr("ACTION"),
+			tableTypeWidth, tr("TYPE"),
+			tableSeverityWidth, tr("SEVERITY"),
+			tableNameWidth, tr("NAME"),
+			tr("INSTANCE ID"))
+	})
+	// 色のエスケープシーケンスで幅がずれないよう、埋めてから色を付ける
+	action := colorizeAction(event.Action, fmt.Sprintf("%-*s", tableActionWidth, truncate(tr(event.Action), tableActionWidth)))
+	fmt.Printf("%s  %s  %-*s  %-*s  %-*s  %s\n",
+		time.Now().Format("15:04:05"),
+		action,
+		tableTypeWidth, truncate(event.DeviceType, tableTypeWidth),
+		tableSeverityWidth, truncate(event.Severity, tableSeverityWidth),
+		tableNameWidth, truncate(event.Device.FriendlyName, tableNameWidth),
+		event.Device.InstanceID)
+}
+
+// 列の幅に収まらない文字列を切り詰める
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-1]) + "…"
+}
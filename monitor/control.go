@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 実行中の監視に制御コマンドを送るための名前付きパイプ
+const controlPipeName = `\\.\pipe\usbmon`
+
+// 制御コマンドの応答の最大サイズ
+const controlBufferSize = 4096
+
+// 制御パイプのアクセス許可（SYSTEMとAdministratorsのみ）
+// 一時停止でブロックなどの強制を止められるため、一般のユーザーには接続させない
+const controlPipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// 監視の終了時に、制御パイプの接続の待機を解除するために接続を試みる間隔
+const controlWakeInterval = 100 * time.Millisecond
+
+// 制御コマンドの要求（コマンド名の後の引数と、コマンドを送ったユーザー）
+type controlRequest struct {
+	// コマンド名の後の文字列（例: pause 30m hardware swap の「30m hardware swap」）
+	Args string
+	// パイプのクライアントのプロセスのユーザー（例: CONTOSO\tanaka、取得できない場合は空）
+	User string
+}
+
+// 名前付きパイプで受け付ける制御コマンド
+var controlCommands = map[string]func(request controlRequest) error{
+	// 設定ファイルを読み込み直す
+	"reload": func(controlRequest) error { return requestReload() },
+	// 監査ログから保持期間を過ぎたレコードを削除
+	"prune": func(controlRequest) error { return requestPrune() },
+	// 監視を一時停止（ブロックなどの強制とアラートを止め、監査ログへの記録は続ける）
+	"pause": requestPause,
+	// 一時停止を解除
+	"resume": requestResume,
+}
+
+// 制御コマンドを名前付きパイプで受け付け、実行結果を応答する
+func serveControlPipe(ctx context.Context) {
+	// 他のプロセスが先に同じ名前のパイプを作成していた場合は、制御コマンドを横取りされないよう受け付けない
+	pipe, err := createControlPipe(true)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	// キャンセルされたら、接続を待っているConnectNamedPipeから戻るよう自分で接続する
+	exited := make(chan struct{})
+	defer close(exited)
+	stop := context.AfterFunc(ctx, func() { wakeControlPipe(exited) })
+	defer stop()
+	for {
+		// クライアントが接続するまで待つ（既に接続済みの場合はERROR_PIPE_CONNECTED）
+		err := windows.ConnectNamedPipe(pipe, nil)
+		connected := err == nil || errors.Is(err, windows.ERROR_PIPE_CONNECTED)
+		if ctx.Err() != nil {
+			windows.CloseHandle(pipe)
+			return
+		}
+		// パイプの名前が空いている間に他のプロセスが作成できないよう、次のインスタンスを先に作成
+		next, err := createControlPipe(false)
+		if connected {
+			handleControlClient(pipe)
+			windows.DisconnectNamedPipe(pipe)
+		}
+		windows.CloseHandle(pipe)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		pipe = next
+	}
+}
+
+// SYSTEMとAdministratorsだけが接続できる制御パイプのインスタンスを作成
+// firstの場合は、同じ名前のパイプが既にあれば失敗する
+func createControlPipe(first bool) (windows.Handle, error) {
+	name, _ := windows.UTF16PtrFromString(controlPipeName)
+	sd, err := windows.SecurityDescriptorFromString(controlPipeSDDL)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create control pipe: %w", err)
+	}
+	sa := &windows.SecurityAttributes{Length: uint32(unsafe.Sizeof(windows.SecurityAttributes{})), SecurityDescriptor: sd}
+	openMode := uint32(windows.PIPE_ACCESS_DUPLEX)
+	if first {
+		openMode |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	pipe, err := windows.CreateNamedPipe(
+		name,
+		openMode,
+		windows.PIPE_TYPE_MESSAGE|windows.PIPE_READMODE_MESSAGE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		controlBufferSize,
+		controlBufferSize,
+		0,
+		sa,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create control pipe: %w", err)
+	}
+	return pipe, nil
+}
+
+// 制御パイプの受け付けが終了するまで、制御パイプへの接続を繰り返す
+func wakeControlPipe(exited <-chan struct{}) {
+	name, _ := windows.UTF16PtrFromString(controlPipeName)
+	for {
+		if pipe, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0); err == nil {
+			windows.CloseHandle(pipe)
+		}
+		select {
+		case <-exited:
+			return
+		case <-time.After(controlWakeInterval):
+		}
+	}
+}
+
+// 1つの制御コマンドを読み取り、実行結果を応答
+func handleControlClient(pipe windows.Handle) {
+	buffer := make([]byte, controlBufferSize)
+	var n uint32
+	if err := windows.ReadFile(pipe, buffer, &n, nil); err != nil {
+		return
+	}
+	command, args, _ := strings.Cut(strings.TrimSpace(string(buffer[:n])), " ")
+	response := "OK"
+	if run, ok := controlCommands[command]; !ok {
+		response = fmt.Sprintf("unknown command %q", command)
+	} else if err := run(controlRequest{Args: strings.TrimSpace(args), User: pipeClientUser(pipe)}); err != nil {
+		response = err.Error()
+	}
+	windows.WriteFile(pipe, []byte(response), &n, nil)
+}
+
+// パイプのクライアントのプロセスを実行しているユーザー（ドメイン\ユーザー名）
+func pipeClientUser(pipe windows.Handle) string {
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(pipe, &pid); err != nil {
+		return ""
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(process)
+	var token windows.Token
+	if err := windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token); err != nil {
+		return ""
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return ""
+	}
+	account, domain, _, err := user.User.Sid.LookupAccount("")
+	if err != nil {
+		return user.User.Sid.String()
+	}
+	return domain + `\` + account
+}
+
+// `usbmon reload` などのサブコマンド
+// 実行中の監視に制御コマンドを送り、応答を出力
+func runControlCommand(command string) int {
+	response, err := sendControlCommand(command)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(response)
+	if response != "OK" {
+		return 1
+	}
+	return 0
+}
+
+// 名前付きパイプに制御コマンドを送り、応答を返す
+func sendControlCommand(command string) (string, error) {
+	name, _ := windows.UTF16PtrFromString(controlPipeName)
+	pipe, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return "", errors.New("usbmon is not running")
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to open control pipe: %w", err)
+	}
+	defer windows.CloseHandle(pipe)
+
+	var n uint32
+	if err := windows.WriteFile(pipe, []byte(command), &n, nil); err != nil {
+		return "", fmt.Errorf("Failed to send %s: %w", command, err)
+	}
+	buffer := make([]byte, controlBufferSize)
+	if err := windows.ReadFile(pipe, buffer, &n, nil); err != nil {
+		return "", fmt.Errorf("Failed to read response to %s: %w", command, err)
+	}
+	return string(buffer[:n]), nil
+}
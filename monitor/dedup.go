@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// 既定の重複とみなす時間幅
+const defaultDedupWindow = 10 * time.Second
+
+// デバイスごとの最後に出力した接続・切断
+type correlatedChange struct {
+	arrival bool
+	source  string
+	at      time.Time
+}
+
+// 通知と補正のための再列挙（スリープからの復帰を含む）が同じ接続・切断をそれぞれ検出した場合に、1つのイベントにまとめる
+// フィンガープリントごとに最後の接続・切断を記録し、時間幅内に同じ向きの変化が再び届いたら重複とみなす
+// 間に逆向きの変化があれば重複とみなさないため、抜き差しし直した場合は別のイベントになる
+type EventCorrelator struct {
+	// ウォッチドッグが作り直したメッセージループと、停止から戻った古いメッセージループの両方から呼び出されうる
+	mu sync.Mutex
+	// フィンガープリントごとの最後の接続・切断
+	changes map[string]correlatedChange
+}
+
+// WinAPIのコールバック（メッセージループ）から利用する
+var eventCorrelator = &EventCorrelator{changes: map[string]correlatedChange{}}
+
+// 接続・切断を記録し、時間幅内に別の経路から同じ変化を出力済みの場合はtrueを返す
+func (c *EventCorrelator) duplicate(instanceID string, arrival bool, source string, now time.Time) bool {
+	window := time.Duration(currentConfig().DedupWindow)
+	if window <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for fingerprint, change := range c.changes {
+		if now.Sub(change.at) > window {
+			delete(c.changes, fingerprint)
+		}
+	}
+	fingerprint := deviceFingerprint(instanceID)
+	if previous, ok := c.changes[fingerprint]; ok && previous.arrival == arrival {
+		tracef("duplicate %s of %s from %s merged with %s event at %s", changeName(arrival), instanceID, source, previous.source, previous.at.Format(time.RFC3339Nano))
+		return true
+	}
+	c.changes[fingerprint] = correlatedChange{arrival: arrival, source: source, at: now}
+	return false
+}
+
+func changeName(arrival bool) string {
+	if arrival {
+		return "arrival"
+	}
+	return "removal"
+}
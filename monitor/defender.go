@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Defender for Endpoint Device Controlの規則の種類
+	defenderAllow = "Allow"
+	defenderDeny  = "Deny"
+	// 読み取り・書き込み・実行（ディスクとファイルの両方）を対象にするアクセスマスク
+	defenderAccessMask = 63
+	// リムーバブル記憶域のアクセス制御を設定するIntuneのOMA-URI
+	intuneDeviceControlURI = "./Vendor/MSFT/Defender/Configuration/DeviceControl"
+)
+
+// Device Controlのデバイスグループ
+type DefenderGroup struct {
+	XMLName   xml.Name `xml:"Group"`
+	ID        string   `xml:"Id,attr"`
+	Name      string   `xml:"Name"`
+	MatchType string   `xml:"MatchType"`
+	// VID_PID（例: 046D_C52B）とSerialNumberIdのいずれか、または両方
+	Descriptors DefenderDescriptors `xml:"DescriptorIdList"`
+}
+
+// デバイスグループに一致するデバイスの条件
+type DefenderDescriptors struct {
+	VIDPID string `xml:"VID_PID,omitempty"`
+	Serial string `xml:"SerialNumberId,omitempty"`
+}
+
+// Device Controlの規則
+type DefenderPolicyRule struct {
+	XMLName  xml.Name      `xml:"PolicyRule"`
+	ID       string        `xml:"Id,attr"`
+	Name     string        `xml:"Name"`
+	Included []string      `xml:"IncludedIdList>GroupId"`
+	Excluded []string      `xml:"ExcludedIdList>GroupId"`
+	Entry    DefenderEntry `xml:"Entry"`
+}
+
+// Device Controlの規則の内容
+type DefenderEntry struct {
+	ID         string `xml:"Id,attr"`
+	Type       string `xml:"Type"`
+	Options    int    `xml:"Options"`
+	AccessMask int    `xml:"AccessMask"`
+}
+
+// IntuneのカスタムプロファイルのOMA-URI設定
+type IntuneSetting struct {
+	Name     string `json:"displayName"`
+	OMAURI   string `json:"omaUri"`
+	DataType string `json:"dataType"`
+	Value    string `json:"value"`
+}
+
+// 規則の内容から、出力し直しても変わらないGUIDを生成
+func stableGUID(kind string, rule PolicyRule) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + rule.Action + "\x00" + rule.VIDPID + "\x00" + rule.Serial))
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// 許可・ブロックの規則を、Device Controlのデバイスグループと規則に変換
+func toDefenderPolicy(p Policy) ([]DefenderGroup, []DefenderPolicyRule) {
+	var groups []DefenderGroup
+	var rules []DefenderPolicyRule
+	for _, rule := range p.Rules {
+		// Device Controlのデバイスグループは物理的なポート・HIDの用途で絞り込めないため、ポート・クラス・HIDの種類で絞り込む規則は出力しない
+		if rule.Port != "" || rule.Class != "" || rule.HIDType != "" {
+			continue
+		}
+		group := DefenderGroup{
+			ID:        stableGUID("group", rule),
+			Name:      "usbmon " + rule.String(),
+			MatchType: "MatchAll",
+			Descriptors: DefenderDescriptors{
+				VIDPID: strings.ReplaceAll(rule.VIDPID, ":", "_"),
+				Serial: rule.Serial,
+			},
+		}
+		entryType := defenderAllow
+		if rule.Action == policyBlock {
+			entryType = defenderDeny
+		}
+		groups = append(groups, group)
+		rules = append(rules, DefenderPolicyRule{
+			ID:       stableGUID("rule", rule),
+			Name:     group.Name,
+			Included: []string{group.ID},
+			Entry: DefenderEntry{
+				ID:         stableGUID("entry", rule),
+				Type:       entryType,
+				AccessMask: defenderAccessMask,
+			},
+		})
+	}
+	return groups, rules
+}
+
+// ポリシーをDefender for Endpoint Device ControlのXML（groups.xml、rules.xml）またはIntuneのOMA-URI設定（intune.json）として出力
+func exportPolicy(p Policy, format string, dir string) error {
+	groups, rules := toDefenderPolicy(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("Failed to create export directory: %w", err)
+	}
+	switch format {
+	case "defender":
+		groupsXML, err := xml.MarshalIndent(struct {
+			XMLName xml.Name `xml:"Groups"`
+			Groups  []DefenderGroup
+		}{Groups: groups}, "", "  ")
+		if err != nil {
+			return err
+		}
+		rulesXML, err := xml.MarshalIndent(struct {
+			XMLName xml.Name `xml:"PolicyRules"`
+			Rules   []DefenderPolicyRule
+		}{Rules: rules}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "groups.xml"), groupsXML, 0o644); err != nil {
+			return fmt.Errorf("Failed to write export: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "rules.xml"), rulesXML, 0o644); err != nil {
+			return fmt.Errorf("Failed to write export: %w", err)
+		}
+	case "intune":
+		var settings []IntuneSetting
+		for _, group := range groups {
+			data, err := xml.Marshal(group)
+			if err != nil {
+				return err
+			}
+			settings = append(settings, IntuneSetting{
+				Name:     group.Name,
+				OMAURI:   intuneDeviceControlURI + "/PolicyGroups/" + url.PathEscape(group.ID) + "/GroupData",
+				DataType: "String",
+				Value:    string(data),
+			})
+		}
+		for _, rule := range rules {
+			data, err := xml.Marshal(rule)
+			if err != nil {
+				return err
+			}
+			settings = append(settings, IntuneSetting{
+				Name:     rule.Name,
+				OMAURI:   intuneDeviceControlURI + "/PolicyRules/" + url.PathEscape(rule.ID) + "/RuleData",
+				DataType: "String",
+				Value:    string(data),
+			})
+		}
+		data, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "intune.json"), data, 0o644); err != nil {
+			return fmt.Errorf("Failed to write export: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown export format %q (defender or intune)", format)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// デバイスの列挙・プロパティの取得に使用するWindows APIの抽象化
+// 実機がなくても列挙・差分・イベントの処理をテストできるよう、偽の実装（deviceapi_test.go）に差し替えられる
+type DeviceAPI interface {
+	// 接続されているデバイスインターフェースのパスを列挙
+	interfacePaths(classGuid windows.GUID) ([]string, error)
+	// インスタンスIDのデバイスのプロパティを取得
+	properties(instanceID string) (DeviceInfo, error)
+	// インスタンスIDのデバイスの問題コードを取得（問題がない場合は0）
+	problemCode(instanceID string) (uint32, error)
+}
+
+// 監視で使用するWindows API
+var deviceAPI DeviceAPI = windowsDeviceAPI{}
+
+// SetupAPI・CfgMgr32を呼び出す実装
+type windowsDeviceAPI struct{}
+
+func (windowsDeviceAPI) interfacePaths(classGuid windows.GUID) ([]string, error) {
+	return windows.CM_Get_Device_Interface_List("", &classGuid, windows.CM_GET_DEVICE_INTERFACE_LIST_PRESENT)
+}
+
+func (windowsDeviceAPI) properties(instanceID string) (DeviceInfo, error) {
+	return getDeviceInfo(instanceID)
+}
+
+func (windowsDeviceAPI) problemCode(instanceID string) (uint32, error) {
+	devInst, err := locateDevNode(instanceID)
+	if err != nil {
+		return 0, err
+	}
+	code, ok := getProblemCode(devInst)
+	if !ok {
+		return 0, fmt.Errorf("Failed to get devnode status %s", instanceID)
+	}
+	return code, nil
+}
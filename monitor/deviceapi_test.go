@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// メモリ上のデバイスを返す偽の実装
+type FakeDeviceAPI struct {
+	mu sync.Mutex
+	// インスタンスIDごとの接続されているデバイス
+	devices map[string]fakeDevice
+}
+
+// 偽の実装で接続されているデバイス
+type fakeDevice struct {
+	// デバイスインターフェースクラスのGUID
+	classGuid windows.GUID
+	// デバイスのプロパティ
+	info DeviceInfo
+	// 問題コード
+	problemCode uint32
+}
+
+func newFakeDeviceAPI() *FakeDeviceAPI {
+	return &FakeDeviceAPI{devices: map[string]fakeDevice{}}
+}
+
+// デバイスを接続
+func (f *FakeDeviceAPI) plug(classGuid windows.GUID, info DeviceInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info.InstanceID = strings.ToUpper(info.InstanceID)
+	f.devices[info.InstanceID] = fakeDevice{classGuid: classGuid, info: info}
+}
+
+// インスタンスIDだけを持つデバイスを、列挙子に対応するデバイスインターフェースクラス（HIDまたはUSB）で接続
+func (f *FakeDeviceAPI) plugInstance(instanceID string) {
+	classGuid := usbDeviceInterfaceGuid
+	if strings.HasPrefix(strings.ToUpper(instanceID), `HID\`) {
+		classGuid = hidInterfaceGuid
+	}
+	f.plug(classGuid, DeviceInfo{InstanceID: instanceID})
+}
+
+// デバイスを切断
+func (f *FakeDeviceAPI) unplug(instanceID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.devices, strings.ToUpper(instanceID))
+}
+
+// デバイスの問題コードを変更
+func (f *FakeDeviceAPI) setProblemCode(instanceID string, code uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	instanceID = strings.ToUpper(instanceID)
+	if device, ok := f.devices[instanceID]; ok {
+		device.problemCode = code
+		f.devices[instanceID] = device
+	}
+}
+
+func (f *FakeDeviceAPI) interfacePaths(classGuid windows.GUID) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for instanceID, device := range f.devices {
+		if device.classGuid == classGuid {
+			paths = append(paths, instanceIDToInterfacePath(instanceID, classGuid))
+		}
+	}
+	return paths, nil
+}
+
+func (f *FakeDeviceAPI) properties(instanceID string) (DeviceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	device, ok := f.devices[strings.ToUpper(instanceID)]
+	if !ok {
+		return DeviceInfo{InstanceID: instanceID}, fmt.Errorf("Failed to enumerate device %s: not present", instanceID)
+	}
+	return device.info, nil
+}
+
+func (f *FakeDeviceAPI) problemCode(instanceID string) (uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	device, ok := f.devices[strings.ToUpper(instanceID)]
+	if !ok {
+		return 0, fmt.Errorf("Failed to locate devnode %s: not present", instanceID)
+	}
+	return device.problemCode, nil
+}
+
+// インスタンスIDをデバイスインターフェース名（デバイスパス）に変換（interfacePathToInstanceIDの逆）
+func instanceIDToInterfacePath(instanceID string, classGuid windows.GUID) string {
+	return `\\?\` + strings.ReplaceAll(instanceID, `\`, "#") + "#" + strings.ToLower(classGuid.String())
+}
+
+// 監視で使用するWindows APIを偽の実装に差し替え、テストの終了時に元に戻す
+func useFakeDeviceAPI(t *testing.T) *FakeDeviceAPI {
+	t.Helper()
+	fake := newFakeDeviceAPI()
+	saved := deviceAPI
+	deviceAPI = fake
+	t.Cleanup(func() { deviceAPI = saved })
+	return fake
+}
+
+func TestInstanceIDToInterfacePath(t *testing.T) {
+	tests := []string{
+		`USB\VID_046D&PID_C52B\5&2C0E7D7&0&2`,
+		`HID\VID_1050&PID_0407&MI_00\7&1A2B3C4D&0&0000`,
+		`USBSTOR\DISK&VEN_SANDISK&PROD_ULTRA&REV_1.00\4C530001230412345678&0`,
+	}
+	for _, instanceID := range tests {
+		path := instanceIDToInterfacePath(instanceID, usbDeviceInterfaceGuid)
+		if got := interfacePathToInstanceID(path); got != instanceID {
+			t.Errorf("interfacePathToInstanceID(%q) = %q, want %q", path, got, instanceID)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// USBデバイスのドライバのキー名とインスタンスIDの対応表のキャッシュ
+// ハブに複数のデバイスが接続されると通知ごとにUSB列挙子配下のすべてのデバイスを列挙することになるため、
+// 通知ごとに差分で更新し、すべてを列挙し直すのは補正のための再列挙とキャッシュにないキー名の場合に限る
+type DeviceCache struct {
+	mu sync.Mutex
+	// ドライバのキー名ごとのインスタンスID
+	driverKeys map[string]string
+	// 接続中のデバイスの接続時の情報（大文字にしたインスタンスIDごと）
+	// 切断の通知が届いた時点ではプロパティを読み取れないため、切断イベントはこの情報から作る
+	devices map[string]DeviceInfo
+	// 列挙し直したかどうか
+	built bool
+	// キャッシュで解決できた回数・列挙し直した回数
+	hits   int
+	misses int
+}
+
+var deviceCache = &DeviceCache{driverKeys: map[string]string{}, devices: map[string]DeviceInfo{}}
+
+// ドライバのキー名からインスタンスIDを取得（キャッシュになければ列挙し直す）
+func (c *DeviceCache) instanceID(driverKey string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if instanceID, ok := c.driverKeys[driverKey]; ok && c.built {
+		c.hits++
+		return instanceID
+	}
+	c.misses++
+	c.rebuildLocked()
+	return c.driverKeys[driverKey]
+}
+
+// 接続されたUSBデバイスをキャッシュに追加
+func (c *DeviceCache) add(deviceInfo DeviceInfo) {
+	if deviceInfo.DriverKey == "" || !strings.HasPrefix(strings.ToUpper(deviceInfo.InstanceID), `USB\`) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.driverKeys[deviceInfo.DriverKey] = deviceInfo.InstanceID
+}
+
+// トポロジーなどを追加した接続中のデバイスの情報を記録
+func (c *DeviceCache) store(deviceInfo DeviceInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.devices[strings.ToUpper(deviceInfo.InstanceID)] = deviceInfo
+}
+
+// 起動時に接続されているデバイス（インスタンスID → 監視するデバイスの種類）の情報を読み取って記録
+// 接続イベントを出力しないデバイスも、切断イベントに情報を含めるため
+// presentを指定した場合は、デバイスごとにPresentイベントを出力（監視の終了でキャンセルされたら途中で戻る）
+func (c *DeviceCache) preload(ctx context.Context, snapshot map[string]string, present bool) {
+	for instanceID, watchClass := range snapshot {
+		if ctx.Err() != nil {
+			return
+		}
+		deviceInfo, err := getDeviceInfo(instanceID)
+		if err != nil {
+			continue
+		}
+		setDriverInfo(&deviceInfo)
+		enrichDeviceInfo(&deviceInfo)
+		if present {
+			emitPresent(DeviceEvent{Action: "Present", HostName: getHostName(), WatchClass: watchClass, Source: sourceStartup, Device: deviceInfo})
+		}
+	}
+}
+
+// 切断されたデバイスをキャッシュから削除し、接続時に記録した情報を返す
+func (c *DeviceCache) remove(instanceID string) (DeviceInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for driverKey, cached := range c.driverKeys {
+		if strings.EqualFold(cached, instanceID) {
+			delete(c.driverKeys, driverKey)
+		}
+	}
+	key := strings.ToUpper(instanceID)
+	deviceInfo, ok := c.devices[key]
+	delete(c.devices, key)
+	return deviceInfo, ok
+}
+
+// 接続中のデバイスの接続時に記録した情報
+func (c *DeviceCache) lookup(instanceID string) (DeviceInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deviceInfo, ok := c.devices[strings.ToUpper(instanceID)]
+	return deviceInfo, ok
+}
+
+// 接続中のデバイスのシリアル番号（エラーの報告から取り除くため、短すぎるものは除く）
+func (c *DeviceCache) serials() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var serials []string
+	for _, deviceInfo := range c.devices {
+		if len(deviceInfo.SerialNumber) >= 4 {
+			serials = append(serials, deviceInfo.SerialNumber)
+		}
+	}
+	return serials
+}
+
+// すべてのUSBデバイスを列挙してキャッシュを作り直す
+func (c *DeviceCache) rebuild() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rebuildLocked()
+}
+
+func (c *DeviceCache) rebuildLocked() {
+	c.driverKeys = getUSBDriverKeys()
+	c.built = true
+}
+
+// キャッシュで解決できた回数と、列挙し直した回数
+func (c *DeviceCache) stats() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// デバイスの種類（イベントの種類として出力し、種類ごとに重大度を設定できる）
+const (
+	deviceTypeGeneric         = "Generic"
+	deviceTypeSmartCardReader = "SmartCardReader"
+	deviceTypeCamera          = "Camera"
+	deviceTypeAudio           = "Audio"
+	deviceTypeNetworkAdapter  = "NetworkAdapter"
+	deviceTypePhone           = "Phone"
+	deviceTypeSecurityKey     = "SecurityKey"
+	deviceTypePrinter         = "Printer"
+	deviceTypeScanner         = "Scanner"
+	deviceTypeBluetoothRadio  = "BluetoothRadio"
+	deviceTypeBluetoothDevice = "BluetoothDevice"
+)
+
+// Bluetoothで接続されたデバイスの親devnodeのインスタンスIDの先頭部分
+var bluetoothEnumerators = []string{`BTHENUM\`, `BTHLEDEVICE\`, `BTHHFENUM\`}
+
+// FIDO AllianceのUsage Page（FIDO / U2Fのセキュリティキー）
+const fidoUsagePage = 0xF1D0
+
+// セキュリティキーとして知られているベンダーID（VID）、またはベンダーID・プロダクトID（VID:PID）
+var securityKeyIDs = map[string]bool{
+	// Yubico
+	"1050": true,
+	// Feitian
+	"096E": true,
+	// Google Titan Security Key
+	"18D1:5026": true,
+	// SoloKeys
+	"0483:A2CA": true,
+	"1209:5070": true,
+	// Nitrokey FIDO2
+	"20A0:42B1": true,
+}
+
+// インスタンスIDからベンダーID・プロダクトIDを取り出す正規表現（例: USB\VID_1050&PID_0407\...）
+var vidPidPattern = regexp.MustCompile(`VID_([0-9A-F]{4})&PID_([0-9A-F]{4})`)
+
+// イベントの重大度
+const (
+	severityInfo     = "info"
+	severityNotice   = "notice"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+// デバイスの種類ごとの重大度の既定値（設定ファイルで上書きできる）
+var defaultSeverities = map[string]string{
+	// 規制の厳しい環境では、想定外のカードリーダーはスキミング機器の可能性がある
+	deviceTypeSmartCardReader: severityWarning,
+	// プライバシーを重視する環境では、許可されていないカメラの接続を把握したい
+	deviceTypeCamera: severityNotice,
+	// USB経由のネットワークアダプターは、エアギャップされたマシンを外部ネットワークにつなぐ可能性がある
+	deviceTypeNetworkAdapter: severityCritical,
+	// スマートフォンへの写真・ファイル転送はよくある持ち出し経路
+	deviceTypePhone: severityWarning,
+	// 管理されていないBluetoothドングルの接続は、多くの環境でポリシー違反になる
+	deviceTypeBluetoothRadio: severityWarning,
+}
+
+// デバイス自身とインターフェース・配下のdevnodeのセットアップクラス名から、デバイスの種類を判定
+func classifyDevice(deviceInfo DeviceInfo) string {
+	classes := deviceClasses(deviceInfo)
+	services := deviceServices(deviceInfo)
+	switch {
+	// USB接続のBluetoothアダプター（ドングル）
+	case classes["bluetooth"] || services["bthusb"]:
+		return deviceTypeBluetoothRadio
+	// Bluetoothアダプター経由で接続されたHIDデバイスなど
+	case isBluetoothAttached(deviceInfo):
+		return deviceTypeBluetoothDevice
+	// FIDO / U2Fのセキュリティキー（常に許可しつつ監査したい）
+	case isSecurityKey(deviceInfo):
+		return deviceTypeSecurityKey
+	// 親がUSBのネットワークアダプター（RNDIS / ECM アダプター、テザリング中のスマートフォン）
+	case classes["net"] && isUSBDevice(deviceInfo):
+		return deviceTypeNetworkAdapter
+	// MTP / PTPモードで接続されたスマートフォン（Windows Portable Devicesクラス）
+	case classes["wpd"]:
+		return deviceTypePhone
+	case classes["smartcardreader"]:
+		return deviceTypeSmartCardReader
+	// Windows 10以降のWebカメラはCameraクラス、それ以前はImageクラスでUSB Video Classドライバを使用
+	case classes["camera"] || services["usbvideo"]:
+		return deviceTypeCamera
+	// USB Audio Class 1.0 / 2.0のドライバ、またはMEDIAクラスのオーディオエンドポイント
+	case services["usbaudio"] || services["usbaudio2"] || classes["audioendpoint"]:
+		return deviceTypeAudio
+	// 管理された印刷基盤を経由しないローカルプリンター
+	case classes["printer"] || services["usbprint"]:
+		return deviceTypePrinter
+	// Webカメラ以外のImageクラスはスキャナー（Still Imageドライバ）
+	case services["usbscan"] || classes["image"]:
+		return deviceTypeScanner
+	}
+	return deviceTypeGeneric
+}
+
+// FIDOのUsage Pageを持つ、またはセキュリティキーとして知られているVID/PIDのデバイスかを判定
+func isSecurityKey(deviceInfo DeviceInfo) bool {
+	for _, usage := range deviceInfo.HIDUsages {
+		if usage.UsagePage == fidoUsagePage {
+			return true
+		}
+	}
+	vid, pid := parseVIDPID(deviceInfo.InstanceID)
+	return vid != "" && (securityKeyIDs[vid] || securityKeyIDs[vid+":"+pid])
+}
+
+// インスタンスIDからベンダーID・プロダクトIDを取り出す
+func parseVIDPID(instanceID string) (string, string) {
+	match := vidPidPattern.FindStringSubmatch(strings.ToUpper(instanceID))
+	if match == nil {
+		return "", ""
+	}
+	return match[1], match[2]
+}
+
+// Bluetoothアダプター経由で接続されたデバイスかを判定
+func isBluetoothAttached(deviceInfo DeviceInfo) bool {
+	for _, prefix := range bluetoothEnumerators {
+		if strings.HasPrefix(deviceInfo.InstanceID, prefix) || strings.HasPrefix(deviceInfo.ParentID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// USBバスに接続されたデバイス（またはその子devnode）かを判定
+func isUSBDevice(deviceInfo DeviceInfo) bool {
+	return strings.HasPrefix(deviceInfo.InstanceID, `USB\`) || strings.HasPrefix(deviceInfo.ParentID, `USB\`)
+}
+
+// デバイス自身とインターフェース・配下のdevnodeのセットアップクラス名（小文字）の集合
+func deviceClasses(deviceInfo DeviceInfo) map[string]bool {
+	classes := map[string]bool{strings.ToLower(deviceInfo.Class): true}
+	for _, iface := range deviceInfo.Interfaces {
+		classes[strings.ToLower(iface.Class)] = true
+		for _, function := range iface.Functions {
+			classes[strings.ToLower(function)] = true
+		}
+	}
+	return classes
+}
+
+// デバイス自身とインターフェースのドライバのサービス名（小文字）の集合
+func deviceServices(deviceInfo DeviceInfo) map[string]bool {
+	services := map[string]bool{strings.ToLower(deviceInfo.Service): true}
+	for _, iface := range deviceInfo.Interfaces {
+		services[strings.ToLower(iface.Service)] = true
+	}
+	return services
+}
+
+// デバイスの種類に対応する重大度を返す
+func severityFor(severities map[string]string, deviceType string) string {
+	if severity, ok := severities[deviceType]; ok {
+		return severity
+	}
+	if severity, ok := defaultSeverities[deviceType]; ok {
+		return severity
+	}
+	return severityInfo
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import "testing"
+
+func TestParseVIDPID(t *testing.T) {
+	tests := []struct {
+		instanceID string
+		vid        string
+		pid        string
+	}{
+		{`USB\VID_1050&PID_0407\5&2C0E7D7&0&2`, "1050", "0407"},
+		{`usb\vid_046d&pid_c52b\5&2c0e7d7&0&2`, "046D", "C52B"},
+		{`HID\VID_046D&PID_C31C&MI_00\7&1A2B3C4D&0&0000`, "046D", "C31C"},
+		{`USBSTOR\DISK&VEN_SANDISK&PROD_ULTRA&REV_1.00\4C530001230412345678&0`, "", ""},
+		{`USB\VID_12&PID_34\1`, "", ""},
+		{``, "", ""},
+	}
+	for _, test := range tests {
+		vid, pid := parseVIDPID(test.instanceID)
+		if vid != test.vid || pid != test.pid {
+			t.Errorf("parseVIDPID(%q) = %q, %q, want %q, %q", test.instanceID, vid, pid, test.vid, test.pid)
+		}
+	}
+}
+
+func TestClassifyDevice(t *testing.T) {
+	tests := []struct {
+		name string
+		info DeviceInfo
+		want string
+	}{
+		{
+			name: "smart card reader",
+			info: DeviceInfo{InstanceID: `USB\VID_076B&PID_3031\5&1`, Class: "SmartCardReader"},
+			want: deviceTypeSmartCardReader,
+		},
+		{
+			name: "mass storage",
+			info: DeviceInfo{InstanceID: `USB\VID_0781&PID_5581\4C530001230412345678`, Class: "USB", Service: "USBSTOR"},
+			want: deviceTypeGeneric,
+		},
+		{
+			name: "webcam",
+			info: DeviceInfo{InstanceID: `USB\VID_046D&PID_085E\5&1`, Class: "USB", Service: "usbccgp", Interfaces: []DeviceInterface{
+				{InstanceID: `USB\VID_046D&PID_085E&MI_00\6&1`, Class: "Image", Service: "usbvideo"},
+				{InstanceID: `USB\VID_046D&PID_085E&MI_02\6&1`, Class: "MEDIA", Service: "usbaudio", Functions: []string{"AudioEndpoint"}},
+			}},
+			want: deviceTypeCamera,
+		},
+		{
+			name: "windows 10 camera",
+			info: DeviceInfo{InstanceID: `USB\VID_04F2&PID_B6DD\5&1`, Class: "Camera"},
+			want: deviceTypeCamera,
+		},
+		{
+			name: "headset",
+			info: DeviceInfo{InstanceID: `USB\VID_046D&PID_0A44\5&1`, Class: "MEDIA", Service: "usbaudio"},
+			want: deviceTypeAudio,
+		},
+		{
+			name: "usb audio 2.0",
+			info: DeviceInfo{InstanceID: `USB\VID_1235&PID_8211\5&1`, Class: "MEDIA", Service: "usbaudio2"},
+			want: deviceTypeAudio,
+		},
+		{
+			name: "usb network adapter",
+			info: DeviceInfo{InstanceID: `USB\VID_0B95&PID_1790\5&1`, Class: "Net"},
+			want: deviceTypeNetworkAdapter,
+		},
+		{
+			name: "pci network adapter",
+			info: DeviceInfo{InstanceID: `PCI\VEN_8086&DEV_15F3\3&1`, Class: "Net"},
+			want: deviceTypeGeneric,
+		},
+		{
+			name: "tethered phone",
+			info: DeviceInfo{InstanceID: `USB\VID_04E8&PID_6860\5&1`, Class: "USB", Service: "usbccgp", Interfaces: []DeviceInterface{
+				{InstanceID: `USB\VID_04E8&PID_6860&MI_00\6&1`, Class: "Net", Service: "usb_rndisx"},
+			}},
+			want: deviceTypeNetworkAdapter,
+		},
+		{
+			name: "mtp phone",
+			info: DeviceInfo{InstanceID: `USB\VID_05AC&PID_12A8\5&1`, Class: "WPD"},
+			want: deviceTypePhone,
+		},
+		{
+			name: "yubikey by vid",
+			info: DeviceInfo{InstanceID: `USB\VID_1050&PID_0407\5&1`, Class: "USB"},
+			want: deviceTypeSecurityKey,
+		},
+		{
+			name: "titan by vid and pid",
+			info: DeviceInfo{InstanceID: `USB\VID_18D1&PID_5026\5&1`, Class: "USB"},
+			want: deviceTypeSecurityKey,
+		},
+		{
+			name: "other google device",
+			info: DeviceInfo{InstanceID: `USB\VID_18D1&PID_4EE1\5&1`, Class: "USB"},
+			want: deviceTypeGeneric,
+		},
+		{
+			name: "fido usage page",
+			info: DeviceInfo{InstanceID: `USB\VID_ABCD&PID_0001\5&1`, Class: "USB", HIDUsages: []HIDUsage{{UsagePage: fidoUsagePage, Usage: 0x01}}},
+			want: deviceTypeSecurityKey,
+		},
+		{
+			name: "printer",
+			info: DeviceInfo{InstanceID: `USB\VID_03F0&PID_0C17\5&1`, Class: "USB", Interfaces: []DeviceInterface{
+				{InstanceID: `USB\VID_03F0&PID_0C17&MI_00\6&1`, Class: "USB", Service: "usbprint"},
+			}},
+			want: deviceTypePrinter,
+		},
+		{
+			name: "scanner",
+			info: DeviceInfo{InstanceID: `USB\VID_04B8&PID_0142\5&1`, Class: "Image", Service: "usbscan"},
+			want: deviceTypeScanner,
+		},
+		{
+			name: "bluetooth dongle",
+			info: DeviceInfo{InstanceID: `USB\VID_8087&PID_0029\5&1`, Class: "Bluetooth", Service: "BTHUSB"},
+			want: deviceTypeBluetoothRadio,
+		},
+		{
+			name: "bluetooth keyboard",
+			info: DeviceInfo{InstanceID: `HID\{00001124-0000-1000-8000-00805F9B34FB}_VID&0002046D_PID&B342\8&1`, Class: "HIDClass", ParentID: `BTHENUM\{00001124-0000-1000-8000-00805F9B34FB}_VID&0002046D_PID&B342\7&1`},
+			want: deviceTypeBluetoothDevice,
+		},
+	}
+	fake := useFakeDeviceAPI(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake.plug(usbDeviceInterfaceGuid, test.info)
+			info, err := deviceAPI.properties(test.info.InstanceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := classifyDevice(info); got != test.want {
+				t.Errorf("classifyDevice() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSeverityFor(t *testing.T) {
+	configured := map[string]string{deviceTypeSmartCardReader: severityCritical}
+	tests := []struct {
+		deviceType string
+		want       string
+	}{
+		{deviceTypeSmartCardReader, severityCritical},
+		{deviceTypeGeneric, severityInfo},
+		{deviceTypeCamera, severityNotice},
+		{deviceTypeNetworkAdapter, severityCritical},
+		{deviceTypePhone, severityWarning},
+		{deviceTypeBluetoothRadio, severityWarning},
+	}
+	for _, test := range tests {
+		if got := severityFor(configured, test.deviceType); got != test.want {
+			t.Errorf("severityFor(%s) = %s, want %s", test.deviceType, got, test.want)
+		}
+	}
+}
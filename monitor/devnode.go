@@ -0,0 +1,313 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// デバイスツリー（devnode）を操作するAPI群を提供するcfgmgr32.dllから関数をロード
+var (
+	cfgmgr32 = syscall.NewLazyDLL("cfgmgr32.dll")
+	// インスタンスIDからdevnodeを取得
+	procCM_Locate_DevNodeW = cfgmgr32.NewProc("CM_Locate_DevNodeW")
+	// devnodeの親を取得
+	procCM_Get_Parent = cfgmgr32.NewProc("CM_Get_Parent")
+	// devnodeの最初の子を取得
+	procCM_Get_Child = cfgmgr32.NewProc("CM_Get_Child")
+	// devnodeの次の兄弟を取得
+	procCM_Get_Sibling = cfgmgr32.NewProc("CM_Get_Sibling")
+	// devnodeのインスタンスIDを取得
+	procCM_Get_Device_IDW = cfgmgr32.NewProc("CM_Get_Device_IDW")
+	// devnodeの状態と問題コードを取得
+	procCM_Get_DevNode_Status = cfgmgr32.NewProc("CM_Get_DevNode_Status")
+	// devnodeのプロパティを取得
+	procCM_Get_DevNode_Registry_PropertyW = cfgmgr32.NewProc("CM_Get_DevNode_Registry_PropertyW")
+	// devnodeのプロパティ（DEVPROPKEYで指定）を取得
+	procCM_Get_DevNode_PropertyW = cfgmgr32.NewProc("CM_Get_DevNode_PropertyW")
+)
+
+// CfgMgr32で使用される定数
+const (
+	// 成功を示す戻り値（CONFIGRET）
+	CR_SUCCESS = 0x00000000
+	// 現在存在するdevnodeを検索するフラグ
+	CM_LOCATE_DEVNODE_NORMAL = 0x00000000
+	// 切断されたデバイス（過去に接続されたことのあるデバイス）のdevnodeも検索するフラグ
+	CM_LOCATE_DEVNODE_PHANTOM = 0x00000001
+	// デバイスの説明を取得するプロパティ
+	CM_DRP_DEVICEDESC = 0x00000001
+	// デバイスのドライバのサービス名（例: usbvideo）を取得するプロパティ
+	CM_DRP_SERVICE = 0x00000005
+	// デバイスのセットアップクラス名（例: HIDClass, Keyboard）を取得するプロパティ
+	CM_DRP_CLASS = 0x00000008
+	// 複合デバイス（Composite Device）のドライバのサービス名
+	compositeDeviceService = "usbccgp"
+	// devnodeに問題があることを示す状態フラグ
+	DN_HAS_PROBLEM = 0x00000400
+	// 接続後に問題が発生しないかを監視する時間
+	problemWatchDuration = 30 * time.Second
+	// 問題が発生しないかを確認する間隔
+	problemCheckInterval = time.Second
+)
+
+// デバイスマネージャーに表示される問題コード（CM_PROB_*）の説明
+var problemDescriptions = map[uint32]string{
+	1:  "device is not configured",
+	3:  "driver may be corrupted or out of memory",
+	10: "device cannot start",
+	12: "not enough free resources",
+	14: "restart required",
+	18: "drivers need to be reinstalled",
+	19: "registry configuration is incomplete or damaged",
+	21: "device is being removed",
+	22: "device is disabled",
+	24: "device is not present or not working properly",
+	28: "drivers are not installed",
+	29: "device is disabled by firmware",
+	31: "device is not working properly",
+	32: "driver service is disabled",
+	37: "driver failed to initialize",
+	38: "previous driver instance is still in memory",
+	39: "driver is corrupted or missing",
+	41: "driver loaded but device was not found",
+	43: "device reported a problem and was stopped",
+	45: "device is not connected",
+	47: "device is prepared for safe removal",
+	48: "driver is blocked from starting",
+	52: "driver signature cannot be verified",
+}
+
+// 問題コードの表示用の文字列（例: Code 43 (device reported a problem and was stopped)）
+func problemDescription(code uint32) string {
+	if description, ok := problemDescriptions[code]; ok {
+		return fmt.Sprintf("Code %d (%s)", code, description)
+	}
+	return fmt.Sprintf("Code %d", code)
+}
+
+// 複合デバイスの子インターフェース
+type DeviceInterface struct {
+	// インターフェースのインスタンスID（例: USB\VID_046D&PID_C52B&MI_00\7&1A2B3C4D&0&0000）
+	InstanceID string
+	// インターフェースのセットアップクラス名（例: HIDClass）
+	Class string
+	// インターフェースの説明
+	Description string
+	// インターフェースのドライバのサービス名（例: usbvideo）
+	Service string
+	// インターフェースの配下に作成された機能のクラス名（例: Keyboard, Mouse）
+	Functions []string
+}
+
+// 複合デバイスの場合、子インターフェースの一覧を設定
+func setInterfaces(deviceInfo *DeviceInfo) {
+	if deviceInfo.Service != compositeDeviceService {
+		return
+	}
+	devInst, err := locateDevNode(deviceInfo.InstanceID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, child := range getChildDevNodes(devInst) {
+		iface := DeviceInterface{
+			InstanceID:  getDevNodeID(child),
+			Class:       getDevNodeProperty(child, CM_DRP_CLASS),
+			Description: getDevNodeProperty(child, CM_DRP_DEVICEDESC),
+			Service:     getDevNodeProperty(child, CM_DRP_SERVICE),
+		}
+		iface.Functions = getDescendantClasses(child)
+		deviceInfo.Interfaces = append(deviceInfo.Interfaces, iface)
+	}
+}
+
+// 親devnode（ハブ・複合デバイス）と、同じ親を持つ兄弟devnodeを設定
+func setDeviceTree(deviceInfo *DeviceInfo) {
+	devInst, err := locateDevNode(deviceInfo.InstanceID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	parent, ok := getParentDevNode(devInst)
+	if !ok {
+		return
+	}
+	deviceInfo.ParentID = getDevNodeID(parent)
+	for _, sibling := range getChildDevNodes(parent) {
+		if sibling != devInst {
+			deviceInfo.Siblings = append(deviceInfo.Siblings, getDevNodeID(sibling))
+		}
+	}
+}
+
+// デバイスに問題がある場合、問題コードを設定
+func setProblemCode(deviceInfo *DeviceInfo) {
+	code, err := deviceAPI.problemCode(deviceInfo.InstanceID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	deviceInfo.ProblemCode = code
+}
+
+// 接続後しばらくの間、デバイスが問題のある状態に変化しないかを監視
+// 問題が発生した場合は追加のイベントを出力（監視の終了でキャンセルされたら戻る）
+func watchProblemState(ctx context.Context, event DeviceEvent) {
+	deadline := time.Now().Add(problemWatchDuration)
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(problemCheckInterval):
+		case <-ctx.Done():
+			return
+		}
+		// 切断された場合は監視を終了
+		code, err := deviceAPI.problemCode(event.Device.InstanceID)
+		if err != nil {
+			return
+		}
+		if code == event.Device.ProblemCode {
+			continue
+		}
+		event.Action = "Problem"
+		event.Device.ProblemCode = code
+		recorder.recordEvent(event)
+		logDeviceEvent(event)
+		return
+	}
+}
+
+// devnodeの問題コードを取得（問題がない場合は0）
+func getProblemCode(devInst uint32) (uint32, bool) {
+	var status, problem uint32
+	ret, _, _ := procCM_Get_DevNode_Status.Call(
+		uintptr(unsafe.Pointer(&status)),
+		uintptr(unsafe.Pointer(&problem)),
+		uintptr(devInst),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return 0, false
+	}
+	if status&DN_HAS_PROBLEM == 0 {
+		return 0, true
+	}
+	return problem, true
+}
+
+// devnodeの配下にあるすべてのdevnodeのクラス名を重複なく取得
+func getDescendantClasses(devInst uint32) []string {
+	var classes []string
+	seen := map[string]bool{}
+	var walk func(uint32)
+	walk = func(parent uint32) {
+		for _, child := range getChildDevNodes(parent) {
+			class := getDevNodeProperty(child, CM_DRP_CLASS)
+			if class != "" && !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+			walk(child)
+		}
+	}
+	walk(devInst)
+	return classes
+}
+
+// インスタンスIDからdevnodeを取得
+func locateDevNode(instanceID string) (uint32, error) {
+	return locateDevNodeWithFlags(instanceID, CM_LOCATE_DEVNODE_NORMAL)
+}
+
+// インスタンスIDから、指定したフラグでdevnodeを検索
+func locateDevNodeWithFlags(instanceID string, flags uintptr) (uint32, error) {
+	id, err := windows.UTF16PtrFromString(instanceID)
+	if err != nil {
+		return 0, err
+	}
+	var devInst uint32
+	err = callCfgMgr(procCM_Locate_DevNodeW,
+		uintptr(unsafe.Pointer(&devInst)),
+		uintptr(unsafe.Pointer(id)),
+		flags,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to locate devnode %s: %w", instanceID, err)
+	}
+	return devInst, nil
+}
+
+// インスタンスIDのdevnodeから親を順にたどり、祖先のインスタンスIDを近い順に取得
+func getAncestorIDs(instanceID string) []string {
+	devInst, err := locateDevNode(instanceID)
+	if err != nil {
+		return nil
+	}
+	var ancestors []string
+	for {
+		parent, ok := getParentDevNode(devInst)
+		if !ok {
+			return ancestors
+		}
+		ancestors = append(ancestors, getDevNodeID(parent))
+		devInst = parent
+	}
+}
+
+// devnodeの親を取得
+func getParentDevNode(devInst uint32) (uint32, bool) {
+	var parent uint32
+	ret, _, _ := procCM_Get_Parent.Call(uintptr(unsafe.Pointer(&parent)), uintptr(devInst), 0)
+	return parent, ret == CR_SUCCESS
+}
+
+// devnodeの子を順に取得
+func getChildDevNodes(devInst uint32) []uint32 {
+	var children []uint32
+	var child uint32
+	ret, _, _ := procCM_Get_Child.Call(uintptr(unsafe.Pointer(&child)), uintptr(devInst), 0)
+	for ret == CR_SUCCESS {
+		children = append(children, child)
+		ret, _, _ = procCM_Get_Sibling.Call(uintptr(unsafe.Pointer(&child)), uintptr(child), 0)
+	}
+	return children
+}
+
+// devnodeのインスタンスIDを取得
+func getDevNodeID(devInst uint32) string {
+	var buffer [256]uint16
+	ret, _, _ := procCM_Get_Device_IDW.Call(
+		uintptr(devInst),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(len(buffer)),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return ""
+	}
+	return strings.ToUpper(windows.UTF16ToString(buffer[:]))
+}
+
+// devnodeのプロパティ（文字列）を取得
+func getDevNodeProperty(devInst uint32, property uint32) string {
+	var buffer [256]uint16
+	regDataType := uint32(0)
+	length := uint32(len(buffer) * 2)
+	ret, _, _ := procCM_Get_DevNode_Registry_PropertyW.Call(
+		uintptr(devInst),
+		uintptr(property),
+		uintptr(unsafe.Pointer(&regDataType)),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(unsafe.Pointer(&length)),
+		0,
+	)
+	if ret != CR_SUCCESS {
+		return ""
+	}
+	return windows.UTF16ToString(buffer[:])
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchProblemState(t *testing.T) {
+	const instanceID = `USB\VID_0781&PID_5581\4C530001230412345678`
+	tests := []struct {
+		name string
+		// 監視を始めた後のデバイスの変化
+		change func(fake *FakeDeviceAPI)
+		// Problemのイベントが出力されるかどうか
+		wantEvent bool
+		// 出力されるイベントの問題コード
+		wantCode uint32
+	}{
+		{
+			name:      "problem",
+			change:    func(fake *FakeDeviceAPI) { fake.setProblemCode(instanceID, 28) },
+			wantEvent: true,
+			wantCode:  28,
+		},
+		{
+			name:   "removed",
+			change: func(fake *FakeDeviceAPI) { fake.unplug(instanceID) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := useFakeDeviceAPI(t)
+			sink := useRecordingSink(t)
+			fake.plugInstance(instanceID)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				watchProblemState(context.Background(), DeviceEvent{Action: "Arrival", Device: DeviceInfo{InstanceID: instanceID}})
+			}()
+			test.change(fake)
+
+			select {
+			case <-done:
+			case <-time.After(5 * problemCheckInterval):
+				t.Fatal("watchProblemState did not return")
+			}
+			sinkSends.Wait()
+			event, ok := sink.next(0)
+			switch {
+			case ok && !test.wantEvent:
+				t.Errorf("unexpected event %s", event.Action)
+			case !ok && test.wantEvent:
+				t.Error("no Problem event")
+			case ok && (event.Action != "Problem" || event.Device.ProblemCode != test.wantCode):
+				t.Errorf("event = %s (ProblemCode=%d), want Problem (ProblemCode=%d)", event.Action, event.Device.ProblemCode, test.wantCode)
+			}
+		})
+	}
+}
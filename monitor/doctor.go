@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// 診断結果の状態
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+// 1項目の診断結果
+type doctorResult struct {
+	// 診断した項目（例: DLL exports）
+	Name string
+	// PASS / WARN / FAIL
+	Status string
+	// 結果の詳細と、失敗した場合の対処方法
+	Detail string
+}
+
+// 監視に使用するWindows APIの関数（mkwinsyscallで生成したスタブ）
+var doctorStubProcs = []*windows.LazyProc{
+	procRegisterClassExW,
+	procCreateWindowExW,
+	procDefWindowProcW,
+	procGetMessageW,
+	procTranslateMessage,
+	procDispatchMessageW,
+	procRegisterDeviceNotificationW,
+	procUnregisterDeviceNotification,
+	procSetTimer,
+	procKillTimer,
+	procPostQuitMessage,
+	procSendMessageW,
+}
+
+// 監視に使用するWindows APIの関数
+var doctorProcs = []*syscall.LazyProc{
+	procCM_Locate_DevNodeW,
+	procCM_Get_Parent,
+	procCM_Get_Child,
+	procCM_Get_Sibling,
+	procCM_Get_Device_IDW,
+	procCM_Get_DevNode_Status,
+	procCM_Get_DevNode_Registry_PropertyW,
+	procCM_Get_DevNode_PropertyW,
+	procCM_Request_Device_EjectW,
+	procHidD_GetPreparsedData,
+	procHidD_FreePreparsedData,
+	procHidP_GetCaps,
+	procGetUserDefaultLocaleName,
+}
+
+// `usbmon doctor` サブコマンド
+// 監視に必要な環境が整っているかを確認し、項目ごとの合否を出力
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file to check")
+	fs.Parse(args)
+
+	var results []doctorResult
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		results = append(results, doctorResult{"Config", doctorFail, err.Error()})
+	} else {
+		results = append(results, doctorResult{"Config", doctorPass, fmt.Sprintf("watch classes: %s", strings.Join(cfg.WatchClasses, ", "))})
+	}
+	results = append(results, checkProcs())
+	results = append(results, checkSession())
+	results = append(results, checkNotifications(cfg)...)
+	results = append(results, checkHostControllers())
+
+	failed := false
+	for _, result := range results {
+		fmt.Printf("[%s] %s: %s\n", result.Status, result.Name, result.Detail)
+		if result.Status == doctorFail {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// 使用するDLLと関数がこのバージョンのWindowsに存在するかを確認
+func checkProcs() doctorResult {
+	var missing []string
+	for _, proc := range doctorStubProcs {
+		if err := proc.Find(); err != nil {
+			missing = append(missing, proc.Name)
+		}
+	}
+	for _, proc := range doctorProcs {
+		if err := proc.Find(); err != nil {
+			missing = append(missing, proc.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return doctorResult{"DLL exports", doctorFail, "missing " + strings.Join(missing, ", ")}
+	}
+	return doctorResult{"DLL exports", doctorPass, fmt.Sprintf("%d functions found", len(doctorStubProcs)+len(doctorProcs))}
+}
+
+// サービスとして実行されている（セッション0）かを確認
+func checkSession() doctorResult {
+	var sessionID uint32
+	if err := windows.ProcessIdToSessionId(windows.GetCurrentProcessId(), &sessionID); err != nil {
+		return doctorResult{"Session", doctorWarn, fmt.Sprintf("Failed to get session ID: %v", err)}
+	}
+	if sessionID == 0 {
+		return doctorResult{"Session", doctorWarn, "running in session 0 (non-interactive service session); notifications still work, but nothing can be shown to the user"}
+	}
+	return doctorResult{"Session", doctorPass, fmt.Sprintf("interactive session %d", sessionID)}
+}
+
+// ウィンドウクラスの登録、ウィンドウの作成、監視するデバイスの種類ごとの通知の登録を確認
+func checkNotifications(cfg Config) []doctorResult {
+	hWnd, err := createNotificationWindow(nil)
+	if err != nil {
+		return []doctorResult{{"Window", doctorFail, err.Error() + " (another usbmon may hold the window class, or the process has no desktop)"}}
+	}
+	results := []doctorResult{{"Window", doctorPass, "window class registered and window created"}}
+	classes, _ := notificationClasses(cfg)
+	for _, watchClass := range classes {
+		name := "Notification " + watchClass
+		if err := registerDeviceNotification(hWnd, watchClass); err != nil {
+			results = append(results, doctorResult{name, doctorFail, err.Error()})
+			continue
+		}
+		results = append(results, doctorResult{name, doctorPass, "RegisterDeviceNotification succeeded"})
+	}
+	return results
+}
+
+// USBホストコントローラーが見つかるかを確認
+func checkHostControllers() doctorResult {
+	controllers, err := windows.CM_Get_Device_Interface_List("", &usbHostControllerGuid, windows.CM_GET_DEVICE_INTERFACE_LIST_PRESENT)
+	if err != nil {
+		return doctorResult{"USB host controllers", doctorFail, fmt.Sprintf("Failed to list host controllers: %v", err)}
+	}
+	if len(controllers) == 0 {
+		return doctorResult{"USB host controllers", doctorWarn, "no USB host controllers found; topology and port information will be unavailable"}
+	}
+	return doctorResult{"USB host controllers", doctorPass, fmt.Sprintf("%d found", len(controllers))}
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// ドライバの情報が格納されているレジストリキー（ドライバのキー名を連結して使用）
+	driverClassKeyPath = `SYSTEM\CurrentControlSet\Control\Class\`
+	// ドライバのインストール完了を待つ時間
+	driverInstallTimeout = 10 * time.Minute
+	// デバイスが構成されていないことを示す問題コード
+	CM_PROB_NOT_CONFIGURED = 1
+	// ドライバがインストールされていないことを示す問題コード
+	CM_PROB_FAILED_INSTALL = 28
+)
+
+// ドライバのインストールが完了していないデバイス
+type PendingDrivers struct {
+	mu sync.Mutex
+	// インスタンスIDごとの接続イベント
+	events map[string]DeviceEvent
+	// インスタンスIDごとの接続時刻
+	arrivedAt map[string]time.Time
+}
+
+// メッセージループとデバイスごとのゴルーチンで共有する、ドライバのインストール待ちの一覧
+var pendingDrivers = &PendingDrivers{
+	events:    map[string]DeviceEvent{},
+	arrivedAt: map[string]time.Time{},
+}
+
+// デバイスにバインドされたドライバの情報
+type DriverInfo struct {
+	// ドライバの提供元（INFのProvider）
+	Provider string
+	// ドライバのバージョン（例: 10.0.19041.1）
+	Version string
+	// ドライバの日付（例: 6-21-2006）
+	Date string
+	// ドライバのインストールに使用されたINFファイル（例: usbstor.inf）
+	InfPath string
+}
+
+// ドライバのキー名からドライバの情報を設定
+func setDriverInfo(deviceInfo *DeviceInfo) {
+	if deviceInfo.DriverKey == "" {
+		return
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, driverClassKeyPath+deviceInfo.DriverKey, registry.QUERY_VALUE)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+
+	deviceInfo.Driver.Provider, _, _ = key.GetStringValue("ProviderName")
+	deviceInfo.Driver.Version, _, _ = key.GetStringValue("DriverVersion")
+	deviceInfo.Driver.Date, _, _ = key.GetStringValue("DriverDate")
+	deviceInfo.Driver.InfPath, _, _ = key.GetStringValue("InfPath")
+}
+
+// 接続時点でドライバのインストールが完了していないかを判定
+func needsDriverInstall(deviceInfo DeviceInfo) bool {
+	if deviceInfo.DriverKey == "" || deviceInfo.Service == "" {
+		return true
+	}
+	return deviceInfo.ProblemCode == CM_PROB_NOT_CONFIGURED || deviceInfo.ProblemCode == CM_PROB_FAILED_INSTALL
+}
+
+// ドライバのインストール待ちに追加
+func (p *PendingDrivers) add(event DeviceEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events[event.Device.InstanceID] = event
+	p.arrivedAt[event.Device.InstanceID] = time.Now()
+}
+
+// ドライバのインストール待ちから削除（切断された場合）
+func (p *PendingDrivers) remove(instanceID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.events, instanceID)
+	delete(p.arrivedAt, instanceID)
+}
+
+// devnodeが変化したときに、ドライバのインストールが完了したデバイスのイベントを出力
+func (p *PendingDrivers) check() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for instanceID, event := range p.events {
+		if time.Since(p.arrivedAt[instanceID]) > driverInstallTimeout {
+			delete(p.events, instanceID)
+			delete(p.arrivedAt, instanceID)
+			continue
+		}
+		deviceInfo, err := getDeviceInfo(instanceID)
+		if err != nil {
+			continue
+		}
+		setProblemCode(&deviceInfo)
+		if needsDriverInstall(deviceInfo) {
+			continue
+		}
+		setDriverInfo(&deviceInfo)
+		// 接続時に取得したトポロジーなどの情報は引き継ぎ、ドライバに関する情報だけを更新
+		event.Action = "DriverInstalled"
+		event.Device.Service = deviceInfo.Service
+		event.Device.DriverKey = deviceInfo.DriverKey
+		event.Device.Driver = deviceInfo.Driver
+		event.Device.ProblemCode = deviceInfo.ProblemCode
+		recorder.recordEvent(event)
+		logDeviceEvent(event)
+		delete(p.events, instanceID)
+		delete(p.arrivedAt, instanceID)
+	}
+}
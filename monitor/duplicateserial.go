@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 安価なデバイスや偽造品がよく使用する、既定のままのシリアル番号
+var knownDefaultSerials = map[string]bool{
+	"0123456789":       true,
+	"0123456789ABCDEF": true,
+	"000000000000":     true,
+	"00000000000000":   true,
+	"0000000000000001": true,
+	"123456789ABC":     true,
+	"1234567890":       true,
+	"AAAAAAAAAAAA":     true,
+	"FFFFFFFFFFFF":     true,
+}
+
+// 接続中のUSBデバイスのシリアル番号
+type SerialTracker struct {
+	mu sync.Mutex
+	// インスタンスIDごとのシリアル番号とコンテナID
+	devices map[string]trackedSerial
+}
+
+type trackedSerial struct {
+	serial      string
+	containerID string
+}
+
+var serialTracker = &SerialTracker{devices: map[string]trackedSerial{}}
+
+// 接続されたUSBデバイスのシリアル番号を記録し、同じシリアル番号の接続中のデバイスのインスタンスIDを返す
+// 同じ物理デバイスのdevnode（コンテナIDが同じ）は重複として扱わない
+func (t *SerialTracker) arrived(deviceInfo DeviceInfo) (string, []string) {
+	// 複合デバイスのインターフェースやUSBSTORのディスクは親のUSBデバイスと同じシリアル番号を持つため対象外
+	if !strings.HasPrefix(strings.ToUpper(deviceInfo.InstanceID), `USB\`) || strings.Contains(strings.ToUpper(deviceInfo.InstanceID), "&MI_") {
+		return "", nil
+	}
+	serial := strings.ToUpper(deviceSerial(deviceInfo.InstanceID))
+	if serial == "" {
+		return "", nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var duplicates []string
+	for instanceID, tracked := range t.devices {
+		if tracked.serial == serial && !strings.EqualFold(instanceID, deviceInfo.InstanceID) &&
+			(deviceInfo.ContainerID == "" || !strings.EqualFold(tracked.containerID, deviceInfo.ContainerID)) {
+			duplicates = append(duplicates, instanceID)
+		}
+	}
+	t.devices[strings.ToUpper(deviceInfo.InstanceID)] = trackedSerial{serial: serial, containerID: deviceInfo.ContainerID}
+	return serial, duplicates
+}
+
+// 切断されたデバイスのシリアル番号の記録を削除
+func (t *SerialTracker) removed(instanceID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.devices, strings.ToUpper(instanceID))
+}
+
+// 接続中の別のデバイスと同じシリアル番号、または既定のままのシリアル番号のデバイスを、DuplicateSerialイベントとして出力
+func detectDuplicateSerial(event DeviceEvent) {
+	if !currentConfig().DetectDuplicateSerials {
+		return
+	}
+	serial, duplicates := serialTracker.arrived(event.Device)
+	var reasons []string
+	if len(duplicates) > 0 {
+		reasons = append(reasons, fmt.Sprintf("serial %s is also reported by %s", serial, strings.Join(duplicates, ", ")))
+	}
+	if knownDefaultSerials[serial] {
+		reasons = append(reasons, fmt.Sprintf("serial %s is a known default serial", serial))
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	event.Action = "DuplicateSerial"
+	event.Severity = severityWarning
+	event.Explanation = strings.Join(reasons, "; ")
+	logDeviceEvent(event)
+}
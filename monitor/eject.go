@@ -0,0 +1,211 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// cfgmgr32.dllからCM_Request_Device_EjectW関数をロード
+// デバイスの取り外しを要求する関数（「ハードウェアの安全な取り外し」と同じ処理）
+var procCM_Request_Device_EjectW = cfgmgr32.NewProc("CM_Request_Device_EjectW")
+
+// ボリュームの取り外しに使用するIOCTL
+const (
+	// ボリュームをロックして他のプロセスからのアクセスを止める
+	FSCTL_LOCK_VOLUME = 0x00090018
+	// ボリュームをマウント解除する
+	FSCTL_DISMOUNT_VOLUME = 0x00090020
+	// メディアの取り外しの禁止を解除する
+	IOCTL_STORAGE_MEDIA_REMOVAL = 0x002D4804
+	// ボリューム・ディスクのデバイス番号を取得する
+	IOCTL_STORAGE_GET_DEVICE_NUMBER = 0x002D1080
+	// STORAGE_DEVICE_NUMBER構造体のサイズ
+	storageDeviceNumberLength = 12
+	// 取り外しを拒否したプロセス・ドライバの名前の最大の長さ
+	MAX_PATH = 260
+)
+
+// 取り外しを拒否した理由（PNP_VETO_TYPE）
+var vetoTypeNames = map[uint32]string{
+	1:  "unknown",
+	2:  "legacy device",
+	3:  "pending close",
+	4:  "Windows application",
+	5:  "Windows service",
+	6:  "outstanding open",
+	7:  "device",
+	8:  "driver",
+	9:  "illegal device request",
+	10: "insufficient power",
+	11: "non-disableable",
+	12: "legacy driver",
+	13: "insufficient rights",
+	14: "already removed",
+}
+
+// `usbmon eject` サブコマンド
+// ドライブ文字（例: E:）またはインスタンスIDで指定したデバイスを、マウントを解除してから安全に取り外す
+func runEject(args []string) int {
+	fs := flag.NewFlagSet("eject", flag.ExitOnError)
+	id := fs.String("id", "", "instance ID of the device to eject instead of a drive letter")
+	fs.Parse(args)
+
+	var devInst uint32
+	var target string
+	switch {
+	case fs.NArg() == 1:
+		drive := strings.ToUpper(strings.TrimSuffix(fs.Arg(0), `\`))
+		if len(drive) == 1 {
+			drive += ":"
+		}
+		parent, err := findVolumeDevice(drive)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		devInst, target = parent, drive
+	case *id != "":
+		var err error
+		if devInst, err = locateDevNode(strings.ToUpper(*id)); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		target = strings.ToUpper(*id)
+	default:
+		fmt.Println("usage: usbmon eject E: | usbmon eject -id <instance ID>")
+		return 2
+	}
+
+	if err := requestEject(devInst); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("Ejected %s (%s)\n", target, getDevNodeID(devInst))
+	return 0
+}
+
+// ボリュームのマウントを解除し、ボリュームのディスクの親（USBデバイス）のdevnodeを返す
+func findVolumeDevice(drive string) (uint32, error) {
+	deviceNumber, err := dismountVolume(drive)
+	if err != nil {
+		return 0, err
+	}
+	diskInst, err := findDiskDevNode(deviceNumber)
+	if err != nil {
+		return 0, err
+	}
+	// ディスクの親（USBデバイス）ごと取り外す
+	parent, ok := getParentDevNode(diskInst)
+	if !ok {
+		return 0, fmt.Errorf("Failed to find the device of %s", drive)
+	}
+	return parent, nil
+}
+
+// ボリュームのマウントを解除し、USBデバイスごと安全に取り外す
+func ejectVolume(drive string) error {
+	devInst, err := findVolumeDevice(drive)
+	if err != nil {
+		return err
+	}
+	return requestEject(devInst)
+}
+
+// ボリュームをロックしてマウントを解除し、ディスクのデバイス番号を返す
+func dismountVolume(drive string) (uint32, error) {
+	name, err := windows.UTF16PtrFromString(`\\.\` + drive)
+	if err != nil {
+		return 0, err
+	}
+	h, err := windows.CreateFile(
+		name,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open volume %s: %w", drive, err)
+	}
+	defer windows.CloseHandle(h)
+
+	number := make([]byte, storageDeviceNumberLength)
+	if err := deviceIoControl(h, IOCTL_STORAGE_GET_DEVICE_NUMBER, nil, number); err != nil {
+		return 0, fmt.Errorf("Failed to get device number of %s: %w", drive, err)
+	}
+
+	var returned uint32
+	// 開いているファイルがあるとロックできない
+	if err := windows.DeviceIoControl(h, FSCTL_LOCK_VOLUME, nil, 0, nil, 0, &returned, nil); err != nil {
+		return 0, fmt.Errorf("Failed to lock volume %s (files may be open): %w", drive, err)
+	}
+	if err := windows.DeviceIoControl(h, FSCTL_DISMOUNT_VOLUME, nil, 0, nil, 0, &returned, nil); err != nil {
+		return 0, fmt.Errorf("Failed to dismount volume %s: %w", drive, err)
+	}
+	// PREVENT_MEDIA_REMOVAL構造体（PreventMediaRemoval = FALSE）
+	allow := []byte{0}
+	if err := windows.DeviceIoControl(h, IOCTL_STORAGE_MEDIA_REMOVAL, &allow[0], uint32(len(allow)), nil, 0, &returned, nil); err != nil {
+		return 0, fmt.Errorf("Failed to allow media removal of %s: %w", drive, err)
+	}
+	// STORAGE_DEVICE_NUMBER構造体のDeviceNumber
+	return binary.LittleEndian.Uint32(number[4:8]), nil
+}
+
+// デバイス番号が一致するディスクのdevnodeを探す
+func findDiskDevNode(deviceNumber uint32) (uint32, error) {
+	diskGuid := watchClassGuids["DiskDrive"]
+	paths, err := windows.CM_Get_Device_Interface_List("", &diskGuid, windows.CM_GET_DEVICE_INTERFACE_LIST_PRESENT)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list disks: %w", err)
+	}
+	for _, path := range paths {
+		name, err := windows.UTF16PtrFromString(path)
+		if err != nil {
+			continue
+		}
+		// デバイス番号の取得にはアクセス権が不要
+		h, err := windows.CreateFile(name, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+		if err != nil {
+			continue
+		}
+		number := make([]byte, storageDeviceNumberLength)
+		err = deviceIoControl(h, IOCTL_STORAGE_GET_DEVICE_NUMBER, nil, number)
+		windows.CloseHandle(h)
+		if err != nil || binary.LittleEndian.Uint32(number[4:8]) != deviceNumber {
+			continue
+		}
+		return locateDevNode(interfacePathToInstanceID(path))
+	}
+	return 0, fmt.Errorf("Failed to find disk %d", deviceNumber)
+}
+
+// デバイスの取り外しを要求し、拒否された場合は理由を返す
+func requestEject(devInst uint32) error {
+	var vetoType uint32
+	var vetoName [MAX_PATH]uint16
+	ret, _, _ := procCM_Request_Device_EjectW.Call(
+		uintptr(devInst),
+		uintptr(unsafe.Pointer(&vetoType)),
+		uintptr(unsafe.Pointer(&vetoName[0])),
+		uintptr(len(vetoName)),
+		0,
+	)
+	if vetoType != 0 {
+		reason, ok := vetoTypeNames[vetoType]
+		if !ok {
+			reason = fmt.Sprintf("veto type %d", vetoType)
+		}
+		return fmt.Errorf("Eject was vetoed (%s) by %s", reason, windows.UTF16ToString(vetoName[:]))
+	}
+	if ret != CR_SUCCESS {
+		return fmt.Errorf("Failed to eject %s: %w", getDevNodeID(devInst), &ConfigRetError{Func: procCM_Request_Device_EjectW.Name, Code: ret})
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// BitLockerで暗号化されたボリュームのブートセクタのOEM ID
+	bitLockerSignature = "-FVE-FS-"
+	// ブートセクタのサイズ
+	bootSectorSize = 512
+)
+
+// 暗号化されていないリムーバブルメディアの設定
+type EncryptedMediaConfig struct {
+	// 暗号化されていないボリュームを検出するかどうか
+	Required bool `json:"required"`
+	// Unencryptedイベントの重大度（既定はwarning）
+	Severity string `json:"severity"`
+	// 暗号化されていないボリュームを取り外すかどうか（promptで確認するドライブは取り外さない）
+	Eject bool `json:"eject"`
+	// 許可する規則に一致したドライブの場合、ログオン中のユーザーにBitLocker To Goでの暗号化を確認するかどうか
+	Prompt bool `json:"prompt"`
+}
+
+// ボリュームのファイルシステム（例: FAT32, exFAT, NTFS）を取得
+func volumeFileSystem(volume string) string {
+	root, err := windows.UTF16PtrFromString(volume + `\`)
+	if err != nil {
+		return ""
+	}
+	var name [windows.MAX_PATH + 1]uint16
+	if err := windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &name[0], uint32(len(name))); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(name[:])
+}
+
+// ボリュームがBitLocker（BitLocker To Go）で暗号化されているかを、ブートセクタのOEM IDで判定
+// ロック解除後もブートセクタは暗号化されたボリュームのものが読み取れる
+func isBitLockerVolume(volume string) (bool, error) {
+	name, err := windows.UTF16PtrFromString(`\\.\` + volume)
+	if err != nil {
+		return false, err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return false, fmt.Errorf("Failed to open volume %s: %w", volume, err)
+	}
+	defer windows.CloseHandle(h)
+	sector := make([]byte, bootSectorSize)
+	var n uint32
+	if err := windows.ReadFile(h, sector, &n, nil); err != nil {
+		return false, fmt.Errorf("Failed to read boot sector of %s: %w", volume, err)
+	}
+	return n >= 11 && bytes.Equal(sector[3:11], []byte(bitLockerSignature)), nil
+}
+
+// 暗号化されていないリムーバブルメディアのボリュームを、Unencryptedイベントとして出力（設定により取り外す）
+func checkVolumeEncryption(cfg EncryptedMediaConfig, event DeviceEvent) {
+	if !cfg.Required || event.Volume == "" {
+		return
+	}
+	encrypted, err := isBitLockerVolume(event.Volume)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if encrypted {
+		return
+	}
+	event.Action = "Unencrypted"
+	event.Severity = cfg.Severity
+	if event.Severity == "" {
+		event.Severity = severityWarning
+	}
+	event.Explanation = fmt.Sprintf("%s volume %s is not encrypted with BitLocker", volumeFileSystem(event.Volume), event.Volume)
+	// 許可済みのドライブは取り外さずに、暗号化するかをユーザーに確認
+	if rule := currentPolicy().evaluate(event.Device); cfg.Prompt && rule != nil && rule.Action == policyAllow {
+		logDeviceEvent(event)
+		go promptBitLocker(event)
+		return
+	}
+	// 一時停止中は取り外さない
+	if cfg.Eject && !monitorPause.active() {
+		if err := ejectVolume(event.Volume); err != nil {
+			event.Explanation += fmt.Sprintf("; eject failed: %v", err)
+		} else {
+			event.Explanation += "; ejected"
+		}
+	}
+	logDeviceEvent(event)
+}
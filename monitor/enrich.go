@@ -0,0 +1,232 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// 既定の外部プログラムの実行のタイムアウト
+	defaultEnrichmentTimeout = 2 * time.Second
+	// 外部プログラムが終了した後、標準出力を引き継いだ子プロセスが閉じるのを待つ時間
+	enrichmentWaitDelay = time.Second
+	// 外部プログラムの標準出力の最大サイズ
+	maxEnrichmentOutput = 64 << 10
+	// 外部プログラムで項目を追加するのを待つイベントの最大数
+	enrichmentQueueSize = 256
+)
+
+// 外部プログラムで項目を追加してから出力するイベントのキュー
+// メッセージループを止めないよう1つのゴルーチンで順に処理し、イベントの順序を保つ
+type EnrichmentQueue struct {
+	mu sync.Mutex
+	// キューを処理するゴルーチンが動いているか
+	running bool
+	events  chan DeviceEvent
+}
+
+var enrichmentQueue = &EnrichmentQueue{events: make(chan DeviceEvent, enrichmentQueueSize)}
+
+// イベントをキューに追加（キューがいっぱいの場合は外部プログラムを実行せずにすぐに出力）
+// 終了時に出力を待てるよう、処理が終わるまでsinkSendsに数える
+func (q *EnrichmentQueue) enqueue(event DeviceEvent) {
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		// 監視の開始前・終了後（simulateなど）は、呼び出したゴルーチンで項目を追加して出力
+		deliverDeviceEvent(event, true)
+		return
+	}
+	sinkSends.Add(1)
+	select {
+	case q.events <- event:
+		q.mu.Unlock()
+	default:
+		q.mu.Unlock()
+		sinkSends.Done()
+		fmt.Printf(tr("Enrichment queue is full, sending without command fields: Action=%s\n"), tr(event.Action))
+		deliverDeviceEvent(event, false)
+	}
+}
+
+// キューの処理を開始（監視の開始時に呼び出す）
+func (q *EnrichmentQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running = true
+}
+
+// キューのイベントに項目を追加して順に出力
+// キャンセルされたら、それまでにキューに追加されたイベントを出力して終了する
+func (q *EnrichmentQueue) run(ctx context.Context) {
+	for {
+		select {
+		case event := <-q.events:
+			q.deliver(event)
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.running = false
+			q.mu.Unlock()
+			for {
+				select {
+				case event := <-q.events:
+					q.deliver(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *EnrichmentQueue) deliver(event DeviceEvent) {
+	defer sinkSends.Done()
+	defer reportPanic()
+	deliverDeviceEvent(event, true)
+}
+
+// イベントを出力先・監査ログに送る前に項目を追加する設定
+// 追加した項目はイベントのFieldsに入り、署名・監査ログ・すべての出力先で同じ値になる
+type EnrichmentConfig struct {
+	// 項目の名前ごとのGoのテンプレート（出力先の書式と同じ値を使用できる、例: {"asset_class": "{{if eq .VID \"046D\"}}peripheral{{end}}"}）
+	// 結果が空の項目は追加しない
+	Fields map[string]string `json:"fields"`
+	// イベントのJSONを標準入力で受け取り、追加する項目をJSONのオブジェクトで標準出力に書くプログラム（空の場合は実行しない）
+	// テンプレートで追加した項目も受け取り、同じ名前の項目はプログラムの値で置き換える
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// プログラムの実行のタイムアウト（既定は2秒）
+	// プログラムを指定した場合、イベントは別のゴルーチンで順に項目を追加してから出力するため、長くするとイベントの出力が遅れる
+	Timeout Duration `json:"timeout"`
+	// 項目を追加するイベントの種類（例: ["Connected", "Blocked"]、空の場合はすべて）
+	Actions []string `json:"actions"`
+}
+
+// 設定の項目のテンプレートを確認
+func checkEnrichment(cfg EnrichmentConfig) error {
+	for name, text := range cfg.Fields {
+		if _, err := template.New(name).Option("missingkey=error").Parse(text); err != nil {
+			return fmt.Errorf("invalid enrichment template for field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// 設定したテンプレートと外部プログラム（runCommandを指定した場合のみ）の結果をイベントのFieldsに追加
+// 失敗した場合はエラーを出力し、それまでに追加した項目でイベントを出力する
+func enrichEvent(event DeviceEvent, runCommand bool) DeviceEvent {
+	cfg := currentConfig().Enrichment
+	if (len(cfg.Fields) == 0 && cfg.Command == "") ||
+		(len(cfg.Actions) > 0 && !slices.Contains(cfg.Actions, event.Action)) {
+		return event
+	}
+	fields := maps.Clone(event.Fields)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	if len(cfg.Fields) > 0 {
+		data := newTemplateData(event)
+		for _, name := range slices.Sorted(maps.Keys(cfg.Fields)) {
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(cfg.Fields[name])
+			if err != nil {
+				fmt.Printf(tr("Failed to enrich event: Field=%s: %v\n"), name, err)
+				continue
+			}
+			var b bytes.Buffer
+			if err := tmpl.Execute(&b, data); err != nil {
+				fmt.Printf(tr("Failed to enrich event: Field=%s: %v\n"), name, err)
+				continue
+			}
+			if value := strings.TrimSpace(b.String()); value != "" {
+				fields[name] = value
+			}
+		}
+	}
+	if cfg.Command != "" && runCommand {
+		event.Fields = fields
+		added, err := runEnrichmentCommand(cfg, event)
+		if err != nil {
+			fmt.Printf(tr("Failed to enrich event: Command=%s: %v\n"), cfg.Command, err)
+		}
+		maps.Copy(fields, added)
+	}
+	if len(fields) > 0 {
+		event.Fields = fields
+	}
+	return event
+}
+
+// 外部プログラムにイベントのJSONを渡し、返された項目を文字列にして返す
+func runEnrichmentCommand(cfg EnrichmentConfig, event DeviceEvent) (map[string]string, error) {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultEnrichmentTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	// プログラムが終了しても標準出力を引き継いだ子プロセスが残っている場合は、待たずにパイプを閉じる
+	cmd.WaitDelay = enrichmentWaitDelay
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	type readResult struct {
+		data []byte
+		err  error
+	}
+	read := make(chan readResult, 1)
+	go func() {
+		data, err := io.ReadAll(io.LimitReader(pr, maxEnrichmentOutput+1))
+		// 上限を超えた出力は読まずに閉じる（プログラムへの書き込みはエラーになる）
+		pr.Close()
+		read <- readResult{data, err}
+	}()
+	waitErr := cmd.Wait()
+	pw.Close()
+	result := <-read
+	if len(result.data) > maxEnrichmentOutput {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxEnrichmentOutput)
+	}
+	// プログラムが正常に終了し、残った子プロセスのためにパイプを閉じただけの場合は出力を使用する
+	if waitErr != nil && !errors.Is(waitErr, exec.ErrWaitDelay) {
+		return nil, waitErr
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	output := result.data
+	var values map[string]any
+	if err := json.Unmarshal(output, &values); err != nil {
+		return nil, fmt.Errorf("output is not a JSON object: %w", err)
+	}
+	fields := make(map[string]string, len(values))
+	for name, value := range values {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			fields[name] = value
+		default:
+			data, _ := json.Marshal(value)
+			fields[name] = string(data)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,201 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// エラーの報告先への要求のタイムアウト
+	errorReportTimeout = 10 * time.Second
+	// 同じ出力先への送信が続けて失敗したら報告する回数
+	sinkErrorReportThreshold = 5
+	// 報告に含めるシリアル番号の置き換え
+	scrubbedSerial = "[serial]"
+)
+
+// 監視の内部の障害（パニック・出力先への送信の失敗・通知の登録の失敗）を報告する先の設定
+type ErrorReportingConfig struct {
+	// Sentry互換のDSN（例: https://<key>@sentry.example.com/42、空の場合は報告しない）
+	DSN string `json:"dsn"`
+	// 報告に付ける環境の名前（例: production）
+	Environment string `json:"environment"`
+}
+
+// 報告するエラーの種類
+const (
+	faultPanic        = "panic"
+	faultSink         = "sink"
+	faultRegistration = "registration"
+)
+
+// 監視の内部の障害をSentry互換のstore APIに送る
+type ErrorReporter struct {
+	client *http.Client
+	mu     sync.Mutex
+	// 出力先ごとの続けて失敗した回数
+	sinkFailures map[string]int
+}
+
+var errorReporter = &ErrorReporter{client: &http.Client{Timeout: errorReportTimeout}, sinkFailures: map[string]int{}}
+
+// Sentryのstore APIに送るイベント
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	Release     string            `json:"release"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+// エラーを報告（報告先を設定していなければ何もしない）
+// パニック以外はイベントの処理を止めないよう別のゴルーチンで送る
+func (r *ErrorReporter) report(kind string, message string, extra map[string]string) {
+	if currentConfig().ErrorReporting.DSN == "" {
+		return
+	}
+	if kind == faultPanic {
+		r.send(kind, message, extra)
+		return
+	}
+	go r.send(kind, message, extra)
+}
+
+func (r *ErrorReporter) send(kind string, message string, extra map[string]string) {
+	cfg := currentConfig().ErrorReporting
+	endpoint, auth, err := parseDSN(cfg.DSN)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	level := "error"
+	if kind == faultPanic {
+		level = "fatal"
+	}
+	for key, value := range extra {
+		extra[key] = scrubSerials(value)
+	}
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       level,
+		Logger:      "usbmon",
+		Platform:    "go",
+		Release:     "usbmon@" + version,
+		Environment: cfg.Environment,
+		ServerName:  getHostName(),
+		Message:     scrubSerials(message),
+		Tags:        map[string]string{"fault": kind, "machine_guid": machineIdentity().GUID},
+		Extra:       extra,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		fmt.Printf("Failed to report error: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		fmt.Printf("Failed to report error: POST %s: %s\n", endpoint, resp.Status)
+	}
+}
+
+// DSNからstore APIのURLと認証ヘッダーを作成
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return "", "", fmt.Errorf("Failed to parse error reporting DSN %q", dsn)
+	}
+	path, project, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if project == "" {
+		path, project = "", path
+	} else {
+		path = "/" + path
+	}
+	if project == "" {
+		return "", "", fmt.Errorf("Failed to parse error reporting DSN %q: missing project ID", dsn)
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path, project)
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=usbmon/%s, sentry_key=%s", version, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return endpoint, auth, nil
+}
+
+// 出力先への送信の結果を記録し、続けて失敗した回数がしきい値に達したら報告
+func (r *ErrorReporter) sinkResult(name string, err error) {
+	r.mu.Lock()
+	if err == nil {
+		delete(r.sinkFailures, name)
+		r.mu.Unlock()
+		return
+	}
+	r.sinkFailures[name]++
+	failures := r.sinkFailures[name]
+	r.mu.Unlock()
+	fmt.Printf("Failed to send event to sink %s: %v\n", name, err)
+	if failures == sinkErrorReportThreshold {
+		r.report(faultSink, fmt.Sprintf("sink %s failed %d times in a row: %v", name, failures, err), nil)
+	}
+}
+
+// パニックを報告してから、そのままパニックを続ける
+// 報告するゴルーチンでdeferで呼び出す
+func reportPanic() {
+	if v := recover(); v != nil {
+		errorReporter.report(faultPanic, fmt.Sprint(v), map[string]string{"stack": string(debug.Stack())})
+		panic(v)
+	}
+}
+
+var (
+	// インスタンスIDの末尾（シリアル番号か、シリアル番号のないデバイスにWindowsが割り当てたID）
+	instanceIDSerial = regexp.MustCompile(`(?i)\b((?:USB|USBSTOR|HID|SCSI|BTHENUM|SWD|WPDBUSENUM)\\[^\\\s"']+\\)([^\\\s"',;:)]+)`)
+	// Windowsが割り当てたID（例: 5&2C0E7D7&0&2）
+	generatedInstanceID = regexp.MustCompile(`^[0-9A-Fa-f]+(&[0-9A-Fa-f]+){2,}$`)
+)
+
+// 報告に含める文字列からデバイスのシリアル番号を取り除く
+func scrubSerials(text string) string {
+	text = instanceIDSerial.ReplaceAllStringFunc(text, func(match string) string {
+		groups := instanceIDSerial.FindStringSubmatch(match)
+		if generatedInstanceID.MatchString(groups[2]) {
+			return match
+		}
+		return groups[1] + scrubbedSerial
+	})
+	for _, serial := range deviceCache.serials() {
+		text = strings.ReplaceAll(text, serial, scrubbedSerial)
+	}
+	return text
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// ソフトウェアの制限のポリシー（SRP）の設定のレジストリキー（HKLM）
+	saferCodeIdentifiersPath = `SOFTWARE\Policies\Microsoft\Windows\Safer\CodeIdentifiers`
+	// 「許可しない」（Disallowed）のセキュリティレベルのパスの規則のサブキー
+	saferDisallowedPathsPath = saferCodeIdentifiersPath + `\0\Paths`
+	// SRPを設定していない場合の既定のセキュリティレベル（制限なし）
+	saferLevelUnrestricted = 0x40000
+	// usbmonが作成した規則の説明の先頭（異常終了で残った規則を起動時に削除するために使用）
+	executionBlockDescription = "usbmon: "
+)
+
+// 許可されていないUSBストレージのボリュームからのプログラムの実行を禁止する規則
+type ExecutionBlocks struct {
+	mu sync.Mutex
+	// ドライブ文字（例: E:）ごとの規則のサブキーの名前（GUID）
+	rules map[string]string
+}
+
+var executionBlocks = &ExecutionBlocks{rules: map[string]string{}}
+
+// ボリュームのパスの規則（例: E:\）を「許可しない」として追加
+func (b *ExecutionBlocks) block(session VolumeSession) error {
+	if err := ensureSaferPolicy(); err != nil {
+		return err
+	}
+	guid, err := windows.GenerateGUID()
+	if err != nil {
+		return fmt.Errorf("Failed to block execution on %s: %w", session.Volume, err)
+	}
+	name := guid.String()
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath+`\`+name, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("Failed to block execution on %s: %w", session.Volume, err)
+	}
+	modified := windows.NsecToFiletime(time.Now().UnixNano())
+	err = errors.Join(
+		key.SetStringValue("Description", executionBlockDescription+session.Fingerprint),
+		key.SetExpandStringValue("ItemData", session.Volume+`\`),
+		key.SetDWordValue("SaferFlags", 0),
+		key.SetQWordValue("LastModified", uint64(modified.HighDateTime)<<32|uint64(modified.LowDateTime)),
+	)
+	key.Close()
+	if err != nil {
+		// 一部の値だけの規則を残さない
+		registry.DeleteKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath+`\`+name)
+		return fmt.Errorf("Failed to block execution on %s: %w", session.Volume, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules[strings.ToUpper(session.Volume)] = name
+	return nil
+}
+
+// 取り外されたボリュームの規則を削除
+func (b *ExecutionBlocks) unblock(volume string) {
+	b.mu.Lock()
+	name, ok := b.rules[strings.ToUpper(volume)]
+	delete(b.rules, strings.ToUpper(volume))
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := registry.DeleteKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath+`\`+name); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		fmt.Printf("Failed to unblock execution on %s: %v\n", volume, err)
+	}
+}
+
+// 異常終了などで残ったusbmonの規則を削除（同じドライブ文字を別のデバイスが使用するため）
+func clearExecutionBlocks() {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return
+	}
+	names, _ := key.ReadSubKeyNames(-1)
+	key.Close()
+	for _, name := range names {
+		rule, err := registry.OpenKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath+`\`+name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		description, _, _ := rule.GetStringValue("Description")
+		rule.Close()
+		if strings.HasPrefix(description, executionBlockDescription) {
+			registry.DeleteKey(registry.LOCAL_MACHINE, saferDisallowedPathsPath+`\`+name)
+		}
+	}
+}
+
+// SRPを設定していない場合は、既定のレベルを「制限なし」としてSRPを有効にする
+// 既に設定されている場合は、既存の設定を変更しない
+func ensureSaferPolicy() error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, saferCodeIdentifiersPath, registry.QUERY_VALUE)
+	if err == nil {
+		key.Close()
+		return nil
+	}
+	key, _, err = registry.CreateKey(registry.LOCAL_MACHINE, saferCodeIdentifiersPath, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("Failed to enable software restriction policies: %w", err)
+	}
+	// DLLは対象外、管理者を含むすべてのユーザーに適用
+	err = errors.Join(
+		key.SetDWordValue("DefaultLevel", saferLevelUnrestricted),
+		key.SetDWordValue("TransparentEnabled", 1),
+		key.SetDWordValue("PolicyScope", 0),
+		key.SetStringsValue("ExecutableTypes", []string{"BAT", "CMD", "COM", "EXE", "HTA", "JS", "LNK", "MSI", "PS1", "SCR", "VBS", "WSF"}),
+	)
+	key.Close()
+	if err != nil {
+		// 一部の値だけの設定を残すと、次回は設定済みとみなして作り直さないため削除
+		registry.DeleteKey(registry.LOCAL_MACHINE, saferCodeIdentifiersPath)
+		return fmt.Errorf("Failed to enable software restriction policies: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package monitor
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// 出力する日付の書式
+const exportDateFormat = "2006-01-02"
+
+// 1件のイベントを1行にする場合の列
+var eventExportHeader = []string{"Time", "Action", "Host", "Class", "Type", "Severity", "Instance ID", "VID:PID", "Serial", "Name", "Manufacturer", "Volume", "Policy", "Owner", "Note"}
+
+// 接続から切断までを1行にする場合の列
+var sessionExportHeader = []string{"Connected", "Disconnected", "Duration", "Host", "Class", "Type", "Instance ID", "VID:PID", "Serial", "Name", "Manufacturer", "Volume", "Owner", "Note"}
+
+// `usbmon export` サブコマンド
+// 監査ログのイベントを、期間を指定してCSV・Excel（xlsx）の表として出力
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find audit_log and audit_encryption)")
+	path := fs.String("log", "", "path to the audit log (overrides audit_log in the config)")
+	from := fs.String("from", "", "first day to export (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day to export (YYYY-MM-DD, inclusive)")
+	format := fs.String("format", "csv", "output format: csv or xlsx")
+	by := fs.String("by", "event", "one row per event or per session (connected to disconnected)")
+	out := fs.String("out", "", "output file (csv is written to stdout if omitted)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if *path == "" {
+		*path = cfg.AuditLog
+	}
+	if *path == "" {
+		fmt.Println("specify -log or audit_log in the config")
+		return 2
+	}
+	// 出力先のファイルを作成する前に、指定を確認する
+	if *by != "event" && *by != "session" {
+		fmt.Printf("unknown -by %q (event or session)\n", *by)
+		return 2
+	}
+	switch *format {
+	case "csv":
+	case "xlsx":
+		if *out == "" {
+			fmt.Println("specify -out for xlsx")
+			return 2
+		}
+	default:
+		fmt.Printf("unknown format %q (csv or xlsx)\n", *format)
+		return 2
+	}
+	var start, end time.Time
+	if *from != "" {
+		if start, err = time.ParseInLocation(exportDateFormat, *from, time.Local); err != nil {
+			fmt.Printf("invalid -from %q\n", *from)
+			return 2
+		}
+	}
+	if *to != "" {
+		if end, err = time.ParseInLocation(exportDateFormat, *to, time.Local); err != nil {
+			fmt.Printf("invalid -to %q\n", *to)
+			return 2
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+
+	// アーカイブしたレコードも含めて出力
+	records, err := readAuditHistory(*path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var rows [][]string
+	switch *by {
+	case "event":
+		rows = append(rows, eventExportHeader)
+		for _, record := range records {
+			if !inExportRange(record.Time, start, end) {
+				continue
+			}
+			event, err := record.event(cfg.AuditEncryption)
+			if err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			rows = append(rows, eventExportRow(record.Time, event))
+		}
+	case "session":
+		rows = append(rows, sessionExportHeader)
+		sessionRows, err := sessionExportRows(records, start, end, cfg.AuditEncryption)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		rows = append(rows, sessionRows...)
+	}
+
+	if *out == "" {
+		err = writeExport(os.Stdout, *format, rows)
+	} else {
+		file, createErr := os.Create(*out)
+		if createErr != nil {
+			fmt.Printf("Failed to create export: %v\n", createErr)
+			return 1
+		}
+		err = writeExport(file, *format, rows)
+		// 書き込みのエラーがClose時に返る場合もあるため、Closeのエラーも失敗とする
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to write export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// 表を指定した形式（csv / xlsx）で出力
+func writeExport(w io.Writer, format string, rows [][]string) error {
+	if format == "xlsx" {
+		return writeXLSX(w, rows)
+	}
+	return writeCSV(w, rows)
+}
+
+// 時刻が出力する期間に含まれるかを判定（指定がない場合は制限なし）
+func inExportRange(t, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+}
+
+// イベントを1行に変換
+func eventExportRow(t time.Time, event DeviceEvent) []string {
+	vid, pid := parseVIDPID(event.Device.InstanceID)
+	vidPID := ""
+	if vid != "" {
+		vidPID = vid + ":" + pid
+	}
+	return []string{
+		t.Local().Format(time.DateTime), event.Action, event.HostName, event.WatchClass, event.DeviceType, event.Severity,
+		event.Device.InstanceID, vidPID, deviceSerial(event.Device.InstanceID),
+		event.Device.FriendlyName, event.Device.Manufacturer, event.Volume, event.Policy,
+		event.Owner, event.Note,
+	}
+}
+
+// 接続イベントと、同じデバイスの次の切断イベントを組にして1行に変換
+// 期間内に接続したデバイスを対象にし、切断されていない場合は切断の列を空にする
+func sessionExportRows(records []AuditRecord, start, end time.Time, encryption *AuditEncryptionConfig) ([][]string, error) {
+	var rows [][]string
+	// 切断されていない接続（インスタンスIDごとの行の位置と接続時刻）
+	open := map[string]int{}
+	connectedAt := map[string]time.Time{}
+	for _, record := range records {
+		event, err := record.event(encryption)
+		if err != nil {
+			return nil, err
+		}
+		id := event.Device.InstanceID
+		switch event.Action {
+		case "Connected", "Present", "Blocked":
+			if !inExportRange(record.Time, start, end) {
+				continue
+			}
+			row := eventExportRow(record.Time, event)
+			// Connected, Disconnected, Duration, Host, Class, Type, Instance ID, VID:PID, Serial, Name, Manufacturer, Volume, Owner, Note
+			open[id] = len(rows)
+			connectedAt[id] = record.Time
+			rows = append(rows, []string{row[0], "", "", row[2], row[3], row[4], row[6], row[7], row[8], row[9], row[10], row[11], row[13], row[14]})
+		case "Disconnected":
+			i, ok := open[id]
+			if !ok {
+				continue
+			}
+			rows[i][1] = record.Time.Local().Format(time.DateTime)
+			rows[i][2] = record.Time.Sub(connectedAt[id]).Round(time.Second).String()
+			delete(open, id)
+		}
+	}
+	return rows, nil
+}
+
+// 表をCSVとして出力（Excelで文字化けしないよう、UTF-8のBOMを付ける）
+func writeCSV(w io.Writer, rows [][]string) error {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = escapeCSVFormula(cell)
+		}
+		if err := writer.Write(cells); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// 表計算ソフトが数式として解釈する文字で始まるセルの先頭に'を付ける
+// デバイスの名前やシリアル番号はデバイスが自由に設定できるため、CSVを開いたときに数式を実行させないようにする
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// xlsxを構成するファイル（シートは1枚、セルはすべて文字列）
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="usbmon" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// 表をExcelのブック（xlsx）として出力
+func writeXLSX(w io.Writer, rows [][]string) error {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for _, row := range rows {
+		sheet.WriteString("<row>")
+		for _, cell := range row {
+			sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&sheet, []byte(cell))
+			sheet.WriteString("</t></is></c>")
+		}
+		sheet.WriteString("</row>")
+	}
+	sheet.WriteString("</sheetData></worksheet>")
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, sheet.String()); err != nil {
+		return err
+	}
+	return archive.Close()
+}
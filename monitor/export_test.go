@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEscapeCSVFormula(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"Kingston DataTraveler", "Kingston DataTraveler"},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+		{"'quoted", "'quoted"},
+	}
+	for _, test := range tests {
+		if got := escapeCSVFormula(test.cell); got != test.want {
+			t.Errorf("escapeCSVFormula(%q) = %q, want %q", test.cell, got, test.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	rows := [][]string{
+		{"Name", "Serial"},
+		{"=cmd|' /C calc'!A0", "1234"},
+		{"Logitech, Inc.", "-"},
+	}
+	if err := writeCSV(&buf, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := "\xEF\xBB\xBF" + "Name,Serial\n" + "'=cmd|' /C calc'!A0,1234\n" + "\"Logitech, Inc.\",'-\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeCSV() = %q, want %q", got, want)
+	}
+}
+
+func TestInExportRange(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 1, 0)
+	tests := []struct {
+		t          time.Time
+		start, end time.Time
+		want       bool
+	}{
+		{start, start, end, true},
+		{end.Add(-time.Second), start, end, true},
+		{end, start, end, false},
+		{start.Add(-time.Second), start, end, false},
+		{start.Add(-time.Second), time.Time{}, end, true},
+		{end, start, time.Time{}, true},
+		{end, time.Time{}, time.Time{}, true},
+	}
+	for _, test := range tests {
+		if got := inExportRange(test.t, test.start, test.end); got != test.want {
+			t.Errorf("inExportRange(%s, %s, %s) = %v, want %v", test.t, test.start, test.end, got, test.want)
+		}
+	}
+}
+
+func TestEventExportRow(t *testing.T) {
+	at := time.Date(2026, 9, 1, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		instanceID string
+		vidPID     string
+		serial     string
+	}{
+		{`USB\VID_0781&PID_5581\4C530001230412345678`, "0781:5581", "4C530001230412345678"},
+		// シリアル番号を持たないデバイスは、Windowsが生成したIDになる
+		{`USB\VID_046D&PID_C52B\5&2C0E7D7&0&2`, "046D:C52B", ""},
+		{`ACPI\PNP0303\4&1D401FB5&0`, "", ""},
+	}
+	for _, test := range tests {
+		row := eventExportRow(at, DeviceEvent{Action: "Connected", Device: DeviceInfo{InstanceID: test.instanceID}})
+		if len(row) != len(eventExportHeader) {
+			t.Fatalf("eventExportRow() = %d columns, want %d", len(row), len(eventExportHeader))
+		}
+		if row[0] != "2026-09-01 09:30:00" || row[1] != "Connected" || row[6] != test.instanceID || row[7] != test.vidPID || row[8] != test.serial {
+			t.Errorf("eventExportRow(%s) = %q", test.instanceID, row)
+		}
+	}
+}
+
+func TestSessionExportRows(t *testing.T) {
+	const (
+		stick = `USB\VID_0781&PID_5581\4C530001230412345678`
+		mouse = `USB\VID_046D&PID_C077\5&2C0E7D7&0&1`
+	)
+	start := time.Date(2026, 9, 1, 9, 0, 0, 0, time.Local)
+	record := func(offset time.Duration, action string, instanceID string) AuditRecord {
+		data, err := json.Marshal(DeviceEvent{Action: action, Device: DeviceInfo{InstanceID: instanceID}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return AuditRecord{Time: start.Add(offset), Event: data}
+	}
+	tests := []struct {
+		name       string
+		records    []AuditRecord
+		start, end time.Time
+		// 行ごとの接続日時・切断日時・接続時間・インスタンスID
+		want [][4]string
+	}{
+		{
+			name: "paired",
+			records: []AuditRecord{
+				record(0, "Connected", stick),
+				record(time.Minute, "Connected", mouse),
+				record(90*time.Minute+30*time.Second, "Disconnected", stick),
+			},
+			want: [][4]string{
+				{"2026-09-01 09:00:00", "2026-09-01 10:30:30", "1h30m30s", stick},
+				{"2026-09-01 09:01:00", "", "", mouse},
+			},
+		},
+		{
+			name: "reconnected",
+			records: []AuditRecord{
+				record(0, "Present", stick),
+				record(time.Minute, "Disconnected", stick),
+				record(2*time.Minute, "Connected", stick),
+			},
+			want: [][4]string{
+				{"2026-09-01 09:00:00", "2026-09-01 09:01:00", "1m0s", stick},
+				{"2026-09-01 09:02:00", "", "", stick},
+			},
+		},
+		{
+			// 期間より前に接続したデバイスの切断は出力しない
+			name: "connected before range",
+			records: []AuditRecord{
+				record(0, "Connected", stick),
+				record(time.Hour, "Connected", mouse),
+				record(2*time.Hour, "Disconnected", stick),
+				record(3*time.Hour, "Disconnected", mouse),
+			},
+			start: start.Add(30 * time.Minute),
+			want: [][4]string{
+				{"2026-09-01 10:00:00", "2026-09-01 12:00:00", "2h0m0s", mouse},
+			},
+		},
+		{
+			name: "other events",
+			records: []AuditRecord{
+				record(0, "Problem", stick),
+				record(time.Minute, "Disconnected", stick),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := sessionExportRows(test.records, test.start, test.end, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][4]string
+			for _, row := range rows {
+				if len(row) != len(sessionExportHeader) {
+					t.Fatalf("row = %d columns, want %d", len(row), len(sessionExportHeader))
+				}
+				got = append(got, [4]string{row[0], row[1], row[2], row[6]})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sessionExportRows() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// ファイルの変更が止まってから記録するまでの時間（コピー中の変更をまとめる）
+	fileTransferSettleDelay = 2 * time.Second
+	// ReadDirectoryChangesWのバッファのサイズ
+	fileTransferBufferSize = 64 * 1024
+	// ハッシュを計算するファイルのサイズの上限の既定値（MB）
+	defaultFileTransferMaxHashSizeMB = 100
+)
+
+// USBストレージに書き込まれたファイルの記録の設定
+type FileTransferConfig struct {
+	// 接続中のUSBストレージのボリュームを監視するかどうか
+	Enabled bool `json:"enabled"`
+	// 書き込まれたファイルのSHA-256を記録するかどうか
+	Hash bool `json:"hash"`
+	// ハッシュを計算するファイルのサイズの上限（MB、既定は100）
+	MaxHashSizeMB int `json:"max_hash_size_mb"`
+}
+
+// USBストレージに書き込まれたファイル
+type FileTransfer struct {
+	// ファイルのパス（例: E:\backup\report.xlsx）
+	Path string
+	// 作成・変更（Created / Modified）
+	Change string
+	// ファイルのサイズ（バイト）
+	Size int64
+	// ファイルのSHA-256（hashを有効にした場合）
+	SHA256 string `json:",omitempty"`
+}
+
+// ボリュームごとのディレクトリの監視
+type FileTransferWatchers struct {
+	mu      sync.Mutex
+	handles map[string]windows.Handle
+}
+
+var fileTransferWatchers = &FileTransferWatchers{handles: map[string]windows.Handle{}}
+
+// 接続したUSBストレージのボリュームの監視を開始
+func (w *FileTransferWatchers) start(cfg FileTransferConfig, session VolumeSession) {
+	root := session.Volume + `\`
+	name, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return
+	}
+	handle, err := windows.CreateFile(name, windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		fmt.Printf("Failed to watch %s: %v\n", root, err)
+		return
+	}
+	w.mu.Lock()
+	w.handles[session.Volume] = handle
+	w.mu.Unlock()
+	go w.watch(cfg, session, handle)
+}
+
+// 切断されたデバイスのボリュームの監視を終了
+func (w *FileTransferWatchers) stop(volume string) {
+	w.mu.Lock()
+	handle, ok := w.handles[volume]
+	delete(w.handles, volume)
+	w.mu.Unlock()
+	if ok {
+		// 待機中のReadDirectoryChangesWを中断してから閉じる
+		windows.CancelIoEx(handle, nil)
+		windows.CloseHandle(handle)
+	}
+}
+
+// ボリュームの変更を読み取り、変更が止まったファイルをFileTransferイベントとして出力
+func (w *FileTransferWatchers) watch(cfg FileTransferConfig, session VolumeSession, handle windows.Handle) {
+	var mu sync.Mutex
+	pending := map[string]*time.Timer{}
+	changes := map[string]string{}
+	buffer := make([]byte, fileTransferBufferSize)
+	for {
+		var n uint32
+		err := windows.ReadDirectoryChanges(handle, &buffer[0], uint32(len(buffer)), true,
+			windows.FILE_NOTIFY_CHANGE_FILE_NAME|windows.FILE_NOTIFY_CHANGE_SIZE|windows.FILE_NOTIFY_CHANGE_LAST_WRITE,
+			&n, nil, 0)
+		if err != nil {
+			// 切断・監視の終了
+			return
+		}
+		for offset := uint32(0); offset < n; {
+			info := (*windows.FileNotifyInformation)(unsafe.Pointer(&buffer[offset]))
+			name := windows.UTF16ToString(unsafe.Slice(&info.FileName, info.FileNameLength/2))
+			path := filepath.Join(session.Volume+`\`, name)
+			change := ""
+			switch info.Action {
+			case windows.FILE_ACTION_ADDED, windows.FILE_ACTION_RENAMED_NEW_NAME:
+				change = "Created"
+			case windows.FILE_ACTION_MODIFIED:
+				change = "Modified"
+			}
+			if change != "" {
+				mu.Lock()
+				// 作成後の変更は作成として記録
+				if changes[path] == "" {
+					changes[path] = change
+				}
+				if timer, ok := pending[path]; ok {
+					timer.Reset(fileTransferSettleDelay)
+				} else {
+					pending[path] = time.AfterFunc(fileTransferSettleDelay, func() {
+						mu.Lock()
+						change := changes[path]
+						delete(pending, path)
+						delete(changes, path)
+						mu.Unlock()
+						logFileTransfer(cfg, session, path, change)
+					})
+				}
+				mu.Unlock()
+			}
+			if info.NextEntryOffset == 0 {
+				break
+			}
+			offset += info.NextEntryOffset
+		}
+	}
+}
+
+// 書き込まれたファイルを、接続したデバイスのFileTransferイベントとして出力
+func logFileTransfer(cfg FileTransferConfig, session VolumeSession, path string, change string) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return
+	}
+	transfer := FileTransfer{Path: path, Change: change, Size: info.Size()}
+	maxHashSize := int64(cfg.MaxHashSizeMB) << 20
+	if maxHashSize <= 0 {
+		maxHashSize = defaultFileTransferMaxHashSizeMB << 20
+	}
+	if cfg.Hash && info.Size() <= maxHashSize {
+		transfer.SHA256, _ = hashFile(path)
+	}
+	logDeviceEvent(DeviceEvent{
+		Action:       "FileTransfer",
+		HostName:     getHostName(),
+		WatchClass:   "DiskDrive",
+		Severity:     severityInfo,
+		Device:       DeviceInfo{InstanceID: session.InstanceID},
+		Fingerprint:  session.Fingerprint,
+		Volume:       session.Volume,
+		FileTransfer: &transfer,
+	})
+}
+
+// ファイルのSHA-256を計算
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
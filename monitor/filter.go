@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	// PC本体（内蔵デバイス）を表すコンテナID
+	machineContainerID = "{00000000-0000-0000-FFFF-FFFFFFFFFFFF}"
+	// ルートハブのインスタンスIDの先頭部分
+	rootHubPrefix = `USB\ROOT_HUB`
+)
+
+// USBハブのドライバのサービス名
+var hubServices = map[string]bool{"usbhub": true, "USBHUB3": true}
+
+// 接続時に除外したデバイス（切断時はプロパティを読み取れないため、インスタンスIDで判定）
+type ExcludedDevices struct {
+	mu        sync.Mutex
+	instances map[string]bool
+}
+
+// メッセージループとデバイスごとのゴルーチンで共有する、除外したデバイスの一覧
+var excludedDevices = &ExcludedDevices{instances: map[string]bool{}}
+
+// 除外したデバイスとして記録
+func (e *ExcludedDevices) add(instanceID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.instances[instanceID] = true
+}
+
+// 除外したデバイスかを判定し、記録から削除（切断時に使用）
+func (e *ExcludedDevices) pop(instanceID string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	excluded := e.instances[instanceID]
+	delete(e.instances, instanceID)
+	return excluded
+}
+
+// 設定に従って、イベントの出力から除外するデバイスかを判定
+func isExcluded(filters FilterConfig, deviceInfo DeviceInfo) bool {
+	if isRootHub(deviceInfo.InstanceID) {
+		return filters.ExcludeRootHubs
+	}
+	if !isBuiltin(deviceInfo) {
+		return false
+	}
+	if isHub(deviceInfo) {
+		return filters.ExcludeInternalHubs
+	}
+	return filters.ExcludeBuiltinDevices
+}
+
+// ルートハブかを判定
+func isRootHub(instanceID string) bool {
+	return strings.HasPrefix(instanceID, rootHubPrefix)
+}
+
+// ハブかを判定
+func isHub(deviceInfo DeviceInfo) bool {
+	return hubServices[deviceInfo.Service] || deviceInfo.IsHub
+}
+
+// PC本体に内蔵されたデバイス、またはユーザーが接続できない内部ポートのデバイスかを判定
+func isBuiltin(deviceInfo DeviceInfo) bool {
+	return strings.EqualFold(deviceInfo.ContainerID, machineContainerID) || deviceInfo.InternalPort
+}
@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 接続・切断を短時間に繰り返すデバイス（ケーブル不良、ポート故障、ファームウェアの不具合など）を検出するための設定
+const (
+	// 接続・切断の回数を数える時間幅
+	flapWindow = 30 * time.Second
+	// 時間幅内にこの回数以上の接続・切断サイクルがあればフラッピングと判定
+	flapCycleThreshold = 3
+	// フラッピングが収まったかを確認する間隔
+	flapCheckInterval = 5 * time.Second
+	// フラッピング確認用タイマーの識別子
+	flapTimerID = 1
+)
+
+// デバイスごとの接続・切断の履歴
+type flapState struct {
+	// 時間幅内に発生した接続・切断の時刻
+	transitions []time.Time
+	// フラッピング中かどうか
+	flapping bool
+	// フラッピング開始からの接続・切断の回数
+	flapTransitions int
+	// 最後の接続・切断が接続だったかどうか
+	lastArrival bool
+	// 最後の接続・切断の時刻
+	last time.Time
+	// フラッピングを検出したホスト名
+	hostName string
+	// フラッピングが収まったときに、最後の接続・切断を通常どおり処理する関数
+	settle func()
+}
+
+// フラッピングしているデバイスを検出し、個別のイベントを1つのアラートにまとめる
+type FlapDetector struct {
+	// ウォッチドッグが作り直したメッセージループと、停止から戻った古いメッセージループの両方から呼び出されうる
+	mu sync.Mutex
+	// インスタンスIDごとの接続・切断の履歴
+	devices map[string]*flapState
+}
+
+// WinAPIのコールバック（メッセージループ）から利用するフラッピング検出器
+var flapDetector = &FlapDetector{devices: map[string]*flapState{}}
+
+// 接続・切断を記録し、個別のイベントを抑制すべき場合はtrueを返す
+// settleは抑制した場合に、フラッピングが収まった時点の状態がこの接続・切断であれば呼び出される
+func (d *FlapDetector) record(instanceID string, arrival bool, now time.Time, hostName string, settle func()) bool {
+	suppress, started := d.update(instanceID, arrival, now, hostName, settle)
+	// イベントの出力に時間がかかっても他のメッセージループを待たせないよう、ロックを外してから出力
+	if started != nil {
+		logFlapping(instanceID, started)
+	}
+	return suppress
+}
+
+// 接続・切断を履歴に反映し、フラッピングを検出した場合はその時点の履歴を返す
+func (d *FlapDetector) update(instanceID string, arrival bool, now time.Time, hostName string, settle func()) (bool, *flapState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.devices[instanceID]
+	if !ok {
+		state = &flapState{}
+		d.devices[instanceID] = state
+	}
+	state.lastArrival = arrival
+	state.last = now
+	state.hostName = hostName
+	state.settle = settle
+
+	if state.flapping {
+		state.flapTransitions++
+		return true, nil
+	}
+
+	// 時間幅から外れた古い記録を削除
+	kept := state.transitions[:0]
+	for _, t := range state.transitions {
+		if now.Sub(t) <= flapWindow {
+			kept = append(kept, t)
+		}
+	}
+	state.transitions = append(kept, now)
+
+	// 接続と切断の2回で1サイクル
+	if len(state.transitions)/2 < flapCycleThreshold {
+		return false, nil
+	}
+	state.flapping = true
+	state.flapTransitions = len(state.transitions)
+	state.transitions = nil
+	started := *state
+	return true, &started
+}
+
+// 時間幅を超えて接続・切断が発生していないデバイスの履歴を整理し、フラッピングの終了を通知
+// 抑制していた最後の接続・切断は、分類・ポリシーの評価などを通常どおり行う
+func (d *FlapDetector) flush(now time.Time) {
+	stopped := map[string]*flapState{}
+	d.mu.Lock()
+	for instanceID, state := range d.devices {
+		if now.Sub(state.last) <= flapWindow {
+			continue
+		}
+		if state.flapping {
+			stopped[instanceID] = state
+		}
+		delete(d.devices, instanceID)
+	}
+	d.mu.Unlock()
+	for instanceID, state := range stopped {
+		logFlappingStopped(instanceID, state)
+		if state.settle != nil {
+			state.settle()
+		}
+	}
+}
+
+// フラッピングの開始を重大度warningのFlappingイベントとして出力
+func logFlapping(instanceID string, state *flapState) {
+	logDeviceEvent(DeviceEvent{
+		Action:      "Flapping",
+		HostName:    state.hostName,
+		Severity:    severityWarning,
+		Fingerprint: deviceFingerprint(instanceID),
+		Explanation: fmt.Sprintf("%d connect/disconnect cycles within %s", state.flapTransitions/2, flapWindow),
+		Device:      flappingDevice(instanceID),
+	})
+}
+
+// フラッピングの終了を重大度noticeのFlappingStoppedイベントとして出力
+func logFlappingStopped(instanceID string, state *flapState) {
+	lastState := "disconnected"
+	if state.lastArrival {
+		lastState = "connected"
+	}
+	logDeviceEvent(DeviceEvent{
+		Action:      "FlappingStopped",
+		HostName:    state.hostName,
+		Severity:    severityNotice,
+		Fingerprint: deviceFingerprint(instanceID),
+		Explanation: fmt.Sprintf("stopped after %d cycles, last state %s", state.flapTransitions/2, lastState),
+		Device:      flappingDevice(instanceID),
+	})
+}
+
+// 接続時に記録した情報があればそれを、なければインスタンスIDのみのデバイスの情報を返す
+func flappingDevice(instanceID string) DeviceInfo {
+	if deviceInfo, ok := deviceCache.lookup(instanceID); ok {
+		return deviceInfo
+	}
+	return DeviceInfo{InstanceID: instanceID}
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFlappingSettles(t *testing.T) {
+	device := DeviceInfo{
+		InstanceID: `USB\VID_0781&PID_5581\4C530001230412345678`,
+		Service:    "USBSTOR",
+	}
+	tests := []struct {
+		name string
+		// 最後の接続・切断
+		last string
+		// フラッピングが収まった時点で出力されるイベント
+		want []string
+	}{
+		// ブロックする規則に一致するデバイスが接続されたままの場合も、ブロックする
+		{name: "connected", last: "Connected", want: []string{"FlappingStopped", "Blocked"}},
+		{name: "disconnected", last: "Disconnected", want: []string{"FlappingStopped", "Disconnected"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, Config{})
+			sink := useRecordingSink(t)
+			savedPolicy := currentPolicy()
+			setPolicy(Policy{Rules: []PolicyRule{{Action: policyBlock, VIDPID: "0781:5581"}}})
+			t.Cleanup(func() { setPolicy(savedPolicy) })
+			savedDetector := flapDetector
+			flapDetector = &FlapDetector{devices: map[string]*flapState{}}
+			t.Cleanup(func() { flapDetector = savedDetector })
+
+			actions := []string{"Connected", "Disconnected"}
+			for range flapCycleThreshold {
+				for _, action := range actions {
+					injectEvent(DeviceEvent{Action: action, Device: device})
+				}
+			}
+			injectEvent(DeviceEvent{Action: "Connected", Device: device})
+			if test.last == "Disconnected" {
+				injectEvent(DeviceEvent{Action: "Disconnected", Device: device})
+			}
+			// フラッピングが収まるまでに出力されたイベントは読み捨てる
+			sinkSends.Wait()
+			for {
+				if _, ok := sink.next(0); !ok {
+					break
+				}
+			}
+
+			flapDetector.flush(time.Now().Add(flapWindow + time.Second))
+			sinkSends.Wait()
+			var got []string
+			for {
+				event, ok := sink.next(0)
+				if !ok {
+					break
+				}
+				got = append(got, event.Action)
+			}
+			// 出力先への送信は非同期のため、順序は問わない
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(test.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("events = %v, want %v", got, want)
+			}
+		})
+	}
+}
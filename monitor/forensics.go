@@ -0,0 +1,302 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// USB大容量記憶装置のdevnodeが記録されるレジストリキー（HKLM）
+	usbstorKeyPath = `SYSTEM\CurrentControlSet\Enum\USBSTOR`
+	// ボリュームに割り当てたドライブ文字が記録されるレジストリキー（HKLM）
+	mountedDevicesKeyPath = `SYSTEM\MountedDevices`
+	// ドライブ文字の値の名前の接頭辞（例: \DosDevices\E:）
+	dosDevicesPrefix = `\DosDevices\`
+	// 証拠の取得元
+	forensicSourceUSBSTOR        = "USBSTOR"
+	forensicSourceMountedDevices = "MountedDevices"
+)
+
+// 過去に接続されたデバイスの証拠
+type ForensicDevice struct {
+	// インスタンスID（例: USBSTOR\DISK&VEN_SANDISK&PROD_CRUZER&REV_1.00\4C530001230101115195&0）
+	InstanceID string
+	// ベンダー・製品名・リビジョン（USBSTORのデバイスIDから取得）
+	Vendor   string `json:",omitempty"`
+	Product  string `json:",omitempty"`
+	Revision string `json:",omitempty"`
+	// シリアル番号（シリアル番号を持たないデバイスは空）
+	Serial       string `json:",omitempty"`
+	FriendlyName string `json:",omitempty"`
+	// 最後に割り当てられたドライブ文字
+	DriveLetters []string `json:",omitempty"`
+	// このホストでの接続履歴
+	History DeviceHistory
+	// setupapi.dev.logに記録されたインストールの日時
+	InstallTimes []time.Time `json:",omitempty"`
+	// 証拠の取得元（USBSTOR / MountedDevices / setupapi.dev.log）
+	Sources []string
+}
+
+// 過去に接続されたデバイスの証拠を、インスタンスIDごとにまとめた初回接続のデータベース（JSONファイル）
+type ForensicDatabase map[string]*ForensicDevice
+
+// データベースのパスの既定値
+func defaultForensicDatabasePath() string {
+	return filepath.Join(os.Getenv("ProgramData"), "usbmon", "devices.json")
+}
+
+// データベースを読み込む（ファイルがない場合は空）
+func loadForensicDatabase(path string) (ForensicDatabase, error) {
+	db := ForensicDatabase{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read device database: %w", err)
+	}
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("Failed to parse device database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// データベースを保存
+func saveForensicDatabase(path string, db ForensicDatabase) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create device database directory: %w", err)
+	}
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write device database: %w", err)
+	}
+	return nil
+}
+
+// 証拠をデータベースに統合（初回接続は最も古い日時、最後の接続・切断は最も新しい日時を残す）
+func (db ForensicDatabase) merge(device ForensicDevice) {
+	id := strings.ToUpper(device.InstanceID)
+	existing, ok := db[id]
+	if !ok {
+		device.InstanceID = id
+		db[id] = &device
+		return
+	}
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&existing.Vendor, device.Vendor)
+	fill(&existing.Product, device.Product)
+	fill(&existing.Revision, device.Revision)
+	fill(&existing.Serial, device.Serial)
+	fill(&existing.FriendlyName, device.FriendlyName)
+	existing.History.FirstInstalled = earlierTime(existing.History.FirstInstalled, device.History.FirstInstalled)
+	existing.History.LastArrival = laterTime(existing.History.LastArrival, device.History.LastArrival)
+	existing.History.LastRemoval = laterTime(existing.History.LastRemoval, device.History.LastRemoval)
+	for _, letter := range device.DriveLetters {
+		if !slices.Contains(existing.DriveLetters, letter) {
+			existing.DriveLetters = append(existing.DriveLetters, letter)
+		}
+	}
+	for _, t := range device.InstallTimes {
+		if !slices.ContainsFunc(existing.InstallTimes, t.Equal) {
+			existing.InstallTimes = append(existing.InstallTimes, t)
+		}
+	}
+	slices.SortFunc(existing.InstallTimes, time.Time.Compare)
+	for _, source := range device.Sources {
+		if !slices.Contains(existing.Sources, source) {
+			existing.Sources = append(existing.Sources, source)
+		}
+	}
+}
+
+// 古い方の日時（どちらかがnilの場合はもう一方）
+func earlierTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.Before(*a)) {
+		return b
+	}
+	return a
+}
+
+// 新しい方の日時（どちらかがnilの場合はもう一方）
+func laterTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// `usbmon forensics` サブコマンド
+// エージェントを導入する前に接続されたデバイスの証拠を集め、初回接続のデータベースに統合
+func runForensics(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: usbmon forensics (import-registry | import-setupapi [-log setupapi.dev.log]) [-db devices.json]")
+		return 2
+	}
+	fs := flag.NewFlagSet("forensics "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", defaultForensicDatabasePath(), "path to the device database to merge into")
+	logPath := fs.String("log", "", `path to setupapi.dev.log (default: all setupapi.dev*.log in %SystemRoot%\INF)`)
+	fs.Parse(args[1:])
+
+	var devices []ForensicDevice
+	var err error
+	switch args[0] {
+	case "import-registry":
+		devices, err = importRegistryEvidence()
+	case "import-setupapi":
+		paths := defaultSetupAPILogPaths()
+		if *logPath != "" {
+			paths = []string{*logPath}
+		}
+		devices, err = importSetupAPIEvidence(paths)
+	default:
+		fmt.Printf("unknown forensics command %q\n", args[0])
+		return 2
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	db, err := loadForensicDatabase(*dbPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for _, device := range devices {
+		db.merge(device)
+	}
+	if err := saveForensicDatabase(*dbPath, db); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("Imported %d devices into %s (%d devices in total)\n", len(devices), *dbPath, len(db))
+	return 0
+}
+
+// USBSTORとMountedDevicesのレジストリから、過去に接続されたUSB大容量記憶装置の証拠を集める
+func importRegistryEvidence() ([]ForensicDevice, error) {
+	usbstor, err := registry.OpenKey(registry.LOCAL_MACHINE, usbstorKeyPath, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open HKLM\\%s: %w", usbstorKeyPath, err)
+	}
+	defer usbstor.Close()
+	deviceIDs, err := usbstor.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read HKLM\\%s: %w", usbstorKeyPath, err)
+	}
+
+	driveLetters := readMountedDevices()
+	var devices []ForensicDevice
+	for _, deviceID := range deviceIDs {
+		key, err := registry.OpenKey(usbstor, deviceID, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		instances, _ := key.ReadSubKeyNames(0)
+		key.Close()
+		for _, instance := range instances {
+			instanceID := strings.ToUpper(`USBSTOR\` + deviceID + `\` + instance)
+			device := parseUSBSTORInstanceID(instanceID)
+			device.Sources = []string{forensicSourceUSBSTOR}
+			if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Enum\`+instanceID, registry.QUERY_VALUE); err == nil {
+				device.FriendlyName, _, _ = key.GetStringValue("FriendlyName")
+				key.Close()
+			}
+			// 接続履歴はdevnodeのプロパティから取得（切断されているデバイスも残っている）
+			if devInst, err := locateDevNodeWithFlags(instanceID, CM_LOCATE_DEVNODE_PHANTOM); err == nil {
+				device.History.FirstInstalled = getDevNodeTime(devInst, DEVPKEY_Device_FirstInstallDate)
+				device.History.LastArrival = getDevNodeTime(devInst, DEVPKEY_Device_LastArrivalDate)
+				device.History.LastRemoval = getDevNodeTime(devInst, DEVPKEY_Device_LastRemovalDate)
+			}
+			if letters, ok := driveLetters[instanceID]; ok {
+				device.DriveLetters = letters
+				device.Sources = append(device.Sources, forensicSourceMountedDevices)
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// USBSTORのインスタンスID（USBSTOR\DISK&VEN_x&PROD_y&REV_z\serial&0）からベンダー・製品名・シリアル番号を読み取る
+func parseUSBSTORInstanceID(instanceID string) ForensicDevice {
+	device := ForensicDevice{InstanceID: instanceID}
+	parts := strings.Split(instanceID, `\`)
+	if len(parts) != 3 {
+		return device
+	}
+	for _, field := range strings.Split(parts[1], "&") {
+		name, value, _ := strings.Cut(field, "_")
+		switch name {
+		case "VEN":
+			device.Vendor = value
+		case "PROD":
+			device.Product = value
+		case "REV":
+			device.Revision = value
+		}
+	}
+	// 末尾の &0 はLUN、シリアル番号を持たないデバイスはWindowsが生成した「&」を含むIDになる
+	serial := parts[2]
+	if i := strings.LastIndex(serial, "&"); i >= 0 {
+		serial = serial[:i]
+	}
+	if !strings.Contains(serial, "&") {
+		device.Serial = serial
+	}
+	return device
+}
+
+// MountedDevicesから、USBSTORのインスタンスIDごとに割り当てられたドライブ文字を読み取る
+// 値のデータは _??_USBSTOR#Disk&Ven_x&Prod_y&Rev_z#serial&0#{GUID} の形式のUTF-16文字列
+func readMountedDevices() map[string][]string {
+	letters := map[string][]string{}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, mountedDevicesKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return letters
+	}
+	defer key.Close()
+	names, _ := key.ReadValueNames(0)
+	for _, name := range names {
+		if !strings.HasPrefix(name, dosDevicesPrefix) {
+			continue
+		}
+		data, _, err := key.GetBinaryValue(name)
+		if err != nil || len(data)%2 != 0 {
+			continue
+		}
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		path := strings.ToUpper(string(utf16.Decode(u)))
+		parts := strings.Split(strings.TrimPrefix(path, `_??_`), "#")
+		if len(parts) < 3 || parts[0] != "USBSTOR" {
+			continue
+		}
+		instanceID := parts[0] + `\` + parts[1] + `\` + parts[2]
+		letters[instanceID] = append(letters[instanceID], strings.TrimPrefix(name, dosDevicesPrefix))
+	}
+	return letters
+}
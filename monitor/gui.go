@@ -0,0 +1,442 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ウィンドウとコントロールで使用される定数
+const (
+	// ウィンドウのスタイル（タイトルバー・枠・最小化・最大化のボタンを持つ通常のウィンドウ）
+	WS_OVERLAPPEDWINDOW = 0x00CF0000
+	WS_VISIBLE          = 0x10000000
+	WS_CHILD            = 0x40000000
+	WS_BORDER           = 0x00800000
+	// 既定の位置・大きさでウィンドウを作成
+	CW_USEDEFAULT = -0x80000000
+	// ウィンドウのメッセージ
+	WM_CLOSE     = 0x0010
+	WM_SIZE      = 0x0005
+	WM_SETFONT   = 0x0030
+	WM_NOTIFY    = 0x004E
+	WM_COMMAND   = 0x0111
+	WM_APP_GUI   = 0x8000 + 2
+	IDC_ARROW    = 32512
+	COLOR_WINDOW = 5
+	// 標準のGUIのフォント（GetStockObject）
+	DEFAULT_GUI_FONT = 17
+	// 一覧表示のウィンドウクラスとスタイル
+	WC_LISTVIEW                  = "SysListView32"
+	ICC_LISTVIEW_CLASSES         = 0x00000001
+	LVS_REPORT                   = 0x0001
+	LVS_SINGLESEL                = 0x0004
+	LVS_SHOWSELALWAYS            = 0x0008
+	LVS_EX_GRIDLINES             = 0x00000001
+	LVS_EX_FULLROWSELECT         = 0x00000020
+	LVM_FIRST                    = 0x1000
+	LVM_DELETEITEM               = LVM_FIRST + 8
+	LVM_GETNEXTITEM              = LVM_FIRST + 12
+	LVM_SETEXTENDEDLISTVIEWSTYLE = LVM_FIRST + 54
+	LVM_INSERTITEMW              = LVM_FIRST + 77
+	LVM_INSERTCOLUMNW            = LVM_FIRST + 97
+	LVM_SETITEMTEXTW             = LVM_FIRST + 116
+	LVCF_WIDTH                   = 0x0002
+	LVCF_TEXT                    = 0x0004
+	LVIF_TEXT                    = 0x0001
+	LVNI_SELECTED                = 0x0002
+	// 一覧表示を右クリックした時の通知（NM_RCLICK）
+	NM_RCLICK = 0xFFFFFFFB
+	// 右クリックのメニュー
+	MF_STRING       = 0x0000
+	MF_GRAYED       = 0x0001
+	TPM_RIGHTBUTTON = 0x0002
+	TPM_RETURNCMD   = 0x0100
+	// 結果を知らせるメッセージボックスのスタイル
+	MB_ICONERROR       = 0x00000010
+	MB_ICONINFORMATION = 0x00000040
+)
+
+const (
+	// コントロールの識別子
+	guiListID  = 1
+	guiPauseID = 2
+	// 右クリックのメニューの項目
+	guiMenuAllow = 1
+	guiMenuBlock = 2
+	guiMenuEject = 3
+	// 一覧に表示するイベントの数（古いものから削除）
+	guiMaxRows = 1000
+	// 一時停止ボタンの高さと余白
+	guiButtonHeight = 28
+	guiMargin       = 6
+	// 規則を追加した時のメモ
+	guiRuleNote = "gui"
+)
+
+// INITCOMMONCONTROLSEX構造体
+type initCommonControlsEx struct {
+	Size uint32
+	ICC  uint32
+}
+
+// POINT構造体（マウスカーソルの画面上の位置）
+type point struct {
+	X int32
+	Y int32
+}
+
+// LVCOLUMNW構造体
+type lvColumn struct {
+	Mask      uint32
+	Fmt       int32
+	Cx        int32
+	Text      *uint16
+	TextMax   int32
+	SubItem   int32
+	Image     int32
+	Order     int32
+	CxMin     int32
+	CxDefault int32
+	CxIdeal   int32
+}
+
+// LVITEMW構造体
+type lvItem struct {
+	Mask      uint32
+	Item      int32
+	SubItem   int32
+	State     uint32
+	StateMask uint32
+	Text      *uint16
+	TextMax   int32
+	Image     int32
+	LParam    uintptr
+	Indent    int32
+	GroupID   int32
+	Columns   uint32
+	PuColumns *uint32
+	PiColFmt  *int32
+	Group     int32
+}
+
+// NMHDR構造体（WM_NOTIFYのlParam）
+type nmHdr struct {
+	HwndFrom windows.HWND
+	IDFrom   uintptr
+	Code     uint32
+}
+
+// 一覧の列（見出しと幅）
+var guiColumns = []struct {
+	title string
+	width int32
+}{
+	{"TIME", 80},
+	{"ACTION", 120},
+	{"NAME", 260},
+	{"SERIAL", 180},
+}
+
+// イベントの一覧を表示するウィンドウ
+// ウィンドウは監視のメッセージループのスレッドで作成し、イベントはPostMessageでそのスレッドに渡す
+type EventWindow struct {
+	mu sync.Mutex
+	// 一覧にまだ追加していないイベント（一時停止中はたまっていく）
+	pending []DeviceEvent
+	// メッセージループのスレッドだけが使用する
+	hWnd   windows.HWND
+	list   windows.HWND
+	pause  windows.HWND
+	paused bool
+	// 一覧の行に対応するイベント（新しい順）
+	rows []DeviceEvent
+}
+
+// イベントの一覧のウィンドウ（-guiを指定した場合のみ）
+// ウォッチドッグがメッセージループを作り直すと、新しいスレッドで作成したウィンドウに置き換わる
+var eventWindow atomic.Pointer[EventWindow]
+
+// ウィンドウのハンドルごとのイベントの一覧のウィンドウ
+// ウィンドウクラスは最初に登録したものを使い続けるため、ウィンドウプロシージャはここから対象のウィンドウを探す
+var eventWindows sync.Map
+
+// イベントの一覧のウィンドウを作成して表示
+// 監視のメッセージループのスレッドで呼び出す
+func openEventWindow() (*EventWindow, error) {
+	if err := initCommonControls(ICC_LISTVIEW_CLASSES); err != nil {
+		return nil, fmt.Errorf("Failed to initialize common controls: %w", err)
+	}
+	hInstance, err := getModuleHandle()
+	if err != nil {
+		return nil, err
+	}
+	w := &EventWindow{}
+	className, _ := windows.UTF16PtrFromString("USBMonitorEventWindow")
+	cursor, err := loadCursor(IDC_ARROW)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	wndClass := Wndclassex{
+		CbSize:        uint32(unsafe.Sizeof(Wndclassex{})),
+		LpfnWndProc:   eventWindowProc,
+		HInstance:     hInstance,
+		HCursor:       cursor,
+		HbrBackground: windows.Handle(COLOR_WINDOW + 1),
+		LpszClassName: className,
+	}
+	// ウォッチドッグがウィンドウを作り直す場合は、登録済みのウィンドウクラスを使用
+	if err := registerClassEx(&wndClass); err != nil && !errors.Is(err, windows.ERROR_CLASS_ALREADY_EXISTS) {
+		return nil, fmt.Errorf("Failed to register event window class: %w", err)
+	}
+	if w.hWnd, err = createStyledWindow(0, className, "usbmon", WS_OVERLAPPEDWINDOW|WS_VISIBLE, CW_USEDEFAULT, CW_USEDEFAULT, 720, 420, 0, 0, hInstance); err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	eventWindows.Store(w.hWnd, w)
+
+	font, err := getStockObject(DEFAULT_GUI_FONT)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	buttonClass, _ := windows.UTF16PtrFromString("BUTTON")
+	if w.pause, err = createStyledWindow(0, buttonClass, tr("Pause"), WS_CHILD|WS_VISIBLE, 0, 0, 0, 0, w.hWnd, guiPauseID, hInstance); err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	listClass, _ := windows.UTF16PtrFromString(WC_LISTVIEW)
+	if w.list, err = createStyledWindow(0, listClass, "", WS_CHILD|WS_VISIBLE|WS_BORDER|LVS_REPORT|LVS_SINGLESEL|LVS_SHOWSELALWAYS, 0, 0, 0, 0, w.hWnd, guiListID, hInstance); err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	sendMessage(w.pause, WM_SETFONT, uintptr(font), 1)
+	sendMessage(w.list, WM_SETFONT, uintptr(font), 1)
+	sendMessage(w.list, LVM_SETEXTENDEDLISTVIEWSTYLE, 0, LVS_EX_FULLROWSELECT|LVS_EX_GRIDLINES)
+	for i, column := range guiColumns {
+		title, _ := windows.UTF16PtrFromString(tr(column.title))
+		col := lvColumn{Mask: LVCF_TEXT | LVCF_WIDTH, Cx: column.width, Text: title}
+		sendMessage(w.list, LVM_INSERTCOLUMNW, uintptr(i), uintptr(unsafe.Pointer(&col)))
+	}
+	if err := w.layout(); err != nil {
+		return nil, fmt.Errorf("Failed to create event window: %w", err)
+	}
+	eventWindow.Store(w)
+	return w, nil
+}
+
+// イベントの一覧のウィンドウを破棄
+// ウィンドウを作成したメッセージループのスレッドで呼び出す
+func (w *EventWindow) destroy() error {
+	eventWindow.CompareAndSwap(w, nil)
+	err := destroyWindow(w.hWnd)
+	eventWindows.Delete(w.hWnd)
+	return err
+}
+
+// イベントの一覧のウィンドウクラスのウィンドウプロシージャ（ハンドルから対象のウィンドウを探して処理を渡す）
+var eventWindowProc = newWindowProc(func(hWnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	if w, ok := eventWindows.Load(hWnd); ok {
+		return w.(*EventWindow).wndProc(hWnd, msg, wParam, lParam)
+	}
+	return defWindowProc(hWnd, msg, wParam, lParam)
+})
+
+// 子ウィンドウ（ボタン・一覧表示）を含むウィンドウを作成
+func createStyledWindow(exStyle uint32, className *uint16, title string, style uint32, x, y, width, height int32, parent windows.HWND, id uintptr, hInstance windows.Handle) (windows.HWND, error) {
+	titleText, err := windows.UTF16PtrFromString(title)
+	if err != nil {
+		return 0, err
+	}
+	hWnd, err := callCreateWindowEx(exStyle, className, titleText, style, x, y, width, height, parent, id, hInstance, 0)
+	return hWnd, win32Result("CreateWindowExW", uintptr(hWnd), err, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(titleText)), uintptr(style), uintptr(parent), id)
+}
+
+// イベントを一覧に追加するよう、メッセージループに依頼（どのゴルーチンからも呼び出せる）
+func (w *EventWindow) add(event DeviceEvent) {
+	w.mu.Lock()
+	w.pending = append(w.pending, event)
+	w.mu.Unlock()
+	postMessage(w.hWnd, WM_APP_GUI, 0, 0)
+}
+
+// ウィンドウのメッセージを処理
+func (w *EventWindow) wndProc(hWnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	switch msg {
+	case WM_SIZE:
+		if err := w.layout(); err != nil {
+			fmt.Println(err)
+		}
+	case WM_APP_GUI:
+		if !w.paused {
+			w.flush()
+		}
+	case WM_COMMAND:
+		if wParam&0xFFFF == guiPauseID {
+			w.togglePause()
+		}
+	case WM_NOTIFY:
+		hdr := *(**nmHdr)(unsafe.Pointer(&lParam))
+		if hdr.HwndFrom == w.list && hdr.Code == NM_RCLICK {
+			w.showMenu()
+		}
+	case WM_CLOSE:
+		// ウィンドウを閉じたら監視を終了
+		postQuitMessage(0)
+	default:
+		return defWindowProc(hWnd, msg, wParam, lParam)
+	}
+	return 0
+}
+
+// ウィンドウの大きさに合わせて、ボタンと一覧表示を配置
+func (w *EventWindow) layout() error {
+	rect, err := getClientRect(w.hWnd)
+	if err != nil {
+		return err
+	}
+	if err := moveWindow(w.pause, guiMargin, guiMargin, 100, guiButtonHeight, true); err != nil {
+		return err
+	}
+	top := int32(guiMargin*2 + guiButtonHeight)
+	return moveWindow(w.list, guiMargin, top, max(rect.Right-guiMargin*2, 0), max(rect.Bottom-top-guiMargin, 0), true)
+}
+
+// 一時停止・再開を切り替える（再開したら、一時停止中のイベントを追加）
+func (w *EventWindow) togglePause() {
+	w.paused = !w.paused
+	label := tr("Pause")
+	if w.paused {
+		label = tr("Resume")
+	}
+	if err := setWindowText(w.pause, label); err != nil {
+		fmt.Println(err)
+	}
+	if !w.paused {
+		w.flush()
+	}
+}
+
+// たまっているイベントを一覧の先頭に追加
+func (w *EventWindow) flush() {
+	w.mu.Lock()
+	events := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	for _, event := range events {
+		w.insertRow(event)
+	}
+}
+
+// イベントを一覧の先頭の行として追加
+func (w *EventWindow) insertRow(event DeviceEvent) {
+	values := []string{
+		time.Now().Format("15:04:05"),
+		tr(event.Action),
+		event.Device.FriendlyName,
+		event.Device.SerialNumber,
+	}
+	text, _ := windows.UTF16PtrFromString(values[0])
+	item := lvItem{Mask: LVIF_TEXT, Text: text}
+	sendMessage(w.list, LVM_INSERTITEMW, 0, uintptr(unsafe.Pointer(&item)))
+	for i := 1; i < len(values); i++ {
+		text, _ := windows.UTF16PtrFromString(values[i])
+		item := lvItem{SubItem: int32(i), Text: text}
+		sendMessage(w.list, LVM_SETITEMTEXTW, 0, uintptr(unsafe.Pointer(&item)))
+	}
+	w.rows = append([]DeviceEvent{event}, w.rows...)
+	if len(w.rows) > guiMaxRows {
+		w.rows = w.rows[:guiMaxRows]
+		sendMessage(w.list, LVM_DELETEITEM, guiMaxRows, 0)
+	}
+}
+
+// 選択した行のイベントに対する操作（許可・ブロック・取り外し）のメニューを表示
+func (w *EventWindow) showMenu() {
+	selected := int(int32(sendMessage(w.list, LVM_GETNEXTITEM, ^uintptr(0), LVNI_SELECTED)))
+	if selected < 0 || selected >= len(w.rows) {
+		return
+	}
+	event := w.rows[selected]
+	menu, err := createPopupMenu()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer func() {
+		if err := destroyMenu(menu); err != nil {
+			fmt.Println(err)
+		}
+	}()
+	if err := errors.Join(
+		addMenuItem(menu, guiMenuAllow, tr("Allow"), event.Device.InstanceID == ""),
+		addMenuItem(menu, guiMenuBlock, tr("Block"), event.Device.InstanceID == ""),
+		addMenuItem(menu, guiMenuEject, tr("Eject"), event.Volume == ""),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	pt, err := getCursorPos()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	// 前面にできなくてもメニューは表示できる（メニューの外をクリックしても閉じないだけ）
+	setForegroundWindow(w.hWnd)
+	// 選んだ項目の識別子（閉じた場合と失敗した場合は0）
+	command := trackPopupMenu(menu, TPM_RETURNCMD|TPM_RIGHTBUTTON, pt.X, pt.Y, 0, w.hWnd, nil)
+	// 再読み込みや取り外しはメッセージループを使用する・時間がかかるため、別のゴルーチンで実行
+	switch command {
+	case guiMenuAllow:
+		go w.runAction(func() error { return addDeviceRule(policyAllow, event.Device) })
+	case guiMenuBlock:
+		go w.runAction(func() error { return addDeviceRule(policyBlock, event.Device) })
+	case guiMenuEject:
+		go w.runAction(func() error { return ejectVolume(event.Volume) })
+	}
+}
+
+// メニューの項目を追加（disabledの場合は選べない項目にする）
+func addMenuItem(menu windows.Handle, id uintptr, text string, disabled bool) error {
+	flags := uint32(MF_STRING)
+	if disabled {
+		flags |= MF_GRAYED
+	}
+	return appendMenu(menu, flags, id, text)
+}
+
+// 操作を実行し、結果をメッセージボックスで知らせる
+func (w *EventWindow) runAction(action func() error) {
+	title, _ := windows.UTF16PtrFromString("usbmon")
+	if err := action(); err != nil {
+		text, _ := windows.UTF16PtrFromString(err.Error())
+		windows.MessageBox(w.hWnd, text, title, MB_ICONERROR)
+		return
+	}
+	text, _ := windows.UTF16PtrFromString(tr("Done"))
+	windows.MessageBox(w.hWnd, text, title, MB_ICONINFORMATION)
+}
+
+// デバイス（VID:PIDとシリアル番号）の規則をポリシーファイルに追加し、監視に読み込ませる
+func addDeviceRule(action string, device DeviceInfo) error {
+	vid, pid := parseVIDPID(device.InstanceID)
+	rule := PolicyRule{Action: action, Serial: deviceSerial(device.InstanceID), Note: guiRuleNote, Added: time.Now()}
+	if vid != "" && pid != "" {
+		rule.VIDPID = vid + ":" + pid
+	}
+	if rule.VIDPID == "" && rule.Serial == "" {
+		return fmt.Errorf("no VID:PID or serial number for %s", device.InstanceID)
+	}
+	path := policyPath(currentConfig())
+	p, err := loadPolicy(path)
+	if err != nil {
+		return err
+	}
+	p.Rules = append(p.Rules, rule)
+	if err := savePolicy(path, p); err != nil {
+		return err
+	}
+	return requestReload()
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// 監視を開始した日時
+var monitorStarted = time.Now()
+
+// 最後にイベントを出力した日時（UnixNano）
+var lastEventTime atomic.Int64
+
+// 監視が動作していることを知らせるハートビートの設定
+type HeartbeatConfig struct {
+	// ハートビートを送る間隔（例: "5m"、0で送らない）
+	Interval Duration `json:"interval"`
+	// ハートビートを送る出力先の名前（sinksの名前、重大度のroutesとは別に指定）
+	Sinks []string `json:"sinks"`
+}
+
+// 監視の状態（Heartbeatイベントで送る）
+type Heartbeat struct {
+	// usbmonのバージョン
+	Version string
+	// 監視を開始してからの時間
+	Uptime Duration
+	// 最後にイベントを出力した日時（出力していない場合はゼロ値）
+	LastEvent time.Time
+	// ドライバのインストール待ちのデバイスの数
+	PendingDrivers int
+	// マウントされているUSBストレージのボリュームの数
+	VolumeSessions int
+	// 出力を制限している期間の数
+	RateLimitWindows int
+	// デバイスのキャッシュで解決できた回数と、列挙し直した回数
+	CacheHits   int
+	CacheMisses int
+}
+
+// 現在の監視の状態
+func currentHeartbeat() Heartbeat {
+	heartbeat := Heartbeat{
+		Version: version,
+		Uptime:  Duration(time.Since(monitorStarted).Round(time.Second)),
+	}
+	if last := lastEventTime.Load(); last != 0 {
+		heartbeat.LastEvent = time.Unix(0, last)
+	}
+	pendingDrivers.mu.Lock()
+	heartbeat.PendingDrivers = len(pendingDrivers.events)
+	pendingDrivers.mu.Unlock()
+	volumeSessions.mu.Lock()
+	heartbeat.VolumeSessions = len(volumeSessions.sessions)
+	volumeSessions.mu.Unlock()
+	rateLimiter.mu.Lock()
+	heartbeat.RateLimitWindows = len(rateLimiter.windows)
+	rateLimiter.mu.Unlock()
+	heartbeat.CacheHits, heartbeat.CacheMisses = deviceCache.stats()
+	return heartbeat
+}
+
+// 設定した間隔でHeartbeatイベントを出力先に送る
+// 監査ログには記録せず、メンテナンス期間中も送る（ハートビートが途絶えたことを監視の停止として検出するため）
+func runHeartbeat(ctx context.Context) {
+	for {
+		cfg := currentConfig()
+		interval := time.Duration(cfg.Heartbeat.Interval)
+		if interval <= 0 {
+			// 設定の再読み込みで有効になるまで待つ
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		heartbeat := currentHeartbeat()
+		event := DeviceEvent{
+			Action:       "Heartbeat",
+			HostName:     getHostName(),
+			Severity:     severityInfo,
+			AgentVersion: version,
+			Machine:      machineIdentity(),
+			Heartbeat:    &heartbeat,
+		}
+		sinksMu.RLock()
+		sinks := runningSinks
+		sinksMu.RUnlock()
+		for _, name := range currentConfig().Heartbeat.Sinks {
+			sink, ok := sinks[name]
+			if !ok {
+				continue
+			}
+			errorReporter.sinkResult(name, sink.send(eventSigner.sign(event)))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// HIDデバイスのレポートディスクリプタを解析するAPI群を提供するhid.dllから関数をロード
+var (
+	hid = syscall.NewLazyDLL("hid.dll")
+	// HIDデバイスの解析済みレポートディスクリプタを取得
+	procHidD_GetPreparsedData = hid.NewProc("HidD_GetPreparsedData")
+	// 解析済みレポートディスクリプタを解放
+	procHidD_FreePreparsedData = hid.NewProc("HidD_FreePreparsedData")
+	// トップレベルコレクションのUsage Page / Usageなどを取得
+	procHidP_GetCaps = hid.NewProc("HidP_GetCaps")
+)
+
+const (
+	// HidP_GetCapsの成功を示す戻り値（HIDP_STATUS_SUCCESS）
+	HIDP_STATUS_SUCCESS = 0x00110000
+	// HIDP_CAPS構造体のサイズ
+	hidpCapsSize = 64
+	// HIDデバイスのdevnodeのインスタンスIDの先頭部分
+	hidPrefix = `HID\`
+)
+
+// HIDデバイスのインターフェースクラスGUID（GUID_DEVINTERFACE_HID）
+var hidInterfaceGuid = windows.GUID{
+	Data1: 0x4D1E55B2,
+	Data2: 0xF16F,
+	Data3: 0x11CF,
+	Data4: [8]byte{0x88, 0xCB, 0x00, 0x11, 0x11, 0x00, 0x00, 0x30},
+}
+
+// HIDのトップレベルコレクションの用途
+type HIDUsage struct {
+	// Usage Page（例: 0x01 Generic Desktop、0xF1D0 FIDO Alliance）
+	UsagePage uint16
+	// Usage（例: 0x06 Keyboard、0x02 Mouse）
+	Usage uint16
+	// Usage Page / Usageから判定した種類（例: keyboard、vendor-defined）
+	Type string
+}
+
+// HIDのトップレベルコレクションの種類（ポリシーのhid_typeに指定する）
+const (
+	hidTypeKeyboard      = "keyboard"
+	hidTypeKeypad        = "keypad"
+	hidTypeMouse         = "mouse"
+	hidTypeJoystick      = "joystick"
+	hidTypeGamepad       = "gamepad"
+	hidTypeSystemControl = "system-control"
+	hidTypeConsumer      = "consumer-control"
+	hidTypeDigitizer     = "digitizer"
+	hidTypeTelephony     = "telephony"
+	hidTypeSensor        = "sensor"
+	hidTypeFIDO          = "fido"
+	hidTypeVendorDefined = "vendor-defined"
+	hidTypeOther         = "other"
+)
+
+// ベンダー定義のUsage Pageの範囲の先頭（0xFF00〜0xFFFF）
+const hidVendorDefinedStart = 0xFF00
+
+// Usage Page / Usageから種類を判定
+func hidUsageType(usagePage uint16, usage uint16) string {
+	switch {
+	case usagePage >= hidVendorDefinedStart:
+		return hidTypeVendorDefined
+	case usagePage == fidoUsagePage:
+		return hidTypeFIDO
+	case usagePage == 0x0C:
+		return hidTypeConsumer
+	case usagePage == 0x0D:
+		return hidTypeDigitizer
+	case usagePage == 0x0B:
+		return hidTypeTelephony
+	case usagePage == 0x20:
+		return hidTypeSensor
+	case usagePage != 0x01:
+		return hidTypeOther
+	}
+	// Generic Desktop
+	switch usage {
+	case 0x02:
+		return hidTypeMouse
+	case 0x04:
+		return hidTypeJoystick
+	case 0x05:
+		return hidTypeGamepad
+	case 0x06:
+		return hidTypeKeyboard
+	case 0x07:
+		return hidTypeKeypad
+	case 0x80:
+		return hidTypeSystemControl
+	}
+	return hidTypeOther
+}
+
+// 表示用の文字列（例: 0x0001:0x0006 keyboard）
+func (u HIDUsage) String() string {
+	return fmt.Sprintf("0x%04X:0x%04X %s", u.UsagePage, u.Usage, u.Type)
+}
+
+// デバイスのHIDのトップレベルコレクションに、指定した種類のものがあるかを判定
+func hasHIDType(deviceInfo DeviceInfo, hidType string) bool {
+	for _, usage := range deviceInfo.HIDUsages {
+		if strings.EqualFold(usage.Type, hidType) {
+			return true
+		}
+	}
+	return false
+}
+
+// デバイス自身と配下にあるHIDデバイスのトップレベルコレクションの用途を設定
+func setHIDUsages(deviceInfo *DeviceInfo) {
+	devInst, err := locateDevNode(deviceInfo.InstanceID)
+	if err != nil {
+		return
+	}
+	var walk func(uint32)
+	walk = func(node uint32) {
+		if id := getDevNodeID(node); strings.HasPrefix(id, hidPrefix) {
+			if usage, ok := getHIDUsage(id); ok {
+				deviceInfo.HIDUsages = append(deviceInfo.HIDUsages, usage)
+			}
+		}
+		for _, child := range getChildDevNodes(node) {
+			walk(child)
+		}
+	}
+	walk(devInst)
+}
+
+// HIDデバイスのトップレベルコレクションのUsage Page / Usageを取得
+func getHIDUsage(instanceID string) (HIDUsage, bool) {
+	paths, err := windows.CM_Get_Device_Interface_List(instanceID, &hidInterfaceGuid, windows.CM_GET_DEVICE_INTERFACE_LIST_PRESENT)
+	if err != nil || len(paths) == 0 {
+		return HIDUsage{}, false
+	}
+	name, err := windows.UTF16PtrFromString(paths[0])
+	if err != nil {
+		return HIDUsage{}, false
+	}
+	// キーボードやマウスはOSが排他的に開いているため、アクセス権なしで開く
+	h, err := windows.CreateFile(name, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return HIDUsage{}, false
+	}
+	defer windows.CloseHandle(h)
+
+	var preparsed uintptr
+	if ret, _, _ := procHidD_GetPreparsedData.Call(uintptr(h), uintptr(unsafe.Pointer(&preparsed))); ret == 0 {
+		return HIDUsage{}, false
+	}
+	defer procHidD_FreePreparsedData.Call(preparsed)
+
+	// HIDP_CAPS構造体（先頭がUsage、Usage Pageの順）
+	var caps [hidpCapsSize]byte
+	if ret, _, _ := procHidP_GetCaps.Call(preparsed, uintptr(unsafe.Pointer(&caps[0]))); ret != HIDP_STATUS_SUCCESS {
+		return HIDUsage{}, false
+	}
+	usage := HIDUsage{
+		Usage:     uint16(caps[0]) | uint16(caps[1])<<8,
+		UsagePage: uint16(caps[2]) | uint16(caps[3])<<8,
+	}
+	usage.Type = hidUsageType(usage.UsagePage, usage.Usage)
+	return usage, true
+}
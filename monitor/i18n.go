@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// kernel32.dllからGetUserDefaultLocaleName関数をロード
+// ユーザーの既定のロケール名（例: ja-JP）を取得する関数
+var procGetUserDefaultLocaleName = kernel32.NewProc("GetUserDefaultLocaleName")
+
+// ロケール名の最大の長さ（LOCALE_NAME_MAX_LENGTH）
+const LOCALE_NAME_MAX_LENGTH = 85
+
+// 出力する言語（ja / en）
+var outputLang = "en"
+
+// 英語の出力メッセージ（書式）ごとの翻訳
+var messageCatalog = map[string]map[string]string{
+	"ja": {
+		// イベントの種類
+		"Connected":        "接続",
+		"Present":          "接続済み",
+		"Missing":          "未接続",
+		"Restored":         "再接続",
+		"Flapping":         "フラッピング",
+		"FlappingStopped":  "フラッピング終了",
+		"Suppressed":       "抑制",
+		"Watchdog":         "ウォッチドッグ",
+		"Disconnected":     "切断",
+		"Problem":          "問題発生",
+		"DriverInstalled":  "ドライバインストール完了",
+		"Blocked":          "ブロック",
+		"Anomaly":          "異常",
+		"Threshold":        "しきい値超過",
+		"FileAccess":       "ファイルアクセス",
+		"FileTransfer":     "ファイル書き込み",
+		"Reenumerated":     "再列挙",
+		"DuplicateSerial":  "シリアル番号の重複",
+		"IdentityMorph":    "インターフェースの追加",
+		"Unencrypted":      "暗号化されていないメディア",
+		"EncryptionPrompt": "暗号化の確認",
+		"Heartbeat":        "ハートビート",
+		"Inventory":        "インベントリ",
+		"Paused":           "一時停止",
+		"Resumed":          "再開",
+		// イベントの項目
+		"Host=%s, ":                              "ホスト=%s, ",
+		"Class=%s, ":                             "クラス=%s, ",
+		"Source=%s, ":                            "検出元=%s, ",
+		"Instance ID=%s\n":                       "インスタンスID=%s\n",
+		"Instance ID=%s, ":                       "インスタンスID=%s, ",
+		"Type=%s, ":                              "種類=%s, ",
+		"Severity=%s, ":                          "重大度=%s, ",
+		"Policy=%s, ":                            "ポリシー=%s, ",
+		"Owner=%s, ":                             "所有者=%s, ",
+		"Failed to enrich event: Field=%s: %v\n": "イベントの項目の追加に失敗しました: 項目=%s: %v\n",
+		"Failed to enrich event: Command=%s: %v\n":                              "イベントの項目の追加に失敗しました: プログラム=%s: %v\n",
+		"Enrichment queue is full, sending without command fields: Action=%s\n": "項目の追加を待つイベントが多すぎるため、プログラムの項目なしで出力します: 種類=%s\n",
+		"Fields=[%s], ":                              "項目=[%s], ",
+		"Note=%s, ":                                  "メモ=%s, ",
+		"Explanation=%s, ":                           "理由=%s, ",
+		"Paused by %s until %s: %s":                  "%sが%sまで一時停止: %s",
+		"Pause by %s expired":                        "%sによる一時停止の期間が終了",
+		"Resumed by %s (paused by %s)":               "%sが再開（一時停止したユーザー: %s）",
+		"Program execution blocked until removal":    "取り外すまでプログラムの実行を禁止",
+		"Program execution could not be blocked: %v": "プログラムの実行を禁止できませんでした: %v",
+		"Encrypt USB drive":                          "USBドライブの暗号化",
+		"%s (%s) is not encrypted. Start BitLocker To Go encryption now?": "%s（%s）は暗号化されていません。BitLocker To Goで暗号化を開始しますか?",
+		"File=%s, Access=%s, User=%s, Process=%s, ":                       "ファイル=%s, アクセス=%s, ユーザー=%s, プロセス=%s, ",
+		"File=%s, Change=%s, Size=%d, SHA256=%s, ":                        "ファイル=%s, 変更=%s, サイズ=%d, SHA256=%s, ",
+		"Devices=%d, Added=%d, Removed=%d\n":                              "デバイス=%d, 接続=%d, 切断=%d\n",
+		"Version=%s, Uptime=%s, Last Event=%s, Pending Drivers=%d, Volumes=%d, Rate Limits=%d, Cache Hits=%d, Cache Misses=%d\n": "バージョン=%s, 稼働時間=%s, 最後のイベント=%s, ドライバ待ち=%d, ボリューム=%d, 出力制限=%d, キャッシュヒット=%d, キャッシュミス=%d\n",
+		"Name=%s, ":                                  "名前=%s, ",
+		"Device Manufacturer=%s, ":                   "製造元=%s, ",
+		"Serial Number=%s, ":                         "シリアル番号=%s, ",
+		"Port=%s port %d, ":                          "ポート=%s ポート%d, ",
+		"Speed=%s (USB %s), ":                        "速度=%s (USB %s), ",
+		"Power=%dmA (%s powered), ":                  "電力=%dmA (%s給電), ",
+		"Interfaces=[%s], ":                          "インターフェース=[%s], ",
+		"COM Ports=%s, ":                             "COMポート=%s, ",
+		"HID Usages=%s, ":                            "HID用途=%s, ",
+		"MAC=%s, ":                                   "MACアドレス=%s, ",
+		"Driver=%s %s (%s), ":                        "ドライバ=%s %s (%s), ",
+		"Problem=%s, ":                               "問題=%s, ",
+		"Parent=%s, ":                                "親=%s, ",
+		"Siblings=[%s], ":                            "兄弟=[%s], ",
+		"Location=%s (%s), ":                         "位置=%s (%s), ",
+		"Ready Latency=%s":                           "準備時間=%s",
+		", Volume=%s, Mount Latency=%s":              ", ボリューム=%s, マウント時間=%s",
+		"Failed to reload config: %v\n":              "設定の再読み込みに失敗しました: %v\n",
+		"Config reloaded: ":                          "設定を再読み込みしました: ",
+		"Policy updated: URL=%s, Rules=%d\n":         "ポリシーを更新しました: URL=%s, 規則=%d\n",
+		"Updated: Version=%s -> %s\n":                "更新しました: バージョン=%s -> %s\n",
+		"Torn audit record moved to %s (%d bytes)\n": "壊れた監査ログのレコードを%sに移しました（%dバイト）\n",
+		"Torn audit records quarantined in %s (%d bytes, not verified)\n": "壊れた監査ログのレコードが%sに移されています（%dバイト、検証の対象外）\n",
+		"Audit log archived: Records=%d\n":                                "監査ログをアーカイブしました: レコード=%d\n",
+		"Audit log pruned: Records=%d\n":                                  "監査ログを削除しました: レコード=%d\n",
+		"Path=%s, ":                                                       "パス=%s, ",
+		"Watch Classes=%s\n":                                              "監視対象=%s\n",
+		// 表形式の見出し
+		"TIME":        "時刻",
+		"ACTION":      "イベント",
+		"TYPE":        "種類",
+		"SEVERITY":    "重大度",
+		"NAME":        "名前",
+		"INSTANCE ID": "インスタンスID",
+		// イベントの一覧のウィンドウ
+		"SERIAL": "シリアル番号",
+		"Pause":  "一時停止",
+		"Resume": "再開",
+		"Allow":  "許可",
+		"Block":  "ブロック",
+		"Eject":  "取り外し",
+		"Done":   "完了しました",
+		// ダッシュボード
+		"usbmon %s - %s - Devices=%d, Events=%d, Severity>=%s": "usbmon %s - %s - デバイス=%d, イベント=%d, 重大度>=%s",
+		"CONNECTED DEVICES": "接続中のデバイス",
+		"EVENTS":            "イベント",
+		"DEVICE DETAILS":    "デバイスの詳細",
+		"q: quit  ↑↓: select  Enter: details  Esc: close  s: severity  b: blocked only  c: clear": "q: 終了  ↑↓: 選択  Enter: 詳細  Esc: 閉じる  s: 重大度  b: ブロックのみ  c: 消去",
+	},
+}
+
+// 出力する言語に翻訳したメッセージを返す（翻訳がなければ英語のまま）
+func tr(message string) string {
+	if translated, ok := messageCatalog[outputLang][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// 対応している言語かを確認
+func checkLang(lang string) error {
+	if lang == "en" {
+		return nil
+	}
+	if _, ok := messageCatalog[lang]; ok {
+		return nil
+	}
+	return fmt.Errorf("unsupported language %q (use ja or en)", lang)
+}
+
+// OSのロケールから出力する言語を決める（日本語以外は英語）
+func systemLang() string {
+	var buffer [LOCALE_NAME_MAX_LENGTH]uint16
+	ret, _, _ := procGetUserDefaultLocaleName.Call(uintptr(unsafe.Pointer(&buffer[0])), uintptr(len(buffer)))
+	if ret == 0 {
+		return "en"
+	}
+	if strings.HasPrefix(strings.ToLower(windows.UTF16ToString(buffer[:])), "ja") {
+		return "ja"
+	}
+	return "en"
+}
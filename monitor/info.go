@@ -0,0 +1,187 @@
+package monitor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// デバイスのプロパティの種類（DEVPROPTYPE）
+const DEVPROP_TYPE_FILETIME = 0x00000010
+
+// デバイスのプロパティを識別するキー（DEVPROPKEY構造体）
+type DevPropKey struct {
+	FmtID windows.GUID
+	PID   uint32
+}
+
+// デバイスの接続履歴に関するプロパティのGUID
+var devicePropertyDateGuid = windows.GUID{
+	Data1: 0x83da6326,
+	Data2: 0x97a6,
+	Data3: 0x4088,
+	Data4: [8]byte{0x94, 0x53, 0xa1, 0x92, 0x3f, 0x57, 0x3b, 0x29},
+}
+
+var (
+	// このホストに初めてインストールされた日時（DEVPKEY_Device_FirstInstallDate）
+	DEVPKEY_Device_FirstInstallDate = DevPropKey{devicePropertyDateGuid, 101}
+	// 最後に接続された日時（DEVPKEY_Device_LastArrivalDate）
+	DEVPKEY_Device_LastArrivalDate = DevPropKey{devicePropertyDateGuid, 102}
+	// 最後に切断された日時（DEVPKEY_Device_LastRemovalDate）
+	DEVPKEY_Device_LastRemovalDate = DevPropKey{devicePropertyDateGuid, 103}
+)
+
+// 1つのデバイスについて分かることをすべてまとめた情報
+type DeviceReport struct {
+	// 現在接続されているかどうか
+	Present bool
+	// デバイスの種類（例: Camera）
+	DeviceType string `json:",omitempty"`
+	// デバイスのプロパティ・トポロジー・ドライバ・問題コードなど
+	Device DeviceInfo
+	// このホストでの接続履歴
+	History DeviceHistory
+}
+
+// このホストでの接続履歴
+type DeviceHistory struct {
+	FirstInstalled *time.Time `json:",omitempty"`
+	LastArrival    *time.Time `json:",omitempty"`
+	LastRemoval    *time.Time `json:",omitempty"`
+}
+
+// `usbmon info` サブコマンド
+// シリアル番号・インスタンスID・VID:PIDで指定したデバイスの情報をすべてJSONで出力
+func runInfo(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	serial := fs.String("serial", "", "device serial number (last part of the instance ID)")
+	id := fs.String("id", "", `device instance ID (e.g. USB\VID_046D&PID_C52B\5&2C0E7D7&0&2)`)
+	vidPid := fs.String("vidpid", "", "vendor and product ID (e.g. 046D:C52B)")
+	fs.Parse(args)
+
+	instanceIDs, err := findDevices(*serial, *id, *vidPid)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("usage: usbmon info (-serial XYZ | -id <instance ID> | -vidpid 046D:C52B)")
+		return 2
+	}
+	if len(instanceIDs) == 0 {
+		fmt.Println("No matching device found")
+		return 1
+	}
+
+	// 多数のデバイスが一致した場合に備えて、プロパティを並行して取得
+	reports := make([]DeviceReport, len(instanceIDs))
+	forEachParallel(len(instanceIDs), func(i int) {
+		reports[i] = getDeviceReport(instanceIDs[i])
+	})
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reports); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// 指定した条件に一致する、このホストに接続されたことのあるUSBデバイスのインスタンスIDを返す
+func findDevices(serial string, id string, vidPid string) ([]string, error) {
+	var match func(instanceID string) bool
+	switch {
+	case id != "":
+		match = func(instanceID string) bool { return strings.EqualFold(instanceID, id) }
+	case serial != "":
+		match = func(instanceID string) bool {
+			return strings.EqualFold(instanceID[strings.LastIndex(instanceID, `\`)+1:], serial)
+		}
+	case vidPid != "":
+		vid, pid, ok := strings.Cut(vidPid, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid VID:PID %q", vidPid)
+		}
+		prefix := strings.ToUpper(fmt.Sprintf(`USB\VID_%s&PID_%s\`, vid, pid))
+		match = func(instanceID string) bool { return strings.HasPrefix(instanceID, prefix) }
+	default:
+		return nil, fmt.Errorf("no device specified")
+	}
+
+	var matches []string
+	for _, instanceID := range listDeviceInstanceIDs("USB") {
+		if match(instanceID) {
+			matches = append(matches, instanceID)
+		}
+	}
+	return matches, nil
+}
+
+// 列挙子（例: USB）のデバイスを、切断されているものも含めて列挙
+func listDeviceInstanceIDs(enumerator string) []string {
+	return listDeviceInstanceIDsWithFlags(enumerator, windows.DIGCF_ALLCLASSES)
+}
+
+// 列挙子のデバイスを、指定したフラグ（DIGCF_*）で列挙
+func listDeviceInstanceIDsWithFlags(enumerator string, flags windows.DIGCF) []string {
+	devInfo, err := windows.SetupDiGetClassDevsEx(nil, enumerator, 0, flags, 0, "")
+	if err != nil {
+		return nil
+	}
+	defer devInfo.Close()
+
+	var instanceIDs []string
+	for i := 0; ; i++ {
+		deviceInfoData, err := devInfo.EnumDeviceInfo(i)
+		if err != nil {
+			break
+		}
+		if instanceID, err := getDeviceInstanceID(devInfo, deviceInfoData); err == nil {
+			instanceIDs = append(instanceIDs, instanceID)
+		}
+	}
+	return instanceIDs
+}
+
+// デバイスのプロパティ・トポロジー・ドライバ・接続履歴などをまとめて取得
+func getDeviceReport(instanceID string) DeviceReport {
+	report := DeviceReport{Device: DeviceInfo{InstanceID: instanceID}}
+	if deviceInfo, err := getDeviceInfo(instanceID); err == nil {
+		report.Present = true
+		setDriverInfo(&deviceInfo)
+		enrichDeviceInfo(&deviceInfo)
+		report.Device = deviceInfo
+		report.DeviceType = classifyDevice(deviceInfo)
+	}
+	// 切断されているデバイスも、接続履歴はdevnodeに残っている
+	if devInst, err := locateDevNodeWithFlags(instanceID, CM_LOCATE_DEVNODE_PHANTOM); err == nil {
+		report.History.FirstInstalled = getDevNodeTime(devInst, DEVPKEY_Device_FirstInstallDate)
+		report.History.LastArrival = getDevNodeTime(devInst, DEVPKEY_Device_LastArrivalDate)
+		report.History.LastRemoval = getDevNodeTime(devInst, DEVPKEY_Device_LastRemovalDate)
+	}
+	return report
+}
+
+// devnodeの日時のプロパティを取得（ない場合はnil）
+func getDevNodeTime(devInst uint32, key DevPropKey) *time.Time {
+	var filetime windows.Filetime
+	var propertyType uint32
+	size := uint32(unsafe.Sizeof(filetime))
+	ret, _, _ := procCM_Get_DevNode_PropertyW.Call(
+		uintptr(devInst),
+		uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(&propertyType)),
+		uintptr(unsafe.Pointer(&filetime)),
+		uintptr(unsafe.Pointer(&size)),
+		0,
+	)
+	if ret != CR_SUCCESS || propertyType != DEVPROP_TYPE_FILETIME {
+		return nil
+	}
+	t := time.Unix(0, filetime.Nanoseconds())
+	return &t
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// 監視の多重起動を防ぐための名前付きミューテックス（すべてのセッションで共有）
+const singleInstanceMutexName = `Global\usbmon`
+
+// 監視の終了まで保持するミューテックスのハンドル
+var singleInstanceMutex windows.Handle
+
+// 名前付きミューテックスを作成し、既に別の監視が起動している場合はエラーを返す
+func acquireSingleInstance() error {
+	name, err := windows.UTF16PtrFromString(singleInstanceMutexName)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateMutex(nil, false, name)
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		windows.CloseHandle(handle)
+		return fmt.Errorf("Another usbmon is already running (mutex %s exists); stop it before starting a new monitor", singleInstanceMutexName)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to create mutex %s: %w", singleInstanceMutexName, err)
+	}
+	singleInstanceMutex = handle
+	return nil
+}
+
+// 監視の終了時にミューテックスを解放（同じプロセスで監視を開始し直せるようにする）
+func releaseSingleInstance() error {
+	if singleInstanceMutex == 0 {
+		return nil
+	}
+	err := windows.CloseHandle(singleInstanceMutex)
+	singleInstanceMutex = 0
+	if err != nil {
+		return fmt.Errorf("Failed to close mutex %s: %w", singleInstanceMutexName, err)
+	}
+	return nil
+}
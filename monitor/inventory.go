@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 既定のインベントリの送信間隔
+const defaultInventoryInterval = time.Hour
+
+// 接続中のデバイスの一覧（インベントリ）を定期的に送る設定
+// イベントの流れではなく状態の同期で取り込む資産管理システムやダッシュボード向け
+type InventoryConfig struct {
+	// インベントリを送る間隔（既定は1時間、0で送らない）
+	Interval Duration `json:"interval"`
+	// インベントリを送る出力先の名前（空の場合は送らない）
+	Sinks []string `json:"sinks"`
+}
+
+// 接続中のデバイスの一覧（Inventoryイベントで送る）
+type Inventory struct {
+	// 接続中のデバイス（インスタンスIDの順）
+	Devices []InventoryDevice
+	// 前回のインベントリから接続・切断されたデバイスのインスタンスID
+	Added   []string
+	Removed []string
+}
+
+// インベントリに含めるデバイス
+type InventoryDevice struct {
+	DeviceType string
+	Device     DeviceInfo
+}
+
+// 接続中のデバイスの一覧を作成（previousは前回のインベントリのインスタンスID）
+func currentInventory(previous []string) Inventory {
+	var inventory Inventory
+	for _, deviceInfo := range deviceCache.connected() {
+		inventory.Devices = append(inventory.Devices, InventoryDevice{
+			DeviceType: classifyDevice(deviceInfo),
+			Device:     sanitizeDeviceInfo(deviceInfo),
+		})
+	}
+	current := inventory.instanceIDs()
+	for _, instanceID := range current {
+		if !slices.Contains(previous, instanceID) {
+			inventory.Added = append(inventory.Added, instanceID)
+		}
+	}
+	for _, instanceID := range previous {
+		if !slices.Contains(current, instanceID) {
+			inventory.Removed = append(inventory.Removed, instanceID)
+		}
+	}
+	return inventory
+}
+
+// インベントリのデバイスのインスタンスID
+func (inventory Inventory) instanceIDs() []string {
+	instanceIDs := make([]string, 0, len(inventory.Devices))
+	for _, device := range inventory.Devices {
+		instanceIDs = append(instanceIDs, device.Device.InstanceID)
+	}
+	return instanceIDs
+}
+
+// 設定した間隔でInventoryイベントを出力先に送る
+// ハートビートと同じく監査ログには記録せず、メンテナンス期間中も送る
+func runInventory(ctx context.Context) {
+	var previous []string
+	for {
+		cfg := currentConfig()
+		interval := time.Duration(cfg.Inventory.Interval)
+		if interval <= 0 || len(cfg.Inventory.Sinks) == 0 {
+			// 設定の再読み込みで有効になるまで待つ
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		inventory := currentInventory(previous)
+		previous = inventory.instanceIDs()
+		event := DeviceEvent{
+			Action:       "Inventory",
+			HostName:     getHostName(),
+			Severity:     severityInfo,
+			AgentVersion: version,
+			Machine:      machineIdentity(),
+			Inventory:    &inventory,
+		}
+		sinksMu.RLock()
+		sinks := runningSinks
+		sinksMu.RUnlock()
+		for _, name := range currentConfig().Inventory.Sinks {
+			sink, ok := sinks[name]
+			if !ok {
+				continue
+			}
+			errorReporter.sinkResult(name, sink.send(eventSigner.sign(event)))
+		}
+	}
+}
+
+// 接続中のデバイスの、接続時に記録した情報（インスタンスIDの順）
+func (c *DeviceCache) connected() []DeviceInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	devices := make([]DeviceInfo, 0, len(c.devices))
+	for _, deviceInfo := range c.devices {
+		devices = append(devices, deviceInfo)
+	}
+	slices.SortFunc(devices, func(a, b DeviceInfo) int {
+		return strings.Compare(strings.ToUpper(a.InstanceID), strings.ToUpper(b.InstanceID))
+	})
+	return devices
+}
@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// デバイスのプロパティが読み取れるようになるまで待つ時間の既定値
+	defaultEnumerationTimeout = 5 * time.Second
+	// ストレージデバイスのボリュームがマウントされるまで待つ時間
+	mountTimeout = 10 * time.Second
+	// ストレージデバイスのドライバのサービス名
+	massStorageService = "USBSTOR"
+	// 接続直後に空だったプロパティの読み取りを再試行する回数
+	propertyRetries = 4
+	// 最初の再試行までの待ち時間（再試行ごとに2倍にする）
+	propertyRetryDelay = 100 * time.Millisecond
+)
+
+// マウントされたボリューム
+type mountedVolume struct {
+	// ドライブ文字（例: E:）
+	name string
+	// マウント通知を受け取った時刻
+	mountedAt time.Time
+}
+
+// ボリュームのマウントを待っているストレージデバイス
+type MountWaiters struct {
+	mu sync.Mutex
+	// 待ち始めた順に並んだ、マウントされたボリュームを受け取るチャネル
+	waiters []chan mountedVolume
+	// 待っているデバイスがいない間にマウントされたボリューム
+	unclaimed []mountedVolume
+}
+
+// メッセージループとデバイスごとのゴルーチンで共有する、マウント待ちの一覧
+var mountWaiters = &MountWaiters{}
+
+// 接続時刻以降にマウントされたボリュームを待つチャネルを返す
+// 既にマウントされていれば、そのボリュームをすぐに受け取れる
+func (m *MountWaiters) wait(arrivedAt time.Time) chan mountedVolume {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan mountedVolume, 1)
+	for i, volume := range m.unclaimed {
+		if !volume.mountedAt.Before(arrivedAt) {
+			m.unclaimed = append(m.unclaimed[:i], m.unclaimed[i+1:]...)
+			ch <- volume
+			return ch
+		}
+	}
+	m.waiters = append(m.waiters, ch)
+	return ch
+}
+
+// マウント待ちから削除（タイムアウトした場合）
+func (m *MountWaiters) cancel(ch chan mountedVolume) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, waiter := range m.waiters {
+		if waiter == ch {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// マウントされたボリュームを、最も早く待ち始めたストレージデバイスに通知
+func (m *MountWaiters) notify(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	volume := mountedVolume{name: name, mountedAt: now}
+	if len(m.waiters) > 0 {
+		m.waiters[0] <- volume
+		m.waiters = m.waiters[1:]
+		return
+	}
+	// 古いボリュームは、これから接続されるデバイスに紐づかないよう破棄
+	kept := m.unclaimed[:0]
+	for _, v := range m.unclaimed {
+		if now.Sub(v.mountedAt) <= mountTimeout {
+			kept = append(kept, v)
+		}
+	}
+	m.unclaimed = append(kept, volume)
+}
+
+// デバイスのプロパティが読み取れるようになるまで、一定間隔で列挙を繰り返す
+func waitForDeviceInfo(instanceID string, timeout time.Duration) (DeviceInfo, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		deviceInfo, err := deviceAPI.properties(instanceID)
+		if err == nil || time.Now().After(deadline) {
+			return deviceInfo, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// 表示名・製造元・ドライバの情報が空のままになっているかを判定
+func hasBlankProperties(deviceInfo DeviceInfo) bool {
+	return deviceInfo.FriendlyName == "" ||
+		deviceInfo.Manufacturer == "" ||
+		deviceInfo.DriverKey == "" ||
+		deviceInfo.Driver.Provider == ""
+}
+
+// 接続直後はレジストリへの書き込みが完了しておらずプロパティが空の場合があるため、
+// 間隔を延ばしながら読み取りを再試行する（再試行しても空のままなら、その時点の値を使用）
+func retryBlankProperties(deviceInfo DeviceInfo) DeviceInfo {
+	setDriverInfo(&deviceInfo)
+	delay := propertyRetryDelay
+	for i := 0; i < propertyRetries && hasBlankProperties(deviceInfo); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		retried, err := deviceAPI.properties(deviceInfo.InstanceID)
+		if err != nil {
+			// 再試行中に切断された場合は、読み取れた値を使用
+			break
+		}
+		setDriverInfo(&retried)
+		deviceInfo = retried
+	}
+	return deviceInfo
+}
+
+// 接続通知からデバイスが使用可能になるまでの時間を計測し、イベントに設定
+// ストレージデバイスの場合は、ボリュームがマウントされるまでの時間も計測
+func waitForDeviceReady(ctx context.Context, event *DeviceEvent, instanceID string, arrivedAt time.Time) error {
+	deviceInfo, err := waitForDeviceInfo(instanceID, defaultEnumerationTimeout)
+	if err == nil {
+		deviceInfo = retryBlankProperties(deviceInfo)
+	}
+	event.Device = deviceInfo
+	event.ReadyLatency = time.Since(arrivedAt)
+	if err != nil || deviceInfo.Service != massStorageService {
+		return err
+	}
+
+	ch := mountWaiters.wait(arrivedAt)
+	select {
+	case volume := <-ch:
+		event.Volume = volume.name
+		event.MountLatency = volume.mountedAt.Sub(arrivedAt)
+	case <-time.After(mountTimeout):
+		mountWaiters.cancel(ch)
+	case <-ctx.Done():
+		mountWaiters.cancel(ch)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package monitor
+
+import "unsafe"
+
+// Win32 APIに渡す構造体のサイズが、CのSDKの定義と一致することをコンパイル時に確認
+// 一致しない場合は、配列の長さが0にならないか負の値になり、ビルドが失敗する
+// ポインタ・ハンドルのサイズによって変わるサイズは layout_64bit.go・layout_32bit.go で定義する
+var (
+	_ [0]struct{} = [unsafe.Sizeof(Wndclassex{}) - sizeofWndclassex]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Msg{}) - sizeofMsg]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DevBroadcastHdr{}) - 12]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DevBroadcastVolume{}) - 20]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DevBroadcastDeviceInterface{}) - 32]struct{}{}
+	// dbcc_nameの位置（可変長文字列の長さの計算に使用）
+	_ [0]struct{} = [unsafe.Offsetof(DevBroadcastDeviceInterface{}.Name) - 28]struct{}{}
+)
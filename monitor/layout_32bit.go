@@ -0,0 +1,11 @@
+//go:build 386
+
+package monitor
+
+// 32ビット版Windows（x86）での構造体のサイズ
+const (
+	// WNDCLASSEXW
+	sizeofWndclassex = 48
+	// MSG
+	sizeofMsg = 28
+)
@@ -0,0 +1,11 @@
+//go:build amd64 || arm64
+
+package monitor
+
+// 64ビット版Windows（x64・ARM64）での構造体のサイズ
+const (
+	// WNDCLASSEXW
+	sizeofWndclassex = 80
+	// MSG（wParamの前に4バイトの詰め物が入る）
+	sizeofMsg = 48
+)
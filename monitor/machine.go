@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// Windowsのインストールごとに生成されるMachineGuidのレジストリキー（HKLM）
+	machineGuidKeyPath = `SOFTWARE\Microsoft\Cryptography`
+	// OSの更新のリビジョン（UBR）のレジストリキー（HKLM）
+	currentVersionKeyPath = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+)
+
+// ホスト名を変更・再利用しても、収集側でイベントを同じ端末として結び付けるための識別情報
+type MachineIdentity struct {
+	// HKLM\SOFTWARE\Microsoft\Cryptography のMachineGuid
+	GUID string `json:",omitempty"`
+	// 参加しているActive Directoryのドメイン（NetBIOS名、ワークグループの場合は空）
+	Domain string `json:",omitempty"`
+	// OSのバージョン（例: 10.0.22631.3447）
+	OSVersion string `json:",omitempty"`
+}
+
+// 実行中は変わらないため、最初に使用した時に1回だけ取得
+var machineIdentity = sync.OnceValue(func() MachineIdentity {
+	return MachineIdentity{
+		GUID:      machineGUID(),
+		Domain:    joinedDomain(),
+		OSVersion: osVersion(),
+	}
+})
+
+// MachineGuidを取得（32ビット版のusbmonでも、リダイレクトされない64ビットのレジストリから読む）
+func machineGUID() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, machineGuidKeyPath, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	guid, _, _ := key.GetStringValue("MachineGuid")
+	return guid
+}
+
+// 参加しているドメインの名前を取得
+func joinedDomain() string {
+	var name *uint16
+	var status uint32
+	if err := windows.NetGetJoinInformation(nil, &name, &status); err != nil {
+		return ""
+	}
+	defer windows.NetApiBufferFree((*byte)(unsafe.Pointer(name)))
+	if status != windows.NetSetupDomainName {
+		return ""
+	}
+	return windows.UTF16PtrToString(name)
+}
+
+// OSのバージョンとビルド番号・更新のリビジョンを取得
+func osVersion() string {
+	info := windows.RtlGetVersion()
+	version := fmt.Sprintf("%d.%d.%d", info.MajorVersion, info.MinorVersion, info.BuildNumber)
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, currentVersionKeyPath, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return version
+	}
+	defer key.Close()
+	if ubr, _, err := key.GetIntegerValue("UBR"); err == nil {
+		version += fmt.Sprintf(".%d", ubr)
+	}
+	return version
+}
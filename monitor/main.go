@@ -0,0 +1,1036 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	// WindowsシステムAPI を利用するための公式ライブラリ
+	"golang.org/x/sys/windows"
+)
+
+// WinAPIの関数をGo言語から呼び出すためにDLL（Dynamic Link Library）から関数をロード
+var (
+	// 基本的なWindows API（メモリ管理やプロセス操作など）を提供するkernel32.dllをロード
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+)
+
+// WinAPIで使用されるデバイス関連の定数
+const (
+	// デバイスの状態が変化したとき（接続、切断など）に送信されるメッセージ
+	WM_DEVICECHANGE = 0x0219
+	// SetTimerで指定した間隔ごとに送信されるメッセージ
+	WM_TIMER = 0x0113
+	// 新しいデバイスが接続されたことを示すイベント
+	DBT_DEVICEARRIVAL = 0x8000
+	// デバイスが安全に取り外されたことを示すイベント
+	DBT_DEVICEREMOVECOMPLETE = 0x8004
+	// デバイスの種類を示す値
+	// デバイスインターフェースを表す
+	DBT_DEVTYP_DEVICEINTERFACE = 0x00000005
+	// デバイスツリー（devnode）が変化したことを示すイベント
+	DBT_DEVNODES_CHANGED = 0x0007
+	// デバイスの種類を示す値
+	// ボリューム（ドライブ文字）を表す
+	DBT_DEVTYP_VOLUME = 0x00000002
+	// 通知の送信先がウィンドウハンドルであることを示すフラグ
+	DEVICE_NOTIFY_WINDOW_HANDLE = 0x00000000
+)
+
+// USBデバイスのデバイスインターフェースクラスGUID（GUID_DEVINTERFACE_USB_DEVICE）
+var usbDeviceInterfaceGuid = windows.GUID{
+	Data1: 0xA5DCBF10,
+	Data2: 0x6530,
+	Data3: 0x11D2,
+	Data4: [8]byte{0x90, 0x1F, 0x00, 0xC0, 0x4F, 0xB9, 0x51, 0xED},
+}
+
+// ウィンドウクラスを定義するための構造体
+type Wndclassex struct {
+	// 構造体のサイズ
+	CbSize uint32
+	// ウィンドウクラスのスタイル（例: 描画の仕方）
+	Style uint32
+	//  メッセージ処理関数（ウィンドウの振る舞いを決定）
+	LpfnWndProc uintptr
+	// クラスに追加するメモリのサイズ
+	CbClsExtra int32
+	// ウィンドウごとに追加するメモリのサイズ
+	CbWndExtra int32
+	// ウィンドウを属するプロセス（モジュール）のハンドル
+	HInstance windows.Handle
+	// ウィンドウのアイコン
+	HIcon windows.Handle
+	// ウィンドウで使用するカーソル
+	HCursor windows.Handle
+	// 背景ブラシ（背景色）
+	HbrBackground windows.Handle
+	// メニューバーの名前（省略可能）
+	LpszMenuName *uint16
+	// ウィンドウクラスの名前
+	LpszClassName *uint16
+	// 小さいアイコン（タスクバーなどで使用）
+	HIconSm windows.Handle
+}
+
+// Windowsのメッセージ情報を格納するための構造体
+type Msg struct {
+	// メッセージの送信先ウィンドウハンドル
+	HWnd windows.HWND
+	// メッセージの種類
+	Message uint32
+	// メッセージに付随する追加情報
+	WParam uintptr
+	LParam uintptr
+	// メッセージが発生した時刻
+	Time uint32
+	// マウスイベント時の座標
+	Pt struct {
+		X int32
+		Y int32
+	}
+}
+
+type DeviceInfo struct {
+	// デバイスを一意に識別するインスタンスID（例: USB\VID_046D&PID_C52B\5&2C0E7D7&0&2）
+	InstanceID string
+	// デバイスのセットアップクラス名（例: USB, HIDClass, DiskDrive）
+	Class string
+	// デバイスマネージャーに表示される名前（例: Logitech USB Headset）
+	FriendlyName string
+	// デバイスの製造元を表す情報
+	Manufacturer string
+	// USBデバイスに固有の情報
+	SerialNumber string
+	// デバイスのハードウェアID（例: USB\VID_046D&PID_C52B&REV_1201, USB\VID_046D&PID_C52B）
+	HardwareIDs []string
+	// デバイスの互換ID（例: USB\Class_03&SubClass_01&Prot_01, USB\Class_03）
+	CompatibleIDs []string
+	// デバイスのドライバのサービス名（例: USBSTOR）
+	Service string
+	// デバイスが属するコンテナ（物理的なデバイス）のID
+	ContainerID string
+	// デバイスのドライバのキー名（例: {36fc9e60-c465-11cf-8056-444553540000}\0005）
+	DriverKey string
+	// デバイスにバインドされたドライバの情報
+	Driver DriverInfo
+	// デバイスの物理的な接続位置のパス（例: PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(3)）
+	LocationPath string
+	// デバイスの接続先ポートの表示名（例: Port_#0003.Hub_#0001）
+	LocationInfo string
+	// デバイスが接続されているハブの種類（root_hub / external_hub）
+	HubType string
+	// デバイスが接続されているハブのポート番号
+	Port int
+	// デバイスがユーザーが接続できない内部ポートに接続されているかどうか
+	InternalPort bool
+	// デバイス自体がハブかどうか
+	IsHub bool
+	// 通信速度（LowSpeed / FullSpeed / HighSpeed / SuperSpeed / SuperSpeedPlus）
+	Speed string
+	// デバイスディスクリプタのUSB仕様のバージョン（例: 3.20）
+	USBVersion string
+	// コンフィギュレーションディスクリプタで宣言された最大消費電流（mA）
+	MaxPower int
+	// 電源の供給方法（self / bus）
+	PowerMode string
+	// 複合デバイスの子インターフェース
+	Interfaces []DeviceInterface
+	// USBシリアル変換アダプターに割り当てられたCOMポート（例: COM3）
+	COMPorts []string
+	// デバイス自身と配下にあるHIDデバイスのトップレベルコレクションの用途
+	HIDUsages []HIDUsage
+	// USB接続のネットワークアダプターのMACアドレス（例: 00-11-22-33-44-55）
+	MACAddress string
+	// 親devnode（ハブ・複合デバイス）のインスタンスID
+	ParentID string
+	// 同じ親を持つdevnode（同じハブのデバイス・同じ複合デバイスのインターフェース）のインスタンスID
+	Siblings []string
+	// デバイスの問題コード（CM_PROB_*、問題がない場合は0）
+	ProblemCode uint32
+}
+
+// デバイスの接続・切断を表すイベント
+type DeviceEvent struct {
+	// デバイスの接続・切断の種類（Connected / Disconnected / Blocked / Problem / DriverInstalled / Anomaly / Threshold / FileAccess / FileTransfer / Reenumerated / DuplicateSerial / IdentityMorph / Unencrypted / EncryptionPrompt / Present / Heartbeat / Inventory / Missing / Restored / Flapping / FlappingStopped / Suppressed / Paused / Resumed / Watchdog）
+	Action string
+	// ホスト名
+	HostName string
+	// 通知を受け取ったデバイスの種類（例: USB, HID）
+	WatchClass string
+	// イベントの発生元（notification / resume / reconcile / simulate）
+	Source string
+	// イベントを出力したusbmonのバージョン
+	AgentVersion string
+	// 端末の識別情報（MachineGuid・ドメイン・OSのバージョン）
+	Machine MachineIdentity
+	// デバイスに一致したポリシーの規則（例: block 046D:C52B (guest keyboards)）
+	Policy string
+	// デバイスのフィンガープリント（例: 046D:C52B:XYZ）
+	Fingerprint string
+	// usbmon device annotateでデバイスに付けた所有者とメモ
+	Owner string `json:",omitempty"`
+	Note  string `json:",omitempty"`
+	// enrichmentの設定で追加した項目（例: asset_class → peripheral）
+	Fields map[string]string `json:",omitempty"`
+	// Anomaly・Threshold・Reenumerated・DuplicateSerial・IdentityMorph・Unencrypted・Flappingイベントの場合、通常と異なると判定した理由
+	// Paused・Resumedイベントの場合、一時停止・再開したユーザーと理由
+	// Suppressedイベントの場合、制限により出力しなかったイベントの数
+	// Watchdogイベントの場合、対象（message loop / notifications）・状態・詳細
+	Explanation string `json:",omitempty"`
+	// FileAccessイベントの場合、USBストレージ上のファイルへのアクセス
+	FileAccess *FileAccess `json:",omitempty"`
+	// FileTransferイベントの場合、USBストレージに書き込まれたファイル
+	FileTransfer *FileTransfer `json:",omitempty"`
+	// Heartbeatイベントの場合、監視の状態
+	Heartbeat *Heartbeat `json:",omitempty"`
+	// Inventoryイベントの場合、接続中のデバイスの一覧
+	Inventory *Inventory `json:",omitempty"`
+	// セットアップクラスから判定したデバイスの種類（例: SmartCardReader）
+	DeviceType string
+	// イベントの重大度（info / notice / warning / critical）
+	Severity string
+	// デバイスの情報（切断時はインスタンスIDのみ）
+	Device DeviceInfo
+	// 接続通知からデバイスのプロパティが読み取れるまでの時間
+	ReadyLatency time.Duration
+	// 接続通知からボリュームがマウントされるまでの時間（ストレージのみ）
+	MountLatency time.Duration
+	// マウントされたボリューム（例: E:）
+	Volume string
+	// 署名した鍵の鍵ID（signing_keyを指定した場合）
+	KeyID string `json:",omitempty"`
+	// KeyIDを含むイベントのJSONに対するEd25519署名（Base64）
+	Signature string `json:",omitempty"`
+}
+
+// DEV_BROADCAST_HDR構造体
+type DevBroadcastHdr struct {
+	Size       uint32
+	DeviceType uint32
+	Reserved   uint32
+}
+
+// DEV_BROADCAST_VOLUME構造体
+type DevBroadcastVolume struct {
+	Size       uint32
+	DeviceType uint32
+	Reserved   uint32
+	UnitMask   uint32 // ドライブ文字のビットマスク（ビット0がA:）
+	Flags      uint16
+}
+
+// DEV_BROADCAST_DEVICEINTERFACE構造体
+type DevBroadcastDeviceInterface struct {
+	Size       uint32
+	DeviceType uint32
+	Reserved   uint32
+	ClassGuid  windows.GUID
+	Name       [1]uint16 // 可変長文字列
+}
+
+// usbmonコマンドを実行し、終了コードを返す（argsはコマンド名を除いた引数）
+func Main(args []string) int {
+	// サブコマンドが指定されていれば、そのモードで実行
+	if len(args) > 0 {
+		switch args[0] {
+		case "stress":
+			return runStress(args[1:])
+		case "topology":
+			return runTopology(args[1:])
+		case "doctor":
+			return runDoctor(args[1:])
+		case "simulate":
+			return runSimulate(args[1:])
+		case "reload":
+			return runControlCommand("reload")
+		case "info":
+			return runInfo(args[1:])
+		case "eject":
+			return runEject(args[1:])
+		case "policy":
+			return runPolicy(args[1:])
+		case "verify":
+			return runVerify(args[1:])
+		case "keygen":
+			return runKeygen(args[1:])
+		case "prune":
+			return runPrune(args[1:])
+		case "export":
+			return runExport(args[1:])
+		case "forensics":
+			return runForensics(args[1:])
+		case "device":
+			return runDevice(args[1:])
+		case "maintenance":
+			return runMaintenance(args[1:])
+		case "update":
+			return runUpdate(args[1:])
+		case "version":
+			return runVersion(args[1:])
+		case "pause":
+			return runPause(args[1:])
+		case "resume":
+			return runControlCommand("resume")
+		case "tui":
+			return runTUI(args[1:])
+		}
+	}
+	return runMonitor(args)
+}
+
+// USBデバイスの接続・切断を監視し、ログに出力
+func runMonitor(args []string) int {
+	fs := flag.NewFlagSet("usbmon", flag.ExitOnError)
+	fs.StringVar(&configPath, "config", "", "path to a JSON config file")
+	strict := fs.Bool("strict", false, "exit with a non-zero status if any part of the setup fails")
+	fs.BoolVar(&traceEnabled, "trace", false, "log raw window messages and Windows API calls")
+	recordDir := fs.String("record", "", "directory to record raw notifications and events to, for replay with simulate")
+	fs.StringVar(&outputLang, "lang", systemLang(), "output language (ja or en)")
+	fs.BoolVar(&tableOutput, "table", false, "print events as aligned table rows")
+	noColor := fs.Bool("no-color", false, "do not color events by action")
+	showWindow := fs.Bool("gui", false, "show a window listing recent events, with allow/block/eject on right-click")
+	fs.Parse(args)
+	if err := checkLang(outputLang); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	colorOutput = !*noColor && enableColor()
+
+	monitor := &Monitor{ConfigPath: configPath, Strict: *strict, RecordDir: *recordDir, ShowWindow: *showWindow}
+	// Ctrl+Cで監視を終了し、出力先への送信が終わるのを待つ
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := monitor.Run(ctx); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// 監視用のウィンドウを作成し、通知とタイマーを登録
+// ウィンドウを作成できなかった場合は0を返す
+func startMonitorWindow() (windows.HWND, []error) {
+	hWnd, err := createNotificationWindow(watchClasses)
+	if hWnd == 0 {
+		return 0, []error{err}
+	}
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// フラッピングが収まったデバイスを定期的に確認するタイマーを作成
+	// ウォッチドッグはこのタイマーの処理をメッセージループが動いている証拠として扱う
+	if err := setTimer(hWnd, flapTimerID, flapCheckInterval); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to create flapping timer: %w", err))
+	}
+
+	// 取りこぼした通知を定期的に補正するタイマーを作成
+	if err := setReconcileTimer(hWnd, time.Duration(currentConfig().ReconcileInterval)); err != nil {
+		errs = append(errs, err)
+	}
+	return hWnd, errs
+}
+
+// デバイスの接続・切断通知を受け取るための仮想的なウィンドウを作成
+// 監視するデバイスの種類ごとに通知を登録
+// ウィンドウを作成できた場合は、通知の登録に失敗した種類があってもウィンドウのハンドルを返す
+func createNotificationWindow(watchClasses []string) (windows.HWND, error) {
+	// 現在実行中のプロセス（自分自身のモジュール）のハンドルを取得
+	hInstance, err := getModuleHandle()
+	if err != nil {
+		return 0, err
+	}
+
+	// ウィンドウクラス名
+	// ウィンドウクラス名=ウィンドウクラスを識別するための一意のラベル
+	// ウィンドウクラス=ウィンドウの振る舞いやスタイルを定義するテンプレート
+	className, _ := windows.UTF16PtrFromString("USBMonitorClass")
+
+	// 仮想的なウィンドウクラスのテンプレートを定義
+	wndClass := Wndclassex{
+		CbSize:        uint32(unsafe.Sizeof(Wndclassex{})),
+		LpfnWndProc:   newWindowProc(wndProc),
+		HInstance:     hInstance,
+		LpszClassName: className,
+	}
+
+	// Windowsシステム（OSのカーネル内）にウィンドウクラスを登録
+	// ウォッチドッグがウィンドウを作り直す場合は、登録済みのウィンドウクラスを使用
+	if err := registerClassEx(&wndClass); err != nil && !errors.Is(err, windows.ERROR_CLASS_ALREADY_EXISTS) {
+		return 0, fmt.Errorf("Failed to register window class: %w", err)
+	}
+
+	// テンプレートを基に、仮想的なウィンドウを作成
+	title, _ := windows.UTF16PtrFromString("USB Monitor")
+	hWnd, err := createWindowEx(wndClass.LpszClassName, title, hInstance)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create window: %w", err)
+	}
+
+	// 一部のデバイスの種類で登録に失敗しても、登録できた種類の通知は受け取れるようウィンドウを返す
+	var errs []error
+	for _, watchClass := range watchClasses {
+		if err := registerDeviceNotification(hWnd, watchClass); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return hWnd, errors.Join(errs...)
+}
+
+// デバイスの接続・切断通知をウィンドウで受け取るように登録
+func registerDeviceNotification(hWnd windows.HWND, watchClass string) error {
+	classGuid, err := parseWatchClass(watchClass)
+	if err != nil {
+		return err
+	}
+	filter := DevBroadcastDeviceInterface{
+		Size:       uint32(unsafe.Sizeof(DevBroadcastDeviceInterface{})),
+		DeviceType: DBT_DEVTYP_DEVICEINTERFACE,
+		ClassGuid:  classGuid,
+	}
+	hNotify, err := registerDeviceInterfaceNotification(hWnd, &filter)
+	if err != nil {
+		return fmt.Errorf("Failed to register device notification for %s: %w", watchClass, err)
+	}
+	loopMu.Lock()
+	notificationHandles = append(notificationHandles, hNotify)
+	loopMu.Unlock()
+	return nil
+}
+
+// 登録した通知のハンドル（通知を登録し直すときに解除する）
+// ウォッチドッグが作り直したメッセージループと、停止から戻った古いメッセージループの両方が変更しうるためloopMuで保護する
+var notificationHandles []windows.Handle
+
+// 登録した通知をすべて解除し、解除に失敗したエラーを返す
+func unregisterNotifications() []error {
+	loopMu.Lock()
+	handles := notificationHandles
+	notificationHandles = nil
+	loopMu.Unlock()
+	var errs []error
+	for _, hNotify := range handles {
+		if err := unregisterDeviceNotification(hNotify); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to unregister device notification: %w", err))
+		}
+	}
+	return errs
+}
+
+// 登録した通知をすべて解除し、ウィンドウに登録し直す
+func reregisterNotifications(hWnd windows.HWND) error {
+	unregisterNotifications()
+	var errs []error
+	for _, watchClass := range watchClasses {
+		if err := registerDeviceNotification(hWnd, watchClass); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WM_QUITを受け取るまでメッセージを取得して処理
+func runMessageLoop() {
+	// Windowsの右下に通知を表示
+	var msg Msg
+	for {
+		// システムからメッセージを取得
+		if !getMessage(&msg) {
+			break
+		}
+		// キーボード入力に関連するメッセージの補助処理
+		// キー入力を処理するときに、文字そのものを扱えるようにする
+		translateMessage(&msg)
+		// メッセージをLpfnWndProcで処理
+		dispatchMessage(&msg)
+	}
+}
+
+// デバイスの接続・切断時に呼び出す処理（モードごとに差し替える）
+var deviceChangeHandler = handleDeviceChange
+
+// 通知を登録したデバイスの種類
+var watchClasses []string
+
+func wndProc(hWnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	// 終了の依頼は、ウォッチドッグが止めた古いメッセージループでも処理する
+	if msg == WM_APP_STOP {
+		postQuitMessage(0)
+		return 0
+	}
+	// ウォッチドッグが作り直す前のウィンドウのメッセージは処理しない（イベントの重複を防ぐ）
+	if !watchdog.isActive(hWnd) {
+		return defWindowProc(hWnd, msg, wParam, lParam)
+	}
+	switch msg {
+	case WM_DEVICECHANGE:
+		if traceEnabled || recorder != nil {
+			notification := decodeNotification(wParam, lParam)
+			traceDeviceChange(notification, lParam)
+			recorder.recordNotification(notification)
+		}
+		// ドライバのインストールなどでdevnodeが変化した
+		if wParam == DBT_DEVNODES_CHANGED {
+			deviceTasks.spawn(func(context.Context) { pendingDrivers.check() })
+			deviceTasks.spawn(func(context.Context) { interfaceWatcher.check() })
+			break
+		}
+		if wParam != DBT_DEVICEARRIVAL && wParam != DBT_DEVICEREMOVECOMPLETE {
+			break
+		}
+		// ボリュームのマウントは、接続待ちのストレージデバイスに紐づける
+		if volume, ok := getVolume(lParam); ok {
+			if wParam == DBT_DEVICEARRIVAL {
+				mountWaiters.notify(volume)
+			}
+			break
+		}
+		instanceID, watchClass, ok := getInstanceID(lParam)
+		if !ok {
+			break
+		}
+		deviceChangeHandler(instanceID, watchClass, wParam == DBT_DEVICEARRIVAL)
+	case WM_APP_RELOAD:
+		// 制御コマンド・設定ファイルの監視からの再読み込みの依頼
+		reloadResults <- reloadConfig(hWnd)
+		return 1
+	case WM_POWERBROADCAST:
+		tracef("WM_POWERBROADCAST wParam=0x%04X", wParam)
+		handlePowerBroadcast(hWnd, wParam)
+	case WM_TIMER:
+		switch wParam {
+		case flapTimerID:
+			watchdog.beat()
+			flapDetector.flush(time.Now())
+		case resumeTimerID:
+			killTimer(hWnd, resumeTimerID)
+			resyncAfterResume()
+		case reconcileTimerID:
+			reconcileAndRecover(hWnd)
+		}
+	case WM_APP_RECONCILE:
+		// ウォッチドッグがメッセージループを作り直した直後の補正
+		reconcileAndRecover(hWnd)
+	}
+	// 自分で処理しないメッセージ（例: ウィンドウの最小化、移動、閉じる操作など）をWindowsに処理を依頼
+	return defWindowProc(hWnd, msg, wParam, lParam)
+}
+
+// 監視モードでのデバイスの接続・切断の処理
+func handleDeviceChange(instanceID string, watchClass string, arrival bool) {
+	processDeviceChange(instanceID, watchClass, arrival, sourceNotification)
+}
+
+// デバイスの接続・切断をイベントとして出力
+// sourceは通知以外（スリープからの復帰後の再同期など）で検出した場合の発生元
+func processDeviceChange(instanceID string, watchClass string, arrival bool, source string) {
+	arrivedAt := time.Now()
+	hostName := getHostName()
+	trackDevice(instanceID, watchClass, arrival)
+	// 通知と補正のための再列挙の両方で検出した同じ接続・切断は、先に届いた方だけを出力
+	if eventCorrelator.duplicate(instanceID, arrival, source, arrivedAt) {
+		return
+	}
+	// 短時間に接続・切断を繰り返している場合は個別のイベントを抑制し、収まった時点の状態だけを通常どおり処理
+	settle := func() { processRemoval(instanceID, watchClass, hostName, source) }
+	if arrival {
+		settle = func() { processArrival(instanceID, watchClass, hostName, source, time.Now()) }
+	}
+	if flapDetector.record(instanceID, arrival, arrivedAt, hostName, settle) {
+		return
+	}
+	if !arrival {
+		processRemoval(instanceID, watchClass, hostName, source)
+		return
+	}
+	processArrival(instanceID, watchClass, hostName, source, arrivedAt)
+}
+
+// 接続したデバイスのプロパティを読み取り、接続イベントを出力
+func processArrival(instanceID string, watchClass string, hostName string, source string, arrivedAt time.Time) {
+	// プロパティの読み取りやボリュームのマウントを待つ間もメッセージループを止めない
+	deviceTasks.spawn(func(ctx context.Context) {
+		event := DeviceEvent{Action: "Connected", HostName: hostName, WatchClass: watchClass, Source: source}
+		if err := waitForDeviceReady(ctx, &event, instanceID, arrivedAt); err != nil {
+			fmt.Println(err)
+		}
+		enrichDeviceInfo(&event.Device)
+		if !emitArrival(&event) {
+			return
+		}
+		// 最初のイベントの時点でドライバのインストールが完了していなければ、完了時に追加のイベントを出力
+		if needsDriverInstall(event.Device) {
+			pendingDrivers.add(event)
+		}
+		// 列挙後に問題のある状態に変化した場合に備えて監視
+		if event.Device.ProblemCode == 0 {
+			watchProblemState(ctx, event)
+		}
+	})
+}
+
+// 切断したデバイスの記録を削除し、切断イベントを出力
+func processRemoval(instanceID string, watchClass string, hostName string, source string) {
+	pendingDrivers.remove(instanceID)
+	// 切断時にはプロパティを読み取れないため、接続時に記録した情報で切断イベントを作る
+	deviceInfo, ok := deviceCache.remove(instanceID)
+	if !ok {
+		deviceInfo = DeviceInfo{InstanceID: instanceID}
+	}
+	// 切断されたハブを、接続されたデバイスの親のハブとして開かないようにする
+	if deviceInfo.IsHub {
+		hubCache.invalidate()
+	}
+	emitRemoval(DeviceEvent{
+		Action:     "Disconnected",
+		HostName:   hostName,
+		WatchClass: watchClass,
+		Source:     source,
+		Device:     deviceInfo,
+	})
+}
+
+// プロパティを読み取ったデバイスに、トポロジー・子インターフェース・ドライバなどの情報を追加
+func enrichDeviceInfo(deviceInfo *DeviceInfo) {
+	deviceCache.add(*deviceInfo)
+	setTopologyInfo(deviceInfo)
+	setInterfaces(deviceInfo)
+	setDeviceTree(deviceInfo)
+	setProblemCode(deviceInfo)
+	setCOMPorts(deviceInfo)
+	setMACAddress(deviceInfo)
+	setHIDUsages(deviceInfo)
+	deviceCache.store(*deviceInfo)
+}
+
+// 列挙済みの接続イベントにデバイスの種類と重大度を設定し、除外されていなければ出力
+// 除外した場合はfalseを返す
+func emitArrival(event *DeviceEvent) bool {
+	// 再生時に現在の設定で分類し直せるよう、分類前のイベントを記録
+	recorder.recordEvent(*event)
+	requiredDevices.arrived(event.Device, deviceFingerprint(event.Device.InstanceID))
+	cfg := currentConfig()
+	// 一時停止中は規則を記録するだけで、ブロック・プログラムの実行の禁止は行わない
+	paused := monitorPause.active()
+	rule, ok := classifyArrival(event, cfg, paused)
+	if !ok {
+		return false
+	}
+	if event.Volume != "" {
+		session := volumeSessions.start(*event)
+		if cfg.FileTransfer.Enabled {
+			fileTransferWatchers.start(cfg.FileTransfer, session)
+		}
+		// 許可する規則に一致しないUSBストレージからは、プログラムを実行させない
+		if cfg.BlockRemovableExecution && (rule == nil || rule.Action != policyAllow) && !paused {
+			if err := executionBlocks.block(session); err != nil {
+				fmt.Println(err)
+				event.Explanation = fmt.Sprintf(tr("Program execution could not be blocked: %v"), err)
+			} else {
+				event.Explanation = tr("Program execution blocked until removal")
+			}
+		}
+	}
+	logDeviceEvent(*event)
+	pushed := *event
+	deviceTasks.spawn(func(context.Context) { assetSync.push(pushed) })
+	detectAnomaly(*event)
+	checkThresholds(*event)
+	detectReenumeration(*event)
+	detectDuplicateSerial(*event)
+	if cfg.DetectIdentityMorph {
+		interfaceWatcher.add(*event)
+	}
+	checkVolumeEncryption(cfg.EncryptedMedia, *event)
+	return true
+}
+
+// 接続したデバイスの種類・重大度・所有者と一致した規則を設定
+// ブロックする規則に一致した接続は、一時停止中でなければBlockedにする
+// 除外したデバイスの場合はfalseを返す
+func classifyArrival(event *DeviceEvent, cfg Config, paused bool) (*PolicyRule, bool) {
+	if event.DeviceType == "" {
+		event.DeviceType = classifyDevice(event.Device)
+	}
+	if event.Severity == "" {
+		event.Severity = severityFor(cfg.Severities, event.DeviceType)
+		if severity, ok := scheduledSeverity(cfg.ScheduledSeverities, *event, time.Now()); ok {
+			event.Severity = severity
+		}
+	}
+	// ルートハブ・内部ハブ・内蔵デバイスはイベントを出力しない
+	// Bluetoothの監視のために追加したHIDの通知は、Bluetooth経由のデバイスのみ出力
+	_, bluetoothHIDOnly := notificationClasses(cfg)
+	if isExcluded(cfg.Filters, event.Device) ||
+		(bluetoothHIDOnly && event.WatchClass == "HID" && event.DeviceType != deviceTypeBluetoothDevice) {
+		excludedDevices.add(event.Device.InstanceID)
+		return nil, false
+	}
+	annotateEvent(event)
+	// ブロックする規則に一致したデバイスは、重大度criticalのBlockedイベントとして出力
+	rule := currentPolicy().evaluate(event.Device)
+	if rule != nil {
+		event.Policy = rule.String()
+		if rule.Action == policyBlock && event.Action == "Connected" && !paused {
+			event.Action = "Blocked"
+			event.Severity = severityCritical
+		}
+	}
+	return rule, true
+}
+
+// 切断イベントを、接続時に除外したデバイスでなければ出力
+func emitRemoval(event DeviceEvent) {
+	recorder.recordEvent(event)
+	requiredDevices.removed(event.Device, deviceFingerprint(event.Device.InstanceID))
+	portWatcher.removed(event.Device.InstanceID, time.Now())
+	serialTracker.removed(event.Device.InstanceID)
+	interfaceWatcher.remove(event.Device.InstanceID)
+	if excludedDevices.pop(event.Device.InstanceID) || (currentConfig().Filters.ExcludeRootHubs && isRootHub(event.Device.InstanceID)) {
+		return
+	}
+	annotateEvent(&event)
+	for _, session := range volumeSessions.end(event.Device.InstanceID) {
+		fileTransferWatchers.stop(session.Volume)
+		executionBlocks.unblock(session.Volume)
+	}
+	logDeviceEvent(event)
+}
+
+// 通知メッセージのlParamがボリュームの場合、ドライブ文字（例: E:）を返す
+func getVolume(lParam uintptr) (string, bool) {
+	// lParamはDEV_BROADCAST_HDR構造体へのポインタ
+	hdr := *(**DevBroadcastHdr)(unsafe.Pointer(&lParam))
+	if hdr.DeviceType != DBT_DEVTYP_VOLUME {
+		return "", false
+	}
+	bv := *(**DevBroadcastVolume)(unsafe.Pointer(&lParam))
+	for i := 0; i < 26; i++ {
+		if bv.UnitMask&(1<<i) != 0 {
+			return string(rune('A'+i)) + ":", true
+		}
+	}
+	return "", false
+}
+
+// 通知メッセージのlParamからデバイスインターフェース名を読み取り、インスタンスIDと監視するデバイスの種類に変換
+func getInstanceID(lParam uintptr) (string, string, bool) {
+	// lParamはDEV_BROADCAST_HDR構造体へのポインタ
+	hdr := *(**DevBroadcastHdr)(unsafe.Pointer(&lParam))
+	if hdr.DeviceType != DBT_DEVTYP_DEVICEINTERFACE {
+		return "", "", false
+	}
+	bdi := *(**DevBroadcastDeviceInterface)(unsafe.Pointer(&lParam))
+	// 可変長文字列の長さは構造体のサイズから求める
+	length := (bdi.Size - uint32(unsafe.Offsetof(bdi.Name))) / 2
+	name := windows.UTF16ToString(unsafe.Slice(&bdi.Name[0], length))
+
+	return interfacePathToInstanceID(name), watchClassName(bdi.ClassGuid), true
+}
+
+// デバイスインターフェース名（デバイスパス）をインスタンスIDに変換
+func interfacePathToInstanceID(path string) string {
+	// 例: \\?\USB#VID_046D&PID_C52B#5&2c0e7d7&0&2#{a5dcbf10-6530-11d2-901f-00c04fb951ed}
+	path = strings.TrimPrefix(path, `\\?\`)
+	if i := strings.LastIndex(path, "#{"); i >= 0 {
+		path = path[:i]
+	}
+	return strings.ToUpper(strings.ReplaceAll(path, "#", `\`))
+}
+
+func getDeviceInfo(instanceID string) (DeviceInfo, error) {
+	// 指定したインスタンスIDのデバイスだけを含むリストのハンドルを取得
+	// デバイスインターフェースクラスを問わず、インスタンスIDで絞り込む
+	devInfo, err := windows.SetupDiGetClassDevsEx(nil, instanceID, 0, windows.DIGCF_PRESENT|windows.DIGCF_ALLCLASSES|windows.DIGCF_DEVICEINTERFACE, 0, "")
+	if err != nil {
+		err = setupAPIError("SetupDiGetClassDevsExW", err)
+		tracef("SetupDiGetClassDevsExW(Enumerator=%s) = INVALID_HANDLE_VALUE (%v)", instanceID, err)
+		return DeviceInfo{InstanceID: instanceID}, err
+	}
+	tracef("SetupDiGetClassDevsExW(Enumerator=%s) = 0x%X", instanceID, devInfo)
+	// ハンドルを使用後に解放するようスケジュール
+	defer devInfo.Close()
+
+	// デバイスリストのハンドル内のデバイス情報を1つ取得
+	deviceInfoData, err := devInfo.EnumDeviceInfo(0)
+	if err != nil {
+		return DeviceInfo{InstanceID: instanceID}, fmt.Errorf("Failed to enumerate device %s: %w", instanceID, setupAPIError("SetupDiEnumDeviceInfo", err))
+	}
+
+	// 製造元の取得
+	// 接続直後はプロパティがまだ読み取れない場合がある
+	manufacturer, err := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_MFG)
+	if err != nil {
+		return DeviceInfo{InstanceID: instanceID}, err
+	}
+
+	// シリアル番号(Hardware ID)の取得
+	// ハードウェアIDは複数の文字列（REG_MULTI_SZ）で、最も詳細なものが先頭
+	hardwareIDs, _ := getDeviceRegistryMultiString(devInfo, deviceInfoData, windows.SPDRP_HARDWAREID)
+	var serialNumber string
+	if len(hardwareIDs) > 0 {
+		serialNumber = hardwareIDs[0]
+	}
+	// 互換IDの取得
+	compatibleIDs, _ := getDeviceRegistryMultiString(devInfo, deviceInfoData, windows.SPDRP_COMPATIBLEIDS)
+
+	// 表示名の取得（フレンドリ名がなければデバイスの説明を使用）
+	friendlyName, err := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_FRIENDLYNAME)
+	if err != nil || friendlyName == "" {
+		friendlyName, _ = getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_DEVICEDESC)
+	}
+
+	// セットアップクラス名の取得
+	class, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_CLASS)
+
+	// ドライバのサービス名の取得
+	service, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_SERVICE)
+	driverKey, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_DRIVER)
+	containerID, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_BASE_CONTAINERID)
+
+	// 物理的な接続位置の取得
+	locationPath, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_LOCATION_PATHS)
+	locationInfo, _ := getDeviceRegistryProperty(devInfo, deviceInfoData, windows.SPDRP_LOCATION_INFORMATION)
+
+	return DeviceInfo{
+		InstanceID:    instanceID,
+		Class:         class,
+		FriendlyName:  friendlyName,
+		Manufacturer:  manufacturer,
+		SerialNumber:  serialNumber,
+		HardwareIDs:   hardwareIDs,
+		CompatibleIDs: compatibleIDs,
+		Service:       service,
+		DriverKey:     driverKey,
+		ContainerID:   containerID,
+		LocationPath:  locationPath,
+		LocationInfo:  locationInfo,
+	}, nil
+}
+
+// デバイスのプロパティ（文字列）を取得
+// REG_MULTI_SZのプロパティ（例: SPDRP_LOCATION_PATHS）は最初の文字列を返す
+func getDeviceRegistryProperty(devInfo windows.DevInfo, deviceInfoData *windows.DevInfoData, property windows.SPDRP) (string, error) {
+	value, err := getDeviceRegistryPropertyValue(devInfo, deviceInfoData, property)
+	if err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case []string:
+		if len(value) == 0 {
+			return "", nil
+		}
+		return value[0], nil
+	}
+	return "", fmt.Errorf("Failed to read device property 0x%X: unexpected type %T", property, value)
+}
+
+// デバイスのプロパティ（REG_MULTI_SZの複数の文字列）を取得
+func getDeviceRegistryMultiString(devInfo windows.DevInfo, deviceInfoData *windows.DevInfoData, property windows.SPDRP) ([]string, error) {
+	value, err := getDeviceRegistryPropertyValue(devInfo, deviceInfoData, property)
+	if err != nil {
+		return nil, err
+	}
+	switch value := value.(type) {
+	case []string:
+		return value, nil
+	case string:
+		return []string{value}, nil
+	}
+	return nil, fmt.Errorf("Failed to read device property 0x%X: unexpected type %T", property, value)
+}
+
+// デバイスのプロパティの値を、レジストリの型に応じた値（string・[]string・uint32など）で取得
+func getDeviceRegistryPropertyValue(devInfo windows.DevInfo, deviceInfoData *windows.DevInfoData, property windows.SPDRP) (any, error) {
+	value, err := devInfo.DeviceRegistryProperty(deviceInfoData, property)
+	if err != nil {
+		err = setupAPIError("SetupDiGetDeviceRegistryPropertyW", err)
+		tracef("SetupDiGetDeviceRegistryPropertyW(Property=0x%X) failed: %v", property, err)
+		return nil, fmt.Errorf("Failed to read device property 0x%X: %w", property, err)
+	}
+	tracef("SetupDiGetDeviceRegistryPropertyW(Property=0x%X) = %q", property, value)
+	return value, nil
+}
+
+// デバイスのインスタンスIDを取得
+func getDeviceInstanceID(devInfo windows.DevInfo, deviceInfoData *windows.DevInfoData) (string, error) {
+	instanceID, err := devInfo.DeviceInstanceID(deviceInfoData)
+	if err != nil {
+		err = setupAPIError("SetupDiGetDeviceInstanceIdW", err)
+		tracef("SetupDiGetDeviceInstanceIdW() failed: %v", err)
+		return "", fmt.Errorf("Failed to read device instance ID: %w", err)
+	}
+	tracef("SetupDiGetDeviceInstanceIdW() = %q", instanceID)
+	return strings.ToUpper(instanceID), nil
+}
+
+// イベントを監査ログに記録して出力先に送る
+// enrichmentで外部プログラムを指定した場合は、メッセージループを止めないようキューに入れて別のゴルーチンで出力する
+func logDeviceEvent(event DeviceEvent) {
+	if currentConfig().Enrichment.Command != "" {
+		enrichmentQueue.enqueue(event)
+		return
+	}
+	deliverDeviceEvent(event, false)
+}
+
+// イベントを記録し、出力の制限を超えていなければ出力先に振り分ける
+func deliverDeviceEvent(event DeviceEvent, runCommand bool) {
+	event = recordDeviceEvent(event, runCommand)
+	if !rateLimiter.allow(event) {
+		return
+	}
+	routeEvent(event)
+}
+
+// イベントに端末の情報・追加の項目・署名を付けて監査ログに記録し、出力するイベントを返す
+// runCommandを指定した場合は、enrichmentの外部プログラムも実行する
+func recordDeviceEvent(event DeviceEvent, runCommand bool) DeviceEvent {
+	lastEventTime.Store(time.Now().UnixNano())
+	event.AgentVersion = version
+	event.Machine = machineIdentity()
+	event = enrichEvent(event, runCommand)
+	event = sanitizeEvent(event)
+	event = eventSigner.sign(event)
+	auditLog.append(event)
+	return event
+}
+
+// イベントをコンソールに出力
+func printDeviceEvent(event DeviceEvent) {
+	if tableOutput {
+		logDeviceEventRow(event)
+		return
+	}
+	fmt.Printf("%s: ", colorizeAction(event.Action, tr(event.Action)))
+	fmt.Printf(tr("Host=%s, "), event.HostName)
+	fmt.Printf(tr("Class=%s, "), event.WatchClass)
+	if event.Source != sourceNotification {
+		fmt.Printf(tr("Source=%s, "), event.Source)
+	}
+	if event.Heartbeat != nil {
+		fmt.Printf(tr("Version=%s, Uptime=%s, Last Event=%s, Pending Drivers=%d, Volumes=%d, Rate Limits=%d, Cache Hits=%d, Cache Misses=%d\n"),
+			event.Heartbeat.Version, time.Duration(event.Heartbeat.Uptime), event.Heartbeat.LastEvent.Format(time.RFC3339),
+			event.Heartbeat.PendingDrivers, event.Heartbeat.VolumeSessions, event.Heartbeat.RateLimitWindows,
+			event.Heartbeat.CacheHits, event.Heartbeat.CacheMisses)
+		return
+	}
+	if event.Inventory != nil {
+		fmt.Printf(tr("Devices=%d, Added=%d, Removed=%d\n"), len(event.Inventory.Devices), len(event.Inventory.Added), len(event.Inventory.Removed))
+		return
+	}
+	if event.Action == "Disconnected" {
+		if event.Device.FriendlyName != "" {
+			fmt.Printf(tr("Name=%s, "), event.Device.FriendlyName)
+		}
+		if event.Device.Port != 0 {
+			fmt.Printf(tr("Port=%s port %d, "), strings.ReplaceAll(event.Device.HubType, "_", " "), event.Device.Port)
+		}
+		fmt.Printf(tr("Instance ID=%s\n"), event.Device.InstanceID)
+		return
+	}
+	fmt.Printf(tr("Type=%s, "), event.DeviceType)
+	fmt.Printf(tr("Severity=%s, "), event.Severity)
+	if event.Policy != "" {
+		fmt.Printf(tr("Policy=%s, "), event.Policy)
+	}
+	if event.Owner != "" {
+		fmt.Printf(tr("Owner=%s, "), event.Owner)
+	}
+	if event.Note != "" {
+		fmt.Printf(tr("Note=%s, "), event.Note)
+	}
+	if len(event.Fields) > 0 {
+		var fields []string
+		for _, name := range slices.Sorted(maps.Keys(event.Fields)) {
+			fields = append(fields, name+"="+event.Fields[name])
+		}
+		fmt.Printf(tr("Fields=[%s], "), strings.Join(fields, "; "))
+	}
+	if event.Explanation != "" {
+		fmt.Printf(tr("Explanation=%s, "), event.Explanation)
+	}
+	if event.FileAccess != nil {
+		fmt.Printf(tr("File=%s, Access=%s, User=%s, Process=%s, "), event.FileAccess.Path, event.FileAccess.Access, event.FileAccess.User, event.FileAccess.Process)
+	}
+	if event.FileTransfer != nil {
+		fmt.Printf(tr("File=%s, Change=%s, Size=%d, SHA256=%s, "), event.FileTransfer.Path, event.FileTransfer.Change, event.FileTransfer.Size, event.FileTransfer.SHA256)
+	}
+	fmt.Printf(tr("Name=%s, "), event.Device.FriendlyName)
+	fmt.Printf(tr("Device Manufacturer=%s, "), event.Device.Manufacturer)
+	fmt.Printf(tr("Serial Number=%s, "), event.Device.SerialNumber)
+	if event.Device.Port != 0 {
+		fmt.Printf(tr("Port=%s port %d, "), strings.ReplaceAll(event.Device.HubType, "_", " "), event.Device.Port)
+	}
+	if event.Device.Speed != "" {
+		fmt.Printf(tr("Speed=%s (USB %s), "), event.Device.Speed, event.Device.USBVersion)
+	}
+	if event.Device.PowerMode != "" {
+		fmt.Printf(tr("Power=%dmA (%s powered), "), event.Device.MaxPower, event.Device.PowerMode)
+	}
+	if len(event.Device.Interfaces) > 0 {
+		var interfaces []string
+		for _, iface := range event.Device.Interfaces {
+			description := iface.Class
+			if len(iface.Functions) > 0 {
+				description += " (" + strings.Join(iface.Functions, ", ") + ")"
+			}
+			interfaces = append(interfaces, description)
+		}
+		fmt.Printf(tr("Interfaces=[%s], "), strings.Join(interfaces, "; "))
+	}
+	if len(event.Device.COMPorts) > 0 {
+		fmt.Printf(tr("COM Ports=%s, "), strings.Join(event.Device.COMPorts, ", "))
+	}
+	if len(event.Device.HIDUsages) > 0 {
+		var usages []string
+		for _, usage := range event.Device.HIDUsages {
+			usages = append(usages, usage.String())
+		}
+		fmt.Printf(tr("HID Usages=%s, "), strings.Join(usages, ", "))
+	}
+	if event.Device.MACAddress != "" {
+		fmt.Printf(tr("MAC=%s, "), event.Device.MACAddress)
+	}
+	if event.Device.Driver.Provider != "" {
+		fmt.Printf(tr("Driver=%s %s (%s), "), event.Device.Driver.Provider, event.Device.Driver.Version, event.Device.Driver.Date)
+	}
+	if event.Device.ProblemCode != 0 {
+		fmt.Printf(tr("Problem=%s, "), problemDescription(event.Device.ProblemCode))
+	}
+	if event.Device.ParentID != "" {
+		fmt.Printf(tr("Parent=%s, "), event.Device.ParentID)
+	}
+	if len(event.Device.Siblings) > 0 {
+		fmt.Printf(tr("Siblings=[%s], "), strings.Join(event.Device.Siblings, "; "))
+	}
+	if event.Device.LocationPath != "" {
+		fmt.Printf(tr("Location=%s (%s), "), event.Device.LocationPath, event.Device.LocationInfo)
+	}
+	fmt.Printf(tr("Ready Latency=%s"), event.ReadyLatency.Round(time.Millisecond))
+	if event.Volume != "" {
+		fmt.Printf(tr(", Volume=%s, Mount Latency=%s"), event.Volume, event.MountLatency.Round(time.Millisecond))
+	}
+	fmt.Println()
+}
+
+func getHostName() string {
+	hostName, err := os.Hostname()
+	if err != nil {
+		return "Unknown Host"
+	}
+	return hostName
+}
@@ -0,0 +1,294 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// イベントの通知を止めるメンテナンス期間
+// scheduleとdurationを指定した場合は定期的な期間、startとendを指定した場合は1回だけの期間
+type MaintenanceWindow struct {
+	// cron形式の開始時刻（分 時 日 月 曜日、例: "0 9 * * 6" は毎週土曜日9時）
+	Schedule string `json:"schedule,omitempty"`
+	// 定期的な期間の長さ（例: "4h"）
+	Duration Duration `json:"duration,omitempty"`
+	// 1回だけの期間の開始・終了日時
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// 期間の理由（例: hardware swap）
+	Reason string `json:"reason,omitempty"`
+}
+
+// 日時が期間に含まれるかを判定
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	if w.Schedule == "" {
+		return !t.Before(w.Start) && t.Before(w.End)
+	}
+	schedule, err := parseCronSchedule(w.Schedule)
+	if err != nil {
+		return false
+	}
+	// 期間の長さだけさかのぼった間に、開始時刻に一致する分があれば期間中
+	start := t.Truncate(time.Minute)
+	for m := start; !m.Before(start.Add(-time.Duration(w.Duration))); m = m.Add(-time.Minute) {
+		if schedule.matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// 分・時・日・月・曜日ごとに一致する値のビット集合
+type cronSchedule struct {
+	fields [5]uint64
+	// 日と曜日の両方を指定した場合は、どちらかに一致すれば一致（cronと同じ）
+	domRestricted, dowRestricted bool
+}
+
+// cron形式の各項目の値の範囲
+var cronFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// cron形式（分 時 日 月 曜日）を読み取る（*、数値、a-b、a,b、*/n、a-b/nに対応）
+func parseCronSchedule(spec string) (cronSchedule, error) {
+	var schedule cronSchedule
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("invalid schedule %q: expected 5 fields (minute hour day month weekday)", spec)
+	}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFieldRanges[i][0], cronFieldRanges[i][1])
+		if err != nil {
+			return schedule, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		schedule.fields[i] = bits
+	}
+	// 曜日の7は日曜日
+	if schedule.fields[4]&(1<<7) != 0 {
+		schedule.fields[4] |= 1
+	}
+	schedule.domRestricted = fields[2] != "*"
+	schedule.dowRestricted = fields[4] != "*"
+	return schedule, nil
+}
+
+// cron形式の1つの項目を読み取る
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowText, highText, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// 日時が開始時刻に一致するかを判定
+func (s cronSchedule) matches(t time.Time) bool {
+	has := func(i, v int) bool { return s.fields[i]&(1<<v) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(2, t.Day()), has(4, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// 設定のメンテナンス期間の書式を確認
+func checkMaintenanceWindows(windows []MaintenanceWindow) error {
+	for _, w := range windows {
+		if w.Schedule == "" {
+			if w.Start.IsZero() || !w.End.After(w.Start) {
+				return fmt.Errorf("maintenance window needs a schedule and duration, or a start before its end")
+			}
+			continue
+		}
+		if _, err := parseCronSchedule(w.Schedule); err != nil {
+			return err
+		}
+		if w.Duration <= 0 {
+			return fmt.Errorf("maintenance window %q needs a duration", w.Schedule)
+		}
+	}
+	return nil
+}
+
+// usbmon maintenanceで設定した1回だけのメンテナンス期間（実行中に再読み込みされる）
+var (
+	maintenanceMu      sync.RWMutex
+	runningMaintenance []MaintenanceWindow
+)
+
+// usbmon maintenanceで設定したメンテナンス期間を置き換える
+func setMaintenance(windows []MaintenanceWindow) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	runningMaintenance = windows
+}
+
+// 現在メンテナンス期間中であれば、その期間を返す
+func activeMaintenance(now time.Time) (MaintenanceWindow, bool) {
+	maintenanceMu.RLock()
+	windows := append(append([]MaintenanceWindow{}, currentConfig().MaintenanceWindows...), runningMaintenance...)
+	maintenanceMu.RUnlock()
+	for _, w := range windows {
+		if w.contains(now) {
+			return w, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// メンテナンス期間のファイルのパス（設定で指定しない場合は %ProgramData%\usbmon\maintenance.json）
+func maintenancePath(cfg Config) string {
+	if cfg.MaintenanceFile != "" {
+		return cfg.MaintenanceFile
+	}
+	return filepath.Join(os.Getenv("ProgramData"), "usbmon", "maintenance.json")
+}
+
+// メンテナンス期間のファイルを読み込む（ファイルがない場合は空）
+func loadMaintenance(path string) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return windows, nil
+	}
+	if err != nil {
+		return windows, fmt.Errorf("Failed to read maintenance windows: %w", err)
+	}
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return windows, fmt.Errorf("Failed to parse maintenance windows %s: %w", path, err)
+	}
+	return windows, nil
+}
+
+// メンテナンス期間のファイルに保存
+func saveMaintenance(path string, windows []MaintenanceWindow) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create maintenance directory: %w", err)
+	}
+	data, err := json.MarshalIndent(windows, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write maintenance windows: %w", err)
+	}
+	return nil
+}
+
+// `usbmon maintenance` サブコマンド
+// 1回だけのメンテナンス期間を開始・終了し、実行中の監視に再読み込みさせる
+func runMaintenance(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(`usage: usbmon maintenance start -for 4h [-reason "hardware swap"] | usbmon maintenance stop | usbmon maintenance list`)
+		return 2
+	}
+	fs := flag.NewFlagSet("maintenance "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find maintenance_file)")
+	duration := fs.Duration("for", 0, "length of the maintenance window (e.g. 4h)")
+	reason := fs.String("reason", "", "reason for the maintenance window")
+	fs.Parse(args[1:])
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	path := maintenancePath(cfg)
+	windows, err := loadMaintenance(path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	// 終了した期間は残さない
+	now := time.Now()
+	var current []MaintenanceWindow
+	for _, w := range windows {
+		if w.End.After(now) {
+			current = append(current, w)
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		printMaintenance(cfg.MaintenanceWindows, current)
+		return 0
+	case "start":
+		if *duration <= 0 {
+			fmt.Println("specify -for")
+			return 2
+		}
+		current = append(current, MaintenanceWindow{Start: now, End: now.Add(*duration), Reason: *reason})
+	case "stop":
+		current = nil
+	default:
+		fmt.Printf("unknown maintenance command %q\n", args[0])
+		return 2
+	}
+
+	if err := saveMaintenance(path, current); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	printMaintenance(cfg.MaintenanceWindows, current)
+	if response, err := sendControlCommand("reload"); err != nil {
+		fmt.Printf("Maintenance windows saved to %s (%v)\n", path, err)
+	} else if response != "OK" {
+		fmt.Printf("Maintenance windows saved to %s, but the running monitor failed to reload: %s\n", path, response)
+		return 1
+	}
+	return 0
+}
+
+// 設定の定期的な期間と、usbmon maintenanceで設定した期間の一覧を出力
+func printMaintenance(scheduled []MaintenanceWindow, oneOff []MaintenanceWindow) {
+	if len(scheduled) == 0 && len(oneOff) == 0 {
+		fmt.Println("No maintenance windows")
+		return
+	}
+	for _, w := range scheduled {
+		fmt.Printf("scheduled  %-16s  for %-8s  %s\n", w.Schedule, time.Duration(w.Duration), w.Reason)
+	}
+	for _, w := range oneOff {
+		fmt.Printf("one-off    %s - %s  %s\n", w.Start.Format(time.DateTime), w.End.Format(time.DateTime), w.Reason)
+	}
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "0 9 * * 6"},
+		{spec: "*/15 0-6 1,15 * 1-5"},
+		{spec: "0 22-23/1 * 1-12/3 7"},
+		{spec: "  30   2 * * 0  "},
+		{spec: "0 9 * *", wantErr: true},
+		{spec: "0 9 * * 6 2024", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* 24 * * *", wantErr: true},
+		{spec: "* * 0 * *", wantErr: true},
+		{spec: "* * * 13 *", wantErr: true},
+		{spec: "* * * * 8", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "*/x * * * *", wantErr: true},
+		{spec: "a * * * *", wantErr: true},
+		{spec: "1-b * * * *", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, test := range tests {
+		_, err := parseCronSchedule(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseCronSchedule(%q) error = %v, wantErr %v", test.spec, err, test.wantErr)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	// 2024-06-01は土曜日
+	saturday := time.Date(2024, 6, 1, 9, 0, 0, 0, time.Local)
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"0 9 * * 6", saturday, true},
+		{"0 9 * * 6", saturday.Add(time.Minute), false},
+		{"0 9 * * 6", saturday.AddDate(0, 0, 1), false},
+		{"*/15 * * * *", saturday.Add(45 * time.Minute), true},
+		{"*/15 * * * *", saturday.Add(50 * time.Minute), false},
+		{"10-20/5 * * * *", saturday.Add(15 * time.Minute), true},
+		{"10-20/5 * * * *", saturday.Add(25 * time.Minute), false},
+		{"5/20 * * * *", saturday.Add(45 * time.Minute), true},
+		// 曜日の0と7はどちらも日曜日
+		{"0 9 * * 0", saturday.AddDate(0, 0, 1), true},
+		{"0 9 * * 7", saturday.AddDate(0, 0, 1), true},
+		// 日と曜日の両方を指定した場合は、どちらかに一致すれば一致
+		{"0 9 1 * 1", saturday, true},
+		{"0 9 2 * 6", saturday, true},
+		{"0 9 2 * 1", saturday, false},
+		// 日だけを指定した場合は、曜日を問わない
+		{"0 9 1 * *", saturday, true},
+		{"0 9 1 7 *", saturday, false},
+	}
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.matches(test.t); got != test.want {
+			t.Errorf("%q matches %s = %v, want %v", test.spec, test.t.Format(time.RFC3339), got, test.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.Local)
+	weekly := MaintenanceWindow{Schedule: "0 9 * * 6", Duration: Duration(4 * time.Hour)}
+	oneOff := MaintenanceWindow{Start: start, End: start.Add(time.Hour)}
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		t      time.Time
+		want   bool
+	}{
+		{"weekly start", weekly, start, true},
+		{"weekly middle", weekly, start.Add(2*time.Hour + 30*time.Second), true},
+		{"weekly end", weekly, start.Add(4 * time.Hour), true},
+		{"weekly after", weekly, start.Add(4*time.Hour + time.Minute), false},
+		{"weekly before", weekly, start.Add(-time.Minute), false},
+		{"weekly next week", weekly, start.AddDate(0, 0, 7).Add(time.Hour), true},
+		{"invalid schedule", MaintenanceWindow{Schedule: "0 9 * *", Duration: Duration(time.Hour)}, start, false},
+		{"one-off start", oneOff, start, true},
+		{"one-off end", oneOff, start.Add(time.Hour), false},
+		{"one-off before", oneOff, start.Add(-time.Second), false},
+	}
+	for _, test := range tests {
+		if got := test.window.contains(test.t); got != test.want {
+			t.Errorf("%s: contains(%s) = %v, want %v", test.name, test.t.Format(time.RFC3339), got, test.want)
+		}
+	}
+}
+
+func TestCheckMaintenanceWindows(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		window  MaintenanceWindow
+		wantErr bool
+	}{
+		{"scheduled", MaintenanceWindow{Schedule: "0 9 * * 6", Duration: Duration(time.Hour)}, false},
+		{"one-off", MaintenanceWindow{Start: start, End: start.Add(time.Hour)}, false},
+		{"no duration", MaintenanceWindow{Schedule: "0 9 * * 6"}, true},
+		{"invalid schedule", MaintenanceWindow{Schedule: "0 9", Duration: Duration(time.Hour)}, true},
+		{"end before start", MaintenanceWindow{Start: start, End: start.Add(-time.Hour)}, true},
+		{"empty", MaintenanceWindow{}, true},
+	}
+	for _, test := range tests {
+		err := checkMaintenanceWindows([]MaintenanceWindow{test.window})
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: checkMaintenanceWindows() error = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// monitorパッケージはUSBデバイスの接続・切断を監視する（usbmonコマンドの処理と、他のプログラムに組み込むためのMonitor）
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// メッセージループの終了を依頼するメッセージ（監視の終了時と、ウォッチドッグがメッセージループを作り直す時に送る）
+const WM_APP_STOP = 0x8000 + 3
+
+// 監視の実行（フラグの代わりにフィールドで指定）
+type Monitor struct {
+	// 設定ファイルのパス（空の場合は既定の設定）
+	ConfigPath string
+	// 一部の準備に失敗した場合に監視を開始しない
+	Strict bool
+	// 通知とイベントを記録するディレクトリ（空の場合は記録しない）
+	RecordDir string
+	// 最近のイベントを一覧表示するウィンドウを表示
+	ShowWindow bool
+
+	// 監視中に動かすゴルーチン（終了時にキャンセルし、戻るのを待つ）
+	workers       sync.WaitGroup
+	cancelWorkers context.CancelFunc
+}
+
+// 出力先へ送信中のイベント（監視の終了時に送信が終わるのを待つ）
+var sinkSends sync.WaitGroup
+
+// メッセージループなど、Monitorを参照できない処理から開始するゴルーチン（監視の終了時にキャンセルし、戻るのを待つ）
+type backgroundTasks struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// デバイスの接続の処理・起動時のデバイスの情報の読み取りなど、通知を受けて開始するゴルーチン
+var deviceTasks = newBackgroundTasks()
+
+func newBackgroundTasks() *backgroundTasks {
+	t := &backgroundTasks{}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return t
+}
+
+// ゴルーチンで処理を開始し、終了時に待てるよう数える（終了を始めた後は開始しない）
+func (t *backgroundTasks) spawn(task func(ctx context.Context)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ctx.Err() != nil {
+		return
+	}
+	ctx := t.ctx
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer reportPanic()
+		task(ctx)
+	}()
+}
+
+// 処理をキャンセルしてすべてのゴルーチンが戻るのを待ち、次の監視のために新しく開始できる状態に戻す
+func (t *backgroundTasks) stop() {
+	t.mu.Lock()
+	t.cancel()
+	t.mu.Unlock()
+	t.wg.Wait()
+	t.mu.Lock()
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.mu.Unlock()
+}
+
+// 監査ログ・記録先を閉じ、署名の鍵を破棄する（次の監視では設定から開き直す）
+func closeOutputs() []error {
+	var errs []error
+	if auditLog != nil {
+		if err := auditLog.close(); err != nil {
+			errs = append(errs, err)
+		}
+		auditLog = nil
+	}
+	if recorder != nil {
+		if err := recorder.close(); err != nil {
+			errs = append(errs, err)
+		}
+		recorder = nil
+	}
+	eventSigner = nil
+	return errs
+}
+
+// 監視を開始し、コンテキストがキャンセルされるかメッセージループが終了するまで待つ
+// メッセージループは別のOSのスレッドで動くため、Runはどのゴルーチンから呼び出してもよい
+// 終了時にはウィンドウ・通知の登録・出力先を片付け、開始したゴルーチンがすべて戻るのを待ってから、準備と片付けで発生したエラーをまとめて返す
+func (m *Monitor) Run(ctx context.Context) error {
+	defer reportPanic()
+	configPath = m.ConfigPath
+	// 複数の監視が同時に動くと、同じイベントが重複して出力される
+	if err := acquireSingleInstance(); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return errors.Join(err, releaseSingleInstance())
+	}
+	setConfig(cfg)
+	p, err := loadEffectivePolicy(cfg)
+	if err != nil {
+		return errors.Join(err, releaseSingleInstance())
+	}
+	setPolicy(p)
+	annotations, err := loadAnnotations(annotationsPath(cfg))
+	if err != nil {
+		return errors.Join(err, releaseSingleInstance())
+	}
+	setAnnotations(annotations)
+	sinks, err := buildSinks(cfg)
+	if err != nil {
+		return errors.Join(err, releaseSingleInstance())
+	}
+	setSinks(sinks)
+	maintenance, err := loadMaintenance(maintenancePath(cfg))
+	if err != nil {
+		return errors.Join(err, releaseSingleInstance())
+	}
+	setMaintenance(maintenance)
+	if m.RecordDir != "" {
+		if recorder, err = openRecorder(m.RecordDir); err != nil {
+			return errors.Join(err, releaseSingleInstance())
+		}
+	}
+	if cfg.SigningKey != "" {
+		if eventSigner, err = loadEventSigner(cfg.SigningKey); err != nil {
+			return errors.Join(append([]error{err}, append(closeOutputs(), releaseSingleInstance())...)...)
+		}
+	}
+	if cfg.AuditLog != "" {
+		if auditLog, err = openAuditLog(cfg.AuditLog, cfg.AuditEncryption); err != nil {
+			return errors.Join(append([]error{err}, append(closeOutputs(), releaseSingleInstance())...)...)
+		}
+	}
+
+	watchClasses, _ = notificationClasses(cfg)
+	// 起動時に接続されているデバイスを記録（取りこぼした通知の補正に使用）
+	devices := snapshotDevices(watchClasses)
+	setTrackedDevices(devices)
+	// 起動時に接続されていない必須のデバイスは、起動した時点から切断されているとみなす
+	requiredDevices.start(devices)
+	snapshot, present := maps.Clone(devices), cfg.StartupEvents == startupEventsEmit
+	deviceTasks.spawn(func(ctx context.Context) { deviceCache.preload(ctx, snapshot, present) })
+	loop, setupErrs := startMessageLoop(m.ShowWindow)
+	if loop == nil {
+		deviceTasks.stop()
+		return errors.Join(append(setupErrs, append(closeOutputs(), releaseSingleInstance())...)...)
+	}
+	watchdog.start(loop, m.ShowWindow)
+
+	for _, err := range setupErrs {
+		errorReporter.report(faultRegistration, err.Error(), nil)
+	}
+	// 一部の準備に失敗しても監視は続けられるため、Strictを指定した場合のみ終了
+	if m.Strict && len(setupErrs) > 0 {
+		return errors.Join(append(setupErrs, m.teardown()...)...)
+	}
+	for _, err := range setupErrs {
+		fmt.Println(err)
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	m.cancelWorkers = cancel
+	// メッセージループの停止を検出し、自動的に復旧
+	m.spawn(workerCtx, watchdog.run)
+	if auditLog != nil {
+		m.spawn(workerCtx, auditLog.runRetention)
+	}
+	// 外部プログラムで項目を追加するイベントを、メッセージループとは別に順に出力
+	enrichmentQueue.start()
+	m.spawn(workerCtx, enrichmentQueue.run)
+
+	// 設定ファイルの変更と、`usbmon reload` などの制御コマンドを受け付ける
+	if configPath != "" {
+		m.spawn(workerCtx, func(ctx context.Context) { watchConfigFile(ctx, configPath) })
+	}
+	m.spawn(workerCtx, watchRegistryConfig)
+	m.spawn(workerCtx, serveControlPipe)
+	// 前回の実行で残ったプログラムの実行の禁止を解除
+	clearExecutionBlocks()
+	if cfg.SecurityLogCorrelation {
+		m.spawn(workerCtx, watchSecurityLog)
+	}
+	// 配布サーバーからポリシーを定期的に取得
+	m.spawn(workerCtx, remotePolicy.run)
+	m.spawn(workerCtx, runHeartbeat)
+	m.spawn(workerCtx, runInventory)
+	// 配布サーバーから署名された更新を定期的に確認
+	removeOldExecutable()
+	m.spawn(workerCtx, runAutoUpdate)
+
+	if dashboard != nil {
+		dashboard.start(trackedSnapshot())
+	}
+	// コンテキストがキャンセルされるか、メッセージループが終了する（イベントの一覧のウィンドウを閉じた、作り直せなかったなど）まで待つ
+	// ウォッチドッグがメッセージループを作り直しても、作り直したメッセージループの終了を待つ
+	var loopErr error
+	select {
+	case <-ctx.Done():
+	case loopErr = <-watchdog.exited:
+	}
+	return errors.Join(append([]error{loopErr}, m.teardown()...)...)
+}
+
+// ゴルーチンで処理を開始し、終了時に待てるよう数える（処理はコンテキストがキャンセルされたら戻る）
+func (m *Monitor) spawn(ctx context.Context, worker func(ctx context.Context)) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		defer reportPanic()
+		worker(ctx)
+	}()
+}
+
+// メッセージループとゴルーチンを止めて通知の登録を解除し、出力先への送信が終わるのを待ってから監査ログ・記録先を閉じる
+func (m *Monitor) teardown() []error {
+	var errs []error
+	// 以降はウォッチドッグがメッセージループを作り直さない
+	if loop := watchdog.stop(); loop != nil {
+		errs = append(errs, loop.stop(loopStopTimeout)...)
+	}
+	// メッセージループを止めてから、設定の再読み込みなどを依頼するゴルーチンを止める
+	if m.cancelWorkers != nil {
+		m.cancelWorkers()
+		m.workers.Wait()
+		m.cancelWorkers = nil
+	}
+	// メッセージループから開始した接続の処理などを止める
+	deviceTasks.stop()
+	errs = append(errs, unregisterNotifications()...)
+	// 新しいイベントを出力先に送らないようにし、送信中のイベントを待つ
+	setSinks(nil)
+	sinkSends.Wait()
+	errs = append(errs, closeOutputs()...)
+	if err := releaseSingleInstance(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// 専用のOSのスレッドで動くメッセージループ（ウォッチドッグが停止したメッセージループを別のスレッドで作り直せるようにする）
+type messageLoop struct {
+	// 通知を受け取るウィンドウ
+	hWnd windows.HWND
+	// メッセージループが終了し、ウィンドウを破棄したら閉じる
+	done chan struct{}
+	// ウィンドウの破棄で発生したエラー（doneが閉じてから参照する）
+	errs []error
+}
+
+// 新しいゴルーチンをOSのスレッドに固定し、監視用のウィンドウ（showWindowの場合はイベントの一覧のウィンドウも）を作成してメッセージループを開始
+// ウィンドウを作成できなかった場合はnilを返す
+func startMessageLoop(showWindow bool) (*messageLoop, []error) {
+	type started struct {
+		loop *messageLoop
+		errs []error
+	}
+	ready := make(chan started, 1)
+	go func() {
+		defer reportPanic()
+		// ウィンドウのメッセージはウィンドウを作成したスレッドでしか受け取れないため、
+		// ウィンドウを破棄するまで同じOSのスレッドで実行
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		hWnd, errs := startMonitorWindow()
+		if hWnd == 0 {
+			ready <- started{nil, errs}
+			return
+		}
+		// イベントの一覧のウィンドウは、通知を受け取るウィンドウと同じスレッドで作成する
+		var window *EventWindow
+		if showWindow {
+			var err error
+			if window, err = openEventWindow(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		loop := &messageLoop{hWnd: hWnd, done: make(chan struct{})}
+		ready <- started{loop, errs}
+		runMessageLoop()
+
+		// ウィンドウは作成したスレッドでしか破棄できない（ウィンドウを破棄するとタイマーも破棄される）
+		if window != nil {
+			if err := window.destroy(); err != nil {
+				loop.errs = append(loop.errs, fmt.Errorf("Failed to destroy event window: %w", err))
+			}
+		}
+		if err := destroyWindow(hWnd); err != nil {
+			loop.errs = append(loop.errs, fmt.Errorf("Failed to destroy window: %w", err))
+		}
+		close(loop.done)
+		watchdog.loopExited(loop)
+	}()
+	s := <-ready
+	return s.loop, s.errs
+}
+
+// メッセージループに終了を依頼し、ウィンドウを破棄するまで待つ
+func (l *messageLoop) stop(timeout time.Duration) []error {
+	if err := postMessage(l.hWnd, WM_APP_STOP, 0, 0); err != nil {
+		return []error{fmt.Errorf("Failed to stop message loop: %w", err)}
+	}
+	select {
+	case <-l.done:
+		return l.errs
+	case <-time.After(timeout):
+		return []error{fmt.Errorf("Failed to stop message loop: no response within %s", timeout)}
+	}
+}
+
+// 指定した時間待つ（コンテキストがキャンセルされた場合はすぐにfalseを返す）
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// ハンドルがシグナル状態になるまで待つ（コンテキストがキャンセルされた場合はfalseを返す）
+func waitContext(ctx context.Context, handle windows.Handle) (bool, error) {
+	cancelled, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		windows.SetEvent(cancelled)
+		close(done)
+	})
+	defer func() {
+		// キャンセルの処理が動いている場合は、終わってからイベントを閉じる
+		if !stop() {
+			<-done
+		}
+		windows.CloseHandle(cancelled)
+	}()
+	event, err := windows.WaitForMultipleObjects([]windows.Handle{handle, cancelled}, false, windows.INFINITE)
+	if err != nil {
+		return false, err
+	}
+	return event == windows.WAIT_OBJECT_0, nil
+}
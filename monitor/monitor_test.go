@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+// 設定を置き換え、テストの終了時に元に戻す
+func useConfig(t *testing.T, cfg Config) {
+	t.Helper()
+	saved := currentConfig()
+	setConfig(cfg)
+	t.Cleanup(func() { setConfig(saved) })
+}
+
+// 出力されたイベントを記録する出力先
+type recordingSink struct {
+	events chan DeviceEvent
+}
+
+func newRecordingSink() recordingSink {
+	return recordingSink{events: make(chan DeviceEvent, 16)}
+}
+
+func (s recordingSink) send(event DeviceEvent) error {
+	s.events <- event
+	return nil
+}
+
+// 記録したイベントを1件取り出す（timeoutまでに出力されない場合はfalse）
+func (s recordingSink) next(timeout time.Duration) (DeviceEvent, bool) {
+	select {
+	case event := <-s.events:
+		return event, true
+	default:
+	}
+	select {
+	case event := <-s.events:
+		return event, true
+	case <-time.After(timeout):
+		return DeviceEvent{}, false
+	}
+}
+
+// コンソールの出力先を記録する出力先に差し替え、テストの終了時に元に戻す
+func useRecordingSink(t *testing.T) recordingSink {
+	t.Helper()
+	sink := newRecordingSink()
+	sinksMu.RLock()
+	saved := runningSinks
+	sinksMu.RUnlock()
+	setSinks(map[string]Sink{consoleSinkName: sink})
+	t.Cleanup(func() {
+		sinkSends.Wait()
+		setSinks(saved)
+	})
+	return sink
+}
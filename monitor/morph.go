@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// キーボードなどの入力デバイスとして動作するインターフェース・機能のクラス
+var inputInterfaceClasses = map[string]bool{
+	"HIDClass": true,
+	"Keyboard": true,
+	"Mouse":    true,
+}
+
+// 接続中の複合デバイスのインターフェースの構成を追跡し、後から追加されたインターフェースを検出
+// USBストレージとして接続した後にキーボードとして動作し始めるデバイスなど、接続時のイベントだけでは分からない攻撃を検出する
+type InterfaceWatcher struct {
+	mu sync.Mutex
+	// インスタンスIDごとの接続イベントと、これまでに確認したインターフェース・機能のクラス
+	events  map[string]DeviceEvent
+	classes map[string]map[string]bool
+}
+
+var interfaceWatcher = &InterfaceWatcher{events: map[string]DeviceEvent{}, classes: map[string]map[string]bool{}}
+
+// インターフェースと、その配下に作成された機能のクラスの一覧
+func interfaceClasses(deviceInfo DeviceInfo) map[string]bool {
+	classes := map[string]bool{}
+	for _, iface := range deviceInfo.Interfaces {
+		if iface.Class != "" {
+			classes[iface.Class] = true
+		}
+		for _, function := range iface.Functions {
+			classes[function] = true
+		}
+	}
+	return classes
+}
+
+// 接続された複合デバイスのインターフェースの構成を記録
+func (w *InterfaceWatcher) add(event DeviceEvent) {
+	if event.Device.Service != compositeDeviceService {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events[event.Device.InstanceID] = event
+	w.classes[event.Device.InstanceID] = interfaceClasses(event.Device)
+}
+
+// 切断されたデバイスの記録を削除
+func (w *InterfaceWatcher) remove(instanceID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.events, instanceID)
+	delete(w.classes, instanceID)
+}
+
+// devnodeが変化したときに、接続中の複合デバイスのインターフェースを読み取り直し、新しいクラスがあればIdentityMorphイベントを出力
+func (w *InterfaceWatcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for instanceID, event := range w.events {
+		deviceInfo := DeviceInfo{InstanceID: instanceID, Service: compositeDeviceService}
+		setInterfaces(&deviceInfo)
+		known := w.classes[instanceID]
+		var added []string
+		for class := range interfaceClasses(deviceInfo) {
+			if !known[class] {
+				known[class] = true
+				added = append(added, class)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		slices.Sort(added)
+		event.Action = "IdentityMorph"
+		event.Severity = severityWarning
+		for _, class := range added {
+			if inputInterfaceClasses[class] {
+				event.Severity = severityCritical
+			}
+		}
+		event.Device.Interfaces = deviceInfo.Interfaces
+		event.Explanation = fmt.Sprintf("new interface classes appeared after arrival: %s", strings.Join(added, ", "))
+		logDeviceEvent(event)
+	}
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// ネットワークアダプターのセットアップクラス名
+	netClass = "Net"
+	// ネットワークアダプターがOSに登録されるまで待つ時間
+	netAdapterTimeout = 5 * time.Second
+	// デバイスのドライバのキー名を取得するプロパティ
+	CM_DRP_DRIVER = 0x0000000A
+)
+
+// USB接続のネットワークアダプター（RNDIS / ECM / テザリング中のスマートフォン）のMACアドレスを設定
+func setMACAddress(deviceInfo *DeviceInfo) {
+	var netInstances []string
+	if strings.EqualFold(deviceInfo.Class, netClass) {
+		netInstances = append(netInstances, deviceInfo.InstanceID)
+	}
+	for _, iface := range deviceInfo.Interfaces {
+		if strings.EqualFold(iface.Class, netClass) {
+			netInstances = append(netInstances, iface.InstanceID)
+		}
+	}
+
+	for _, instanceID := range netInstances {
+		adapterName := getNetCfgInstanceID(instanceID)
+		if adapterName == "" {
+			continue
+		}
+		// アダプターがOSに登録されるまで、一定間隔で確認を繰り返す
+		deadline := time.Now().Add(netAdapterTimeout)
+		for {
+			if mac := getMACAddress(adapterName); mac != "" {
+				deviceInfo.MACAddress = mac
+				return
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+}
+
+// ネットワークアダプターのdevnodeから、アダプター名（NetCfgInstanceId）を取得
+func getNetCfgInstanceID(instanceID string) string {
+	devInst, err := locateDevNode(instanceID)
+	if err != nil {
+		return ""
+	}
+	driverKey := getDevNodeProperty(devInst, CM_DRP_DRIVER)
+	if driverKey == "" {
+		return ""
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, driverClassKeyPath+driverKey, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	name, _, _ := key.GetStringValue("NetCfgInstanceId")
+	return name
+}
+
+// アダプター名（例: {4D36E972-...}）に一致するネットワークアダプターのMACアドレスを取得
+func getMACAddress(adapterName string) string {
+	size := uint32(15000)
+	for {
+		buffer := make([]byte, size)
+		addresses := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buffer[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_ALL_INTERFACES, 0, addresses, &size)
+		if err == windows.ERROR_BUFFER_OVERFLOW {
+			continue
+		}
+		if err != nil {
+			return ""
+		}
+		for a := addresses; a != nil; a = a.Next {
+			if !strings.EqualFold(windows.BytePtrToString(a.AdapterName), adapterName) || a.PhysicalAddressLength == 0 {
+				continue
+			}
+			var octets []string
+			for _, b := range a.PhysicalAddress[:a.PhysicalAddressLength] {
+				octets = append(octets, fmt.Sprintf("%02X", b))
+			}
+			return strings.Join(octets, "-")
+		}
+		return ""
+	}
+}
@@ -0,0 +1,32 @@
+package monitor
+
+import (
+	"runtime"
+	"sync"
+)
+
+// デバイスのプロパティを並行して取得するゴルーチンの最大数
+const maxPropertyWorkers = 8
+
+// 0からn-1までの番号でfnを並行して呼び出し、すべて終わるまで待つ（同時に実行する数はCPU数とmaxPropertyWorkersまで）
+// SetupDiのデバイス情報セットのハンドルはスレッド間で共有できないため、fnではハンドルを共有せずに
+// CfgMgr32のAPIを使うか、呼び出しごとにデバイス情報セットを作成する
+func forEachParallel(n int, fn func(i int)) {
+	workers := min(runtime.NumCPU(), maxPropertyWorkers, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 監視の一時停止（usbmon pauseで開始し、期間が過ぎるかusbmon resumeで解除）
+// 一時停止中はブロック・プログラムの実行の禁止・取り外しを行わず、イベントはコンソールと監査ログにだけ出力する
+type PauseState struct {
+	mu sync.Mutex
+	// 一時停止の終了日時（一時停止していない場合はゼロ）
+	until time.Time
+	// 一時停止したユーザーと理由
+	user   string
+	reason string
+	// 期間が過ぎたら自動的に解除するタイマー
+	timer *time.Timer
+}
+
+var monitorPause PauseState
+
+// 一時停止中かどうか
+func (p *PauseState) active() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.until.IsZero() && time.Now().Before(p.until)
+}
+
+// 一時停止を開始（一時停止中の場合は期間と理由を置き換える）
+func (p *PauseState) pause(duration time.Duration, user string, reason string) {
+	p.mu.Lock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.until = time.Now().Add(duration)
+	p.user, p.reason = user, reason
+	until := p.until
+	p.timer = time.AfterFunc(duration, func() { p.resume(until, "") })
+	p.mu.Unlock()
+
+	logPauseEvent("Paused", fmt.Sprintf(tr("Paused by %s until %s: %s"), displayUser(user), until.Format(time.DateTime), reason))
+}
+
+// 一時停止を解除（untilを指定した場合は、その一時停止がまだ続いているときだけ解除）
+// userが空の場合は期間が過ぎたことによる自動的な解除
+func (p *PauseState) resume(until time.Time, user string) bool {
+	p.mu.Lock()
+	if p.until.IsZero() || (!until.IsZero() && !p.until.Equal(until)) {
+		p.mu.Unlock()
+		return false
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	pausedBy := p.user
+	p.until, p.user, p.reason, p.timer = time.Time{}, "", "", nil
+	p.mu.Unlock()
+
+	explanation := fmt.Sprintf(tr("Pause by %s expired"), displayUser(pausedBy))
+	if user != "" {
+		explanation = fmt.Sprintf(tr("Resumed by %s (paused by %s)"), displayUser(user), displayUser(pausedBy))
+	}
+	logPauseEvent("Resumed", explanation)
+	return true
+}
+
+// ユーザーが取得できなかった場合の表示
+func displayUser(user string) string {
+	if user == "" {
+		return "unknown user"
+	}
+	return user
+}
+
+// 一時停止・解除を監査ログとすべての出力先に記録
+func logPauseEvent(action string, explanation string) {
+	logDeviceEvent(DeviceEvent{
+		Action:      action,
+		HostName:    getHostName(),
+		Severity:    severityNotice,
+		Explanation: explanation,
+	})
+}
+
+// 制御コマンド pause <期間> [理由]
+func requestPause(request controlRequest) error {
+	durationText, reason, _ := strings.Cut(request.Args, " ")
+	duration, err := time.ParseDuration(durationText)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("invalid pause duration %q", durationText)
+	}
+	monitorPause.pause(duration, request.User, strings.TrimSpace(reason))
+	return nil
+}
+
+// 制御コマンド resume
+func requestResume(request controlRequest) error {
+	if !monitorPause.resume(time.Time{}, displayUser(request.User)) {
+		return errors.New("monitoring is not paused")
+	}
+	return nil
+}
+
+// `usbmon pause` サブコマンド
+// 実行中の監視を指定した期間だけ一時停止
+func runPause(args []string) int {
+	fs := flag.NewFlagSet("pause", flag.ExitOnError)
+	duration := fs.Duration("for", 0, "how long to pause enforcement and alerting (e.g. 30m)")
+	reason := fs.String("reason", "", "reason for pausing, recorded in the audit log")
+	fs.Parse(args)
+	if *duration <= 0 {
+		fmt.Println(`usage: usbmon pause -for 30m [-reason "..."]`)
+		return 2
+	}
+	return runControlCommand(fmt.Sprintf("pause %s %s", *duration, *reason))
+}
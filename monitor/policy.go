@@ -0,0 +1,331 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 規則に一致したデバイスの扱い
+const (
+	// 許可（イベントはそのまま出力）
+	policyAllow = "allow"
+	// ブロック（Blockedイベントとして重大度criticalで出力）
+	policyBlock = "block"
+)
+
+// 許可・ブロックの規則
+type PolicyRule struct {
+	// allow / block
+	Action string `json:"action"`
+	// 対象のVID:PID（例: 046D:C52B、空の場合はすべて）
+	VIDPID string `json:"vid_pid,omitempty"`
+	// 対象のシリアル番号（空の場合はすべて）
+	Serial string `json:"serial,omitempty"`
+	// 対象の物理的なポートの位置のパス（例: PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(3)、空の場合はすべて）
+	// ポートに接続されたハブの先のデバイスも対象になる
+	Port string `json:"port,omitempty"`
+	// 対象のセットアップクラス（例: DiskDrive、HIDClass、空の場合はすべて）
+	// 複合デバイスの場合はインターフェースとその配下のクラスも対象
+	Class string `json:"class,omitempty"`
+	// 対象のHIDのトップレベルコレクションの種類（例: keyboard、vendor-defined、空の場合はすべて）
+	// 複合デバイスの場合は配下のHIDデバイスも対象
+	HIDType string `json:"hid_type,omitempty"`
+	// 規則の説明（例: corporate stick）
+	Note string `json:"note,omitempty"`
+	// 規則を追加した日時
+	Added time.Time `json:"added"`
+}
+
+// 許可・ブロックの規則の一覧（ポリシーファイルに保存する）
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// 監視で使用するポリシー（実行中に再読み込みされるため、currentPolicyで取得する）
+var (
+	policyMu      sync.RWMutex
+	runningPolicy Policy
+)
+
+// 現在のポリシーを取得
+func currentPolicy() Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return runningPolicy
+}
+
+// ポリシーを置き換える
+func setPolicy(p Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	runningPolicy = p
+}
+
+// ポリシーファイルのパス（設定で指定しない場合は %ProgramData%\usbmon\policy.json）
+func policyPath(cfg Config) string {
+	if cfg.PolicyFile != "" {
+		return cfg.PolicyFile
+	}
+	return filepath.Join(os.Getenv("ProgramData"), "usbmon", "policy.json")
+}
+
+// ポリシーファイルを読み込む（ファイルがない場合は規則なし）
+func loadPolicy(path string) (Policy, error) {
+	var p Policy
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("Failed to read policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("Failed to parse policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ポリシーファイルに保存（書き込み途中のファイルを監視が読み込まないよう、一時ファイルから置き換える）
+func savePolicy(path string, p Policy) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create policy directory: %w", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("Failed to write policy: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Failed to write policy: %w", err)
+	}
+	return nil
+}
+
+// デバイスのシリアル番号（インスタンスIDの最後の部分）
+// USBストレージのディスク（USBSTOR）は、シリアル番号の後に付く論理ユニット番号（例: &0）を除く
+// シリアル番号を持たないデバイスは、Windowsが生成した「&」を含むIDになるため空を返す
+func deviceSerial(instanceID string) string {
+	serial := instanceID[strings.LastIndex(instanceID, `\`)+1:]
+	if strings.HasPrefix(strings.ToUpper(instanceID), `USBSTOR\`) {
+		if i := strings.LastIndex(serial, "&"); i >= 0 {
+			if _, err := strconv.ParseUint(serial[i+1:], 10, 32); err == nil {
+				serial = serial[:i]
+			}
+		}
+	}
+	if strings.Contains(serial, "&") {
+		return ""
+	}
+	return serial
+}
+
+// 規則がデバイスに一致するかを判定
+func (r PolicyRule) matches(deviceInfo DeviceInfo) bool {
+	if r.VIDPID != "" {
+		vid, pid := parseVIDPID(deviceInfo.InstanceID)
+		if vid == "" || !strings.EqualFold(r.VIDPID, vid+":"+pid) {
+			return false
+		}
+	}
+	if r.Serial != "" && !strings.EqualFold(r.Serial, deviceSerial(deviceInfo.InstanceID)) {
+		return false
+	}
+	if r.Port != "" && !onPort(deviceInfo.LocationPath, r.Port) {
+		return false
+	}
+	if r.Class != "" && !deviceClasses(deviceInfo)[strings.ToLower(r.Class)] {
+		return false
+	}
+	if r.HIDType != "" && !hasHIDType(deviceInfo, r.HIDType) {
+		return false
+	}
+	return r.VIDPID != "" || r.Serial != "" || r.Port != "" || r.Class != "" || r.HIDType != ""
+}
+
+// デバイスの位置のパスが、ポート（またはその先のハブ）を指しているかを判定
+func onPort(locationPath string, port string) bool {
+	locationPath, port = strings.ToUpper(locationPath), strings.ToUpper(port)
+	return locationPath == port || strings.HasPrefix(locationPath, port+"#")
+}
+
+// 規則の具体性（シリアル番号 > VID:PID > ポート・クラス・HIDの種類の順に優先）
+// ポートとクラスを両方指定した規則はVID:PIDだけの規則と同じで、その場合はブロックを優先
+func (r PolicyRule) specificity() int {
+	n := 0
+	if r.Serial != "" {
+		n += 4
+	}
+	if r.VIDPID != "" {
+		n += 2
+	}
+	if r.Port != "" {
+		n++
+	}
+	if r.Class != "" {
+		n++
+	}
+	if r.HIDType != "" {
+		n++
+	}
+	return n
+}
+
+// 規則の表示用の文字列（例: block 046D:C52B (guest keyboards)）
+func (r PolicyRule) String() string {
+	var target []string
+	if r.VIDPID != "" {
+		target = append(target, r.VIDPID)
+	}
+	if r.Serial != "" {
+		target = append(target, "serial "+r.Serial)
+	}
+	if r.Class != "" {
+		target = append(target, "class "+r.Class)
+	}
+	if r.HIDType != "" {
+		target = append(target, "hid "+r.HIDType)
+	}
+	if r.Port != "" {
+		target = append(target, "port "+r.Port)
+	}
+	s := r.Action + " " + strings.Join(target, " ")
+	if r.Note != "" {
+		s += " (" + r.Note + ")"
+	}
+	return s
+}
+
+// デバイスに一致する規則のうち最も具体的なものを返す（同じ具体性ならブロックを優先）
+func (p Policy) evaluate(deviceInfo DeviceInfo) *PolicyRule {
+	var matched *PolicyRule
+	for i, rule := range p.Rules {
+		if !rule.matches(deviceInfo) {
+			continue
+		}
+		if matched == nil || rule.specificity() > matched.specificity() ||
+			(rule.specificity() == matched.specificity() && rule.Action == policyBlock) {
+			matched = &p.Rules[i]
+		}
+	}
+	return matched
+}
+
+// `usbmon policy` サブコマンド
+// 許可・ブロックの規則を追加・削除・一覧表示し、実行中の監視に再読み込みさせる
+func runPolicy(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(`usage: usbmon policy (block|allow) [VID:PID] [-serial XYZ] [-port PATH] [-class CLASS] [-hid-type TYPE] [-note "..."] | usbmon policy remove N | usbmon policy list | usbmon policy export -format defender|intune -out DIR`)
+		return 2
+	}
+	fs := flag.NewFlagSet("policy "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find policy_file)")
+	serial := fs.String("serial", "", "device serial number")
+	note := fs.String("note", "", "note describing the rule")
+	port := fs.String("port", "", "physical port location path (e.g. PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(3))")
+	class := fs.String("class", "", "device setup class (e.g. DiskDrive)")
+	hidType := fs.String("hid-type", "", "HID top-level collection type (e.g. keyboard, mouse, gamepad, vendor-defined)")
+	format := fs.String("format", "defender", "export format: defender (Device Control XML) or intune (OMA-URI settings)")
+	out := fs.String("out", ".", "directory to write exported files to")
+	fs.Parse(args[1:])
+	// VID:PIDなどの位置引数の後に指定したフラグも読み取る
+	var positional []string
+	for fs.NArg() > 0 {
+		positional = append(positional, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	path := policyPath(cfg)
+	p, err := loadPolicy(path)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		printPolicy(p)
+		return 0
+	case "export":
+		// レジストリで配布された規則も含めて出力
+		effective, err := loadEffectivePolicy(cfg)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if err := exportPolicy(effective, *format, *out); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	case policyAllow, policyBlock:
+		rule := PolicyRule{Action: args[0], Serial: *serial, Port: *port, Class: *class, HIDType: strings.ToLower(*hidType), Note: *note, Added: time.Now()}
+		if len(positional) > 0 {
+			rule.VIDPID = strings.ToUpper(positional[0])
+			if vid, pid, ok := strings.Cut(rule.VIDPID, ":"); !ok || len(vid) != 4 || len(pid) != 4 {
+				fmt.Printf("invalid VID:PID %q\n", positional[0])
+				return 2
+			}
+		}
+		if rule.VIDPID == "" && rule.Serial == "" && rule.Port == "" && rule.Class == "" && rule.HIDType == "" {
+			fmt.Println("specify a VID:PID, -serial, -port, -class and/or -hid-type")
+			return 2
+		}
+		p.Rules = append(p.Rules, rule)
+	case "remove":
+		if len(positional) != 1 {
+			fmt.Println("usage: usbmon policy remove N (see usbmon policy list)")
+			return 2
+		}
+		n, err := strconv.Atoi(positional[0])
+		if err != nil || n < 1 || n > len(p.Rules) {
+			fmt.Printf("no rule %s\n", positional[0])
+			return 2
+		}
+		p.Rules = append(p.Rules[:n-1], p.Rules[n:]...)
+	default:
+		fmt.Printf("unknown policy command %q\n", args[0])
+		return 2
+	}
+
+	if err := savePolicy(path, p); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	printPolicy(p)
+	// 実行中の監視があれば、新しいポリシーを読み込ませる
+	if response, err := sendControlCommand("reload"); err != nil {
+		fmt.Printf("Policy saved to %s (%v)\n", path, err)
+	} else if response != "OK" {
+		fmt.Printf("Policy saved to %s, but the running monitor failed to reload: %s\n", path, response)
+		return 1
+	}
+	return 0
+}
+
+// 規則の一覧を番号付きで出力
+func printPolicy(p Policy) {
+	if len(p.Rules) == 0 {
+		fmt.Println("No policy rules")
+		return
+	}
+	fmt.Printf("%-3s  %-6s  %-9s  %-20s  %-10s  %-14s  %-10s  %-20s  %s\n", "#", "ACTION", "VID:PID", "SERIAL", "CLASS", "HID TYPE", "ADDED", "NOTE", "PORT")
+	for i, rule := range p.Rules {
+		fmt.Printf("%-3d  %-6s  %-9s  %-20s  %-10s  %-14s  %-10s  %-20s  %s\n", i+1, rule.Action, rule.VIDPID, rule.Serial, rule.Class, rule.HIDType, rule.Added.Format("2006-01-02"), rule.Note, rule.Port)
+	}
+}
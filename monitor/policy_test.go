@@ -0,0 +1,176 @@
+package monitor
+
+import "testing"
+
+func TestDeviceSerial(t *testing.T) {
+	tests := []struct {
+		instanceID string
+		want       string
+	}{
+		{`USB\VID_0781&PID_5581\4C530001230412345678`, "4C530001230412345678"},
+		// シリアル番号を持たないデバイスは、Windowsが生成した「&」を含むIDになる
+		{`USB\VID_046D&PID_C52B\5&2C0E7D7&0&2`, ""},
+		{`SERIAL`, "SERIAL"},
+		// USBストレージのディスクは、論理ユニット番号を除いたものがシリアル番号
+		{`USBSTOR\DISK&VEN_SANDISK&PROD_ULTRA&REV_1.00\4C530001230412345678&0`, "4C530001230412345678"},
+		{`USBSTOR\DISK&VEN_GENERIC&PROD_FLASH&REV_1.00\7&1A2B3C4D&0&0`, ""},
+	}
+	for _, test := range tests {
+		if got := deviceSerial(test.instanceID); got != test.want {
+			t.Errorf("deviceSerial(%q) = %q, want %q", test.instanceID, got, test.want)
+		}
+	}
+}
+
+func TestOnPort(t *testing.T) {
+	tests := []struct {
+		locationPath string
+		want         bool
+	}{
+		{policyPort, true},
+		{"pciroot(0)#pci(1400)#usbroot(0)#usb(3)", true},
+		// ポートに接続されたハブの先のデバイス
+		{policyPort + "#USB(2)", true},
+		{"PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(30)", false},
+		{"PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(4)", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := onPort(test.locationPath, policyPort); got != test.want {
+			t.Errorf("onPort(%q) = %v, want %v", test.locationPath, got, test.want)
+		}
+	}
+}
+
+// ポリシーの確認に使用するデバイス
+// USBメモリを接続したポート
+const policyPort = "PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(3)"
+
+var (
+	policyStick = DeviceInfo{
+		InstanceID:   `USB\VID_0781&PID_5581\4C530001230412345678`,
+		Class:        "USB",
+		LocationPath: policyPort,
+		Interfaces:   []DeviceInterface{{Class: "USB", Functions: []string{"DiskDrive"}}},
+	}
+	policyDisk = DeviceInfo{
+		InstanceID: `USBSTOR\DISK&VEN_SANDISK&PROD_ULTRA&REV_1.00\4C530001230412345678&0`,
+		Class:      "DiskDrive",
+	}
+	policyKeyboard = DeviceInfo{
+		InstanceID:   `USB\VID_046D&PID_C31C\5&2C0E7D7&0&1`,
+		Class:        "HIDClass",
+		LocationPath: "PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(1)",
+		HIDUsages:    []HIDUsage{{UsagePage: 0x01, Usage: 0x06, Type: hidTypeKeyboard}},
+	}
+)
+
+func TestPolicyRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   PolicyRule
+		device DeviceInfo
+		want   bool
+	}{
+		{"vid pid", PolicyRule{VIDPID: "0781:5581"}, policyStick, true},
+		{"vid pid lower case", PolicyRule{VIDPID: "046d:c31c"}, policyKeyboard, true},
+		{"other vid pid", PolicyRule{VIDPID: "0781:5581"}, policyKeyboard, false},
+		{"serial", PolicyRule{Serial: "4c530001230412345678"}, policyStick, true},
+		{"usbstor serial", PolicyRule{Serial: "4C530001230412345678"}, policyDisk, true},
+		// シリアル番号を持たないデバイスには、シリアル番号の規則は一致しない
+		{"generated serial", PolicyRule{Serial: "5&2C0E7D7&0&1"}, policyKeyboard, false},
+		{"vid pid and serial", PolicyRule{VIDPID: "0781:5581", Serial: "4C530001230412345678"}, policyStick, true},
+		{"vid pid and other serial", PolicyRule{VIDPID: "0781:5581", Serial: "0000"}, policyStick, false},
+		{"port", PolicyRule{Port: policyPort}, policyStick, true},
+		{"other port", PolicyRule{Port: policyPort}, policyKeyboard, false},
+		{"class", PolicyRule{Class: "hidclass"}, policyKeyboard, true},
+		// 複合デバイスのインターフェースの配下のクラス
+		{"function class", PolicyRule{Class: "DiskDrive"}, policyStick, true},
+		{"other class", PolicyRule{Class: "DiskDrive"}, policyKeyboard, false},
+		{"all conditions", PolicyRule{VIDPID: "0781:5581", Serial: "4C530001230412345678", Port: policyPort, Class: "DiskDrive"}, policyStick, true},
+		{"one condition fails", PolicyRule{VIDPID: "0781:5581", Port: "PCIROOT(0)#PCI(1400)#USBROOT(0)#USB(1)"}, policyStick, false},
+		{"hid type", PolicyRule{HIDType: hidTypeKeyboard}, policyKeyboard, true},
+		{"other hid type", PolicyRule{HIDType: hidTypeKeyboard}, policyStick, false},
+		{"hid type and vid pid", PolicyRule{VIDPID: "046D:C31C", HIDType: "KEYBOARD"}, policyKeyboard, true},
+		// 条件のない規則はどのデバイスにも一致しない
+		{"no conditions", PolicyRule{Action: policyBlock}, policyStick, false},
+	}
+	for _, test := range tests {
+		if got := test.rule.matches(test.device); got != test.want {
+			t.Errorf("%s: matches() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []PolicyRule
+		device DeviceInfo
+		// 一致する規則の番号（一致しない場合は-1）
+		want int
+	}{
+		{"no rules", nil, policyStick, -1},
+		{"no match", []PolicyRule{{Action: policyBlock, VIDPID: "046D:C52B"}}, policyStick, -1},
+		{
+			"serial over vid pid",
+			[]PolicyRule{
+				{Action: policyBlock, VIDPID: "0781:5581"},
+				{Action: policyAllow, Serial: "4C530001230412345678"},
+			},
+			policyStick, 1,
+		},
+		{
+			// 同じ具体性の規則はブロックを優先
+			"block wins a tie",
+			[]PolicyRule{
+				{Action: policyAllow, VIDPID: "0781:5581"},
+				{Action: policyBlock, VIDPID: "0781:5581"},
+			},
+			policyStick, 1,
+		},
+		{
+			"vid pid over class",
+			[]PolicyRule{
+				{Action: policyBlock, Class: "DiskDrive"},
+				{Action: policyAllow, VIDPID: "0781:5581"},
+			},
+			policyStick, 1,
+		},
+		{
+			// ポートとクラスを両方指定した規則はVID:PIDだけの規則と同じ具体性で、ブロックを優先
+			"port and class tie with vid pid",
+			[]PolicyRule{
+				{Action: policyAllow, VIDPID: "0781:5581"},
+				{Action: policyBlock, Port: policyPort, Class: "DiskDrive"},
+			},
+			policyStick, 1,
+		},
+		{
+			"port and class tie in either order",
+			[]PolicyRule{
+				{Action: policyBlock, Port: policyPort, Class: "DiskDrive"},
+				{Action: policyAllow, VIDPID: "0781:5581"},
+			},
+			policyStick, 0,
+		},
+		{
+			"first allow of equal rules",
+			[]PolicyRule{
+				{Action: policyAllow, Port: policyPort},
+				{Action: policyAllow, Class: "DiskDrive"},
+			},
+			policyStick, 0,
+		},
+	}
+	for _, test := range tests {
+		p := Policy{Rules: test.rules}
+		got := p.evaluate(test.device)
+		switch {
+		case test.want < 0 && got != nil:
+			t.Errorf("%s: evaluate() = %s, want no match", test.name, got)
+		case test.want >= 0 && got != &p.Rules[test.want]:
+			t.Errorf("%s: evaluate() = %v, want %s", test.name, got, p.Rules[test.want])
+		}
+	}
+}
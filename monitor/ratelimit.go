@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 期間が終わった記録を削除する間隔
+const rateSweepInterval = time.Minute
+
+// イベントの出力の制限（同じデバイスの同じ種類のイベントを、windowの間にmax_events件まで出力）
+type RateLimitRule struct {
+	// 対象のイベントの種類（例: Connected、空の場合はすべて）
+	Action string `json:"action"`
+	// 対象のデバイスの種類（例: Hub、空の場合はすべて）
+	DeviceType string `json:"device_type"`
+	// windowの間に出力するイベントの数
+	MaxEvents int `json:"max_events"`
+	// 制限する期間（例: "10m"）
+	Window Duration `json:"window"`
+}
+
+// イベントが制限の対象かを判定
+func (r RateLimitRule) matches(event DeviceEvent) bool {
+	return (r.Action == "" || strings.EqualFold(r.Action, event.Action)) &&
+		(r.DeviceType == "" || strings.EqualFold(r.DeviceType, event.DeviceType))
+}
+
+// 制限の期間ごとの出力したイベントと抑制したイベントの数
+type rateWindow struct {
+	start time.Time
+	// 期間の長さ（設定の再読み込みで規則が変わっても、記録した時点の長さで期限を判定する）
+	length     time.Duration
+	count      int
+	suppressed int
+}
+
+// 同じデバイスのイベントが短時間に大量に出力されないよう制限し、抑制したイベントの数をSuppressedイベントとしてまとめて出力
+// 監査ログには制限せずにすべてのイベントを記録する
+type RateLimiter struct {
+	mu sync.Mutex
+	// 規則の番号・イベントの種類・フィンガープリントごとの期間
+	windows map[string]*rateWindow
+	// 最後に期間が終わった記録を削除した時刻
+	lastSweep time.Time
+}
+
+var rateLimiter = &RateLimiter{windows: map[string]*rateWindow{}}
+
+// イベントを出力してよいかを判定（最初に一致した規則で制限する）
+func (l *RateLimiter) allow(event DeviceEvent) bool {
+	for i, rule := range currentConfig().RateLimits {
+		if !rule.matches(event) {
+			continue
+		}
+		if rule.MaxEvents <= 0 || rule.Window <= 0 {
+			return true
+		}
+		return l.allowWindow(fmt.Sprintf("%d|%s|%s", i, event.Action, event.Fingerprint), event, rule)
+	}
+	return true
+}
+
+// 規則の期間内に出力したイベントの数を数え、上限を超えたイベントを抑制
+func (l *RateLimiter) allowWindow(key string, event DeviceEvent, rule RateLimitRule) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateSweepInterval {
+		l.sweepLocked(now)
+	}
+	window, ok := l.windows[key]
+	if !ok || now.Sub(window.start) >= time.Duration(rule.Window) {
+		l.windows[key] = &rateWindow{start: now, length: time.Duration(rule.Window), count: 1}
+		return true
+	}
+	if window.count < rule.MaxEvents {
+		window.count++
+		return true
+	}
+	window.suppressed++
+	// 最初に抑制したときに、期間の終わりに抑制した数を出力するよう予約
+	if window.suppressed == 1 {
+		time.AfterFunc(time.Duration(rule.Window)-now.Sub(window.start), func() {
+			l.flush(key, event)
+		})
+	}
+	return false
+}
+
+// 期間が終わった記録を削除し、一度しか接続しなかったデバイスの記録が残り続けないようにする
+// 抑制した数の出力を予約した記録は、出力するときにflushで削除する
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	for key, window := range l.windows {
+		if window.suppressed == 0 && now.Sub(window.start) >= window.length {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// 期間が終わったときに、抑制したイベントの数を抑制したイベントと同じ重大度のSuppressedイベントとして出力
+// 抑制したイベントと同じ出力先に届くよう、監査ログに記録して振り分ける（このイベント自体は制限しない）
+func (l *RateLimiter) flush(key string, event DeviceEvent) {
+	l.mu.Lock()
+	window, ok := l.windows[key]
+	if ok {
+		delete(l.windows, key)
+	}
+	l.mu.Unlock()
+	if !ok || window.suppressed == 0 {
+		return
+	}
+	routeEvent(recordDeviceEvent(DeviceEvent{
+		Action:      "Suppressed",
+		HostName:    event.HostName,
+		WatchClass:  event.WatchClass,
+		DeviceType:  event.DeviceType,
+		Severity:    event.Severity,
+		Fingerprint: event.Fingerprint,
+		Explanation: fmt.Sprintf("%d similar %s events suppressed since %s", window.suppressed, event.Action, window.start.Format(time.RFC3339)),
+		Device:      event.Device,
+	}, false))
+}
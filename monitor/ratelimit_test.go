@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRuleMatches(t *testing.T) {
+	event := DeviceEvent{Action: "Arrival", DeviceType: deviceTypeCamera}
+	tests := []struct {
+		rule RateLimitRule
+		want bool
+	}{
+		{RateLimitRule{}, true},
+		{RateLimitRule{Action: "Arrival"}, true},
+		{RateLimitRule{Action: "arrival"}, true},
+		{RateLimitRule{Action: "Removal"}, false},
+		{RateLimitRule{DeviceType: "camera"}, true},
+		{RateLimitRule{DeviceType: deviceTypePhone}, false},
+		{RateLimitRule{Action: "Arrival", DeviceType: deviceTypeCamera}, true},
+		{RateLimitRule{Action: "Arrival", DeviceType: deviceTypePhone}, false},
+	}
+	for _, test := range tests {
+		if got := test.rule.matches(event); got != test.want {
+			t.Errorf("%+v matches = %v, want %v", test.rule, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	hour := Duration(time.Hour)
+	arrival := func(fingerprint string) DeviceEvent {
+		return DeviceEvent{Action: "Arrival", DeviceType: deviceTypeGeneric, Fingerprint: fingerprint}
+	}
+	removal := func(fingerprint string) DeviceEvent {
+		return DeviceEvent{Action: "Removal", DeviceType: deviceTypeGeneric, Fingerprint: fingerprint}
+	}
+	tests := []struct {
+		name   string
+		rules  []RateLimitRule
+		events []DeviceEvent
+		want   []bool
+	}{
+		{
+			name:   "no rules",
+			events: []DeviceEvent{arrival("a"), arrival("a"), arrival("a")},
+			want:   []bool{true, true, true},
+		},
+		{
+			name:   "limited",
+			rules:  []RateLimitRule{{MaxEvents: 2, Window: hour}},
+			events: []DeviceEvent{arrival("a"), arrival("a"), arrival("a"), arrival("a")},
+			want:   []bool{true, true, false, false},
+		},
+		{
+			name:   "per device",
+			rules:  []RateLimitRule{{MaxEvents: 1, Window: hour}},
+			events: []DeviceEvent{arrival("a"), arrival("b"), arrival("a"), arrival("b")},
+			want:   []bool{true, true, false, false},
+		},
+		{
+			name:   "per action",
+			rules:  []RateLimitRule{{MaxEvents: 1, Window: hour}},
+			events: []DeviceEvent{arrival("a"), removal("a"), arrival("a"), removal("a")},
+			want:   []bool{true, true, false, false},
+		},
+		{
+			name:   "not matched",
+			rules:  []RateLimitRule{{Action: "Removal", MaxEvents: 1, Window: hour}},
+			events: []DeviceEvent{arrival("a"), arrival("a"), removal("a"), removal("a")},
+			want:   []bool{true, true, true, false},
+		},
+		{
+			// 最初に一致した規則で制限する（上限のない規則に一致した場合は制限しない）
+			name: "first matching rule",
+			rules: []RateLimitRule{
+				{Action: "Removal"},
+				{MaxEvents: 1, Window: hour},
+			},
+			events: []DeviceEvent{removal("a"), removal("a"), arrival("a"), arrival("a")},
+			want:   []bool{true, true, true, false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, Config{RateLimits: test.rules})
+			limiter := &RateLimiter{windows: map[string]*rateWindow{}}
+			for i, event := range test.events {
+				if got := limiter.allow(event); got != test.want[i] {
+					t.Errorf("event %d (%s %s): allow() = %v, want %v", i, event.Action, event.Fingerprint, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterFlush(t *testing.T) {
+	const window = 50 * time.Millisecond
+	useConfig(t, Config{RateLimits: []RateLimitRule{{MaxEvents: 1, Window: Duration(window)}}})
+	sink := useRecordingSink(t)
+	limiter := &RateLimiter{windows: map[string]*rateWindow{}}
+	event := DeviceEvent{Action: "Arrival", Severity: severityWarning, Fingerprint: "a"}
+
+	for i, want := range []bool{true, false, false} {
+		if got := limiter.allow(event); got != want {
+			t.Errorf("event %d: allow() = %v, want %v", i, got, want)
+		}
+	}
+	// 期間の終わりに、抑制したイベントの数が抑制したイベントと同じ重大度で出力される
+	summary, ok := sink.next(10 * window)
+	if !ok {
+		t.Fatal("no Suppressed event")
+	}
+	if summary.Action != "Suppressed" || summary.Severity != severityWarning {
+		t.Errorf("summary = %s (%s), want Suppressed (%s)", summary.Action, summary.Severity, severityWarning)
+	}
+	if !strings.HasPrefix(summary.Explanation, "2 similar Arrival events suppressed") {
+		t.Errorf("summary explanation = %q", summary.Explanation)
+	}
+	if !limiter.allow(event) {
+		t.Error("allow() after the window = false, want true")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	now := time.Now()
+	limiter := &RateLimiter{windows: map[string]*rateWindow{
+		"expired": {start: now.Add(-2 * time.Hour), length: time.Hour, count: 1},
+		"active":  {start: now.Add(-time.Minute), length: time.Hour, count: 1},
+		// 抑制した数の出力を予約した記録は、flushで削除する
+		"pending": {start: now.Add(-2 * time.Hour), length: time.Hour, count: 1, suppressed: 1},
+	}}
+	limiter.allowWindow("new", DeviceEvent{Action: "Arrival"}, RateLimitRule{MaxEvents: 1, Window: Duration(time.Hour)})
+
+	var keys []string
+	for key := range limiter.windows {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if got := strings.Join(keys, ","); got != "active,new,pending" {
+		t.Errorf("windows = %s, want active,new,pending", got)
+	}
+}
+
+func TestRateLimitedSink(t *testing.T) {
+	const window = 50 * time.Millisecond
+	inner := newRecordingSink()
+	sink := &rateLimitedSink{name: "siem", sink: inner, limit: SinkRateLimit{MaxEvents: 2, Window: Duration(window)}}
+
+	for i := 0; i < 5; i++ {
+		if err := sink.send(DeviceEvent{Action: "Arrival"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ハートビートは制限しない
+	if err := sink.send(DeviceEvent{Action: "Heartbeat", Heartbeat: &Heartbeat{}}); err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for len(actions) < 3 {
+		event, ok := inner.next(0)
+		if !ok {
+			break
+		}
+		actions = append(actions, event.Action)
+	}
+	if got := strings.Join(actions, ","); got != "Arrival,Arrival,Heartbeat" {
+		t.Errorf("sent = %s, want Arrival,Arrival,Heartbeat", got)
+	}
+	summary, ok := inner.next(10 * window)
+	if !ok {
+		t.Fatal("no Suppressed event")
+	}
+	if summary.Action != "Suppressed" || !strings.HasPrefix(summary.Explanation, "3 events not sent to sink siem") {
+		t.Errorf("summary = %s: %q", summary.Action, summary.Explanation)
+	}
+	// 抑制した数を送った後は、次の期間のイベントを送る
+	if err := sink.send(DeviceEvent{Action: "Removal"}); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := inner.next(0); !ok || event.Action != "Removal" {
+		t.Errorf("sent = %s, want Removal", event.Action)
+	}
+}
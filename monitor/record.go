@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 記録するファイルの名前
+const (
+	// 受信したWM_DEVICECHANGEの内容（1行に1件のJSON）
+	recordNotificationsFile = "notifications.jsonl"
+	// 列挙後のイベント（1行に1件のJSON、simulateの-fixtureにそのまま指定できる）
+	recordEventsFile = "events.jsonl"
+)
+
+// 受信したWM_DEVICECHANGEの内容
+type rawNotification struct {
+	// 受信した時刻
+	Time time.Time
+	// イベントの種類（例: 0x8000 = DBT_DEVICEARRIVAL）
+	WParam uintptr
+	// DEV_BROADCAST_HDRのデバイスの種類（lParamがない場合は0）
+	DeviceType uint32 `json:",omitempty"`
+	// デバイスインターフェースクラスのGUID
+	ClassGuid string `json:",omitempty"`
+	// デバイスインターフェース名（デバイスパス）
+	Name string `json:",omitempty"`
+	// ボリュームのドライブ文字のビットマスク
+	UnitMask uint32 `json:",omitempty"`
+}
+
+// 受信した通知と列挙後のイベントをファイルに記録し、後からsimulateで再現できるようにする
+type Recorder struct {
+	mu sync.Mutex
+	// 受信した通知の書き込み先
+	notifications *json.Encoder
+	// 列挙後のイベントの書き込み先
+	events *json.Encoder
+	// 開いたファイル（監視の終了時に閉じる）
+	files []*os.File
+}
+
+// -recordを指定した場合の記録先（指定しない場合はnil）
+var recorder *Recorder
+
+// 記録先のディレクトリを作成し、ファイルを追記モードで開く
+func openRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to create record directory: %w", err)
+	}
+	r := &Recorder{}
+	open := func(name string) (*json.Encoder, error) {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open record file: %w", err)
+		}
+		r.files = append(r.files, file)
+		return json.NewEncoder(file), nil
+	}
+	var err error
+	if r.notifications, err = open(recordNotificationsFile); err != nil {
+		return nil, err
+	}
+	if r.events, err = open(recordEventsFile); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// 記録先のファイルを閉じる
+func (r *Recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, file := range r.files {
+		if err := file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Failed to close record file: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 受信した通知を記録
+func (r *Recorder) recordNotification(notification rawNotification) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.notifications.Encode(notification); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// 列挙後のイベントを記録
+func (r *Recorder) recordEvent(event DeviceEvent) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.events.Encode(event); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// WM_DEVICECHANGEのwParam・lParamから、lParamが指すDEV_BROADCAST_*構造体の内容を読み取る
+func decodeNotification(wParam, lParam uintptr) rawNotification {
+	notification := rawNotification{Time: time.Now(), WParam: wParam}
+	// DBT_DEVNODES_CHANGEDなど、lParamを持たないイベント
+	if lParam == 0 {
+		return notification
+	}
+	hdr := *(**DevBroadcastHdr)(unsafe.Pointer(&lParam))
+	notification.DeviceType = hdr.DeviceType
+	switch hdr.DeviceType {
+	case DBT_DEVTYP_DEVICEINTERFACE:
+		bdi := *(**DevBroadcastDeviceInterface)(unsafe.Pointer(&lParam))
+		length := (bdi.Size - uint32(unsafe.Offsetof(bdi.Name))) / 2
+		notification.ClassGuid = bdi.ClassGuid.String()
+		notification.Name = windows.UTF16ToString(unsafe.Slice(&bdi.Name[0], length))
+	case DBT_DEVTYP_VOLUME:
+		bv := *(**DevBroadcastVolume)(unsafe.Pointer(&lParam))
+		notification.UnitMask = bv.UnitMask
+	}
+	return notification
+}
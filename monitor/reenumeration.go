@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ポートごとに最後に接続されたデバイスのディスクリプタ
+type portDescriptor struct {
+	instanceID string
+	signature  string
+	// 接続中かどうか
+	connected bool
+	// 切断された時刻
+	removed time.Time
+}
+
+// 同じポートで、取り外さずにディスクリプタを変えて列挙し直したデバイス（BadUSBなど）を検出
+type PortWatcher struct {
+	mu sync.Mutex
+	// 接続位置のパスごとの最後のデバイス
+	ports map[string]*portDescriptor
+	// インスタンスIDごとの接続位置のパス（切断時はインスタンスIDしか分からないため）
+	locations map[string]string
+}
+
+var portWatcher = &PortWatcher{ports: map[string]*portDescriptor{}, locations: map[string]string{}}
+
+// デバイスを識別するディスクリプタの情報（VID:PID・クラス・インターフェースのクラス）
+func descriptorSignature(deviceInfo DeviceInfo) string {
+	vid, pid := parseVIDPID(deviceInfo.InstanceID)
+	parts := []string{vid + ":" + pid, deviceInfo.Class}
+	if len(deviceInfo.CompatibleIDs) > 0 {
+		parts = append(parts, deviceInfo.CompatibleIDs[0])
+	}
+	var interfaces []string
+	for _, iface := range deviceInfo.Interfaces {
+		interfaces = append(interfaces, iface.Class)
+	}
+	slices.Sort(interfaces)
+	if len(interfaces) > 0 {
+		parts = append(parts, "interfaces="+strings.Join(interfaces, "+"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// 接続されたデバイスを記録し、同じポートの直前のデバイスとディスクリプタが異なる場合は直前のディスクリプタを返す
+// 直前のデバイスが切断されていないか、切断からwindow以内に接続された場合を、取り外さずに列挙し直したと判定
+func (w *PortWatcher) arrived(deviceInfo DeviceInfo, arrivedAt time.Time, window time.Duration) (string, bool) {
+	if deviceInfo.LocationPath == "" {
+		return "", false
+	}
+	signature := descriptorSignature(deviceInfo)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	previous := w.ports[deviceInfo.LocationPath]
+	w.ports[deviceInfo.LocationPath] = &portDescriptor{instanceID: deviceInfo.InstanceID, signature: signature, connected: true}
+	w.locations[strings.ToUpper(deviceInfo.InstanceID)] = deviceInfo.LocationPath
+	if previous == nil || previous.signature == signature {
+		return "", false
+	}
+	if previous.connected || arrivedAt.Sub(previous.removed) <= window {
+		return previous.signature, true
+	}
+	return "", false
+}
+
+// 切断されたデバイスのポートに切断時刻を記録
+func (w *PortWatcher) removed(instanceID string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	location, ok := w.locations[strings.ToUpper(instanceID)]
+	if !ok {
+		return
+	}
+	delete(w.locations, strings.ToUpper(instanceID))
+	if port := w.ports[location]; port != nil && strings.EqualFold(port.instanceID, instanceID) {
+		port.connected = false
+		port.removed = now
+	}
+}
+
+// 同じポートでディスクリプタを変えて列挙し直したデバイスを、重大度criticalのReenumeratedイベントとして出力
+func detectReenumeration(event DeviceEvent) {
+	window := time.Duration(currentConfig().ReenumerationWindow)
+	if window <= 0 {
+		return
+	}
+	arrivedAt := time.Now().Add(-event.ReadyLatency - event.MountLatency)
+	previous, changed := portWatcher.arrived(event.Device, arrivedAt, window)
+	if !changed {
+		return
+	}
+	event.Action = "Reenumerated"
+	event.Severity = severityCritical
+	event.Explanation = fmt.Sprintf("descriptors changed on %s without unplug: %s -> %s", event.Device.LocationPath, previous, descriptorSignature(event.Device))
+	logDeviceEvent(event)
+}
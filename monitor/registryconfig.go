@@ -0,0 +1,211 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// グループポリシーや端末管理ツールで配布する設定のレジストリキー（HKLM）
+	registryConfigPath = `Software\usbmon`
+	// 配布する許可・ブロックの規則のサブキー
+	registryPolicySubkey = `Policy`
+	// 重大度の設定のサブキー
+	registrySeveritiesSubkey = `severities`
+	// レジストリの規則の説明
+	registryRuleNote = "registry"
+)
+
+// レジストリの設定で、設定ファイルの値を上書き（レジストリの設定を優先）
+// 値の名前は設定ファイルのJSONのキーと同じ（文字列・時間はREG_SZ、一覧はREG_MULTI_SZ、真偽値はREG_DWORD）
+func applyRegistryConfig(cfg *Config) error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, registryConfigPath, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to open registry config HKLM\\%s: %w", registryConfigPath, err)
+	}
+	defer key.Close()
+
+	if classes, _, err := key.GetStringsValue("watch_classes"); err == nil {
+		cfg.WatchClasses = classes
+	}
+	readRegistryBool(key, "monitor_bluetooth_hid", &cfg.MonitorBluetoothHID)
+	readRegistryBool(key, "block_removable_execution", &cfg.BlockRemovableExecution)
+	readRegistryBool(key, "detect_duplicate_serials", &cfg.DetectDuplicateSerials)
+	readRegistryBool(key, "detect_identity_morph", &cfg.DetectIdentityMorph)
+	readRegistryBool(key, "exclude_root_hubs", &cfg.Filters.ExcludeRootHubs)
+	readRegistryBool(key, "exclude_internal_hubs", &cfg.Filters.ExcludeInternalHubs)
+	readRegistryBool(key, "exclude_builtin_devices", &cfg.Filters.ExcludeBuiltinDevices)
+	readRegistryString(key, "policy_file", &cfg.PolicyFile)
+	readRegistryString(key, "policy_url", &cfg.PolicyURL)
+	readRegistryString(key, "policy_public_key", &cfg.PolicyPublicKey)
+	readRegistryString(key, "audit_log", &cfg.AuditLog)
+	readRegistryString(key, "annotations_file", &cfg.AnnotationsFile)
+	readRegistryString(key, "maintenance_file", &cfg.MaintenanceFile)
+	readRegistryString(key, "signing_key", &cfg.SigningKey)
+	readRegistryString(key, "startup_events", &cfg.StartupEvents)
+	if err := readRegistryDuration(key, "reconcile_interval", &cfg.ReconcileInterval); err != nil {
+		return err
+	}
+	if err := readRegistryDuration(key, "reenumeration_window", &cfg.ReenumerationWindow); err != nil {
+		return err
+	}
+	if err := readRegistryDuration(key, "dedup_window", &cfg.DedupWindow); err != nil {
+		return err
+	}
+	if err := readRegistryDuration(key, "policy_poll_interval", &cfg.PolicyPollInterval); err != nil {
+		return err
+	}
+	if err := readRegistryDuration(key, "retention_max_age", &cfg.RetentionMaxAge); err != nil {
+		return err
+	}
+	if err := readRegistryDuration(key, "archive_after", &cfg.ArchiveAfter); err != nil {
+		return err
+	}
+	if n, _, err := key.GetIntegerValue("retention_max_size_mb"); err == nil {
+		cfg.RetentionMaxSizeMB = int(n)
+	}
+
+	severities, err := registry.OpenKey(key, registrySeveritiesSubkey, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer severities.Close()
+	names, err := severities.ReadValueNames(0)
+	if err != nil {
+		return fmt.Errorf("Failed to read registry config HKLM\\%s\\%s: %w", registryConfigPath, registrySeveritiesSubkey, err)
+	}
+	if cfg.Severities == nil {
+		cfg.Severities = map[string]string{}
+	}
+	for _, name := range names {
+		if severity, _, err := severities.GetStringValue(name); err == nil {
+			cfg.Severities[name] = severity
+		}
+	}
+	return nil
+}
+
+// REG_SZの値があれば読み込む
+func readRegistryString(key registry.Key, name string, value *string) {
+	if s, _, err := key.GetStringValue(name); err == nil {
+		*value = s
+	}
+}
+
+// REG_DWORDの値があれば真偽値として読み込む（0以外はtrue）
+func readRegistryBool(key registry.Key, name string, value *bool) {
+	if n, _, err := key.GetIntegerValue(name); err == nil {
+		*value = n != 0
+	}
+}
+
+// REG_SZの値があれば時間（例: "5m"）として読み込む
+func readRegistryDuration(key registry.Key, name string, value *Duration) error {
+	s, _, err := key.GetStringValue(name)
+	if err != nil {
+		return nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("Failed to parse registry config %s %q: %w", name, s, err)
+	}
+	*value = Duration(duration)
+	return nil
+}
+
+// レジストリで配布された許可・ブロックの規則を読み込む
+// blockとallowの値（REG_MULTI_SZ）に、VID:PID、VID:PID\シリアル番号、\シリアル番号 のいずれかを指定する
+func loadRegistryPolicy() ([]PolicyRule, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, registryConfigPath+`\`+registryPolicySubkey, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open registry policy HKLM\\%s\\%s: %w", registryConfigPath, registryPolicySubkey, err)
+	}
+	defer key.Close()
+
+	var rules []PolicyRule
+	for _, action := range []string{policyBlock, policyAllow} {
+		entries, _, err := key.GetStringsValue(action)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			vidPID, serial, _ := strings.Cut(entry, `\`)
+			if vidPID == "" && serial == "" {
+				continue
+			}
+			rules = append(rules, PolicyRule{
+				Action: action,
+				VIDPID: strings.ToUpper(vidPID),
+				Serial: serial,
+				Note:   registryRuleNote,
+			})
+		}
+	}
+	return rules, nil
+}
+
+// 監視で使用するポリシー（配布サーバーから取得した規則・レジストリで配布された規則・ポリシーファイルの規則を合わせたもの）
+// 規則は最も具体的なものが優先され、同じ具体性ならブロックを、さらに同じなら配布サーバー・レジストリ・ポリシーファイルの順で先の規則を使用する
+func loadEffectivePolicy(cfg Config) (Policy, error) {
+	local, err := loadPolicy(policyPath(cfg))
+	if err != nil {
+		return local, err
+	}
+	rules, err := loadRegistryPolicy()
+	if err != nil {
+		return local, err
+	}
+	p, err := loadRemotePolicy(cfg)
+	if err != nil {
+		// 公開鍵を変更した場合などは、次に取得するまで配布サーバーの規則を使用しない
+		fmt.Println(err)
+		p = Policy{}
+	}
+	p.Rules = append(p.Rules, rules...)
+	p.Rules = append(p.Rules, local.Rules...)
+	return p, nil
+}
+
+// レジストリの設定の変更を待ち、変更されたら再読み込み
+func watchRegistryConfig(ctx context.Context) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, registryConfigPath, registry.NOTIFY)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+	changed, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		fmt.Printf("Failed to watch registry config: %v\n", err)
+		return
+	}
+	defer windows.CloseHandle(changed)
+	for {
+		// 変更をイベントで通知させ、コンテキストのキャンセルでも待機をやめられるようにする
+		err := windows.RegNotifyChangeKeyValue(windows.Handle(key), true, windows.REG_NOTIFY_CHANGE_NAME|windows.REG_NOTIFY_CHANGE_LAST_SET, changed, true)
+		if err != nil {
+			fmt.Printf("Failed to watch registry config: %v\n", err)
+			return
+		}
+		ok, err := waitContext(ctx, changed)
+		if err != nil {
+			fmt.Printf("Failed to watch registry config: %v\n", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		requestReload()
+	}
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// 設定の再読み込みを依頼するメッセージ（WM_APP以降はアプリケーションで使用できる）
+	WM_APP_RELOAD = 0x8000 + 1
+	// 設定ファイルの変更を確認する間隔
+	configPollInterval = 2 * time.Second
+)
+
+var (
+	// 再読み込みの依頼を1つずつ処理するためのロック
+	reloadMu sync.Mutex
+	// メッセージループで処理した再読み込みの結果
+	reloadResults = make(chan error, 1)
+)
+
+// メッセージループに設定の再読み込みを依頼し、結果を待つ
+// 通知の登録やタイマーはウィンドウのスレッドでしか変更できないため、メッセージループで再読み込みする
+func requestReload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	hWnd := watchdog.activeWindow()
+	if hWnd == 0 {
+		return errors.New("Failed to reload config: monitor is not running")
+	}
+	// 作り直しや終了でウィンドウが破棄されていた場合は処理されず0が返る
+	if sendMessage(hWnd, WM_APP_RELOAD, 0, 0) == 0 {
+		return errors.New("Failed to reload config: monitor is not running")
+	}
+	return <-reloadResults
+}
+
+// 設定ファイルを読み込み直し、通知の登録とタイマーを新しい設定に合わせる
+// 通知ウィンドウはそのまま使用するため、処理中のイベントは失われない
+func reloadConfig(hWnd windows.HWND) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf(tr("Failed to reload config: %v\n"), err)
+		return err
+	}
+	p, err := loadEffectivePolicy(cfg)
+	if err != nil {
+		fmt.Printf(tr("Failed to reload config: %v\n"), err)
+		return err
+	}
+	annotations, err := loadAnnotations(annotationsPath(cfg))
+	if err != nil {
+		fmt.Printf(tr("Failed to reload config: %v\n"), err)
+		return err
+	}
+	sinks, err := buildSinks(cfg)
+	if err != nil {
+		fmt.Printf(tr("Failed to reload config: %v\n"), err)
+		return err
+	}
+	maintenance, err := loadMaintenance(maintenancePath(cfg))
+	if err != nil {
+		fmt.Printf(tr("Failed to reload config: %v\n"), err)
+		return err
+	}
+	previous := currentConfig()
+	setConfig(cfg)
+	setPolicy(p)
+	setAnnotations(annotations)
+	setSinks(sinks)
+	setMaintenance(maintenance)
+
+	classes, _ := notificationClasses(cfg)
+	if !slices.Equal(classes, watchClasses) {
+		watchClasses = classes
+		if err := reregisterNotifications(hWnd); err != nil {
+			fmt.Println(err)
+			errorReporter.report(faultRegistration, err.Error(), nil)
+			return err
+		}
+		// 新しく監視するデバイスの種類の、既に接続されているデバイスを接続イベントとして出力しないよう記録し直す
+		devices := snapshotDevices(watchClasses)
+		setTrackedDevices(devices)
+		snapshot := maps.Clone(devices)
+		deviceTasks.spawn(func(ctx context.Context) { deviceCache.preload(ctx, snapshot, false) })
+	}
+	if cfg.ReconcileInterval != previous.ReconcileInterval {
+		if err := setReconcileTimer(hWnd, time.Duration(cfg.ReconcileInterval)); err != nil {
+			fmt.Println(err)
+			return err
+		}
+	}
+	fmt.Print(tr("Config reloaded: "))
+	fmt.Printf(tr("Path=%s, "), configPath)
+	fmt.Printf(tr("Watch Classes=%s\n"), strings.Join(watchClasses, ", "))
+	return nil
+}
+
+// 取りこぼした通知を補正するタイマーを作成し直す（0の場合は停止）
+func setReconcileTimer(hWnd windows.HWND, interval time.Duration) error {
+	killTimer(hWnd, reconcileTimerID)
+	if interval <= 0 {
+		return nil
+	}
+	if err := setTimer(hWnd, reconcileTimerID, interval); err != nil {
+		return fmt.Errorf("Failed to create reconciliation timer: %w", err)
+	}
+	return nil
+}
+
+// 設定ファイルの更新日時を定期的に確認し、変更されていれば再読み込み
+func watchConfigFile(ctx context.Context, path string) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	for sleepContext(ctx, configPollInterval) {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		requestReload()
+	}
+}
@@ -0,0 +1,228 @@
+package monitor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// 配布サーバーからポリシーを取得する間隔の既定値
+	defaultPolicyPollInterval = 15 * time.Minute
+	// ポリシーの取得のタイムアウト
+	policyFetchTimeout = 30 * time.Second
+	// ポリシーの応答の最大サイズ
+	maxPolicyResponseSize = 4 << 20
+	// 配布サーバーから取得した署名付きのポリシーを保存するファイルの拡張子（ポリシーファイルのパスに付ける）
+	remotePolicySuffix = ".remote"
+)
+
+// 配布サーバーが返す署名付きのポリシー
+// signatureは、policyのJSON（送信されたバイト列そのまま）に対するEd25519署名をBase64で表したもの
+type SignedPolicy struct {
+	Policy    json.RawMessage `json:"policy"`
+	Signature string          `json:"signature"`
+}
+
+// 署名されたpolicyのJSONに含める、古いポリシーの再送を拒否するための項目
+type remotePolicyVersion struct {
+	// ポリシーを発行するたびに増やす番号
+	Serial uint64 `json:"serial"`
+	// ポリシーの有効期限（過ぎたポリシーは取得しても使用しない）
+	Expires time.Time `json:"expires"`
+}
+
+// 配布サーバーからポリシーを取得するクライアント
+type RemotePolicySource struct {
+	client *http.Client
+	// ETagを記録したときのpolicy_url
+	url string
+	// 前回取得したポリシーのETag（変更がなければ304が返る）
+	etag string
+}
+
+var remotePolicy = &RemotePolicySource{client: &http.Client{Timeout: policyFetchTimeout}}
+
+// 配布サーバーのURLが設定されている間、定期的にポリシーを取得して保存
+// 設定の再読み込みでURLや間隔が変わった場合は、次回の取得から反映する
+func (s *RemotePolicySource) run(ctx context.Context) {
+	for {
+		cfg := currentConfig()
+		if cfg.PolicyURL != "" {
+			if err := s.update(cfg); err != nil {
+				fmt.Println(err)
+			}
+		}
+		interval := time.Duration(cfg.PolicyPollInterval)
+		if interval <= 0 {
+			interval = defaultPolicyPollInterval
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+	}
+}
+
+// ポリシーを取得し、変更されていれば保存して監視に反映
+// ポリシーファイル（usbmon policyで編集する規則）は書き換えず、別のファイルに保存して読み込み時に合わせる
+func (s *RemotePolicySource) update(cfg Config) error {
+	remote, body, changed, err := s.fetch(cfg)
+	if err != nil || !changed {
+		return err
+	}
+	// 配布サーバーに接続できない状態で起動しても前回のポリシーを使えるよう、署名付きのまま保存
+	if err := saveRemotePolicy(remotePolicyPath(cfg), body); err != nil {
+		return err
+	}
+	p, err := loadEffectivePolicy(cfg)
+	if err != nil {
+		return err
+	}
+	setPolicy(p)
+	fmt.Printf(tr("Policy updated: URL=%s, Rules=%d\n"), cfg.PolicyURL, len(remote.Rules))
+	return nil
+}
+
+// 配布サーバーから取得したポリシーを保存するファイルのパス
+func remotePolicyPath(cfg Config) string {
+	return policyPath(cfg) + remotePolicySuffix
+}
+
+// 配布サーバーから取得した署名付きのポリシーを保存（書き込みの途中で停止しても前回のポリシーが残るよう、一時ファイルから置き換える）
+func saveRemotePolicy(path string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create policy directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("Failed to write remote policy: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Failed to write remote policy: %w", err)
+	}
+	return nil
+}
+
+// 保存した配布サーバーのポリシーを読み込み、署名を検証し直す（policy_urlを指定しない場合・ファイルがない場合は規則なし）
+// 保存したファイルを書き換えて規則を追加されないよう、署名を検証できないポリシーは使用しない
+func loadRemotePolicy(cfg Config) (Policy, error) {
+	if cfg.PolicyURL == "" {
+		return Policy{}, nil
+	}
+	path := remotePolicyPath(cfg)
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Policy{}, nil
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("Failed to read remote policy: %w", err)
+	}
+	// 保存した後に有効期限を過ぎても、配布サーバーに接続できるまでは保存したポリシーを使用する
+	p, _, err := verifySignedPolicy(body, cfg.PolicyPublicKey, path)
+	return p, err
+}
+
+// 保存した配布サーバーのポリシーの番号（ファイルがない場合・検証できない場合は0）
+func savedRemotePolicySerial(cfg Config) uint64 {
+	body, err := os.ReadFile(remotePolicyPath(cfg))
+	if err != nil {
+		return 0
+	}
+	_, version, err := verifySignedPolicy(body, cfg.PolicyPublicKey, remotePolicyPath(cfg))
+	if err != nil {
+		return 0
+	}
+	return version.Serial
+}
+
+// 署名付きのポリシーの署名を検証して規則を読み込む（sourceはエラーの表示用）
+func verifySignedPolicy(body []byte, publicKeyText string, source string) (Policy, remotePolicyVersion, error) {
+	var p Policy
+	var version remotePolicyVersion
+	publicKey, err := base64.StdEncoding.DecodeString(publicKeyText)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return p, version, errors.New("Failed to verify policy: policy_public_key must be a base64 Ed25519 public key")
+	}
+	var signed SignedPolicy
+	if err := json.Unmarshal(body, &signed); err != nil {
+		return p, version, fmt.Errorf("Failed to parse policy from %s: %w", source, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(publicKey, signed.Policy, signature) {
+		return p, version, fmt.Errorf("Failed to verify policy signature from %s", source)
+	}
+	if err := json.Unmarshal(signed.Policy, &p); err != nil {
+		return p, version, fmt.Errorf("Failed to parse policy from %s: %w", source, err)
+	}
+	if err := json.Unmarshal(signed.Policy, &version); err != nil {
+		return p, version, fmt.Errorf("Failed to parse policy from %s: %w", source, err)
+	}
+	return p, version, nil
+}
+
+// 配布サーバーからポリシーを取得して署名を検証し、規則と応答の本文を返す（前回から変更がなければfalseを返す）
+func (s *RemotePolicySource) fetch(cfg Config) (Policy, []byte, bool, error) {
+	var p Policy
+	u, err := url.Parse(cfg.PolicyURL)
+	if err != nil || u.Scheme != "https" {
+		return p, nil, false, fmt.Errorf("Failed to fetch policy: policy_url must be an https URL: %q", cfg.PolicyURL)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cfg.PolicyURL, nil)
+	if err != nil {
+		return p, nil, false, fmt.Errorf("Failed to fetch policy: %w", err)
+	}
+	// policy_urlが変わった場合は、前のURLのETagを送らない
+	if s.url != cfg.PolicyURL {
+		s.url, s.etag = cfg.PolicyURL, ""
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return p, nil, false, fmt.Errorf("Failed to fetch policy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return p, nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return p, nil, false, fmt.Errorf("Failed to fetch policy: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPolicyResponseSize))
+	if err != nil {
+		return p, nil, false, fmt.Errorf("Failed to fetch policy: %w", err)
+	}
+
+	p, version, err := verifySignedPolicy(body, cfg.PolicyPublicKey, cfg.PolicyURL)
+	if err != nil {
+		return p, nil, false, err
+	}
+	// 署名が正しくても、期限切れのポリシーや保存したものより古いポリシー（古い応答の再送）は使用しない
+	if version.Serial == 0 || version.Expires.IsZero() {
+		return p, nil, false, fmt.Errorf("Failed to verify policy from %s: serial and expires are required", cfg.PolicyURL)
+	}
+	if !time.Now().Before(version.Expires) {
+		return p, nil, false, fmt.Errorf("Failed to verify policy from %s: expired at %s", cfg.PolicyURL, version.Expires.Format(time.RFC3339))
+	}
+	saved := savedRemotePolicySerial(cfg)
+	if version.Serial < saved {
+		return p, nil, false, fmt.Errorf("Failed to verify policy from %s: serial %d is older than %d", cfg.PolicyURL, version.Serial, saved)
+	}
+	// 署名を検証できたポリシーだけETagを記録（検証に失敗した場合は次回も取得し直す）
+	s.etag = resp.Header.Get("ETag")
+	if version.Serial == saved {
+		return p, nil, false, nil
+	}
+	return p, body, true, nil
+}
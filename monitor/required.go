@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 常に接続されているべきデバイス（ライセンスのドングル、レジのバーコードスキャナーなど）
+// 切断されてからtimeoutの間に接続し直されなければMissingイベントを出力し、接続し直されるまで同じ間隔で繰り返す
+type RequiredDevice struct {
+	// 規則の名前（アラートの理由に含める）
+	Name string `json:"name"`
+	// 対象のデバイスのフィンガープリント（VID:PID:シリアル番号、例: 096E:0006:ABC123）
+	Fingerprint string `json:"fingerprint"`
+	// 切断から最初のアラートまでの時間と、以降のアラートの間隔（例: "10m"）
+	Timeout Duration `json:"timeout"`
+}
+
+// 接続されていない必須のデバイスの状態
+type missingDevice struct {
+	// 切断された日時（起動時に接続されていなかった場合は起動した日時）
+	since time.Time
+	// 切断されたときのデバイスの情報
+	device DeviceInfo
+	// 出力したアラートの数（最初はwarning、2回目以降はcritical）
+	alerts int
+	timer  *time.Timer
+}
+
+// 必須のデバイスが切断されている時間を監視する
+type RequiredDeviceMonitor struct {
+	mu sync.Mutex
+	// フィンガープリントごとの接続されていない必須のデバイス
+	missing map[string]*missingDevice
+}
+
+var requiredDevices = &RequiredDeviceMonitor{missing: map[string]*missingDevice{}}
+
+// フィンガープリントに一致する規則を返す
+func findRequiredDevice(rules []RequiredDevice, fingerprint string) (RequiredDevice, bool) {
+	for _, rule := range rules {
+		if strings.EqualFold(rule.Fingerprint, fingerprint) {
+			return rule, true
+		}
+	}
+	return RequiredDevice{}, false
+}
+
+// 起動時に接続されていない必須のデバイスの監視を始める（snapshotはインスタンスID → 監視するデバイスの種類）
+func (m *RequiredDeviceMonitor) start(snapshot map[string]string) {
+	present := map[string]bool{}
+	for instanceID := range snapshot {
+		present[deviceFingerprint(instanceID)] = true
+	}
+	for _, rule := range currentConfig().RequiredDevices {
+		if !present[strings.ToUpper(rule.Fingerprint)] {
+			m.removed(DeviceInfo{}, strings.ToUpper(rule.Fingerprint))
+		}
+	}
+}
+
+// 必須のデバイスが切断されたら、アラートを出力するタイマーを始める
+func (m *RequiredDeviceMonitor) removed(deviceInfo DeviceInfo, fingerprint string) {
+	rule, ok := findRequiredDevice(currentConfig().RequiredDevices, fingerprint)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.missing[fingerprint]; ok {
+		return
+	}
+	state := &missingDevice{since: time.Now(), device: deviceInfo}
+	state.timer = time.AfterFunc(time.Duration(rule.Timeout), func() { m.alert(fingerprint, state) })
+	m.missing[fingerprint] = state
+}
+
+// 必須のデバイスが接続し直されたら監視をやめ、アラートを出力していた場合はRestoredイベントを出力
+func (m *RequiredDeviceMonitor) arrived(deviceInfo DeviceInfo, fingerprint string) {
+	m.mu.Lock()
+	state, ok := m.missing[fingerprint]
+	alerts := 0
+	if ok {
+		state.timer.Stop()
+		alerts = state.alerts
+		delete(m.missing, fingerprint)
+	}
+	m.mu.Unlock()
+	if alerts == 0 {
+		return
+	}
+	rule, _ := findRequiredDevice(currentConfig().RequiredDevices, fingerprint)
+	logDeviceEvent(DeviceEvent{
+		Action:      "Restored",
+		HostName:    getHostName(),
+		Severity:    severityNotice,
+		Fingerprint: fingerprint,
+		Explanation: fmt.Sprintf("%s: reconnected after %s", rule.Name, time.Since(state.since).Round(time.Second)),
+		Device:      deviceInfo,
+	})
+}
+
+// 接続し直されないまま時間が過ぎたらMissingイベントを出力し、次のアラートのタイマーを始める
+func (m *RequiredDeviceMonitor) alert(fingerprint string, state *missingDevice) {
+	rule, ok := findRequiredDevice(currentConfig().RequiredDevices, fingerprint)
+	m.mu.Lock()
+	if m.missing[fingerprint] != state {
+		// タイマーが止まる前に接続し直された
+		m.mu.Unlock()
+		return
+	}
+	if !ok || rule.Timeout <= 0 {
+		// 設定の再読み込みで規則が削除された
+		delete(m.missing, fingerprint)
+		m.mu.Unlock()
+		return
+	}
+	state.alerts++
+	severity := severityWarning
+	if state.alerts > 1 {
+		severity = severityCritical
+	}
+	missingFor := time.Since(state.since).Round(time.Second)
+	state.timer = time.AfterFunc(time.Duration(rule.Timeout), func() { m.alert(fingerprint, state) })
+	m.mu.Unlock()
+
+	logDeviceEvent(DeviceEvent{
+		Action:      "Missing",
+		HostName:    getHostName(),
+		Severity:    severity,
+		Fingerprint: fingerprint,
+		Explanation: fmt.Sprintf("%s: not connected for %s", rule.Name, missingFor),
+		Device:      state.device,
+	})
+}
+
+// 設定の必須のデバイスを確認
+func checkRequiredDevices(rules []RequiredDevice) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("required devices need unique names (%q)", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Fingerprint == "" {
+			return fmt.Errorf("required device %q: fingerprint is not set", rule.Name)
+		}
+		if rule.Timeout <= 0 {
+			return fmt.Errorf("required device %q: timeout must be positive", rule.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// 電源の状態の変化に関する定数
+const (
+	// 電源の状態が変化したときに送信されるメッセージ
+	WM_POWERBROADCAST = 0x0218
+	// スリープ・休止状態に入る直前を示すイベント
+	PBT_APMSUSPEND = 0x0004
+	// ユーザー操作によりスリープから復帰したことを示すイベント
+	PBT_APMRESUMESUSPEND = 0x0007
+	// スリープから自動的に復帰したことを示すイベント（常に送信される）
+	PBT_APMRESUMEAUTOMATIC = 0x0012
+	// 復帰後にデバイスの再列挙が落ち着くまで待つ時間
+	resumeSettleDelay = 5 * time.Second
+	// 復帰後の再同期用タイマーの識別子
+	resumeTimerID = 2
+	// 取りこぼした通知を補正するための再列挙の既定の間隔
+	defaultReconcileInterval = 5 * time.Minute
+	// 定期的な再列挙用タイマーの識別子
+	reconcileTimerID = 3
+	// すぐに再列挙して補正することを依頼するメッセージ（ウォッチドッグがメッセージループを作り直した直後に送る）
+	WM_APP_RECONCILE = 0x8000 + 4
+)
+
+// イベントの発生元
+const (
+	// WM_DEVICECHANGEの通知
+	sourceNotification = "notification"
+	// スリープからの復帰後の再同期
+	sourceResume = "resume"
+	// 定期的な再列挙による補正
+	sourceReconcile = "reconcile"
+	// 起動時に接続されていたデバイス
+	sourceStartup = "startup"
+)
+
+// メッセージループが所有する状態（接続中のデバイスの一覧・スリープ前のデバイス・通知の登録）のロック
+// ウォッチドッグがメッセージループを作り直すと、停止から戻った古いメッセージループが処理中の変化を反映しうるため、変更はこのロックで保護する
+// デバイスの列挙やイベントの出力など時間のかかる処理の間は保持しない
+var loopMu sync.Mutex
+
+// 監視中に接続されていると認識しているデバイス（インスタンスID → 監視するデバイスの種類）
+// メッセージループから参照する（loopMuで保護する）
+var trackedDevices = map[string]string{}
+
+// 接続中のデバイスの一覧を置き換える
+func setTrackedDevices(devices map[string]string) {
+	loopMu.Lock()
+	defer loopMu.Unlock()
+	trackedDevices = devices
+}
+
+// 接続中のデバイスの一覧の複製を返す
+func trackedSnapshot() map[string]string {
+	loopMu.Lock()
+	defer loopMu.Unlock()
+	return maps.Clone(trackedDevices)
+}
+
+// 接続・切断を接続中のデバイスの一覧に反映
+func trackDevice(instanceID string, watchClass string, arrival bool) {
+	loopMu.Lock()
+	defer loopMu.Unlock()
+	if arrival {
+		trackedDevices[instanceID] = watchClass
+	} else {
+		delete(trackedDevices, instanceID)
+	}
+}
+
+// 接続中のデバイスの一覧と実際に接続されているデバイスを比較し、取りこぼした接続・切断をイベントとして出力
+// 取りこぼしていた接続・切断の数を返す
+func reconcileDevices() int {
+	before := trackedSnapshot()
+	// 補正のための再列挙では、ドライバのキー名のキャッシュもすべて列挙し直す
+	deviceCache.rebuild()
+	return resyncDevices(before, snapshotDevices(watchClasses), sourceReconcile)
+}
+
+// 取りこぼした通知を補正し、取りこぼしていた場合は通知の登録が無効になっている可能性があるため登録し直す
+// 補正の間にウォッチドッグがメッセージループを作り直した場合は、古いウィンドウに登録し直さない
+func reconcileAndRecover(hWnd windows.HWND) {
+	if missed := reconcileDevices(); missed > 0 && watchdog.isActive(hWnd) {
+		watchdog.recoverNotifications(hWnd, missed)
+	}
+}
+
+// ウォッチドッグがメッセージループを作り直す前に、古いウィンドウに結び付いた状態を初期化
+// 復帰後の再同期のタイマーは古いウィンドウとともに失われるため、スリープ前のデバイスは破棄する
+func resetLoopState() {
+	loopMu.Lock()
+	defer loopMu.Unlock()
+	suspendSnapshot = nil
+}
+
+// スリープに入る直前に接続されていたデバイス（インスタンスID → 監視するデバイスの種類）
+// メッセージループから参照する（loopMuで保護する）
+var suspendSnapshot map[string]string
+
+// 監視しているデバイスの種類ごとに、現在接続されているデバイスを列挙
+func snapshotDevices(watchClasses []string) map[string]string {
+	devices := map[string]string{}
+	for _, watchClass := range watchClasses {
+		classGuid, err := parseWatchClass(watchClass)
+		if err != nil {
+			continue
+		}
+		paths, err := deviceAPI.interfacePaths(classGuid)
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			devices[interfacePathToInstanceID(path)] = watchClassName(classGuid)
+		}
+	}
+	return devices
+}
+
+// スリープ・復帰の通知を処理
+// スリープ中の接続・切断は通知されないため、復帰後に再列挙してスリープ前との差分をイベントとして出力
+func handlePowerBroadcast(hWnd windows.HWND, event uintptr) {
+	// 監視モード以外（ストレステストなど）では再同期しない
+	if len(watchClasses) == 0 {
+		return
+	}
+	switch event {
+	case PBT_APMSUSPEND:
+		snapshot := snapshotDevices(watchClasses)
+		loopMu.Lock()
+		suspendSnapshot = snapshot
+		loopMu.Unlock()
+	case PBT_APMRESUMEAUTOMATIC, PBT_APMRESUMESUSPEND:
+		loopMu.Lock()
+		suspended := suspendSnapshot != nil
+		loopMu.Unlock()
+		// 復帰直後はデバイスの再列挙が完了していないため、タイマーで少し待ってから再同期
+		if suspended {
+			setTimer(hWnd, resumeTimerID, resumeSettleDelay)
+		}
+	}
+}
+
+// スリープ前に接続されていたデバイスと現在のデバイスを比較して再同期
+func resyncAfterResume() {
+	loopMu.Lock()
+	before := suspendSnapshot
+	suspendSnapshot = nil
+	loopMu.Unlock()
+	if before == nil {
+		return
+	}
+	resyncDevices(before, snapshotDevices(watchClasses), sourceResume)
+}
+
+// 再同期で検出した接続・切断を処理する関数（テストでは差分の記録に差し替える）
+var resyncChangeHandler = processDeviceChange
+
+// 2つの時点で接続されていたデバイスを比較し、差分を接続・切断イベントとして出力
+// 差分の数を返す
+func resyncDevices(before map[string]string, after map[string]string, source string) int {
+	changes := 0
+	for instanceID, watchClass := range before {
+		if _, ok := after[instanceID]; !ok {
+			resyncChangeHandler(instanceID, watchClass, false, source)
+			changes++
+		}
+	}
+	for instanceID, watchClass := range after {
+		if _, ok := before[instanceID]; !ok {
+			resyncChangeHandler(instanceID, watchClass, true, source)
+			changes++
+		}
+	}
+	return changes
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// 再同期で検出された接続・切断
+type resyncChange struct {
+	instanceID string
+	watchClass string
+	arrival    bool
+}
+
+func TestResyncDevices(t *testing.T) {
+	const (
+		mouse    = `USB\VID_046D&PID_C077\5&2C0E7D7&0&1`
+		keyboard = `HID\VID_046D&PID_C31C&MI_00\7&1A2B3C4D&0&0000`
+		storage  = `USB\VID_0781&PID_5581\4C530001230412345678`
+	)
+	tests := []struct {
+		name string
+		// 再同期前に接続されていたデバイス
+		before []string
+		// 再同期までに接続されたデバイス
+		plug []string
+		// 再同期までに切断されたデバイス
+		unplug []string
+		want   []resyncChange
+	}{
+		{
+			name:   "no changes",
+			before: []string{mouse, keyboard},
+		},
+		{
+			name:   "arrival",
+			before: []string{mouse},
+			plug:   []string{storage},
+			want:   []resyncChange{{storage, "USB", true}},
+		},
+		{
+			name:   "removal",
+			before: []string{mouse, keyboard},
+			unplug: []string{keyboard},
+			want:   []resyncChange{{keyboard, "HID", false}},
+		},
+		{
+			name:   "swapped",
+			before: []string{mouse, keyboard},
+			plug:   []string{storage},
+			unplug: []string{mouse},
+			want:   []resyncChange{{mouse, "USB", false}, {storage, "USB", true}},
+		},
+		{
+			name:   "reconnected",
+			before: []string{storage},
+			plug:   []string{storage},
+			unplug: []string{storage},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := useFakeDeviceAPI(t)
+			var changes []resyncChange
+			saved := resyncChangeHandler
+			resyncChangeHandler = func(instanceID string, watchClass string, arrival bool, source string) {
+				if source != sourceReconcile {
+					t.Errorf("source = %q, want %q", source, sourceReconcile)
+				}
+				changes = append(changes, resyncChange{instanceID, watchClass, arrival})
+			}
+			t.Cleanup(func() { resyncChangeHandler = saved })
+
+			for _, instanceID := range test.before {
+				fake.plugInstance(instanceID)
+			}
+			before := snapshotDevices([]string{"USB", "HID"})
+			for _, instanceID := range test.unplug {
+				fake.unplug(instanceID)
+			}
+			for _, instanceID := range test.plug {
+				fake.plugInstance(instanceID)
+			}
+			after := snapshotDevices([]string{"USB", "HID"})
+
+			count := resyncDevices(before, after, sourceReconcile)
+			sort.Slice(changes, func(i, j int) bool { return changes[i].instanceID < changes[j].instanceID })
+			if count != len(test.want) {
+				t.Errorf("resyncDevices() = %d, want %d", count, len(test.want))
+			}
+			if !reflect.DeepEqual(changes, test.want) {
+				t.Errorf("changes = %v, want %v", changes, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 保持期間を過ぎたレコードを削除する間隔
+const retentionInterval = time.Hour
+
+// 保持期間（retention_max_age）より古いレコードと、サイズの上限（retention_max_size_mb）を超えた古いレコードを削除
+// 削除した最後のレコードを .base に記録するため、残ったレコードのチェーンは引き続き検証できる
+func (l *AuditLog) prune(cfg Config) (int, error) {
+	if l == nil {
+		return 0, fmt.Errorf("Failed to prune: audit_log is not set")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, err := readAuditLog(l.path)
+	if err != nil {
+		return 0, err
+	}
+	sizes := make([]int64, len(records))
+	var total int64
+	for i, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, err
+		}
+		sizes[i] = int64(len(line) + 1)
+		total += sizes[i]
+	}
+
+	start := 0
+	if maxAge := time.Duration(cfg.RetentionMaxAge); maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		for start < len(records) && records[start].Time.Before(cutoff) {
+			total -= sizes[start]
+			start++
+		}
+	}
+	if maxSize := int64(cfg.RetentionMaxSizeMB) << 20; maxSize > 0 {
+		for start < len(records) && total > maxSize {
+			total -= sizes[start]
+			start++
+		}
+	}
+	if start == 0 {
+		return 0, nil
+	}
+	if err := l.dropLocked(records, start); err != nil {
+		return 0, fmt.Errorf("Failed to prune audit log: %w", err)
+	}
+	return start, nil
+}
+
+// 先頭からstart件を除いたレコードで監査ログを書き直し、除いた最後のレコードを .base に記録
+func (l *AuditLog) dropLocked(records []AuditRecord, start int) error {
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, record := range records[start:] {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// 開いたままのファイルは置き換えられないため、閉じてから置き換えて開き直す
+	l.file.Close()
+	renameErr := os.Rename(tmp, l.path)
+	if l.file, err = os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return fmt.Errorf("Failed to reopen audit log: %w", err)
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	last := records[start-1]
+	return writeAuditMark(l.path+auditBaseSuffix, last.Seq, last.Hash)
+}
+
+// 古いレコードをアーカイブに移してから、保持期間を過ぎたレコードとアーカイブを削除
+// アーカイブしたレコードの数と、削除したレコードの数を返す
+func (l *AuditLog) compact(cfg Config) (int, int, error) {
+	archived, err := l.archive(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	pruned, err := l.prune(cfg)
+	if err != nil {
+		return archived, 0, err
+	}
+	if _, err := pruneAuditArchives(l.path, cfg); err != nil {
+		return archived, pruned, err
+	}
+	return archived, pruned, nil
+}
+
+// 定期的に古いレコードをアーカイブし、保持期間を過ぎたレコードを削除（設定の再読み込みで保持期間が変わった場合は次回から反映）
+func (l *AuditLog) runRetention(ctx context.Context) {
+	for {
+		archived, pruned, err := l.compact(currentConfig())
+		if err != nil {
+			fmt.Println(err)
+		}
+		if archived > 0 {
+			fmt.Printf(tr("Audit log archived: Records=%d\n"), archived)
+		}
+		if pruned > 0 {
+			fmt.Printf(tr("Audit log pruned: Records=%d\n"), pruned)
+		}
+		if !sleepContext(ctx, retentionInterval) {
+			return
+		}
+	}
+}
+
+// 実行中の監視の監査ログから、古いレコードをアーカイブし、保持期間を過ぎたレコードを削除する制御コマンド
+func requestPrune() error {
+	_, _, err := auditLog.compact(currentConfig())
+	return err
+}
+
+// `usbmon prune` サブコマンド
+// 監視が実行中の場合は監視に削除させ、実行中でない場合は直接削除
+func runPrune(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find audit_log and retention settings)")
+	fs.Parse(args)
+
+	if response, err := sendControlCommand("prune"); err == nil {
+		fmt.Println(response)
+		if response != "OK" {
+			return 1
+		}
+		return 0
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if cfg.AuditLog == "" {
+		fmt.Println("audit_log is not set in the config")
+		return 2
+	}
+	l, err := openAuditLog(cfg.AuditLog, cfg.AuditEncryption)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	archived, pruned, err := l.compact(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if archived > 0 {
+		fmt.Printf(tr("Audit log archived: Records=%d\n"), archived)
+	}
+	fmt.Printf(tr("Audit log pruned: Records=%d\n"), pruned)
+	return 0
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogPrune(t *testing.T) {
+	now := time.Now()
+	chain := testAuditRecords(
+		now.AddDate(0, 0, -40), now.AddDate(0, 0, -35),
+		now.AddDate(0, 0, -10),
+		now.Add(-time.Hour), now.Add(-time.Minute),
+	)
+	// 1件で約600KBのレコード（サイズの上限の確認用）
+	large := testAuditRecords(now.Add(-3*time.Minute), now.Add(-2*time.Minute), now.Add(-time.Minute))
+	for i := range large {
+		large[i].Event = json.RawMessage(`"` + strings.Repeat("x", 600<<10) + `"`)
+		if i > 0 {
+			large[i].PrevHash = large[i-1].Hash
+		}
+		large[i].Hash = large[i].computeHash()
+	}
+	tests := []struct {
+		name    string
+		records []AuditRecord
+		cfg     Config
+		want    int
+	}{
+		{name: "no limits", records: chain, want: 0},
+		{name: "max age", records: chain, cfg: Config{RetentionMaxAge: Duration(30 * 24 * time.Hour)}, want: 2},
+		{name: "max age all", records: chain, cfg: Config{RetentionMaxAge: Duration(time.Second)}, want: 5},
+		{name: "max age none", records: chain, cfg: Config{RetentionMaxAge: Duration(365 * 24 * time.Hour)}, want: 0},
+		{name: "max size", records: large, cfg: Config{RetentionMaxSizeMB: 1}, want: 2},
+		{name: "max size within", records: large, cfg: Config{RetentionMaxSizeMB: 2}, want: 0},
+		{name: "max age and size", records: large, cfg: Config{RetentionMaxAge: Duration(150 * time.Second), RetentionMaxSizeMB: 2}, want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, test.records, nil, test.records[len(test.records)-1])
+			l := openTestAuditLog(t, path)
+
+			n, err := l.prune(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != test.want {
+				t.Errorf("prune() = %d, want %d", n, test.want)
+			}
+			// 削除した最後のレコードを .base に記録するため、残ったレコードのチェーンを検証できる
+			if remaining, err := verifyAuditLog(path); err != nil || remaining != len(test.records)-test.want {
+				t.Errorf("verifyAuditLog() = %d, %v, want %d", remaining, err, len(test.records)-test.want)
+			}
+			// 削除した後も、監査ログにはチェーンを続けて追記できる
+			l.append(DeviceEvent{Action: "Arrival"})
+			if _, err := verifyAuditLog(path); err != nil {
+				t.Errorf("verifyAuditLog() after append error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuditLogPruneNil(t *testing.T) {
+	var l *AuditLog
+	if _, err := l.prune(Config{}); err == nil {
+		t.Error("prune() on nil audit log succeeded")
+	}
+}
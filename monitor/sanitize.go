@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// デバイスから読み取った文字列（製品名・シリアル番号など）を出力できる形に正規化
+// 不正なUTF-8はU+FFFDに置き換え、制御文字（改行など）と表示の向きを変える文字は \u000A のようにエスケープする
+// 行単位のログ（コンソール・ファイル・syslog）に偽の行を挿入されないようにするため
+func sanitizeString(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if strings.IndexFunc(s, isUnsafeRune) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if isUnsafeRune(r) {
+			fmt.Fprintf(&b, `\u%04X`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ログに出力するとそのまま表示できない文字かどうか
+func isUnsafeRune(r rune) bool {
+	switch {
+	case unicode.IsControl(r):
+		return true
+	// 行区切り・段落区切り
+	case r == '\u2028', r == '\u2029':
+		return true
+	// 双方向テキストの制御文字（表示上の文字の順序を入れ替えられる）
+	case r == '\u200E', r == '\u200F', r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069':
+		return true
+	}
+	return false
+}
+
+// 文字列の一覧を正規化した新しい一覧を返す（キャッシュしたデバイスの情報を書き換えないようにコピーする）
+func sanitizeStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	sanitized := make([]string, len(values))
+	for i, value := range values {
+		sanitized[i] = sanitizeString(value)
+	}
+	return sanitized
+}
+
+// デバイスから読み取った文字列を正規化
+func sanitizeDeviceInfo(info DeviceInfo) DeviceInfo {
+	info.InstanceID = sanitizeString(info.InstanceID)
+	info.FriendlyName = sanitizeString(info.FriendlyName)
+	info.Manufacturer = sanitizeString(info.Manufacturer)
+	info.SerialNumber = sanitizeString(info.SerialNumber)
+	info.HardwareIDs = sanitizeStrings(info.HardwareIDs)
+	info.CompatibleIDs = sanitizeStrings(info.CompatibleIDs)
+	info.LocationInfo = sanitizeString(info.LocationInfo)
+	info.Driver.Provider = sanitizeString(info.Driver.Provider)
+	info.Driver.Version = sanitizeString(info.Driver.Version)
+	info.Driver.Date = sanitizeString(info.Driver.Date)
+	if info.Interfaces != nil {
+		interfaces := make([]DeviceInterface, len(info.Interfaces))
+		for i, iface := range info.Interfaces {
+			iface.InstanceID = sanitizeString(iface.InstanceID)
+			iface.Description = sanitizeString(iface.Description)
+			iface.Functions = sanitizeStrings(iface.Functions)
+			interfaces[i] = iface
+		}
+		info.Interfaces = interfaces
+	}
+	return info
+}
+
+// イベントに含まれる、デバイスやUSBストレージ上のファイルから読み取った文字列を正規化
+// 署名・監査ログ・すべての出力先で同じ値になるよう、署名の前に行う
+func sanitizeEvent(event DeviceEvent) DeviceEvent {
+	event.Device = sanitizeDeviceInfo(event.Device)
+	event.Fingerprint = sanitizeString(event.Fingerprint)
+	event.Explanation = sanitizeString(event.Explanation)
+	if event.Fields != nil {
+		fields := make(map[string]string, len(event.Fields))
+		for name, value := range event.Fields {
+			fields[sanitizeString(name)] = sanitizeString(value)
+		}
+		event.Fields = fields
+	}
+	if event.FileAccess != nil {
+		access := *event.FileAccess
+		access.Path = sanitizeString(access.Path)
+		access.Process = sanitizeString(access.Process)
+		event.FileAccess = &access
+	}
+	if event.FileTransfer != nil {
+		transfer := *event.FileTransfer
+		transfer.Path = sanitizeString(transfer.Path)
+		event.FileTransfer = &transfer
+	}
+	return event
+}
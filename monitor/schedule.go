@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 曜日の名前
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// 曜日・時間帯によって変える重大度（例: 平日22時以降のディスクドライブはcritical）
+// 時刻はエージェントのローカルタイムゾーンで判定する
+type ScheduledSeverity struct {
+	// 対象のデバイスの種類（例: Camera、空の場合はすべて）
+	DeviceType string `json:"device_type"`
+	// 対象の通知を受け取ったデバイスの種類（例: DiskDrive、空の場合はすべて）
+	WatchClass string `json:"watch_class"`
+	// 曜日（例: "Mon-Fri"、"Sat,Sun"、空の場合は毎日）
+	Days string `json:"days"`
+	// 時間帯（例: "22:00-06:00"、日をまたいでもよい、空の場合は終日）
+	Hours string `json:"hours"`
+	// 時間帯の重大度（info / notice / warning / critical）
+	Severity string `json:"severity"`
+}
+
+// 曜日の指定（例: Mon-Fri、Sat,Sun）を読み取る
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	if spec == "" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		firstText, lastText, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, ok := weekdayNames[firstText]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", part)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[lastText]; !ok {
+				return days, fmt.Errorf("invalid day %q", part)
+			}
+		}
+		// Fri-Monのように週をまたいでもよい
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// 時間帯の指定（例: 22:00-06:00）を、0時からの分で読み取る
+func parseHours(spec string) (int, int, error) {
+	if spec == "" {
+		return 0, 24 * 60, nil
+	}
+	fromText, toText, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid hours %q", spec)
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hours %q", spec)
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(toText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hours %q", spec)
+	}
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), nil
+}
+
+// イベントと時刻が規則に一致するかを判定
+func (s ScheduledSeverity) matches(event DeviceEvent, t time.Time) bool {
+	if s.DeviceType != "" && !strings.EqualFold(s.DeviceType, event.DeviceType) {
+		return false
+	}
+	if s.WatchClass != "" && !strings.EqualFold(s.WatchClass, event.WatchClass) {
+		return false
+	}
+	days, err := parseDays(s.Days)
+	if err != nil || !days[t.Weekday()] {
+		return false
+	}
+	from, to, err := parseHours(s.Hours)
+	if err != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	// 日をまたぐ時間帯
+	return minute >= from || minute < to
+}
+
+// 最初に一致した規則の重大度を返す
+func scheduledSeverity(rules []ScheduledSeverity, event DeviceEvent, t time.Time) (string, bool) {
+	for _, rule := range rules {
+		if rule.matches(event, t) {
+			return rule.Severity, true
+		}
+	}
+	return "", false
+}
+
+// 設定の曜日・時間帯の書式を確認
+func checkScheduledSeverities(rules []ScheduledSeverity) error {
+	for _, rule := range rules {
+		if _, err := parseDays(rule.Days); err != nil {
+			return err
+		}
+		if _, _, err := parseHours(rule.Hours); err != nil {
+			return err
+		}
+		switch rule.Severity {
+		case severityInfo, severityNotice, severityWarning, severityCritical:
+		default:
+			return fmt.Errorf("invalid severity %q", rule.Severity)
+		}
+	}
+	return nil
+}
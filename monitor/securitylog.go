@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// イベントログを購読するAPI群を提供するwevtapi.dllから関数をロード
+var (
+	wevtapi = syscall.NewLazyDLL("wevtapi.dll")
+	// イベントログの新しいイベントを購読
+	procEvtSubscribe = wevtapi.NewProc("EvtSubscribe")
+	// 購読したイベントを取得
+	procEvtNext = wevtapi.NewProc("EvtNext")
+	// イベントをXMLに変換
+	procEvtRender = wevtapi.NewProc("EvtRender")
+	// イベントログのハンドルを閉じる
+	procEvtClose = wevtapi.NewProc("EvtClose")
+)
+
+// イベントログのAPIで使用される定数
+const (
+	// これから記録されるイベントだけを購読するフラグ
+	EvtSubscribeToFutureEvents = 1
+	// イベントをXMLとして取得するフラグ
+	EvtRenderEventXml = 1
+	// 一度に取得するイベントの数
+	securityLogBatchSize = 16
+	// オブジェクトへのアクセスを試行したことを示すイベントID（リムーバブル記憶域の監査で記録される）
+	securityLogObjectAccess = 4663
+)
+
+// 4663のアクセスマスクの意味（ファイルの場合）
+var fileAccessNames = []struct {
+	mask uint32
+	name string
+}{
+	{0x1, "ReadData"},
+	{0x2, "WriteData"},
+	{0x4, "AppendData"},
+	{0x20, "Execute"},
+	{0x10000, "Delete"},
+}
+
+// USBストレージ上のファイルへのアクセス（セキュリティログの4663から取得）
+type FileAccess struct {
+	// アクセスしたユーザー（例: CONTOSO\tanaka）
+	User string
+	// アクセスしたファイル（例: E:\report.xlsx）
+	Path string
+	// アクセスの種類（例: ReadData, WriteData）
+	Access string
+	// アクセスしたプロセス
+	Process string `json:",omitempty"`
+}
+
+// EvtRenderで取得したイベントのXML
+type securityLogEvent struct {
+	EventID int `xml:"System>EventID"`
+	Data    []struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"EventData>Data"`
+}
+
+// セキュリティログの4663を購読し、USBストレージ上のファイルへのアクセスをFileAccessイベントとして出力
+// 「リムーバブル記憶域の監査」を有効にし、管理者として実行している必要がある
+func watchSecurityLog(ctx context.Context) {
+	signal, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		fmt.Printf("Failed to subscribe to the Security log: %v\n", err)
+		return
+	}
+	defer windows.CloseHandle(signal)
+	channel, _ := windows.UTF16PtrFromString("Security")
+	query, _ := windows.UTF16PtrFromString(fmt.Sprintf("*[System[(EventID=%d)]]", securityLogObjectAccess))
+	subscription, err := callWin32(procEvtSubscribe, 0, uintptr(signal), uintptr(unsafe.Pointer(channel)), uintptr(unsafe.Pointer(query)), 0, 0, 0, EvtSubscribeToFutureEvents)
+	if err != nil {
+		fmt.Printf("Failed to subscribe to the Security log: %v\n", err)
+		return
+	}
+	defer procEvtClose.Call(subscription)
+
+	handles := make([]uintptr, securityLogBatchSize)
+	for {
+		ok, err := waitContext(ctx, signal)
+		if err != nil {
+			fmt.Printf("Failed to read the Security log: %v\n", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		for {
+			var returned uint32
+			_, err := callWin32(procEvtNext, subscription, uintptr(len(handles)), uintptr(unsafe.Pointer(&handles[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if errors.Is(lastError(err), windows.ERROR_NO_MORE_ITEMS) {
+				break
+			}
+			if err != nil {
+				fmt.Printf("Failed to read the Security log: %v\n", err)
+				break
+			}
+			for _, handle := range handles[:returned] {
+				if access, session, ok := parseObjectAccess(handle); ok {
+					logFileAccess(access, session)
+				}
+				procEvtClose.Call(handle)
+			}
+		}
+	}
+}
+
+// イベントをXMLに変換して、USBストレージ上のファイルへのアクセスであれば読み取る
+func parseObjectAccess(handle uintptr) (FileAccess, VolumeSession, bool) {
+	var used, properties uint32
+	buffer := make([]uint16, 4096)
+	for {
+		_, err := callWin32(procEvtRender, 0, handle, EvtRenderEventXml, uintptr(len(buffer)*2), uintptr(unsafe.Pointer(&buffer[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&properties)))
+		if errors.Is(lastError(err), windows.ERROR_INSUFFICIENT_BUFFER) {
+			buffer = make([]uint16, used/2+1)
+			continue
+		}
+		if err != nil {
+			return FileAccess{}, VolumeSession{}, false
+		}
+		break
+	}
+	var event securityLogEvent
+	if err := xml.Unmarshal([]byte(windows.UTF16ToString(buffer)), &event); err != nil {
+		return FileAccess{}, VolumeSession{}, false
+	}
+	data := map[string]string{}
+	for _, d := range event.Data {
+		data[d.Name] = d.Value
+	}
+	session, ok := volumeSessions.find(data["ObjectName"])
+	if !ok {
+		return FileAccess{}, VolumeSession{}, false
+	}
+	mask, _ := strconv.ParseUint(strings.TrimPrefix(data["AccessMask"], "0x"), 16, 32)
+	var names []string
+	for _, access := range fileAccessNames {
+		if uint32(mask)&access.mask != 0 {
+			names = append(names, access.name)
+		}
+	}
+	return FileAccess{
+		User:    data["SubjectDomainName"] + `\` + data["SubjectUserName"],
+		Path:    session.displayPath(data["ObjectName"]),
+		Access:  strings.Join(names, ", "),
+		Process: data["ProcessName"],
+	}, session, true
+}
+
+// ファイルへのアクセスを、接続したデバイスのFileAccessイベントとして出力
+func logFileAccess(access FileAccess, session VolumeSession) {
+	event := DeviceEvent{
+		Action:      "FileAccess",
+		HostName:    getHostName(),
+		WatchClass:  "DiskDrive",
+		Severity:    severityInfo,
+		Device:      DeviceInfo{InstanceID: session.InstanceID},
+		Fingerprint: session.Fingerprint,
+		Volume:      session.Volume,
+		FileAccess:  &access,
+	}
+	logDeviceEvent(event)
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// デバイスごとのパラメータが格納されているレジストリキー（インスタンスIDを連結して使用）
+	enumKeyPath = `SYSTEM\CurrentControlSet\Enum\`
+	// シリアルポートのセットアップクラス名
+	portsClass = "Ports"
+	// COMポートが割り当てられるまで待つ時間
+	comPortTimeout = 3 * time.Second
+)
+
+// USBシリアル変換アダプター（FTDI / CH340 / CP210x / PL2303 / CDC-ACM）のドライバのサービス名
+var serialServices = map[string]bool{
+	"FTDIBUS":      true,
+	"CH341SER":     true,
+	"CH341SER_A64": true,
+	"silabser":     true,
+	"Ser2pl":       true,
+	"Ser2pl64":     true,
+	"usbser":       true,
+}
+
+// デバイスと配下のdevnodeに割り当てられたCOMポート（例: COM3）を設定
+// USBシリアル変換アダプターはCOMポートのdevnodeが遅れて作成されるため、割り当てられるまで待つ
+func setCOMPorts(deviceInfo *DeviceInfo) {
+	deadline := time.Now().Add(comPortTimeout)
+	for {
+		deviceInfo.COMPorts = getCOMPorts(deviceInfo.InstanceID)
+		if len(deviceInfo.COMPorts) > 0 || !serialServices[deviceInfo.Service] || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// インスタンスIDのdevnodeと、その配下にあるシリアルポートのCOMポート名を取得
+func getCOMPorts(instanceID string) []string {
+	devInst, err := locateDevNode(instanceID)
+	if err != nil {
+		return nil
+	}
+	var ports []string
+	var walk func(uint32)
+	walk = func(node uint32) {
+		if getDevNodeProperty(node, CM_DRP_CLASS) == portsClass {
+			if port := getPortName(getDevNodeID(node)); port != "" {
+				ports = append(ports, port)
+			}
+		}
+		for _, child := range getChildDevNodes(node) {
+			walk(child)
+		}
+	}
+	walk(devInst)
+	return ports
+}
+
+// シリアルポートのデバイスパラメータからCOMポート名を取得
+func getPortName(instanceID string) string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, enumKeyPath+instanceID+`\Device Parameters`, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	port, _, _ := key.GetStringValue("PortName")
+	return port
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// マウントされているUSBストレージのボリュームと、接続したデバイスの対応
+type VolumeSession struct {
+	// ドライブ文字（例: E:）
+	Volume string
+	// ボリュームのデバイス名（例: \Device\HarddiskVolume5）
+	DevicePath string
+	// 接続したデバイス
+	Fingerprint string
+	InstanceID  string
+	// 接続した日時
+	Started time.Time
+}
+
+// マウントされているUSBストレージのボリューム
+type VolumeSessions struct {
+	mu       sync.Mutex
+	sessions map[string]VolumeSession
+}
+
+var volumeSessions = &VolumeSessions{sessions: map[string]VolumeSession{}}
+
+// 接続イベントのボリュームを記録
+func (s *VolumeSessions) start(event DeviceEvent) VolumeSession {
+	session := VolumeSession{
+		Volume:      event.Volume,
+		DevicePath:  volumeDevicePath(event.Volume),
+		Fingerprint: event.Fingerprint,
+		InstanceID:  event.Device.InstanceID,
+		Started:     time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[strings.ToUpper(event.Volume)] = session
+	return session
+}
+
+// 切断されたデバイスのボリュームの記録を削除し、削除したボリュームを返す
+func (s *VolumeSessions) end(instanceID string) []VolumeSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ended []VolumeSession
+	for volume, session := range s.sessions {
+		if strings.EqualFold(session.InstanceID, instanceID) {
+			ended = append(ended, session)
+			delete(s.sessions, volume)
+		}
+	}
+	return ended
+}
+
+// パス（E:\... または \Device\HarddiskVolume5\...）を含むボリュームを探す
+func (s *VolumeSessions) find(path string) (VolumeSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		for _, prefix := range []string{session.Volume, session.DevicePath} {
+			if prefix != "" && len(path) > len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) && path[len(prefix)] == '\\' {
+				return session, true
+			}
+		}
+	}
+	return VolumeSession{}, false
+}
+
+// ドライブ文字のボリュームのデバイス名（例: \Device\HarddiskVolume5）を取得
+func volumeDevicePath(volume string) string {
+	name, err := windows.UTF16PtrFromString(volume)
+	if err != nil {
+		return ""
+	}
+	var buffer [windows.MAX_PATH]uint16
+	if _, err := windows.QueryDosDevice(name, &buffer[0], uint32(len(buffer))); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(buffer[:])
+}
+
+// ボリューム上のデバイス名のパスを、ドライブ文字のパスに変換（例: \Device\HarddiskVolume5\a.txt → E:\a.txt）
+func (session VolumeSession) displayPath(path string) string {
+	if session.DevicePath != "" && len(path) >= len(session.DevicePath) && strings.EqualFold(path[:len(session.DevicePath)], session.DevicePath) {
+		return session.Volume + path[len(session.DevicePath):]
+	}
+	return path
+}
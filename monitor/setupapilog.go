@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// セクションの開始時刻の書式（ローカル時刻）
+	setupAPITimeFormat = "2006/01/02 15:04:05.000"
+	// 証拠の取得元
+	forensicSourceSetupAPI = "setupapi.dev.log"
+)
+
+var (
+	// デバイスのインストールのセクションの見出し（例: >>>  [Device Install (Hardware initiated) - USBSTOR\Disk&Ven_...\...&0]）
+	setupAPIInstallPattern = regexp.MustCompile(`^>>>\s+\[Device Install .*? - ((?:USB|USBSTOR)\\[^\]]+)\]`)
+	// セクションの開始時刻（例: >>>  Section start 2023/05/12 10:23:45.123）
+	setupAPIStartPattern = regexp.MustCompile(`^>>>\s+Section start (\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\.\d{3})`)
+)
+
+// setupapi.dev.log（ローテーションされた setupapi.dev.YYYYMMDD_hhmmss.log も含む）のパスの既定値
+func defaultSetupAPILogPaths() []string {
+	paths, _ := filepath.Glob(filepath.Join(os.Getenv("SystemRoot"), "INF", "setupapi.dev*.log"))
+	return paths
+}
+
+// setupapi.dev.logから、USBデバイスがインストールされた日時を読み取る
+func importSetupAPIEvidence(paths []string) ([]ForensicDevice, error) {
+	devices := map[string]*ForensicDevice{}
+	var order []string
+	for _, path := range paths {
+		if err := parseSetupAPILog(path, func(instanceID string, installedAt time.Time) {
+			device, ok := devices[instanceID]
+			if !ok {
+				parsed := parseForensicInstanceID(instanceID)
+				parsed.Sources = []string{forensicSourceSetupAPI}
+				device = &parsed
+				devices[instanceID] = device
+				order = append(order, instanceID)
+			}
+			if !slices.ContainsFunc(device.InstallTimes, installedAt.Equal) {
+				device.InstallTimes = append(device.InstallTimes, installedAt)
+			}
+			device.History.FirstInstalled = earlierTime(device.History.FirstInstalled, &installedAt)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	var result []ForensicDevice
+	for _, instanceID := range order {
+		result = append(result, *devices[instanceID])
+	}
+	return result, nil
+}
+
+// setupapi.dev.logを読み、デバイスのインストールのセクションごとにインスタンスIDと開始時刻を渡す
+func parseSetupAPILog(path string, found func(instanceID string, installedAt time.Time)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	// 見出しの次の行がセクションの開始時刻
+	pending := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := setupAPIInstallPattern.FindStringSubmatch(line); match != nil {
+			pending = strings.ToUpper(match[1])
+			continue
+		}
+		if pending == "" {
+			continue
+		}
+		if match := setupAPIStartPattern.FindStringSubmatch(line); match != nil {
+			if t, err := time.ParseInLocation(setupAPITimeFormat, match[1], time.Local); err == nil {
+				found(pending, t)
+			}
+		}
+		pending = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// インスタンスIDから、分かる範囲でデバイスの証拠を作成
+func parseForensicInstanceID(instanceID string) ForensicDevice {
+	if strings.HasPrefix(instanceID, `USBSTOR\`) {
+		return parseUSBSTORInstanceID(instanceID)
+	}
+	return ForensicDevice{InstanceID: instanceID, Serial: deviceSerial(instanceID)}
+}
@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// イベントに署名するEd25519鍵
+type EventSigner struct {
+	key ed25519.PrivateKey
+	// 公開鍵から求めた鍵ID（収集側で検証に使う公開鍵を選ぶため）
+	keyID string
+}
+
+// 設定でsigning_keyを指定した場合の署名鍵（指定しない場合はnil）
+var eventSigner *EventSigner
+
+// 公開鍵の鍵ID（SHA-256の先頭8バイトの16進数）
+func signingKeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// 鍵ファイル（Ed25519のシード32バイトをBase64で記録したもの）から署名鍵を読み込む
+func loadEventSigner(path string) (*EventSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read signing key: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Failed to read signing key %s: not a base64 Ed25519 seed", path)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	return &EventSigner{key: key, keyID: signingKeyID(key.Public().(ed25519.PublicKey))}, nil
+}
+
+// イベントの署名の対象（Signatureを空にしたイベントのJSON）
+func signedEventPayload(event DeviceEvent) ([]byte, error) {
+	event.Signature = ""
+	return json.Marshal(event)
+}
+
+// イベントに鍵IDと署名を設定
+func (s *EventSigner) sign(event DeviceEvent) DeviceEvent {
+	if s == nil {
+		return event
+	}
+	event.KeyID = s.keyID
+	payload, err := signedEventPayload(event)
+	if err != nil {
+		fmt.Println(err)
+		return event
+	}
+	event.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+	return event
+}
+
+// イベントの署名を公開鍵で検証
+func verifyEventSignature(event DeviceEvent, publicKey ed25519.PublicKey) error {
+	if event.Signature == "" {
+		return errors.New("event is not signed")
+	}
+	if event.KeyID != signingKeyID(publicKey) {
+		return fmt.Errorf("event is signed with key %s", event.KeyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(event.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	payload, err := signedEventPayload(event)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return errors.New("signature does not match (event forged or altered)")
+	}
+	return nil
+}
+
+// Base64の公開鍵を読み取る
+func parsePublicKey(text string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key %q", text)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// `usbmon keygen` サブコマンド
+// イベントの署名に使う鍵を生成して鍵ファイルに保存し、収集側に登録する公開鍵と鍵IDを出力
+func runKeygen(args []string) int {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "", "path to write the private key to (base64 Ed25519 seed)")
+	fs.Parse(args)
+	if *out == "" {
+		fmt.Println("specify -out")
+		return 2
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	seed := base64.StdEncoding.EncodeToString(privateKey.Seed())
+	// 既存の鍵を上書きすると、収集側で以前のイベントを検証できなくなるため作成のみ
+	file, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Printf("Failed to write signing key: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, seed); err != nil {
+		fmt.Printf("Failed to write signing key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Public Key=%s, Key ID=%s\n", base64.StdEncoding.EncodeToString(publicKey), signingKeyID(publicKey))
+	return 0
+}
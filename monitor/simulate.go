@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// シミュレーションで注入したイベントの発生元
+const sourceSimulate = "simulate"
+
+// `usbmon simulate` サブコマンド
+// フィクスチャ（DeviceEventのJSON配列）のイベントを、実機なしで分類・除外・フラッピング検出などの処理に流す
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fixturePath := fs.String("fixture", "", "path to a JSON array (or JSON Lines) of device events to inject")
+	fs.StringVar(&configPath, "config", "", "path to a JSON config file")
+	interval := fs.Duration("interval", 0, "time to wait between injected events")
+	fs.StringVar(&outputLang, "lang", systemLang(), "output language (ja or en)")
+	fs.BoolVar(&tableOutput, "table", false, "print events as aligned table rows")
+	noColor := fs.Bool("no-color", false, "do not color events by action")
+	fs.Parse(args)
+	if err := checkLang(outputLang); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	colorOutput = !*noColor && enableColor()
+
+	if *fixturePath == "" {
+		fmt.Println("usage: usbmon simulate -fixture events.json [-config usbmon.json] [-interval 0]")
+		return 2
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	setConfig(cfg)
+	sinks, err := buildSinks(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	setSinks(sinks)
+	watchClasses, _ = notificationClasses(cfg)
+
+	events, err := loadFixture(*fixturePath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for i, event := range events {
+		if i > 0 && *interval > 0 {
+			time.Sleep(*interval)
+		}
+		injectEvent(event)
+	}
+	// フラッピング中のデバイスが残っていれば、終了を通知
+	flapDetector.flush(time.Now().Add(flapWindow + time.Second))
+	return 0
+}
+
+// フィクスチャのイベントを読み込む
+// JSON配列と、-recordで記録した1行に1件のJSON（JSON Lines）のどちらにも対応
+func loadFixture(path string) ([]DeviceEvent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fixture: %w", err)
+	}
+	var events []DeviceEvent
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("Failed to parse fixture %s: %w", path, err)
+		}
+		return events, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var event DeviceEvent
+		if err := decoder.Decode(&event); err != nil {
+			return nil, fmt.Errorf("Failed to parse fixture %s: %w", path, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// 列挙済みのイベントを、通知を受け取った場合と同じ処理に流す
+func injectEvent(event DeviceEvent) {
+	if event.HostName == "" {
+		event.HostName = getHostName()
+	}
+	if event.WatchClass == "" {
+		event.WatchClass = defaultWatchClass
+	}
+	if event.Source == "" {
+		event.Source = sourceSimulate
+	}
+	instanceID := event.Device.InstanceID
+
+	switch event.Action {
+	case "Connected":
+		trackDevice(instanceID, event.WatchClass, true)
+		settle := func() { emitArrival(&event) }
+		if flapDetector.record(instanceID, true, time.Now(), event.HostName, settle) {
+			return
+		}
+		settle()
+	case "Disconnected":
+		trackDevice(instanceID, event.WatchClass, false)
+		settle := func() {
+			pendingDrivers.remove(instanceID)
+			emitRemoval(event)
+		}
+		if flapDetector.record(instanceID, false, time.Now(), event.HostName, settle) {
+			return
+		}
+		settle()
+	default:
+		// 問題の発生・ドライバのインストール完了などの追加のイベントはそのまま出力
+		logDeviceEvent(event)
+	}
+}
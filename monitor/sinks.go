@@ -0,0 +1,298 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// イベントの出力先の種類
+	sinkTypeConsole = "console"
+	sinkTypeFile    = "file"
+	sinkTypeWebhook = "webhook"
+	// 組み込みのコンソールの出力先の名前
+	consoleSinkName = "console"
+	// Webhookの送信のタイムアウト
+	webhookTimeout = 10 * time.Second
+)
+
+// イベントの出力先の設定
+type SinkConfig struct {
+	// console / file / webhook
+	Type string `json:"type"`
+	// fileの場合の出力先のパス（1行に1件のJSON）
+	Path string `json:"path"`
+	// webhookの場合の送信先のURL（イベントのJSONをPOST）
+	URL string `json:"url"`
+	// webhookの場合のプロキシのURL（例: http://proxy.example.com:8080、空の場合は環境変数のプロキシ）
+	Proxy string `json:"proxy,omitempty"`
+	// webhookの場合のTLSの設定（CA証明書・クライアント証明書・最低バージョン）
+	TLS *SinkTLSConfig `json:"tls,omitempty"`
+	// fileとwebhookの場合の送信の制限（指定しない場合は制限しない）
+	RateLimit *SinkRateLimit `json:"rate_limit,omitempty"`
+	// consoleとfileの場合の1件ごとの書式（Goのテンプレート、例: "{{.Time}} {{.Action}} {{.VendorName}} {{.Serial}} by {{.User}}"）
+	// 空の場合、consoleは既定の形式、fileはJSONで出力
+	Template string `json:"template,omitempty"`
+}
+
+// イベントの出力先
+type Sink interface {
+	send(event DeviceEvent) error
+}
+
+// コンソールに出力
+type consoleSink struct {
+	// 書式（nilの場合は既定の形式）
+	template *template.Template
+}
+
+// -guiのウィンドウ・usbmon tuiのダッシュボードを表示している場合は、そちらにも表示する
+func (s consoleSink) send(event DeviceEvent) error {
+	if window := eventWindow.Load(); window != nil && event.Heartbeat == nil && event.Inventory == nil {
+		window.add(event)
+	}
+	if dashboard != nil {
+		dashboard.add(event)
+		return nil
+	}
+	if s.template == nil || event.Heartbeat != nil || event.Inventory != nil {
+		printDeviceEvent(event)
+		return nil
+	}
+	line, err := renderEvent(s.template, event)
+	if err != nil {
+		return err
+	}
+	fmt.Println(line)
+	return nil
+}
+
+// ファイルに1行に1件のJSON（書式を指定した場合はその形式）として追記
+type fileSink struct {
+	mu       sync.Mutex
+	path     string
+	template *template.Template
+}
+
+func (s *fileSink) send(event DeviceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if s.template != nil {
+		line, err := renderEvent(s.template, event)
+		if err != nil {
+			return err
+		}
+		data = []byte(line)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", s.path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// WebhookにイベントのJSONをPOST
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) send(event DeviceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// 出力先ごとの送信の制限（すべてのイベントを合わせて、windowの間にmax_events件まで送信）
+type SinkRateLimit struct {
+	// windowの間に送信するイベントの数
+	MaxEvents int `json:"max_events"`
+	// 制限する期間（例: "1m"）
+	Window Duration `json:"window"`
+}
+
+// 送信の制限を超えたイベントを送らず、期間の終わりに送らなかった数をSuppressedイベントとして送る出力先
+// ハートビートは監視が動いていることを知らせるため制限しない
+type rateLimitedSink struct {
+	name  string
+	sink  Sink
+	limit SinkRateLimit
+
+	mu         sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func (s *rateLimitedSink) send(event DeviceEvent) error {
+	if event.Heartbeat != nil {
+		return s.sink.send(event)
+	}
+	s.mu.Lock()
+	now := time.Now()
+	window := time.Duration(s.limit.Window)
+	// 抑制したイベントがある期間は、flushで次の期間を始める
+	if s.suppressed == 0 && now.Sub(s.start) >= window {
+		s.start, s.count = now, 0
+	}
+	if s.count < s.limit.MaxEvents {
+		s.count++
+		s.mu.Unlock()
+		return s.sink.send(event)
+	}
+	s.suppressed++
+	if s.suppressed == 1 {
+		time.AfterFunc(window-now.Sub(s.start), s.flush)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// 期間が終わったときに、送らなかったイベントの数をこの出力先に送る
+func (s *rateLimitedSink) flush() {
+	s.mu.Lock()
+	suppressed, since := s.suppressed, s.start
+	s.start, s.count, s.suppressed = time.Time{}, 0, 0
+	s.mu.Unlock()
+	summary := DeviceEvent{
+		Action:       "Suppressed",
+		HostName:     getHostName(),
+		AgentVersion: version,
+		Machine:      machineIdentity(),
+		Severity:     severityNotice,
+		Explanation:  fmt.Sprintf("%d events not sent to sink %s since %s (rate_limit)", suppressed, s.name, since.Format(time.RFC3339)),
+	}
+	errorReporter.sinkResult(s.name, s.sink.send(eventSigner.sign(summary)))
+}
+
+// 設定から、名前ごとの出力先を作成（consoleは常に使用できる）
+func buildSinks(cfg Config) (map[string]Sink, error) {
+	sinks := map[string]Sink{consoleSinkName: consoleSink{}}
+	for name, sinkConfig := range cfg.Sinks {
+		tmpl, err := parseSinkTemplate(name, sinkConfig.Template)
+		if err != nil {
+			return nil, err
+		}
+		switch sinkConfig.Type {
+		case sinkTypeConsole:
+			sinks[name] = consoleSink{template: tmpl}
+		case sinkTypeFile:
+			sinks[name] = &fileSink{path: sinkConfig.Path, template: tmpl}
+		case sinkTypeWebhook:
+			client, err := newSinkHTTPClient(name, sinkConfig)
+			if err != nil {
+				return nil, err
+			}
+			sinks[name] = &webhookSink{url: sinkConfig.URL, client: client}
+		default:
+			return nil, fmt.Errorf("unknown sink type %q for sink %q", sinkConfig.Type, name)
+		}
+		if limit := sinkConfig.RateLimit; limit != nil {
+			// コンソールはメッセージループから直接出力するため制限しない
+			if sinkConfig.Type == sinkTypeConsole {
+				return nil, fmt.Errorf("rate_limit is not supported for console sink %q", name)
+			}
+			if limit.MaxEvents <= 0 || limit.Window <= 0 {
+				return nil, fmt.Errorf("rate_limit for sink %q needs positive max_events and window", name)
+			}
+			sinks[name] = &rateLimitedSink{name: name, sink: sinks[name], limit: *limit}
+		}
+	}
+	for _, name := range cfg.Heartbeat.Sinks {
+		if _, ok := sinks[name]; !ok {
+			return nil, fmt.Errorf("heartbeat refers to unknown sink %q", name)
+		}
+	}
+	for _, name := range cfg.Inventory.Sinks {
+		if _, ok := sinks[name]; !ok {
+			return nil, fmt.Errorf("inventory refers to unknown sink %q", name)
+		}
+	}
+	for severity, names := range cfg.Routes {
+		for _, name := range names {
+			if _, ok := sinks[name]; !ok {
+				return nil, fmt.Errorf("route for %s refers to unknown sink %q", severity, name)
+			}
+		}
+	}
+	return sinks, nil
+}
+
+// 監視で使用する出力先（設定の再読み込みで作成し直す）
+var (
+	sinksMu      sync.RWMutex
+	runningSinks = map[string]Sink{consoleSinkName: consoleSink{}}
+)
+
+// 出力先を置き換える
+func setSinks(sinks map[string]Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	runningSinks = sinks
+}
+
+// イベントの重大度に対応する出力先にイベントを送る（routesにない重大度はコンソールのみ）
+// コンソール以外の出力先は、メッセージループを止めないよう別のゴルーチンで送る
+// メンテナンス期間中・一時停止中はコンソールにだけ出力する
+func routeEvent(event DeviceEvent) {
+	_, inMaintenance := activeMaintenance(time.Now())
+	// 一時停止中もコンソールにだけ出力する（一時停止したこと自体はすべての出力先に知らせる）
+	quiet := inMaintenance || (monitorPause.active() && event.Action != "Paused")
+	severity := event.Severity
+	if severity == "" {
+		severity = severityInfo
+	}
+	names, ok := currentConfig().Routes[severity]
+	if !ok {
+		names = []string{consoleSinkName}
+	}
+	sinksMu.RLock()
+	sinks := runningSinks
+	sinksMu.RUnlock()
+	for _, name := range names {
+		sink, ok := sinks[name]
+		if !ok {
+			continue
+		}
+		if _, console := sink.(consoleSink); console {
+			sink.send(event)
+			continue
+		}
+		if quiet {
+			continue
+		}
+		sinkSends.Add(1)
+		go func(name string, sink Sink) {
+			defer sinkSends.Done()
+			defer reportPanic()
+			// メッセージループとは別に、送信が止まっていないかをウォッチドッグで監視する
+			id := watchdog.beginSend(name)
+			defer watchdog.endSend(id)
+			errorReporter.sinkResult(name, sink.send(event))
+		}(name, sink)
+	}
+}
@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// HTTPSで送る出力先のTLSの設定（TLSを検査するプロキシのある社内ネットワーク向け）
+type SinkTLSConfig struct {
+	// システムの証明書に加えて信頼するCA証明書のPEMファイル（例: 社内のTLS検査プロキシのルートCA）
+	CAFile string `json:"ca_file,omitempty"`
+	// クライアント認証に使用する証明書と秘密鍵のPEMファイル
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// 使用するTLSの最低バージョン（1.2 / 1.3、空の場合は1.2）
+	MinVersion string `json:"min_version,omitempty"`
+}
+
+// TLSの最低バージョンの指定
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 出力先の設定からHTTPクライアントを作成
+// proxyを指定しない場合は環境変数（HTTPS_PROXYなど）のプロキシを使用
+func newSinkHTTPClient(name string, sinkConfig SinkConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if sinkConfig.Proxy != "" {
+		proxyURL, err := url.Parse(sinkConfig.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q for sink %q", sinkConfig.Proxy, name)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if sinkConfig.TLS != nil {
+		tlsConfig, err := sinkConfig.TLS.build(name)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}, nil
+}
+
+// TLSの設定を作成
+func (c SinkTLSConfig) build(name string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS min_version %q for sink %q (use 1.2 or 1.3)", c.MinVersion, name)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle for sink %q: %w", name, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Failed to read CA bundle for sink %q: no certificates in %s", name, c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate for sink %q: %w", name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,20 @@
+package monitor
+
+// 起動時に接続されているデバイスの扱い
+const (
+	// 接続イベントを出力せず、起動後の変化だけを出力する（既定）
+	startupEventsSuppress = "suppress"
+	// デバイスごとにPresentイベントを出力する（状態を同期する受信側向け）
+	startupEventsEmit = "emit"
+)
+
+// 起動時に接続されていたデバイスのPresentイベントを出力
+// 接続イベントとは別の種類のため、ブロック・検出器・USBストレージの記録は行わない
+func emitPresent(event DeviceEvent) {
+	recorder.recordEvent(event)
+	if _, ok := classifyArrival(&event, currentConfig(), monitorPause.active()); !ok {
+		return
+	}
+	logDeviceEvent(event)
+	go assetSync.push(event)
+}
@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 1回の接続・切断サイクルの結果
+type stressCycle struct {
+	// 接続通知を受け取った時刻
+	ArrivedAt time.Time
+	// 接続通知からプロパティが読み取れるまでの時間
+	Latency time.Duration
+	// 列挙に失敗した場合のエラー
+	Err error
+}
+
+// 接続・切断を繰り返すデバイスの列挙結果を記録するストレステスト
+type StressTest struct {
+	// 対象デバイスのインスタンスIDの先頭部分（例: USB\VID_046D&PID_C52B\）
+	prefix string
+	// 実行するサイクル数
+	cycles int
+	// 列挙が成功するまで待つ時間
+	timeout time.Duration
+	// 列挙にかかる時間の上限（0の場合は判定しない）
+	maxLatency time.Duration
+	// 完了したサイクルの結果
+	results []stressCycle
+	// 接続中のサイクル（切断されるまで保持）
+	current *stressCycle
+}
+
+// `usbmon stress` サブコマンド
+// 指定したVID/PIDのデバイスの抜き差しをN回記録し、合否のレポートを出力
+func runStress(args []string) int {
+	fs := flag.NewFlagSet("stress", flag.ExitOnError)
+	vid := fs.String("vid", "", "target vendor ID (hex, e.g. 046D)")
+	pid := fs.String("pid", "", "target product ID (hex, e.g. C52B)")
+	cycles := fs.Int("cycles", 10, "number of plug/unplug cycles to record")
+	timeout := fs.Duration("timeout", defaultEnumerationTimeout, "time to wait for enumeration to succeed on each arrival")
+	maxLatency := fs.Duration("max-latency", 0, "fail cycles whose enumeration latency exceeds this (0 disables)")
+	fs.BoolVar(&traceEnabled, "trace", false, "log raw window messages and Windows API calls")
+	fs.Parse(args)
+
+	if *vid == "" || *pid == "" || *cycles <= 0 {
+		fmt.Println("usage: usbmon stress -vid 046D -pid C52B [-cycles 10] [-timeout 5s] [-max-latency 0]")
+		return 2
+	}
+
+	test := &StressTest{
+		prefix:     fmt.Sprintf(`USB\VID_%s&PID_%s\`, strings.ToUpper(*vid), strings.ToUpper(*pid)),
+		cycles:     *cycles,
+		timeout:    *timeout,
+		maxLatency: *maxLatency,
+	}
+	deviceChangeHandler = test.handleDeviceChange
+
+	if _, err := createNotificationWindow([]string{defaultWatchClass}); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("Waiting for %d plug/unplug cycles of %s...\n", test.cycles, strings.TrimSuffix(test.prefix, `\`))
+	runMessageLoop()
+
+	if !test.report() {
+		return 1
+	}
+	return 0
+}
+
+// ストレステストでのデバイスの接続・切断の処理
+func (t *StressTest) handleDeviceChange(instanceID string, watchClass string, arrival bool) {
+	if !strings.HasPrefix(instanceID, t.prefix) {
+		return
+	}
+
+	if arrival {
+		cycle := &stressCycle{ArrivedAt: time.Now()}
+		_, cycle.Err = waitForDeviceInfo(instanceID, t.timeout)
+		cycle.Latency = time.Since(cycle.ArrivedAt)
+		if cycle.Err == nil && t.maxLatency > 0 && cycle.Latency > t.maxLatency {
+			cycle.Err = fmt.Errorf("enumeration latency %s exceeds %s", cycle.Latency, t.maxLatency)
+		}
+		t.current = cycle
+		return
+	}
+
+	// 接続通知を受け取っていない切断は数えない
+	if t.current == nil {
+		return
+	}
+	t.results = append(t.results, *t.current)
+	t.current = nil
+	t.logCycle(len(t.results))
+
+	if len(t.results) >= t.cycles {
+		postQuitMessage(0)
+	}
+}
+
+func (t *StressTest) logCycle(n int) {
+	cycle := t.results[n-1]
+	fmt.Printf("Cycle %d/%d: ", n, t.cycles)
+	fmt.Printf("Latency=%s, ", cycle.Latency.Round(time.Millisecond))
+	if cycle.Err != nil {
+		fmt.Printf("Result=FAIL (%v)\n", cycle.Err)
+	} else {
+		fmt.Println("Result=PASS")
+	}
+}
+
+// 全サイクルの結果をまとめて出力し、すべて成功した場合はtrueを返す
+func (t *StressTest) report() bool {
+	var failures int
+	var total, slowest time.Duration
+	fastest := time.Duration(-1)
+	for _, cycle := range t.results {
+		if cycle.Err != nil {
+			failures++
+		}
+		total += cycle.Latency
+		if cycle.Latency > slowest {
+			slowest = cycle.Latency
+		}
+		if fastest < 0 || cycle.Latency < fastest {
+			fastest = cycle.Latency
+		}
+	}
+
+	passed := len(t.results) == t.cycles && failures == 0
+	fmt.Println("Stress test report:")
+	fmt.Printf("  Device=%s\n", strings.TrimSuffix(t.prefix, `\`))
+	fmt.Printf("  Cycles=%d/%d, Failures=%d\n", len(t.results), t.cycles, failures)
+	if len(t.results) > 0 {
+		avg := total / time.Duration(len(t.results))
+		fmt.Printf("  Latency min=%s, avg=%s, max=%s\n",
+			fastest.Round(time.Millisecond), avg.Round(time.Millisecond), slowest.Round(time.Millisecond))
+	}
+	if passed {
+		fmt.Println("  Result=PASS")
+	} else {
+		fmt.Println("  Result=FAIL")
+	}
+	return passed
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// セッションの情報を取得するAPI（wtsapi32.dll）
+var procWTSQuerySessionInformationW = wtsapi32.NewProc("WTSQuerySessionInformationW")
+
+// WTSQuerySessionInformationWで取得する情報の種類（WTS_INFO_CLASS）
+const (
+	WTSUserName   = 5
+	WTSDomainName = 7
+)
+
+// 出力の書式（テンプレート）で使用できる値
+// イベントの項目（{{.Action}}、{{.Device.FriendlyName}}など）に加えて、よく使う項目を短い名前で参照できる
+type TemplateData struct {
+	DeviceEvent
+	// イベントを出力した日時
+	Time time.Time
+	// 製造元（Device.Manufacturer）
+	VendorName string
+	// 製品名（Device.FriendlyName）
+	ProductName string
+	// ベンダーID・プロダクトID（例: 046D、C52B）
+	VID string
+	PID string
+	// シリアル番号（持たないデバイスは空）
+	Serial string
+	// コンソールにログオンしているユーザー（例: CONTOSO\tanaka、いない場合は空）
+	User string
+}
+
+// 出力先の書式（Goのテンプレート）を読み込む
+func parseSinkTemplate(name string, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for sink %q: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// イベントを書式に当てはめた文字列を返す
+func renderEvent(tmpl *template.Template, event DeviceEvent) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, newTemplateData(event)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// イベントから書式で使用できる値を作成
+func newTemplateData(event DeviceEvent) TemplateData {
+	vid, pid := parseVIDPID(event.Device.InstanceID)
+	return TemplateData{
+		DeviceEvent: event,
+		Time:        time.Now(),
+		VendorName:  event.Device.Manufacturer,
+		ProductName: event.Device.FriendlyName,
+		VID:         vid,
+		PID:         pid,
+		Serial:      deviceSerial(event.Device.InstanceID),
+		User:        consoleUser(),
+	}
+}
+
+// コンソールのセッションにログオンしているユーザー（ドメイン\ユーザー名）
+func consoleUser() string {
+	sessionID := windows.WTSGetActiveConsoleSessionId()
+	if sessionID == 0xFFFFFFFF {
+		return ""
+	}
+	user := querySessionString(sessionID, WTSUserName)
+	if user == "" {
+		return ""
+	}
+	if domain := querySessionString(sessionID, WTSDomainName); domain != "" {
+		return domain + `\` + user
+	}
+	return user
+}
+
+// セッションの情報（文字列）を取得
+func querySessionString(sessionID uint32, infoClass uintptr) string {
+	var buffer *uint16
+	var size uint32
+	if _, err := callWin32(procWTSQuerySessionInformationW,
+		0, // WTS_CURRENT_SERVER_HANDLE
+		uintptr(sessionID),
+		infoClass,
+		uintptr(unsafe.Pointer(&buffer)),
+		uintptr(unsafe.Pointer(&size)),
+	); err != nil {
+		return ""
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(buffer)))
+	return windows.UTF16PtrToString(buffer)
+}
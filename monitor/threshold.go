@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 接続の量のしきい値（windowの間に、条件に一致する接続がmaxを超えたら集約したアラートを出力）
+type ThresholdRule struct {
+	// 規則の名前（アラートの理由に含める）
+	Name string `json:"name"`
+	// 数えるもの（arrivals: 接続の数、distinct: 異なるデバイスの数）
+	Count string `json:"count"`
+	// 監視を起動してから初めて接続されたデバイスだけを数えるかどうか
+	NewOnly bool `json:"new_only"`
+	// 対象のデバイスの種類・通知を受け取ったデバイスの種類（空の場合はすべて）
+	DeviceType string `json:"device_type"`
+	WatchClass string `json:"watch_class"`
+	// しきい値と期間（例: 5、"10m"）
+	Max    int      `json:"max"`
+	Window Duration `json:"window"`
+	// アラートの重大度（空の場合はwarning）
+	Severity string `json:"severity"`
+}
+
+// 数える接続の種類
+const (
+	thresholdCountArrivals = "arrivals"
+	thresholdCountDistinct = "distinct"
+)
+
+// 期間内に数えた接続
+type thresholdHit struct {
+	at          time.Time
+	fingerprint string
+}
+
+// しきい値の規則ごとに接続を数え、しきい値を超えたらThresholdイベントを出力
+type ThresholdMonitor struct {
+	mu sync.Mutex
+	// 規則の名前ごとの期間内の接続
+	hits map[string][]thresholdHit
+	// 規則の名前ごとの最後にアラートを出力した日時（同じ期間に繰り返し出力しない）
+	alerted map[string]time.Time
+	// 監視を起動してから接続されたデバイスのフィンガープリント
+	seen map[string]bool
+}
+
+var thresholdMonitor = &ThresholdMonitor{hits: map[string][]thresholdHit{}, alerted: map[string]time.Time{}, seen: map[string]bool{}}
+
+// 接続をしきい値の規則ごとに数え、しきい値を超えた規則の理由を返す
+func (m *ThresholdMonitor) observe(rules []ThresholdRule, event DeviceEvent, t time.Time) []ThresholdRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	isNew := !m.seen[event.Fingerprint]
+	m.seen[event.Fingerprint] = true
+
+	var exceeded []ThresholdRule
+	for _, rule := range rules {
+		if rule.Max <= 0 || rule.Window <= 0 || (rule.NewOnly && !isNew) ||
+			(rule.DeviceType != "" && !strings.EqualFold(rule.DeviceType, event.DeviceType)) ||
+			(rule.WatchClass != "" && !strings.EqualFold(rule.WatchClass, event.WatchClass)) {
+			continue
+		}
+		window := time.Duration(rule.Window)
+		hits := append(m.hits[rule.Name], thresholdHit{at: t, fingerprint: event.Fingerprint})
+		for len(hits) > 0 && t.Sub(hits[0].at) > window {
+			hits = hits[1:]
+		}
+		m.hits[rule.Name] = hits
+		if m.count(rule, hits) <= rule.Max || t.Sub(m.alerted[rule.Name]) < window {
+			continue
+		}
+		m.alerted[rule.Name] = t
+		exceeded = append(exceeded, rule)
+	}
+	return exceeded
+}
+
+// 期間内の接続を、規則に従って数える
+func (m *ThresholdMonitor) count(rule ThresholdRule, hits []thresholdHit) int {
+	if rule.Count != thresholdCountDistinct {
+		return len(hits)
+	}
+	distinct := map[string]bool{}
+	for _, hit := range hits {
+		distinct[hit.fingerprint] = true
+	}
+	return len(distinct)
+}
+
+// 設定のしきい値の規則を確認
+func checkThresholdRules(rules []ThresholdRule) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("threshold rules need unique names (%q)", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Count {
+		case "", thresholdCountArrivals, thresholdCountDistinct:
+		default:
+			return fmt.Errorf("threshold %q: unknown count %q (arrivals or distinct)", rule.Name, rule.Count)
+		}
+	}
+	return nil
+}
+
+// 接続イベントを数え、しきい値を超えた規則ごとにThresholdイベントを出力
+func checkThresholds(event DeviceEvent) {
+	for _, rule := range thresholdMonitor.observe(currentConfig().Thresholds, event, time.Now()) {
+		alert := event
+		alert.Action = "Threshold"
+		alert.Severity = rule.Severity
+		if alert.Severity == "" {
+			alert.Severity = severityWarning
+		}
+		count := rule.Count
+		if count == "" {
+			count = thresholdCountArrivals
+		}
+		alert.Explanation = fmt.Sprintf("%s: more than %d %s within %s", rule.Name, rule.Max, count, time.Duration(rule.Window))
+		logDeviceEvent(alert)
+	}
+}
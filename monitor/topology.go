@@ -0,0 +1,545 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// USBホストコントローラー・ハブに対するIOCTL
+const (
+	// ホストコントローラーのルートハブ名を取得
+	IOCTL_USB_GET_ROOT_HUB_NAME = 0x220408
+	// ハブの情報（ポート数など）を取得
+	IOCTL_USB_GET_NODE_INFORMATION = 0x220408
+	// ハブのポートに接続されたデバイスの情報を取得
+	IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX = 0x220448
+	// ハブのポートに接続されたデバイスが対応・使用しているUSBプロトコル（SuperSpeedPlusなど）を取得
+	IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX_V2 = 0x22045C
+	// ハブのポートのコネクタの情報（ユーザーが接続できるポートかなど）を取得
+	IOCTL_USB_GET_PORT_CONNECTOR_PROPERTIES = 0x220458
+	// ハブのポートに接続されたデバイスのディスクリプタを取得
+	IOCTL_USB_GET_DESCRIPTOR_FROM_NODE_CONNECTION = 0x220410
+	// ハブのポートに接続された外部ハブの名前を取得
+	IOCTL_USB_GET_NODE_CONNECTION_NAME = 0x220414
+	// ハブのポートに接続されたデバイスのドライバのキー名を取得
+	IOCTL_USB_GET_NODE_CONNECTION_DRIVERKEY_NAME = 0x220420
+	// ポートにデバイスが接続されていることを示す状態（USB_CONNECTION_STATUS）
+	DeviceConnected = 1
+	// USB 3.0以降のプロトコルを問い合わせるフラグ（USB_PROTOCOLS）
+	USB_PROTOCOL_300 = 0x4
+	// SuperSpeedPlus以上で動作していることを示すフラグ（USB_NODE_CONNECTION_INFORMATION_EX_V2_FLAGS）
+	DeviceIsOperatingAtSuperSpeedPlusOrHigher = 0x4
+	// ユーザーが接続できるポートであることを示すフラグ（USB_PORT_PROPERTIES）
+	USB_PORT_IS_USER_CONNECTABLE = 0x1
+	// ディスクリプタを取得する標準リクエスト（GET_DESCRIPTOR）
+	USB_REQUEST_GET_DESCRIPTOR = 0x06
+	// コンフィギュレーションディスクリプタの種類
+	USB_CONFIGURATION_DESCRIPTOR_TYPE = 0x02
+	// コンフィギュレーションディスクリプタの長さ
+	USB_CONFIGURATION_DESCRIPTOR_LENGTH = 9
+	// bmAttributesのセルフパワーを示すビット
+	USB_CONFIG_SELF_POWERED = 0x40
+	// USB_DEVICE_SPEEDのSuperSpeed（bMaxPowerの単位が8mAになる）
+	UsbSuperSpeed = 3
+)
+
+// USB_DEVICE_SPEEDの値に対応する通信速度の名前
+var usbSpeedNames = []string{"LowSpeed", "FullSpeed", "HighSpeed", "SuperSpeed"}
+
+// トポロジーのノードの種類
+const (
+	topologyController  = "controller"
+	topologyRootHub     = "root_hub"
+	topologyExternalHub = "external_hub"
+	topologyDevice      = "device"
+)
+
+// USBホストコントローラーのデバイスインターフェースクラスGUID（GUID_DEVINTERFACE_USB_HOST_CONTROLLER）
+var usbHostControllerGuid = windows.GUID{
+	Data1: 0x3ABF6F2D,
+	Data2: 0x71C4,
+	Data3: 0x462A,
+	Data4: [8]byte{0x8A, 0x92, 0x1E, 0x68, 0x61, 0xE6, 0xAF, 0x27},
+}
+
+// ホストコントローラー → ルートハブ → ポートの順にたどったUSBトポロジーのノード
+type TopologyNode struct {
+	// ノードの種類（controller / root_hub / external_hub / device）
+	Type string `json:"type"`
+	// デバイスのインスタンスID
+	InstanceID string `json:"instance_id,omitempty"`
+	// 親ハブのポート番号（コントローラー・ルートハブは0）
+	Port int `json:"port,omitempty"`
+	// ベンダーID（例: 046D）
+	VendorID string `json:"vendor_id,omitempty"`
+	// プロダクトID（例: C52B）
+	ProductID string `json:"product_id,omitempty"`
+	// 通信速度（LowSpeed / FullSpeed / HighSpeed / SuperSpeed / SuperSpeedPlus）
+	Speed string `json:"speed,omitempty"`
+	// デバイスディスクリプタのUSB仕様のバージョン（bcdUSB、例: 3.20）
+	USBVersion string `json:"usb_version,omitempty"`
+	// コンフィギュレーションディスクリプタで宣言された最大消費電流（mA）
+	MaxPower int `json:"max_power_ma,omitempty"`
+	// 電源の供給方法（self / bus）
+	PowerMode string `json:"power_mode,omitempty"`
+	// ユーザーが接続できない内部ポートに接続されているかどうか
+	Internal bool `json:"internal,omitempty"`
+	// ハブのポート数
+	Ports int `json:"ports,omitempty"`
+	// 子ノード（コントローラーのルートハブ、ハブのポートに接続されたデバイス）
+	Children []*TopologyNode `json:"children,omitempty"`
+	// ハブを開くためのデバイス名（ルートハブ・外部ハブのみ）
+	name string
+}
+
+// ハブのポートに接続されたデバイスの情報（USB_NODE_CONNECTION_INFORMATION_EXの一部）
+type usbConnectionInfo struct {
+	// 接続状態（USB_CONNECTION_STATUS）
+	Status uint32
+	// デバイスディスクリプタのベンダーID・プロダクトID
+	VendorID  uint16
+	ProductID uint16
+	// デバイスディスクリプタのUSB仕様のバージョン（BCD形式、例: 0x0320）
+	BcdUSB uint16
+	// 通信速度（USB_DEVICE_SPEED）
+	Speed uint8
+	// 現在のコンフィギュレーション番号（0の場合は未設定）
+	CurrentConfiguration uint8
+	// 接続されたデバイスがハブかどうか
+	IsHub bool
+}
+
+// 通信速度の名前を返す
+func (c usbConnectionInfo) speedName() string {
+	if int(c.Speed) < len(usbSpeedNames) {
+		return usbSpeedNames[c.Speed]
+	}
+	return fmt.Sprintf("Unknown(%d)", c.Speed)
+}
+
+// USB仕様のバージョンを表示用の文字列（例: 3.20）で返す
+func (c usbConnectionInfo) usbVersion() string {
+	return fmt.Sprintf("%x.%02x", c.BcdUSB>>8, c.BcdUSB&0xFF)
+}
+
+// `usbmon topology` サブコマンド
+// USBトポロジー全体をJSONで出力
+func runTopology(args []string) int {
+	topology, err := getTopology()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(topology); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// すべてのホストコントローラーからUSBトポロジーをたどる
+func getTopology() ([]*TopologyNode, error) {
+	controllers, err := windows.CM_Get_Device_Interface_List("", &usbHostControllerGuid, windows.CM_GET_DEVICE_INTERFACE_LIST_PRESENT)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list host controllers: %w", err)
+	}
+	var nodes []*TopologyNode
+	for _, path := range controllers {
+		controller := &TopologyNode{
+			Type:       topologyController,
+			InstanceID: interfacePathToInstanceID(path),
+		}
+		rootHubName, err := getRootHubName(path)
+		if err != nil {
+			fmt.Println("Failed to get root hub name:", err)
+		} else {
+			rootHub := &TopologyNode{
+				Type:       topologyRootHub,
+				InstanceID: interfacePathToInstanceID(rootHubName),
+				name:       rootHubName,
+			}
+			walkHub(rootHub, rootHubName, true)
+			controller.Children = append(controller.Children, rootHub)
+		}
+		nodes = append(nodes, controller)
+	}
+	return nodes, nil
+}
+
+// ハブの各ポートに接続されたデバイスをたどり、子ノードに追加（recursiveの場合は外部ハブの先もたどる）
+func walkHub(hub *TopologyNode, hubName string, recursive bool) {
+	h, err := openUSBDevice(`\\.\` + hubName)
+	if err != nil {
+		fmt.Println("Failed to open hub:", err)
+		return
+	}
+	defer windows.CloseHandle(h)
+
+	// USB_NODE_INFORMATION構造体（NodeTypeの後にハブディスクリプタが続く）
+	nodeInfo := make([]byte, 76)
+	if err := deviceIoControl(h, IOCTL_USB_GET_NODE_INFORMATION, nodeInfo, nodeInfo); err != nil {
+		fmt.Println("Failed to get hub information:", err)
+		return
+	}
+	// bNumberOfPortsはハブディスクリプタの3バイト目
+	hub.Ports = int(nodeInfo[6])
+
+	for port := 1; port <= hub.Ports; port++ {
+		conn, err := getConnectionInfo(h, port)
+		if err != nil || conn.Status != DeviceConnected {
+			continue
+		}
+		node := &TopologyNode{
+			Type:       topologyDevice,
+			Port:       port,
+			VendorID:   fmt.Sprintf("%04X", conn.VendorID),
+			ProductID:  fmt.Sprintf("%04X", conn.ProductID),
+			Speed:      conn.speedName(),
+			USBVersion: conn.usbVersion(),
+		}
+		// SuperSpeedPlusはUSB_DEVICE_SPEEDでは区別できないため、V2の情報で判定
+		if isSuperSpeedPlus(h, port) {
+			node.Speed = "SuperSpeedPlus"
+		}
+		node.Internal = isInternalPort(h, port)
+		if conn.CurrentConfiguration != 0 {
+			if config, err := getConfigDescriptor(h, port); err == nil {
+				node.MaxPower, node.PowerMode = parsePower(config, conn.Speed)
+			}
+		}
+		if driverKey, err := getNodeConnectionName(h, IOCTL_USB_GET_NODE_CONNECTION_DRIVERKEY_NAME, port); err == nil {
+			// ハブのポートから得られるドライバのキー名をインスタンスIDに変換
+			node.InstanceID = deviceCache.instanceID(driverKey)
+		}
+		if conn.IsHub {
+			node.Type = topologyExternalHub
+			if name, err := getNodeConnectionName(h, IOCTL_USB_GET_NODE_CONNECTION_NAME, port); err == nil {
+				node.name = name
+				if recursive {
+					walkHub(node, name, true)
+				}
+			}
+		}
+		hub.Children = append(hub.Children, node)
+	}
+}
+
+// デバイスのノードと、そのデバイスが接続されているハブのノードを探す
+func findTopologyNode(nodes []*TopologyNode, instanceID string) (*TopologyNode, *TopologyNode) {
+	for _, node := range nodes {
+		for _, child := range node.Children {
+			if child.InstanceID == instanceID && child.Port != 0 {
+				return node, child
+			}
+		}
+		if hub, device := findTopologyNode(node.Children, instanceID); device != nil {
+			return hub, device
+		}
+	}
+	return nil, nil
+}
+
+// 接続されたデバイスの親になりうるハブ（ルートハブ・外部ハブ）
+// 接続のたびにUSBトポロジー全体をたどらないよう、ハブが接続・切断されるまでキャッシュし、親のハブのポートだけを調べる
+type HubCache struct {
+	mu sync.Mutex
+	// 大文字にしたインスタンスIDごとのハブ（nilの場合は次の参照時にUSBトポロジー全体をたどって作成）
+	hubs map[string]*TopologyNode
+}
+
+var hubCache = &HubCache{}
+
+// ハブの接続・切断で、次の参照時にUSBトポロジー全体をたどり直す
+func (c *HubCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hubs = nil
+}
+
+// インスタンスIDのハブを取得
+func (c *HubCache) lookup(instanceID string) (*TopologyNode, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hubs == nil {
+		topology, err := getTopology()
+		if err != nil {
+			return nil, false, err
+		}
+		c.hubs = map[string]*TopologyNode{}
+		collectHubs(topology, c.hubs)
+	}
+	hub, ok := c.hubs[strings.ToUpper(instanceID)]
+	return hub, ok, nil
+}
+
+// USBトポロジーから、開くことのできるハブを集める
+func collectHubs(nodes []*TopologyNode, hubs map[string]*TopologyNode) {
+	for _, node := range nodes {
+		if (node.Type == topologyRootHub || node.Type == topologyExternalHub) && node.InstanceID != "" && node.name != "" {
+			hubs[strings.ToUpper(node.InstanceID)] = &TopologyNode{Type: node.Type, InstanceID: node.InstanceID, name: node.name}
+		}
+		collectHubs(node.Children, hubs)
+	}
+}
+
+// デバイスのノードと、そのデバイスが接続されているハブのノードを、親のハブのポートだけをたどって探す
+// chainはデバイスのインスタンスIDと祖先のインスタンスID（近い順）
+func findConnectedPort(chain []string) (*TopologyNode, *TopologyNode, error) {
+	for i := 0; i+1 < len(chain); i++ {
+		cached, ok, err := hubCache.lookup(chain[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		hub := &TopologyNode{Type: cached.Type, InstanceID: cached.InstanceID}
+		walkHub(hub, cached.name, false)
+		if _, device := findTopologyNode([]*TopologyNode{hub}, chain[i]); device != nil {
+			return hub, device, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// 接続されたデバイスにハブの種類、ポート番号、通信速度を設定
+func setTopologyInfo(deviceInfo *DeviceInfo) {
+	// HIDやディスクなどUSBデバイスの配下にあるdevnodeは、親をたどって接続位置を探す
+	chain := append([]string{deviceInfo.InstanceID}, getAncestorIDs(deviceInfo.InstanceID)...)
+	hub, device, err := findConnectedPort(chain)
+	if err == nil && device == nil {
+		// キャッシュの作成後に接続されたハブの先のデバイスは、USBトポロジー全体をたどり直して探す
+		hubCache.invalidate()
+		hub, device, err = findConnectedPort(chain)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if device == nil {
+		return
+	}
+	// 接続されたハブの先のデバイスを探せるよう、ハブの一覧を作り直す
+	if device.Type == topologyExternalHub {
+		hubCache.invalidate()
+	}
+	deviceInfo.HubType = hub.Type
+	deviceInfo.Port = device.Port
+	deviceInfo.Speed = device.Speed
+	deviceInfo.USBVersion = device.USBVersion
+	deviceInfo.InternalPort = device.Internal
+	deviceInfo.IsHub = device.Type == topologyExternalHub
+	deviceInfo.MaxPower = device.MaxPower
+	deviceInfo.PowerMode = device.PowerMode
+}
+
+// ホストコントローラーのルートハブ名を取得
+func getRootHubName(controllerPath string) (string, error) {
+	h, err := openUSBDevice(controllerPath)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(h)
+
+	// USB_ROOT_HUB_NAME構造体（ActualLengthの後に名前が続く）
+	// 最初に必要なサイズを取得してから、名前全体を取得
+	header := make([]byte, 8)
+	if err := deviceIoControl(h, IOCTL_USB_GET_ROOT_HUB_NAME, nil, header); err != nil {
+		return "", err
+	}
+	buffer := make([]byte, binary.LittleEndian.Uint32(header[0:4]))
+	if len(buffer) < 4 {
+		return "", fmt.Errorf("invalid root hub name length %d", len(buffer))
+	}
+	if err := deviceIoControl(h, IOCTL_USB_GET_ROOT_HUB_NAME, nil, buffer); err != nil {
+		return "", err
+	}
+	return utf16BytesToString(buffer[4:]), nil
+}
+
+// ハブのポートに接続されたデバイスの情報を取得
+func getConnectionInfo(h windows.Handle, port int) (usbConnectionInfo, error) {
+	// USB_NODE_CONNECTION_INFORMATION_EX構造体（1バイト境界で詰めたレイアウト）
+	buffer := make([]byte, 35)
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(port))
+	if err := deviceIoControl(h, IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX, buffer, buffer); err != nil {
+		return usbConnectionInfo{}, err
+	}
+	return usbConnectionInfo{
+		BcdUSB:    binary.LittleEndian.Uint16(buffer[6:8]),
+		VendorID:  binary.LittleEndian.Uint16(buffer[12:14]),
+		ProductID: binary.LittleEndian.Uint16(buffer[14:16]),
+		Speed:     buffer[23],
+		IsHub:     buffer[24] != 0,
+		// CurrentConfigurationValueはデバイスディスクリプタの直後
+		CurrentConfiguration: buffer[22],
+		Status:               binary.LittleEndian.Uint32(buffer[31:35]),
+	}, nil
+}
+
+// ハブのポートに接続されたデバイスがSuperSpeedPlus以上で動作しているかを判定
+func isSuperSpeedPlus(h windows.Handle, port int) bool {
+	// USB_NODE_CONNECTION_INFORMATION_EX_V2構造体
+	// ConnectionIndex、Length、SupportedUsbProtocols、Flagsの順に並ぶ
+	buffer := make([]byte, 16)
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(port))
+	binary.LittleEndian.PutUint32(buffer[4:8], uint32(len(buffer)))
+	binary.LittleEndian.PutUint32(buffer[8:12], USB_PROTOCOL_300)
+	// Windows 8より前のハブドライバは対応していない
+	if err := deviceIoControl(h, IOCTL_USB_GET_NODE_CONNECTION_INFORMATION_EX_V2, buffer, buffer); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(buffer[12:16])&DeviceIsOperatingAtSuperSpeedPlusOrHigher != 0
+}
+
+// ハブのポートがユーザーが接続できない内部ポートかを判定
+func isInternalPort(h windows.Handle, port int) bool {
+	// USB_PORT_CONNECTOR_PROPERTIES構造体
+	// ConnectionIndex、ActualLength、UsbPortProperties、CompanionIndex、CompanionPortNumberの後に名前が続く
+	buffer := make([]byte, 512)
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(port))
+	// Windows 8より前のハブドライバは対応していないため、内部ポートではないとみなす
+	if err := deviceIoControl(h, IOCTL_USB_GET_PORT_CONNECTOR_PROPERTIES, buffer, buffer); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(buffer[8:12])&USB_PORT_IS_USER_CONNECTABLE == 0
+}
+
+// ハブのポートに接続されたデバイスのコンフィギュレーションディスクリプタ全体（インターフェース・エンドポイントを含む）を取得
+func getConfigDescriptor(h windows.Handle, port int) ([]byte, error) {
+	// 最初にコンフィギュレーションディスクリプタだけを取得し、wTotalLengthで全体を取得
+	config, err := getDescriptor(h, port, USB_CONFIGURATION_DESCRIPTOR_TYPE, USB_CONFIGURATION_DESCRIPTOR_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+	if len(config) < USB_CONFIGURATION_DESCRIPTOR_LENGTH {
+		return nil, fmt.Errorf("invalid configuration descriptor length %d", len(config))
+	}
+	total := binary.LittleEndian.Uint16(config[2:4])
+	if total <= USB_CONFIGURATION_DESCRIPTOR_LENGTH {
+		return config, nil
+	}
+	return getDescriptor(h, port, USB_CONFIGURATION_DESCRIPTOR_TYPE, total)
+}
+
+// ハブのポートに接続されたデバイスにGET_DESCRIPTORリクエストを送信
+func getDescriptor(h windows.Handle, port int, descriptorType uint8, length uint16) ([]byte, error) {
+	// USB_DESCRIPTOR_REQUEST構造体（ConnectionIndex、セットアップパケットの後にデータが続く）
+	buffer := make([]byte, 12+int(length))
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(port))
+	// bmRequest（デバイスからホストへの標準リクエスト）
+	buffer[4] = 0x80
+	buffer[5] = USB_REQUEST_GET_DESCRIPTOR
+	// wValue（上位バイトがディスクリプタの種類、下位バイトがインデックス）
+	binary.LittleEndian.PutUint16(buffer[6:8], uint16(descriptorType)<<8)
+	binary.LittleEndian.PutUint16(buffer[8:10], 0)
+	binary.LittleEndian.PutUint16(buffer[10:12], length)
+
+	var returned uint32
+	if err := windows.DeviceIoControl(h, IOCTL_USB_GET_DESCRIPTOR_FROM_NODE_CONNECTION,
+		&buffer[0], uint32(len(buffer)), &buffer[0], uint32(len(buffer)), &returned, nil); err != nil {
+		return nil, err
+	}
+	if returned < 12 {
+		return nil, fmt.Errorf("invalid descriptor response length %d", returned)
+	}
+	return buffer[12:returned], nil
+}
+
+// コンフィギュレーションディスクリプタから最大消費電流（mA）と電源の供給方法を取得
+func parsePower(config []byte, speed uint8) (int, string) {
+	// bMaxPowerの単位はSuperSpeed以上で8mA、それ以外で2mA
+	unit := 2
+	if speed >= UsbSuperSpeed {
+		unit = 8
+	}
+	powerMode := "bus"
+	if config[7]&USB_CONFIG_SELF_POWERED != 0 {
+		powerMode = "self"
+	}
+	return int(config[8]) * unit, powerMode
+}
+
+// ハブのポートに接続されたノードの名前（外部ハブ名・ドライバのキー名）を取得
+func getNodeConnectionName(h windows.Handle, ioctl uint32, port int) (string, error) {
+	// USB_NODE_CONNECTION_NAME構造体（ConnectionIndex、ActualLengthの後に名前が続く）
+	// 最初に必要なサイズを取得してから、名前全体を取得
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(port))
+	if err := deviceIoControl(h, ioctl, header, header); err != nil {
+		return "", err
+	}
+	length := binary.LittleEndian.Uint32(header[4:8])
+	if length < 8 {
+		return "", fmt.Errorf("invalid node name length %d", length)
+	}
+	buffer := make([]byte, length)
+	binary.LittleEndian.PutUint32(buffer[0:4], uint32(port))
+	if err := deviceIoControl(h, ioctl, buffer, buffer); err != nil {
+		return "", err
+	}
+	return utf16BytesToString(buffer[8:]), nil
+}
+
+// 現在接続されているUSBデバイスのドライバのキー名とインスタンスIDの対応表を作成
+// デバイスが多いホストでは時間がかかるため、インスタンスIDの列挙の後、ドライバのキー名を並行して取得
+func getUSBDriverKeys() map[string]string {
+	instanceIDs := listDeviceInstanceIDsWithFlags("USB", windows.DIGCF_PRESENT|windows.DIGCF_ALLCLASSES)
+	keys := make([]string, len(instanceIDs))
+	forEachParallel(len(instanceIDs), func(i int) {
+		if devInst, err := locateDevNode(instanceIDs[i]); err == nil {
+			keys[i] = getDevNodeProperty(devInst, CM_DRP_DRIVER)
+		}
+	})
+	driverKeys := map[string]string{}
+	for i, driverKey := range keys {
+		if driverKey != "" {
+			driverKeys[driverKey] = instanceIDs[i]
+		}
+	}
+	return driverKeys
+}
+
+// IOCTLを送信するためにホストコントローラー・ハブを開く
+func openUSBDevice(path string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	return windows.CreateFile(
+		name,
+		windows.GENERIC_WRITE,
+		windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		0,
+		0,
+	)
+}
+
+// 入力・出力バッファを指定してIOCTLを送信
+func deviceIoControl(h windows.Handle, ioctl uint32, in []byte, out []byte) error {
+	var inPtr *byte
+	if len(in) > 0 {
+		inPtr = &in[0]
+	}
+	var returned uint32
+	return windows.DeviceIoControl(h, ioctl, inPtr, uint32(len(in)), &out[0], uint32(len(out)), &returned, nil)
+}
+
+// UTF-16（リトルエンディアン）のバイト列を文字列に変換
+func utf16BytesToString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return windows.UTF16ToString(u)
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 受信したメッセージとAPIの呼び出しを詳細に出力するかどうか（-traceで有効化）
+var traceEnabled bool
+
+// トレースを有効にしている場合のみ出力
+func tracef(format string, args ...any) {
+	if !traceEnabled {
+		return
+	}
+	fmt.Printf("Trace: "+format+"\n", args...)
+}
+
+// APIの呼び出しの引数と結果を出力
+func traceCall(name string, args []uintptr, ret uintptr, err error) {
+	if !traceEnabled {
+		return
+	}
+	params := make([]string, len(args))
+	for i, arg := range args {
+		params[i] = fmt.Sprintf("0x%X", arg)
+	}
+	if err != nil {
+		tracef("%s(%s) = 0x%X (%v)", name, strings.Join(params, ", "), ret, err)
+		return
+	}
+	tracef("%s(%s) = 0x%X", name, strings.Join(params, ", "), ret)
+}
+
+// WM_DEVICECHANGEのwParam・lParamと、lParamが指すDEV_BROADCAST_*構造体の内容を出力
+func traceDeviceChange(notification rawNotification, lParam uintptr) {
+	if !traceEnabled {
+		return
+	}
+	tracef("WM_DEVICECHANGE wParam=0x%04X lParam=0x%X", notification.WParam, lParam)
+	if lParam == 0 {
+		return
+	}
+	tracef("  DEV_BROADCAST_HDR DeviceType=0x%X", notification.DeviceType)
+	switch notification.DeviceType {
+	case DBT_DEVTYP_DEVICEINTERFACE:
+		tracef("  DEV_BROADCAST_DEVICEINTERFACE ClassGuid=%s Name=%s", notification.ClassGuid, notification.Name)
+	case DBT_DEVTYP_VOLUME:
+		tracef("  DEV_BROADCAST_VOLUME UnitMask=0x%08X", notification.UnitMask)
+	}
+}
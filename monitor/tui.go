@@ -0,0 +1,356 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ダッシュボードの画面を制御するANSIエスケープシーケンス
+const (
+	// 代替画面に切り替え・元の画面に戻す
+	ansiAltScreenOn  = "\x1b[?1049h"
+	ansiAltScreenOff = "\x1b[?1049l"
+	// カーソルを隠す・表示する
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+	// カーソルを左上に移動して画面を消去
+	ansiClearScreen = "\x1b[H\x1b[2J"
+	// 反転表示（選択中のデバイス）
+	ansiReverse = "\x1b[7m"
+)
+
+const (
+	// イベントの一覧に保持するイベントの数
+	dashboardMaxEvents = 500
+	// 他の出力で画面が崩れた場合に備えて、定期的に描き直す間隔
+	dashboardRedrawInterval = time.Second
+)
+
+// 重大度の低い順（ダッシュボードの絞り込みに使用）
+var severityLevels = []string{severityInfo, severityNotice, severityWarning, severityCritical}
+
+// 重大度の順位を返す（不明な重大度はinfoとみなす）
+func severityLevel(severity string) int {
+	for i, level := range severityLevels {
+		if level == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// ダッシュボードに表示するイベント
+type dashboardEvent struct {
+	Time  time.Time
+	Event DeviceEvent
+}
+
+// `usbmon tui` の全画面のダッシュボード
+// 接続中のデバイスの一覧と、イベントの一覧を表示する
+type Dashboard struct {
+	mu sync.Mutex
+	// 接続中のデバイス（インスタンスIDごと）
+	devices map[string]DeviceEvent
+	// 最近のイベント（古い順）
+	events []dashboardEvent
+	// 選択中のデバイスの位置
+	selected int
+	// 詳細を表示しているかどうか
+	detail bool
+	// 表示するイベントの重大度の下限
+	minSeverity int
+	// Blockedイベントだけを表示するかどうか
+	blockedOnly bool
+	// 起動時のコンソールの入力モード（終了時に戻す）
+	inputMode uint32
+}
+
+// ダッシュボード（usbmon tuiで実行している場合のみ）
+var dashboard *Dashboard
+
+// `usbmon tui` サブコマンド
+// 監視を実行し、イベントをダッシュボードに表示する（フラグは監視と同じ）
+func runTUI(args []string) int {
+	stdin := windows.Handle(os.Stdin.Fd())
+	stdout := windows.Handle(os.Stdout.Fd())
+	var inputMode, outputMode uint32
+	if windows.GetConsoleMode(stdin, &inputMode) != nil || windows.GetConsoleMode(stdout, &outputMode) != nil {
+		fmt.Println("usbmon tui must be run in a console")
+		return 2
+	}
+	// 1文字ずつ、矢印キーはエスケープシーケンスとして受け取る
+	if err := windows.SetConsoleMode(stdin, windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
+		fmt.Printf("Failed to set console mode: %v\n", err)
+		return 1
+	}
+	if err := windows.SetConsoleMode(stdout, outputMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		windows.SetConsoleMode(stdin, inputMode)
+		fmt.Printf("Failed to set console mode: %v\n", err)
+		return 1
+	}
+	dashboard = &Dashboard{devices: map[string]DeviceEvent{}, inputMode: inputMode}
+	code := runMonitor(args)
+	dashboard.restore()
+	return code
+}
+
+// 監視の準備ができたら、全画面に切り替えてキー入力の受け付けを始める
+// 準備に失敗した場合のエラーは、元の画面に出力される
+func (d *Dashboard) start(snapshot map[string]string) {
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	go d.loadConnectedDevices(snapshot)
+	go d.readKeys()
+	go d.redrawPeriodically()
+}
+
+// コンソールの状態を元に戻す
+func (d *Dashboard) restore() {
+	fmt.Print(ansiShowCursor + ansiAltScreenOff)
+	windows.SetConsoleMode(windows.Handle(os.Stdin.Fd()), d.inputMode)
+}
+
+// 起動時に接続されているデバイス（インスタンスIDと監視するデバイスの種類）を一覧に加える
+func (d *Dashboard) loadConnectedDevices(snapshot map[string]string) {
+	instanceIDs := make([]string, 0, len(snapshot))
+	for instanceID := range snapshot {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	events := make([]DeviceEvent, len(instanceIDs))
+	forEachParallel(len(instanceIDs), func(i int) {
+		info, err := getDeviceInfo(instanceIDs[i])
+		if err != nil {
+			info = DeviceInfo{InstanceID: instanceIDs[i]}
+		}
+		events[i] = DeviceEvent{
+			Action:     "Connected",
+			WatchClass: snapshot[instanceIDs[i]],
+			DeviceType: classifyDevice(info),
+			Device:     sanitizeDeviceInfo(info),
+		}
+	})
+
+	d.mu.Lock()
+	for _, event := range events {
+		// 起動後に届いたイベントを優先
+		if _, ok := d.devices[event.Device.InstanceID]; !ok {
+			d.devices[event.Device.InstanceID] = event
+		}
+	}
+	d.mu.Unlock()
+	d.redraw()
+}
+
+// イベントを一覧に加え、接続中のデバイスを更新して描き直す
+func (d *Dashboard) add(event DeviceEvent) {
+	d.mu.Lock()
+	d.events = append(d.events, dashboardEvent{Time: time.Now(), Event: event})
+	if len(d.events) > dashboardMaxEvents {
+		d.events = d.events[len(d.events)-dashboardMaxEvents:]
+	}
+	switch event.Action {
+	case "Connected", "Present", "Blocked", "Problem", "DriverInstalled":
+		d.devices[event.Device.InstanceID] = event
+	case "Disconnected":
+		delete(d.devices, event.Device.InstanceID)
+	}
+	d.mu.Unlock()
+	d.redraw()
+}
+
+// キー入力を読み取り、操作を実行
+// q: 終了（詳細の表示中は詳細を閉じる）、↑↓/k j: デバイスの選択、Enter: 詳細、Esc: 詳細を閉じる
+// s: 表示する重大度の下限を切り替え、b: Blockedだけを表示、c: イベントの一覧を消去
+func (d *Dashboard) readKeys() {
+	buffer := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			return
+		}
+		key := string(buffer[:n])
+		d.mu.Lock()
+		quit := false
+		switch key {
+		case "q", "\x03":
+			if d.detail && key == "q" {
+				d.detail = false
+			} else {
+				quit = true
+			}
+		case "\x1b":
+			d.detail = false
+		case "\r", "\n":
+			d.detail = len(d.devices) > 0
+		case "\x1b[A", "k":
+			if d.selected > 0 {
+				d.selected--
+			}
+		case "\x1b[B", "j":
+			if d.selected < len(d.devices)-1 {
+				d.selected++
+			}
+		case "s":
+			d.minSeverity = (d.minSeverity + 1) % len(severityLevels)
+		case "b":
+			d.blockedOnly = !d.blockedOnly
+		case "c":
+			d.events = nil
+		}
+		d.mu.Unlock()
+		if quit {
+			d.restore()
+			os.Exit(0)
+		}
+		d.redraw()
+	}
+}
+
+// 他の出力（エラーなど）で崩れた画面を定期的に描き直す
+func (d *Dashboard) redrawPeriodically() {
+	for range time.Tick(dashboardRedrawInterval) {
+		d.redraw()
+	}
+}
+
+// 接続中のデバイスを、種類と名前の順に並べて返す
+func (d *Dashboard) sortedDevices() []DeviceEvent {
+	devices := make([]DeviceEvent, 0, len(d.devices))
+	for _, event := range d.devices {
+		devices = append(devices, event)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].DeviceType != devices[j].DeviceType {
+			return devices[i].DeviceType < devices[j].DeviceType
+		}
+		if devices[i].Device.FriendlyName != devices[j].Device.FriendlyName {
+			return devices[i].Device.FriendlyName < devices[j].Device.FriendlyName
+		}
+		return devices[i].Device.InstanceID < devices[j].Device.InstanceID
+	})
+	return devices
+}
+
+// 絞り込みの条件に一致するイベントを返す
+func (d *Dashboard) filteredEvents() []dashboardEvent {
+	var events []dashboardEvent
+	for _, e := range d.events {
+		if severityLevel(e.Event.Severity) < d.minSeverity {
+			continue
+		}
+		if d.blockedOnly && e.Event.Action != "Blocked" {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// コンソールの表示範囲の大きさ（取得できない場合は80x25）
+func consoleSize() (int, int) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(os.Stdout.Fd()), &info); err != nil {
+		return 80, 25
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1
+}
+
+// 画面全体を描き直す
+func (d *Dashboard) redraw() {
+	width, height := consoleSize()
+	// 極端に小さいウィンドウでも描けるようにする
+	width, height = max(width, 40), max(height, 10)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	devices := d.sortedDevices()
+	if d.selected >= len(devices) {
+		d.selected = max(len(devices)-1, 0)
+	}
+	var lines []string
+	lines = append(lines, ansiBold+fmt.Sprintf(tr("usbmon %s - %s - Devices=%d, Events=%d, Severity>=%s"), version, getHostName(), len(devices), len(d.events), severityLevels[d.minSeverity])+ansiReset)
+	if d.detail && len(devices) > 0 {
+		lines = append(lines, d.detailLines(devices[d.selected], height-2)...)
+	} else {
+		// 画面の上側の半分にデバイス、残りにイベントを表示
+		deviceRows := min(len(devices), max((height-6)/2, 1))
+		lines = append(lines, "", ansiBold+tr("CONNECTED DEVICES")+ansiReset)
+		first := max(d.selected-deviceRows+1, 0)
+		for i := first; i < first+deviceRows && i < len(devices); i++ {
+			line := d.deviceLine(devices[i], width)
+			if i == d.selected {
+				line = ansiReverse + line + ansiReset
+			}
+			lines = append(lines, line)
+		}
+		lines = append(lines, "", ansiBold+tr("EVENTS")+filterLabel(d.blockedOnly)+ansiReset)
+		events := d.filteredEvents()
+		eventRows := max(height-len(lines)-1, 0)
+		events = events[max(len(events)-eventRows, 0):]
+		for i := len(events) - 1; i >= 0; i-- {
+			lines = append(lines, eventLine(events[i], width))
+		}
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines[:height-1], tr("q: quit  ↑↓: select  Enter: details  Esc: close  s: severity  b: blocked only  c: clear"))
+
+	var b strings.Builder
+	b.WriteString(ansiClearScreen)
+	b.WriteString(strings.Join(lines, "\r\n"))
+	fmt.Print(b.String())
+}
+
+// Blockedだけを表示している場合の見出しの補足
+func filterLabel(blockedOnly bool) string {
+	if blockedOnly {
+		return " (" + tr("Blocked") + ")"
+	}
+	return ""
+}
+
+// 接続中のデバイスの一覧の1行
+func (d *Dashboard) deviceLine(event DeviceEvent, width int) string {
+	vid, pid := parseVIDPID(event.Device.InstanceID)
+	line := fmt.Sprintf("%-*s  %-*s  %-9s  %s",
+		tableTypeWidth, truncate(event.DeviceType, tableTypeWidth),
+		tableNameWidth, truncate(event.Device.FriendlyName, tableNameWidth),
+		vid+":"+pid,
+		event.Device.SerialNumber)
+	if event.Action != "Connected" && event.Action != "Present" {
+		line += "  [" + tr(event.Action) + "]"
+	}
+	return truncate(line, width)
+}
+
+// イベントの一覧の1行
+func eventLine(e dashboardEvent, width int) string {
+	line := fmt.Sprintf("%s  %-*s  %-*s  %-*s  %s",
+		e.Time.Format("15:04:05"),
+		tableActionWidth, truncate(tr(e.Event.Action), tableActionWidth),
+		tableSeverityWidth, truncate(e.Event.Severity, tableSeverityWidth),
+		tableNameWidth, truncate(e.Event.Device.FriendlyName, tableNameWidth),
+		e.Event.Explanation)
+	// 色のエスケープシーケンスを含めずに切り詰めてから色を付ける
+	return colorizeAction(e.Event.Action, truncate(line, width))
+}
+
+// 選択したデバイスの詳細（デバイスの情報のJSON）
+func (d *Dashboard) detailLines(event DeviceEvent, rows int) []string {
+	data, err := json.MarshalIndent(event.Device, "", "  ")
+	if err != nil {
+		return []string{err.Error()}
+	}
+	lines := append([]string{"", ansiBold + tr("DEVICE DETAILS") + ansiReset}, strings.Split(string(data), "\n")...)
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+	return lines
+}
@@ -0,0 +1,332 @@
+package monitor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// 更新の確認・ダウンロードのタイムアウト
+	updateFetchTimeout = 5 * time.Minute
+	// 更新情報の応答の最大サイズ
+	maxUpdateManifestSize = 64 << 10
+	// ダウンロードする実行ファイルの最大サイズ
+	maxUpdateBinarySize = 128 << 20
+	// 更新前の実行ファイルの拡張子（実行中のファイルは削除できないため、名前を変えて残す）
+	updateOldSuffix = ".old"
+	// 更新後に再起動するサービスの名前の既定値
+	defaultUpdateService = "usbmon"
+	// 更新のチャンネルの既定値
+	defaultUpdateChannel = "stable"
+)
+
+// 再起動するサービスの名前として使用できる文字（コマンドラインに渡すため、区切り文字などを含む名前は使用しない）
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// 更新の配布サーバーが返す更新情報
+// signatureは、"バージョン\nチャンネル\n有効期限\nSHA-256"（例: "1.2.3\nstable\n2026-11-01T00:00:00Z\n3a7b..."）に対する
+// Ed25519署名をBase64で表したもの（有効期限はUTCのRFC 3339）
+type UpdateManifest struct {
+	Version string `json:"version"`
+	// 更新のチャンネル（例: stable、beta）
+	Channel string `json:"channel"`
+	// 更新情報の有効期限（古い更新情報の再送を拒否するため）
+	Expires   time.Time `json:"expires"`
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	Signature string    `json:"signature"`
+}
+
+// 署名の対象のバイト列
+func (m UpdateManifest) signedPayload() []byte {
+	return []byte(m.Version + "\n" + m.Channel + "\n" + m.Expires.UTC().Format(time.RFC3339) + "\n" + m.SHA256)
+}
+
+// 自動更新の設定
+type UpdateConfig struct {
+	// 更新情報のURL（https）
+	URL string `json:"url"`
+	// 更新情報の署名を検証するEd25519公開鍵（Base64）
+	PublicKey string `json:"public_key"`
+	// 自動的に更新を確認する間隔（例: "24h"、0で自動更新しない）
+	Interval Duration `json:"interval"`
+	// 更新後に再起動するサービスの名前（空の場合はusbmon）
+	Service string `json:"service"`
+	// 適用する更新のチャンネル（空の場合はstable）
+	Channel string `json:"channel"`
+}
+
+// 適用する更新のチャンネル
+func (c UpdateConfig) channel() string {
+	if c.Channel == "" {
+		return defaultUpdateChannel
+	}
+	return c.Channel
+}
+
+// 更新情報を取得し、署名を検証
+func fetchUpdateManifest(client *http.Client, cfg UpdateConfig) (UpdateManifest, error) {
+	var manifest UpdateManifest
+	publicKey, err := parsePublicKey(cfg.PublicKey)
+	if err != nil {
+		return manifest, fmt.Errorf("Failed to check for updates: %w", err)
+	}
+	body, err := downloadHTTPS(client, cfg.URL, maxUpdateManifestSize)
+	if err != nil {
+		return manifest, fmt.Errorf("Failed to check for updates: %w", err)
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return manifest, fmt.Errorf("Failed to parse update manifest from %s: %w", cfg.URL, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil || !ed25519.Verify(publicKey, manifest.signedPayload(), signature) {
+		return manifest, fmt.Errorf("Failed to verify update signature from %s", cfg.URL)
+	}
+	// 別のチャンネル向けの更新情報や、期限切れの更新情報の再送は適用しない
+	if manifest.Channel != cfg.channel() {
+		return manifest, fmt.Errorf("Failed to verify update manifest from %s: channel %q, want %q", cfg.URL, manifest.Channel, cfg.channel())
+	}
+	if !time.Now().Before(manifest.Expires) {
+		return manifest, fmt.Errorf("Failed to verify update manifest from %s: expired at %s", cfg.URL, manifest.Expires.Format(time.RFC3339))
+	}
+	if _, ok := parseVersion(manifest.Version); !ok {
+		return manifest, fmt.Errorf("Failed to parse update version %q from %s", manifest.Version, cfg.URL)
+	}
+	return manifest, nil
+}
+
+// セマンティックバージョニングのバージョン
+type semanticVersion struct {
+	// メジャー・マイナー・パッチ
+	numbers [3]int
+	// プレリリース（例: rc.1、リリースの場合は空）
+	pre string
+}
+
+// バージョン（例: 1.2.3、v1.2.3-rc.1）を数値の部分とプレリリースの部分に分ける
+func parseVersion(v string) (semanticVersion, bool) {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	core, pre, _ := strings.Cut(v, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semanticVersion{}, false
+	}
+	var parsed semanticVersion
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semanticVersion{}, false
+		}
+		parsed.numbers[i] = n
+	}
+	parsed.pre = pre
+	return parsed, true
+}
+
+// aがbより新しいバージョンならtrue
+// 開発版（dev）などの解釈できないバージョンは、どのバージョンよりも古いとみなす
+func newerVersion(a string, b string) bool {
+	va, ok := parseVersion(a)
+	if !ok {
+		return false
+	}
+	vb, ok := parseVersion(b)
+	if !ok {
+		return true
+	}
+	for i := range va.numbers {
+		if va.numbers[i] != vb.numbers[i] {
+			return va.numbers[i] > vb.numbers[i]
+		}
+	}
+	// 同じバージョンでは、プレリリースよりリリースの方が新しい
+	switch {
+	case va.pre == vb.pre:
+		return false
+	case va.pre == "":
+		return true
+	case vb.pre == "":
+		return false
+	}
+	return va.pre > vb.pre
+}
+
+// httpsのURLからデータを取得（maxSizeを超える場合はエラー）
+func downloadHTTPS(client *http.Client, rawURL string, maxSize int64) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return nil, fmt.Errorf("%q is not an https URL", rawURL)
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("GET %s: response exceeds %d bytes", rawURL, maxSize)
+	}
+	return data, nil
+}
+
+// 署名された更新をダウンロードしてハッシュを検証し、実行中の実行ファイルと置き換える
+func applyUpdate(client *http.Client, manifest UpdateManifest) error {
+	binary, err := downloadHTTPS(client, manifest.URL, maxUpdateBinarySize)
+	if err != nil {
+		return fmt.Errorf("Failed to download update: %w", err)
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return fmt.Errorf("Failed to verify update: SHA-256 of %s does not match", manifest.URL)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to apply update: %w", err)
+	}
+	// 実行中のファイルは上書きできないが、名前は変更できる
+	newPath := exe + ".new"
+	if err := os.WriteFile(newPath, binary, 0o755); err != nil {
+		return fmt.Errorf("Failed to apply update: %w", err)
+	}
+	os.Remove(exe + updateOldSuffix)
+	if err := os.Rename(exe, exe+updateOldSuffix); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("Failed to apply update: %w", err)
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		// 元の実行ファイルに戻す
+		os.Rename(exe+updateOldSuffix, exe)
+		return fmt.Errorf("Failed to apply update: %w", err)
+	}
+	return nil
+}
+
+// 前回の更新で残った更新前の実行ファイルを削除
+func removeOldExecutable() {
+	if exe, err := os.Executable(); err == nil {
+		os.Remove(exe + updateOldSuffix)
+	}
+}
+
+// サービスを再起動する（サービス自身から呼び出しても停止後に起動できるよう、独立したプロセスで実行）
+func restartService(name string) error {
+	if name == "" {
+		name = defaultUpdateService
+	}
+	if !serviceNamePattern.MatchString(name) {
+		return fmt.Errorf("Failed to restart service %q: invalid service name", name)
+	}
+	cmd := exec.Command("cmd.exe", "/c", fmt.Sprintf("net stop %s && net start %s", name, name))
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to restart service %s: %w", name, err)
+	}
+	return cmd.Process.Release()
+}
+
+// 更新を確認し、新しいバージョンがあれば適用してサービスを再起動（更新した場合はtrueを返す）
+// 古いバージョンの更新情報の再送でダウングレードされないよう、実行中より新しいバージョンだけを適用
+func checkForUpdate(cfg UpdateConfig, restart bool) (bool, error) {
+	client := &http.Client{Timeout: updateFetchTimeout}
+	manifest, err := fetchUpdateManifest(client, cfg)
+	if err != nil {
+		return false, err
+	}
+	if !newerVersion(manifest.Version, version) {
+		return false, nil
+	}
+	if err := applyUpdate(client, manifest); err != nil {
+		return false, err
+	}
+	fmt.Printf(tr("Updated: Version=%s -> %s\n"), version, manifest.Version)
+	if restart {
+		return true, restartService(cfg.Service)
+	}
+	return true, nil
+}
+
+// 自動更新の間隔が設定されている間、定期的に更新を確認
+func runAutoUpdate(ctx context.Context) {
+	for {
+		cfg := currentConfig().Update
+		interval := time.Duration(cfg.Interval)
+		if interval <= 0 || cfg.URL == "" {
+			// 設定の再読み込みで有効になるまで待つ
+			if !sleepContext(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleepContext(ctx, interval) {
+			return
+		}
+		if _, err := checkForUpdate(cfg, true); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// `usbmon update` サブコマンド
+// 署名された更新をダウンロードして検証し、実行ファイルを置き換えてサービスを再起動
+func runUpdate(args []string) int {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a JSON config file (to find update.url and update.public_key)")
+	check := fs.Bool("check", false, "only check whether an update is available")
+	noRestart := fs.Bool("no-restart", false, "do not restart the service after updating")
+	fs.Parse(args)
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if cfg.Update.URL == "" {
+		fmt.Println("specify update.url in the config")
+		return 2
+	}
+	if *check {
+		manifest, err := fetchUpdateManifest(&http.Client{Timeout: updateFetchTimeout}, cfg.Update)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if !newerVersion(manifest.Version, version) {
+			fmt.Printf("Up to date: %s\n", version)
+			return 0
+		}
+		fmt.Printf("Update available: %s -> %s\n", version, manifest.Version)
+		return 0
+	}
+	updated, err := checkForUpdate(cfg.Update, !*noRestart)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if !updated {
+		fmt.Printf("Up to date: %s\n", version)
+	}
+	return 0
+}
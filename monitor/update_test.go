@@ -0,0 +1,32 @@
+package monitor
+
+import "testing"
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.2.4", "1.2.3", true},
+		{"1.10.0", "1.9.9", true},
+		{"v2.0.0", "1.99.99", true},
+		// 同じバージョンや古いバージョン（更新情報の再送によるダウングレード）は適用しない
+		{"1.2.3", "1.2.3", false},
+		{"1.2.2", "1.2.3", false},
+		{"1.9.9", "1.10.0", false},
+		// プレリリースは同じバージョンのリリースより古い
+		{"1.2.3", "1.2.3-rc.1", true},
+		{"1.2.3-rc.1", "1.2.3", false},
+		{"1.2.3-rc.2", "1.2.3-rc.1", true},
+		{"1.2.3+build.5", "1.2.3", false},
+		// 開発版はどのバージョンよりも古い
+		{"0.0.1", "dev", true},
+		{"dev", "1.2.3", false},
+		{"1.2", "1.0.0", false},
+	}
+	for _, test := range tests {
+		if got := newerVersion(test.a, test.b); got != test.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ウィンドウとメッセージのAPI（user32.dll、-guiのgdi32.dll・comctl32.dllを含む）の型付きのスタブをmkwinsyscallで生成
+// 引数の型と、失敗を示す戻り値・GetLastErrorの取り出しはzsyscall_windows.goの生成コードで確認する
+// 呼び出しは下の型付きの関数を経由し、エラーを呼び出したAPIの名前を含むエラーに変換する
+//go:generate go run golang.org/x/sys/windows/mkwinsyscall -output zsyscall_windows.go user32.go
+
+// 実行中のモジュールのハンドルを取得する関数
+//sys	callGetModuleHandle(moduleName *uint16) (module windows.Handle, err error) = kernel32.GetModuleHandleW
+// ウィンドウクラスを登録する関数
+//sys	callRegisterClassEx(wndClass *Wndclassex) (atom uint16, err error) = user32.RegisterClassExW
+// 新しいウィンドウを作成する関数
+//sys	callCreateWindowEx(exStyle uint32, className *uint16, windowName *uint16, style uint32, x int32, y int32, width int32, height int32, parent windows.HWND, menu uintptr, instance windows.Handle, param uintptr) (hWnd windows.HWND, err error) = user32.CreateWindowExW
+// デフォルトのウィンドウメッセージ処理を提供する関数
+//sys	defWindowProc(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (result uintptr) = user32.DefWindowProcW
+// Windowsメッセージを取得する関数（失敗した場合は-1を返す）
+//sys	callGetMessage(msg *Msg, hWnd windows.HWND, msgFilterMin uint32, msgFilterMax uint32) (ret int32, err error) [failretval==-1] = user32.GetMessageW
+// キーボード入力のメッセージを翻訳（処理）する関数
+//sys	translateMessage(msg *Msg) (translated bool) = user32.TranslateMessage
+// 取得したメッセージを適切なウィンドウプロシージャに送信する関数
+//sys	dispatchMessage(msg *Msg) (result uintptr) = user32.DispatchMessageW
+// デバイスインターフェースの接続・切断通知をウィンドウで受け取るための関数
+//sys	callRegisterDeviceNotification(recipient windows.HWND, filter *DevBroadcastDeviceInterface, flags uint32) (hNotify windows.Handle, err error) = user32.RegisterDeviceNotificationW
+// RegisterDeviceNotificationWで登録した通知を解除する関数
+//sys	callUnregisterDeviceNotification(hNotify windows.Handle) (err error) = user32.UnregisterDeviceNotification
+// 一定間隔でWM_TIMERメッセージを送信するタイマーを作成する関数
+//sys	callSetTimer(hWnd windows.HWND, id uintptr, elapse uint32, timerFunc uintptr) (timer uintptr, err error) = user32.SetTimer
+// SetTimerで作成したタイマーを破棄する関数
+//sys	callKillTimer(hWnd windows.HWND, id uintptr) (err error) = user32.KillTimer
+// メッセージループを終了させるWM_QUITを送信する関数
+//sys	postQuitMessage(exitCode int32) = user32.PostQuitMessage
+// ウィンドウにメッセージを送り、処理を待たずに戻る関数（別のスレッドから使用できる）
+//sys	callPostMessage(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (err error) = user32.PostMessageW
+// ウィンドウにメッセージを送信し、処理が終わるまで待つ関数
+//sys	sendMessage(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (result uintptr) = user32.SendMessageW
+// ウィンドウを破棄する関数
+//sys	callDestroyWindow(hWnd windows.HWND) (err error) = user32.DestroyWindow
+
+// イベントの一覧のウィンドウ（-gui）で使用するAPI
+// ウィンドウの位置と大きさを変更する関数
+//sys	callMoveWindow(hWnd windows.HWND, x int32, y int32, width int32, height int32, repaint bool) (err error) = user32.MoveWindow
+// ウィンドウの内側の大きさを取得する関数
+//sys	callGetClientRect(hWnd windows.HWND, rect *windows.Rect) (err error) = user32.GetClientRect
+// ウィンドウ・ボタンの文字列を変更する関数
+//sys	callSetWindowText(hWnd windows.HWND, text *uint16) (err error) = user32.SetWindowTextW
+// システムのカーソル（矢印など）を取得する関数
+//sys	callLoadCursor(instance windows.Handle, cursorName uintptr) (cursor windows.Handle, err error) = user32.LoadCursorW
+// 右クリックのメニューを作成・項目を追加・表示・破棄する関数
+//sys	callCreatePopupMenu() (menu windows.Handle, err error) = user32.CreatePopupMenu
+//sys	callAppendMenu(menu windows.Handle, flags uint32, id uintptr, item *uint16) (err error) = user32.AppendMenuW
+//sys	trackPopupMenu(menu windows.Handle, flags uint32, x int32, y int32, reserved int32, hWnd windows.HWND, rect *windows.Rect) (command uintptr) = user32.TrackPopupMenu
+//sys	callDestroyMenu(menu windows.Handle) (err error) = user32.DestroyMenu
+// マウスカーソルの画面上の位置を取得する関数
+//sys	callGetCursorPos(pt *point) (err error) = user32.GetCursorPos
+// メニューの外をクリックした時に閉じるよう、ウィンドウを前面にする関数（前面にできない場合はfalse、GetLastErrorは設定されない）
+//sys	setForegroundWindow(hWnd windows.HWND) (ok bool) = user32.SetForegroundWindow
+// システムのフォントなどを取得する関数（gdi32.dll）
+//sys	callGetStockObject(object int32) (handle windows.Handle, err error) = gdi32.GetStockObject
+// 一覧表示（List View）などのコントロールのウィンドウクラスを登録する関数（comctl32.dll）
+//sys	callInitCommonControlsEx(icc *initCommonControlsEx) (err error) = comctl32.InitCommonControlsEx
+
+// 実行中のプロセス（自分自身のモジュール）のハンドルを取得
+func getModuleHandle() (windows.Handle, error) {
+	hInstance, err := callGetModuleHandle(nil)
+	return hInstance, win32Result("GetModuleHandleW", uintptr(hInstance), err, 0)
+}
+
+// ウィンドウクラスを登録
+func registerClassEx(wndClass *Wndclassex) error {
+	atom, err := callRegisterClassEx(wndClass)
+	return win32Result("RegisterClassExW", uintptr(atom), err, uintptr(unsafe.Pointer(wndClass)))
+}
+
+// 表示しないウィンドウを作成
+func createWindowEx(className *uint16, title *uint16, hInstance windows.Handle) (windows.HWND, error) {
+	hWnd, err := callCreateWindowEx(0, className, title, 0, 0, 0, 0, 0, 0, 0,
+		// 作成するウィンドウを関連付けるプロセス（モジュール）のハンドル
+		hInstance, 0)
+	return hWnd, win32Result("CreateWindowExW", uintptr(hWnd), err, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(title)), uintptr(hInstance))
+}
+
+// メッセージを取得（WM_QUITを受け取った場合と、失敗した場合はfalseを返す）
+func getMessage(msg *Msg) bool {
+	ret, _ := callGetMessage(msg, 0, 0, 0)
+	return ret > 0
+}
+
+// ウィンドウでデバイスインターフェースの接続・切断通知を受け取るよう登録
+func registerDeviceInterfaceNotification(hWnd windows.HWND, filter *DevBroadcastDeviceInterface) (windows.Handle, error) {
+	hNotify, err := callRegisterDeviceNotification(hWnd, filter, DEVICE_NOTIFY_WINDOW_HANDLE)
+	return hNotify, win32Result("RegisterDeviceNotificationW", uintptr(hNotify), err, uintptr(hWnd), uintptr(unsafe.Pointer(filter)), DEVICE_NOTIFY_WINDOW_HANDLE)
+}
+
+// 登録した通知を解除
+func unregisterDeviceNotification(hNotify windows.Handle) error {
+	return win32Result("UnregisterDeviceNotification", 0, callUnregisterDeviceNotification(hNotify), uintptr(hNotify))
+}
+
+// 一定間隔でWM_TIMERを送るタイマーを作成（同じ識別子のタイマーがあれば置き換える）
+func setTimer(hWnd windows.HWND, id uintptr, interval time.Duration) error {
+	timer, err := callSetTimer(hWnd, id, uint32(interval.Milliseconds()), 0)
+	return win32Result("SetTimer", timer, err, uintptr(hWnd), id, uintptr(interval.Milliseconds()))
+}
+
+// タイマーを破棄
+func killTimer(hWnd windows.HWND, id uintptr) {
+	callKillTimer(hWnd, id)
+}
+
+// ウィンドウを破棄（ウィンドウのタイマーも破棄される）
+func destroyWindow(hWnd windows.HWND) error {
+	return win32Result("DestroyWindow", 0, callDestroyWindow(hWnd), uintptr(hWnd))
+}
+
+// ウィンドウにメッセージを送り、処理を待たずに戻る（別のスレッドから使用できる）
+func postMessage(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) error {
+	return win32Result("PostMessageW", 0, callPostMessage(hWnd, msg, wParam, lParam), uintptr(hWnd), uintptr(msg), wParam, lParam)
+}
+
+// ウィンドウの位置と大きさを変更
+func moveWindow(hWnd windows.HWND, x, y, width, height int32, repaint bool) error {
+	return win32Result("MoveWindow", 0, callMoveWindow(hWnd, x, y, width, height, repaint), uintptr(hWnd), uintptr(x), uintptr(y), uintptr(width), uintptr(height))
+}
+
+// ウィンドウの内側の大きさを取得
+func getClientRect(hWnd windows.HWND) (windows.Rect, error) {
+	var rect windows.Rect
+	err := callGetClientRect(hWnd, &rect)
+	return rect, win32Result("GetClientRect", 0, err, uintptr(hWnd))
+}
+
+// ウィンドウ・ボタンの文字列を変更
+func setWindowText(hWnd windows.HWND, text string) error {
+	title, err := windows.UTF16PtrFromString(text)
+	if err != nil {
+		return err
+	}
+	return win32Result("SetWindowTextW", 0, callSetWindowText(hWnd, title), uintptr(hWnd), uintptr(unsafe.Pointer(title)))
+}
+
+// システムのカーソル（IDC_*）を取得
+func loadCursor(id uintptr) (windows.Handle, error) {
+	cursor, err := callLoadCursor(0, id)
+	return cursor, win32Result("LoadCursorW", uintptr(cursor), err, 0, id)
+}
+
+// 空の右クリックのメニューを作成
+func createPopupMenu() (windows.Handle, error) {
+	menu, err := callCreatePopupMenu()
+	return menu, win32Result("CreatePopupMenu", uintptr(menu), err)
+}
+
+// メニューに項目を追加
+func appendMenu(menu windows.Handle, flags uint32, id uintptr, text string) error {
+	item, err := windows.UTF16PtrFromString(text)
+	if err != nil {
+		return err
+	}
+	return win32Result("AppendMenuW", 0, callAppendMenu(menu, flags, id, item), uintptr(menu), uintptr(flags), id, uintptr(unsafe.Pointer(item)))
+}
+
+// メニューを破棄
+func destroyMenu(menu windows.Handle) error {
+	return win32Result("DestroyMenu", 0, callDestroyMenu(menu), uintptr(menu))
+}
+
+// マウスカーソルの画面上の位置を取得
+func getCursorPos() (point, error) {
+	var pt point
+	err := callGetCursorPos(&pt)
+	return pt, win32Result("GetCursorPos", 0, err, uintptr(unsafe.Pointer(&pt)))
+}
+
+// システムのフォントなど（*_FONT）を取得
+func getStockObject(object int32) (windows.Handle, error) {
+	handle, err := callGetStockObject(object)
+	return handle, win32Result("GetStockObject", uintptr(handle), err, uintptr(object))
+}
+
+// コントロール（ICC_*）のウィンドウクラスを登録
+func initCommonControls(classes uint32) error {
+	icc := initCommonControlsEx{ICC: classes}
+	icc.Size = uint32(unsafe.Sizeof(icc))
+	return win32Result("InitCommonControlsEx", 0, callInitCommonControlsEx(&icc), uintptr(classes))
+}
+
+// ウィンドウプロシージャをWindowsから呼び出せる関数ポインタに変換
+func newWindowProc(proc func(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) uintptr) uintptr {
+	return syscall.NewCallback(proc)
+}
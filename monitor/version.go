@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// ビルド時に -ldflags で設定するバージョン情報
+// 例: go build -ldflags "-X github.com/mniyk/usb-device-monitoring/monitor.version=1.2.3 -X github.com/mniyk/usb-device-monitoring/monitor.commit=$(git rev-parse --short HEAD) -X github.com/mniyk/usb-device-monitoring/monitor.buildDate=2024-06-30T12:00:00Z"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// `usbmon version` の出力
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+func currentVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// `usbmon version` サブコマンド
+// バージョン・コミット・ビルド日時を出力
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "output as JSON")
+	fs.Parse(args)
+	info := currentVersionInfo()
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(info); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("usbmon %s (commit %s, built %s, %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion, info.Platform)
+	return 0
+}
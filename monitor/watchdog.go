@@ -0,0 +1,266 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// メッセージループが動いているかを確認する間隔
+	watchdogInterval = 10 * time.Second
+	// この時間メッセージループがタイマーを処理しなければ、停止したと判定
+	watchdogStallTimeout = 30 * time.Second
+	// メッセージループに終了を依頼してから、ウィンドウを破棄するまで待つ時間
+	loopStopTimeout = 10 * time.Second
+	// この時間出力先への送信が終わらなければ、送信が止まったと判定（Webhookのタイムアウトより十分に長くする）
+	sinkStallTimeout = 60 * time.Second
+)
+
+// メッセージループと通知の登録を監視し、問題があれば自動的に復旧する
+type Watchdog struct {
+	// メッセージループが最後にタイマーを処理した時刻（UnixNano）
+	heartbeat atomic.Int64
+	// 監視のメッセージループを管理しているか（falseの場合はストレステストなどで、すべてのウィンドウのメッセージを処理する）
+	enabled atomic.Bool
+	// 現在メッセージを処理しているウィンドウ（メッセージループを作り直している間と終了後は0）
+	window atomic.Uintptr
+
+	mu sync.Mutex
+	// 現在のメッセージループ（監視を終了した場合はnil）
+	loop *messageLoop
+	// 作り直すメッセージループでもイベントの一覧のウィンドウを表示するか
+	showWindow bool
+	// 現在のメッセージループが終了したか、作り直せなかったことを通知（ウォッチドッグが止めた古いメッセージループは通知しない）
+	exited chan error
+
+	sendsMu sync.Mutex
+	// 送信中のイベント（出力先への送信のゴルーチンはメッセージループのハートビートでは監視できないため、個別に開始時刻を記録する）
+	sends    map[uint64]*sinkDelivery
+	nextSend uint64
+	// 送信が止まったと出力した出力先
+	stalledSinks map[string]bool
+}
+
+// 出力先へ送信中のイベント
+type sinkDelivery struct {
+	sink    string
+	started time.Time
+	// 送信が止まったと出力したか
+	reported bool
+}
+
+// メッセージループとウォッチドッグのゴルーチンで共有するウォッチドッグ
+var watchdog = &Watchdog{exited: make(chan error, 1)}
+
+// メッセージループの監視を開始
+func (w *Watchdog) start(loop *messageLoop, showWindow bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// 前回の監視で残った終了の通知を捨てる
+	select {
+	case <-w.exited:
+	default:
+	}
+	w.loop = loop
+	w.showWindow = showWindow
+	w.window.Store(uintptr(loop.hWnd))
+	w.enabled.Store(true)
+	w.beat()
+}
+
+// 監視を終了し、動作中のメッセージループを返す（以降はメッセージループを作り直さない）
+func (w *Watchdog) stop() *messageLoop {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	loop := w.loop
+	w.loop = nil
+	w.window.Store(0)
+	return loop
+}
+
+// メッセージループが終了したことを記録
+// 現在のメッセージループが自分で終了した場合（イベントの一覧のウィンドウを閉じたなど）は監視の終了を通知する
+func (w *Watchdog) loopExited(loop *messageLoop) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.loop != loop {
+		return
+	}
+	w.loop = nil
+	w.window.Store(0)
+	w.notifyExited(nil)
+}
+
+func (w *Watchdog) notifyExited(err error) {
+	select {
+	case w.exited <- err:
+	default:
+	}
+}
+
+// メッセージループが動いていることを記録
+func (w *Watchdog) beat() {
+	w.heartbeat.Store(time.Now().UnixNano())
+}
+
+// 出力先への送信の開始を記録し、送信の番号を返す
+func (w *Watchdog) beginSend(sink string) uint64 {
+	w.sendsMu.Lock()
+	defer w.sendsMu.Unlock()
+	if w.sends == nil {
+		w.sends = map[uint64]*sinkDelivery{}
+	}
+	w.nextSend++
+	w.sends[w.nextSend] = &sinkDelivery{sink: sink, started: time.Now()}
+	return w.nextSend
+}
+
+// 出力先への送信の終了を記録（止まったと出力した送信が終わった場合は、復旧を出力する）
+func (w *Watchdog) endSend(id uint64) {
+	w.sendsMu.Lock()
+	delivery := w.sends[id]
+	delete(w.sends, id)
+	recovered := delivery != nil && delivery.reported && w.stalledSinks[delivery.sink]
+	if recovered {
+		delete(w.stalledSinks, delivery.sink)
+	}
+	w.sendsMu.Unlock()
+	if recovered {
+		logWatchdog("sink "+delivery.sink, "Recovered", fmt.Sprintf("event delivery finished after %s", time.Since(delivery.started).Round(time.Second)))
+	}
+}
+
+// 送信がsinkStallTimeout以上終わっていない出力先を検出して出力
+// 送信のゴルーチンは止められないため、検出だけ行う（出力先ごとに、復旧するまで1回だけ出力する）
+func (w *Watchdog) checkSinks(now time.Time) {
+	stalled := map[string]time.Duration{}
+	w.sendsMu.Lock()
+	for _, delivery := range w.sends {
+		elapsed := now.Sub(delivery.started)
+		if elapsed < sinkStallTimeout || w.stalledSinks[delivery.sink] {
+			continue
+		}
+		delivery.reported = true
+		if elapsed > stalled[delivery.sink] {
+			stalled[delivery.sink] = elapsed
+		}
+	}
+	if len(stalled) > 0 && w.stalledSinks == nil {
+		w.stalledSinks = map[string]bool{}
+	}
+	for sink := range stalled {
+		w.stalledSinks[sink] = true
+	}
+	w.sendsMu.Unlock()
+	// 止まった出力先に送るイベントも非同期に送信するため、ウォッチドッグは止まらない
+	for sink, elapsed := range stalled {
+		logWatchdog("sink "+sink, "Stalled", fmt.Sprintf("event delivery blocked for %s", elapsed.Round(time.Second)))
+	}
+}
+
+// メッセージを処理すべきウィンドウかを判定
+func (w *Watchdog) isActive(hWnd windows.HWND) bool {
+	return !w.enabled.Load() || windows.HWND(w.window.Load()) == hWnd
+}
+
+// 現在メッセージを処理しているウィンドウ
+func (w *Watchdog) activeWindow() windows.HWND {
+	return windows.HWND(w.window.Load())
+}
+
+// メッセージループの停止を定期的に確認し、停止していれば新しいウィンドウとメッセージループを起動
+// 停止したメッセージループは処理中の呼び出しから戻れないため、同じスレッドでは復旧できない
+func (w *Watchdog) run(ctx context.Context) {
+	for sleepContext(ctx, watchdogInterval) {
+		w.mu.Lock()
+		running := w.loop != nil
+		w.mu.Unlock()
+		// 監視を終了した
+		if !running {
+			return
+		}
+		w.checkSinks(time.Now())
+		stalled := time.Since(time.Unix(0, w.heartbeat.Load()))
+		if stalled < watchdogStallTimeout {
+			continue
+		}
+		logWatchdog("message loop", "Stalled", fmt.Sprintf("no timer processed for %s", stalled.Round(time.Second)))
+		w.restartMessageLoop()
+		// 新しいメッセージループが動き出すまで、次の確認では停止と判定しない
+		w.beat()
+	}
+}
+
+// 停止した古いメッセージループを止めてから、新しいスレッドでウィンドウとメッセージループを作り直す
+// 古いメッセージループは停止から戻った時点で自分のウィンドウを破棄して終了し、それまでのメッセージは処理しない
+func (w *Watchdog) restartMessageLoop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.loop
+	// 監視を終了した
+	if old == nil {
+		return
+	}
+	// 以降は古いウィンドウのメッセージを処理しない
+	w.window.Store(0)
+	// 古いウィンドウの通知を解除（停止したままのスレッドでは解除されないため、ここで解除する）
+	for _, err := range unregisterNotifications() {
+		fmt.Println(err)
+	}
+	// 停止したままの場合は待っても終了しないため、少しだけ待って作り直す
+	old.stop(loopStopTimeout)
+	// 古いウィンドウに結び付いた状態を初期化（接続中のデバイスの一覧などは引き継ぎ、停止中に取りこぼした変化は作り直したメッセージループが補正する）
+	resetLoopState()
+
+	loop, errs := startMessageLoop(w.showWindow)
+	if loop == nil {
+		w.loop = nil
+		err := errors.Join(errs...)
+		logWatchdog("message loop", "RecoveryFailed", err.Error())
+		w.notifyExited(fmt.Errorf("Failed to restart message loop: %w", err))
+		return
+	}
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	// 以降の通知は新しいウィンドウで処理する
+	w.loop = loop
+	w.window.Store(uintptr(loop.hWnd))
+	// 停止していた間に取りこぼした接続・切断を補正
+	postMessage(loop.hWnd, WM_APP_RECONCILE, 0, 0)
+	logWatchdog("message loop", "Recovered", "notification window and message loop restarted")
+}
+
+// 再列挙で取りこぼした通知が見つかった場合に、通知を登録し直す
+func (w *Watchdog) recoverNotifications(hWnd windows.HWND, missed int) {
+	logWatchdog("notifications", "Missed", fmt.Sprintf("%d changes were not notified", missed))
+	if err := reregisterNotifications(hWnd); err != nil {
+		logWatchdog("notifications", "RecoveryFailed", err.Error())
+		return
+	}
+	logWatchdog("notifications", "Recovered", "device notifications re-registered")
+}
+
+// ウォッチドッグの検出と復旧をWatchdogイベントとして出力
+// 停止・取りこぼし（出力先への送信の停止を含む）は重大度warning、復旧の失敗はcritical、復旧はnoticeとし、監査ログ・署名・出力先の振り分けの対象にする
+func logWatchdog(subsystem string, state string, detail string) {
+	severity := severityWarning
+	switch state {
+	case "RecoveryFailed":
+		severity = severityCritical
+	case "Recovered":
+		severity = severityNotice
+	}
+	logDeviceEvent(DeviceEvent{
+		Action:      "Watchdog",
+		HostName:    getHostName(),
+		Severity:    severity,
+		Explanation: fmt.Sprintf("%s %s: %s", subsystem, state, detail),
+	})
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogCheckSinks(t *testing.T) {
+	useConfig(t, Config{})
+	sink := useRecordingSink(t)
+	w := &Watchdog{exited: make(chan error, 1)}
+
+	id := w.beginSend("webhook")
+	w.beginSend("webhook")
+	now := time.Now()
+	// タイムアウトまでは止まったと判定しない
+	w.checkSinks(now.Add(sinkStallTimeout / 2))
+	// 同じ出力先は、復旧するまで1回だけ出力する
+	w.checkSinks(now.Add(sinkStallTimeout + time.Second))
+	w.checkSinks(now.Add(2 * sinkStallTimeout))
+	// 出力先への送信は非同期のため、停止の出力を待ってから復旧させる
+	sinkSends.Wait()
+	w.endSend(id)
+	sinkSends.Wait()
+
+	var got []string
+	for {
+		event, ok := sink.next(0)
+		if !ok {
+			break
+		}
+		if event.Action == "Watchdog" {
+			got = append(got, event.Explanation)
+		}
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "sink webhook Stalled") || !strings.HasPrefix(got[1], "sink webhook Recovered") {
+		t.Errorf("events = %q, want Stalled then Recovered", got)
+	}
+}
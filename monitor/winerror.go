@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Win32 APIの呼び出しに失敗したことを示すエラー（GetLastErrorのエラーコードを保持）
+type Win32Error struct {
+	// 呼び出したAPIの名前（例: RegisterClassExW）
+	Func string
+	// GetLastErrorのエラーコード
+	Code syscall.Errno
+}
+
+func (e *Win32Error) Error() string {
+	return fmt.Sprintf("%s failed: %s (error %d)", e.Func, e.Code.Error(), uint32(e.Code))
+}
+
+func (e *Win32Error) Unwrap() error {
+	return e.Code
+}
+
+// CfgMgr32のAPIの呼び出しに失敗したことを示すエラー（CONFIGRETの値を保持）
+type ConfigRetError struct {
+	// 呼び出したAPIの名前（例: CM_Locate_DevNodeW）
+	Func string
+	// CONFIGRETの値
+	Code uintptr
+}
+
+func (e *ConfigRetError) Error() string {
+	return fmt.Sprintf("%s failed: CONFIGRET 0x%X", e.Func, e.Code)
+}
+
+// golang.org/x/sys/windowsの関数が返したエラーコードを、呼び出したAPIの名前を含むエラーに変換
+func setupAPIError(name string, err error) error {
+	if errno, ok := err.(syscall.Errno); ok {
+		return &Win32Error{Func: name, Code: errno}
+	}
+	return err
+}
+
+// 失敗すると0を返すAPI（BOOL、HANDLE、ATOMなど）を呼び出し、失敗した場合はエラーコードを返す
+func callWin32(proc *syscall.LazyProc, args ...uintptr) (uintptr, error) {
+	ret, _, errno := proc.Call(args...)
+	if ret != 0 {
+		traceCall(proc.Name, args, ret, nil)
+		return ret, nil
+	}
+	err := &Win32Error{Func: proc.Name, Code: lastError(errno)}
+	traceCall(proc.Name, args, ret, err)
+	return ret, err
+}
+
+// mkwinsyscallで生成した型付きのスタブの結果をトレースし、エラーを呼び出したAPIの名前を含むエラーに変換
+// retはトレースに出力する戻り値、argsはトレースに出力する引数
+func win32Result(name string, ret uintptr, err error, args ...uintptr) error {
+	err = setupAPIError(name, err)
+	traceCall(name, args, ret, err)
+	return err
+}
+
+// CONFIGRETを返すCfgMgr32のAPIを呼び出し、CR_SUCCESS以外の場合はエラーを返す
+func callCfgMgr(proc *syscall.LazyProc, args ...uintptr) error {
+	ret, _, _ := proc.Call(args...)
+	if ret != CR_SUCCESS {
+		err := &ConfigRetError{Func: proc.Name, Code: ret}
+		traceCall(proc.Name, args, ret, err)
+		return err
+	}
+	traceCall(proc.Name, args, ret, nil)
+	return nil
+}
+
+// 失敗時のエラーコードを取り出す（呼び出しが成功した場合のerrnoは無視する）
+func lastError(err error) syscall.Errno {
+	code, _ := err.(syscall.Errno)
+	return code
+}
@@ -0,0 +1,287 @@
+// Code generated by 'go generate'; DO NOT EDIT.
+
+package monitor
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var _ unsafe.Pointer
+
+// Do the interface allocations only once for common
+// Errno values.
+const (
+	errnoERROR_IO_PENDING = 997
+)
+
+var (
+	errERROR_IO_PENDING error = syscall.Errno(errnoERROR_IO_PENDING)
+	errERROR_EINVAL     error = syscall.EINVAL
+)
+
+// errnoErr returns common boxed Errno values, to prevent
+// allocations at runtime.
+func errnoErr(e syscall.Errno) error {
+	switch e {
+	case 0:
+		return errERROR_EINVAL
+	case errnoERROR_IO_PENDING:
+		return errERROR_IO_PENDING
+	}
+	// TODO: add more here, after collecting data on the common
+	// error values see on Windows. (perhaps when running
+	// all.bat?)
+	return e
+}
+
+var (
+	modcomctl32 = windows.NewLazySystemDLL("comctl32.dll")
+	modgdi32    = windows.NewLazySystemDLL("gdi32.dll")
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	moduser32   = windows.NewLazySystemDLL("user32.dll")
+
+	procInitCommonControlsEx         = modcomctl32.NewProc("InitCommonControlsEx")
+	procGetStockObject               = modgdi32.NewProc("GetStockObject")
+	procGetModuleHandleW             = modkernel32.NewProc("GetModuleHandleW")
+	procAppendMenuW                  = moduser32.NewProc("AppendMenuW")
+	procCreatePopupMenu              = moduser32.NewProc("CreatePopupMenu")
+	procCreateWindowExW              = moduser32.NewProc("CreateWindowExW")
+	procDefWindowProcW               = moduser32.NewProc("DefWindowProcW")
+	procDestroyMenu                  = moduser32.NewProc("DestroyMenu")
+	procDestroyWindow                = moduser32.NewProc("DestroyWindow")
+	procDispatchMessageW             = moduser32.NewProc("DispatchMessageW")
+	procGetClientRect                = moduser32.NewProc("GetClientRect")
+	procGetCursorPos                 = moduser32.NewProc("GetCursorPos")
+	procGetMessageW                  = moduser32.NewProc("GetMessageW")
+	procKillTimer                    = moduser32.NewProc("KillTimer")
+	procLoadCursorW                  = moduser32.NewProc("LoadCursorW")
+	procMoveWindow                   = moduser32.NewProc("MoveWindow")
+	procPostMessageW                 = moduser32.NewProc("PostMessageW")
+	procPostQuitMessage              = moduser32.NewProc("PostQuitMessage")
+	procRegisterClassExW             = moduser32.NewProc("RegisterClassExW")
+	procRegisterDeviceNotificationW  = moduser32.NewProc("RegisterDeviceNotificationW")
+	procSendMessageW                 = moduser32.NewProc("SendMessageW")
+	procSetForegroundWindow          = moduser32.NewProc("SetForegroundWindow")
+	procSetTimer                     = moduser32.NewProc("SetTimer")
+	procSetWindowTextW               = moduser32.NewProc("SetWindowTextW")
+	procTrackPopupMenu               = moduser32.NewProc("TrackPopupMenu")
+	procTranslateMessage             = moduser32.NewProc("TranslateMessage")
+	procUnregisterDeviceNotification = moduser32.NewProc("UnregisterDeviceNotification")
+)
+
+func callInitCommonControlsEx(icc *initCommonControlsEx) (err error) {
+	r1, _, e1 := syscall.Syscall(procInitCommonControlsEx.Addr(), 1, uintptr(unsafe.Pointer(icc)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callGetStockObject(object int32) (handle windows.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procGetStockObject.Addr(), 1, uintptr(object), 0, 0)
+	handle = windows.Handle(r0)
+	if handle == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callGetModuleHandle(moduleName *uint16) (module windows.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procGetModuleHandleW.Addr(), 1, uintptr(unsafe.Pointer(moduleName)), 0, 0)
+	module = windows.Handle(r0)
+	if module == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callAppendMenu(menu windows.Handle, flags uint32, id uintptr, item *uint16) (err error) {
+	r1, _, e1 := syscall.Syscall6(procAppendMenuW.Addr(), 4, uintptr(menu), uintptr(flags), uintptr(id), uintptr(unsafe.Pointer(item)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callCreatePopupMenu() (menu windows.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procCreatePopupMenu.Addr(), 0, 0, 0, 0)
+	menu = windows.Handle(r0)
+	if menu == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callCreateWindowEx(exStyle uint32, className *uint16, windowName *uint16, style uint32, x int32, y int32, width int32, height int32, parent windows.HWND, menu uintptr, instance windows.Handle, param uintptr) (hWnd windows.HWND, err error) {
+	r0, _, e1 := syscall.Syscall12(procCreateWindowExW.Addr(), 12, uintptr(exStyle), uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(windowName)), uintptr(style), uintptr(x), uintptr(y), uintptr(width), uintptr(height), uintptr(parent), uintptr(menu), uintptr(instance), uintptr(param))
+	hWnd = windows.HWND(r0)
+	if hWnd == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func defWindowProc(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (result uintptr) {
+	r0, _, _ := syscall.Syscall6(procDefWindowProcW.Addr(), 4, uintptr(hWnd), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	result = uintptr(r0)
+	return
+}
+
+func callDestroyMenu(menu windows.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procDestroyMenu.Addr(), 1, uintptr(menu), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callDestroyWindow(hWnd windows.HWND) (err error) {
+	r1, _, e1 := syscall.Syscall(procDestroyWindow.Addr(), 1, uintptr(hWnd), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func dispatchMessage(msg *Msg) (result uintptr) {
+	r0, _, _ := syscall.Syscall(procDispatchMessageW.Addr(), 1, uintptr(unsafe.Pointer(msg)), 0, 0)
+	result = uintptr(r0)
+	return
+}
+
+func callGetClientRect(hWnd windows.HWND, rect *windows.Rect) (err error) {
+	r1, _, e1 := syscall.Syscall(procGetClientRect.Addr(), 2, uintptr(hWnd), uintptr(unsafe.Pointer(rect)), 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callGetCursorPos(pt *point) (err error) {
+	r1, _, e1 := syscall.Syscall(procGetCursorPos.Addr(), 1, uintptr(unsafe.Pointer(pt)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callGetMessage(msg *Msg, hWnd windows.HWND, msgFilterMin uint32, msgFilterMax uint32) (ret int32, err error) {
+	r0, _, e1 := syscall.Syscall6(procGetMessageW.Addr(), 4, uintptr(unsafe.Pointer(msg)), uintptr(hWnd), uintptr(msgFilterMin), uintptr(msgFilterMax), 0, 0)
+	ret = int32(r0)
+	if ret == -1 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callKillTimer(hWnd windows.HWND, id uintptr) (err error) {
+	r1, _, e1 := syscall.Syscall(procKillTimer.Addr(), 2, uintptr(hWnd), uintptr(id), 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callLoadCursor(instance windows.Handle, cursorName uintptr) (cursor windows.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procLoadCursorW.Addr(), 2, uintptr(instance), uintptr(cursorName), 0)
+	cursor = windows.Handle(r0)
+	if cursor == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callMoveWindow(hWnd windows.HWND, x int32, y int32, width int32, height int32, repaint bool) (err error) {
+	var _p0 uint32
+	if repaint {
+		_p0 = 1
+	}
+	r1, _, e1 := syscall.Syscall6(procMoveWindow.Addr(), 6, uintptr(hWnd), uintptr(x), uintptr(y), uintptr(width), uintptr(height), uintptr(_p0))
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callPostMessage(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (err error) {
+	r1, _, e1 := syscall.Syscall6(procPostMessageW.Addr(), 4, uintptr(hWnd), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func postQuitMessage(exitCode int32) {
+	syscall.Syscall(procPostQuitMessage.Addr(), 1, uintptr(exitCode), 0, 0)
+	return
+}
+
+func callRegisterClassEx(wndClass *Wndclassex) (atom uint16, err error) {
+	r0, _, e1 := syscall.Syscall(procRegisterClassExW.Addr(), 1, uintptr(unsafe.Pointer(wndClass)), 0, 0)
+	atom = uint16(r0)
+	if atom == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callRegisterDeviceNotification(recipient windows.HWND, filter *DevBroadcastDeviceInterface, flags uint32) (hNotify windows.Handle, err error) {
+	r0, _, e1 := syscall.Syscall(procRegisterDeviceNotificationW.Addr(), 3, uintptr(recipient), uintptr(unsafe.Pointer(filter)), uintptr(flags))
+	hNotify = windows.Handle(r0)
+	if hNotify == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func sendMessage(hWnd windows.HWND, msg uint32, wParam uintptr, lParam uintptr) (result uintptr) {
+	r0, _, _ := syscall.Syscall6(procSendMessageW.Addr(), 4, uintptr(hWnd), uintptr(msg), uintptr(wParam), uintptr(lParam), 0, 0)
+	result = uintptr(r0)
+	return
+}
+
+func setForegroundWindow(hWnd windows.HWND) (ok bool) {
+	r0, _, _ := syscall.Syscall(procSetForegroundWindow.Addr(), 1, uintptr(hWnd), 0, 0)
+	ok = r0 != 0
+	return
+}
+
+func callSetTimer(hWnd windows.HWND, id uintptr, elapse uint32, timerFunc uintptr) (timer uintptr, err error) {
+	r0, _, e1 := syscall.Syscall6(procSetTimer.Addr(), 4, uintptr(hWnd), uintptr(id), uintptr(elapse), uintptr(timerFunc), 0, 0)
+	timer = uintptr(r0)
+	if timer == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func callSetWindowText(hWnd windows.HWND, text *uint16) (err error) {
+	r1, _, e1 := syscall.Syscall(procSetWindowTextW.Addr(), 2, uintptr(hWnd), uintptr(unsafe.Pointer(text)), 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func trackPopupMenu(menu windows.Handle, flags uint32, x int32, y int32, reserved int32, hWnd windows.HWND, rect *windows.Rect) (command uintptr) {
+	r0, _, _ := syscall.Syscall9(procTrackPopupMenu.Addr(), 7, uintptr(menu), uintptr(flags), uintptr(x), uintptr(y), uintptr(reserved), uintptr(hWnd), uintptr(unsafe.Pointer(rect)), 0, 0)
+	command = uintptr(r0)
+	return
+}
+
+func translateMessage(msg *Msg) (translated bool) {
+	r0, _, _ := syscall.Syscall(procTranslateMessage.Addr(), 1, uintptr(unsafe.Pointer(msg)), 0, 0)
+	translated = r0 != 0
+	return
+}
+
+func callUnregisterDeviceNotification(hNotify windows.Handle) (err error) {
+	r1, _, e1 := syscall.Syscall(procUnregisterDeviceNotification.Addr(), 1, uintptr(hNotify), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}